@@ -0,0 +1,602 @@
+package helpers
+
+// Native validator for desktop files according to the Desktop Entry Specification,
+// https://specifications.freedesktop.org/desktop-entry-spec/latest/
+// and the registered categories of the Desktop Menu Specification,
+// https://specifications.freedesktop.org/menu-spec/latest/apa.html
+// This replaces the desktop-file-validate tool, so that no external tool is needed.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DesktopFileProblem is a problem found in a desktop file by ValidateDesktopEntry
+type DesktopFileProblem struct {
+	Line     int          `json:"line,omitempty"` // 0 if the problem is not tied to a line, e.g., a missing key
+	Group    string       `json:"group,omitempty"`
+	Key      string       `json:"key,omitempty"`
+	Severity LintSeverity `json:"severity"` // LintError or LintWarning
+	Message  string       `json:"message"`
+}
+
+func (p DesktopFileProblem) String() string {
+	where := ""
+	if p.Line > 0 {
+		where = fmt.Sprintf("line %d: ", p.Line)
+	}
+	if p.Key != "" {
+		where += p.Key + ": "
+	}
+	return string(p.Severity) + ": " + where + p.Message
+}
+
+// DesktopFileValidationError is returned by ValidateDesktopFile
+// and contains all problems found, of which at least one is an error
+type DesktopFileValidationError struct {
+	Path     string
+	Problems []DesktopFileProblem
+}
+
+func (e *DesktopFileValidationError) Error() string {
+	var lines []string
+	for _, p := range e.Problems {
+		if p.Severity == LintError {
+			lines = append(lines, e.Path+": "+p.String())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Value types of the keys, see
+// https://specifications.freedesktop.org/desktop-entry-spec/latest/value-types.html
+type desktopValueType int
+
+const (
+	desktopString desktopValueType = iota
+	desktopStrings
+	desktopLocaleString
+	desktopLocaleStrings
+	desktopIconString
+	desktopBoolean
+)
+
+type desktopKey struct {
+	valueType  desktopValueType
+	types      []string // Types of desktop entries this key applies to, nil for all
+	deprecated bool
+}
+
+// desktopKeys are the recognized keys of the [Desktop Entry] group, see
+// https://specifications.freedesktop.org/desktop-entry-spec/latest/recognized-keys.html
+var desktopKeys = map[string]desktopKey{
+	"Type":                 {desktopString, nil, false},
+	"Version":              {desktopString, nil, false},
+	"Name":                 {desktopLocaleString, nil, false},
+	"GenericName":          {desktopLocaleString, nil, false},
+	"NoDisplay":            {desktopBoolean, nil, false},
+	"Comment":              {desktopLocaleString, nil, false},
+	"Icon":                 {desktopIconString, nil, false},
+	"Hidden":               {desktopBoolean, nil, false},
+	"OnlyShowIn":           {desktopStrings, nil, false},
+	"NotShowIn":            {desktopStrings, nil, false},
+	"DBusActivatable":      {desktopBoolean, []string{"Application"}, false},
+	"TryExec":              {desktopString, []string{"Application"}, false},
+	"Exec":                 {desktopString, []string{"Application"}, false},
+	"Path":                 {desktopString, []string{"Application"}, false},
+	"Terminal":             {desktopBoolean, []string{"Application"}, false},
+	"Actions":              {desktopStrings, []string{"Application"}, false},
+	"MimeType":             {desktopStrings, []string{"Application"}, false},
+	"Categories":           {desktopStrings, []string{"Application"}, false},
+	"Implements":           {desktopStrings, nil, false},
+	"Keywords":             {desktopLocaleStrings, []string{"Application"}, false},
+	"StartupNotify":        {desktopBoolean, []string{"Application"}, false},
+	"StartupWMClass":       {desktopString, []string{"Application"}, false},
+	"URL":                  {desktopString, []string{"Link"}, false},
+	"PrefersNonDefaultGPU": {desktopBoolean, []string{"Application"}, false},
+	"SingleMainWindow":     {desktopBoolean, []string{"Application"}, false},
+	// Deprecated keys, https://specifications.freedesktop.org/desktop-entry-spec/latest/apc.html
+	"Encoding":        {desktopString, nil, true},
+	"MiniIcon":        {desktopIconString, nil, true},
+	"TerminalOptions": {desktopString, nil, true},
+	"Protocols":       {desktopStrings, nil, true},
+	"Extensions":      {desktopStrings, nil, true},
+	"BinaryPattern":   {desktopStrings, nil, true},
+	"MapNotify":       {desktopString, nil, true},
+	"SwallowTitle":    {desktopLocaleString, nil, true},
+	"SwallowExec":     {desktopString, nil, true},
+	"SortOrder":       {desktopStrings, nil, true},
+	"FilePattern":     {desktopStrings, nil, true},
+}
+
+// desktopActionKeys are the recognized keys of [Desktop Action ...] groups
+var desktopActionKeys = map[string]desktopKey{
+	"Name": {desktopLocaleString, nil, false},
+	"Icon": {desktopIconString, nil, false},
+	"Exec": {desktopString, nil, false},
+}
+
+// desktopMainCategories are the registered main categories of the Desktop Menu Specification
+var desktopMainCategories = []string{
+	"AudioVideo", "Audio", "Video", "Development", "Education", "Game", "Graphics",
+	"Network", "Office", "Science", "Settings", "System", "Utility",
+}
+
+// desktopAdditionalCategories are the registered additional categories of the Desktop Menu Specification
+var desktopAdditionalCategories = []string{
+	"Building", "Debugger", "IDE", "GUIDesigner", "Profiling", "RevisionControl", "Translation",
+	"Calendar", "ContactManagement", "Database", "Dictionary", "Chart", "Email", "Finance",
+	"FlowChart", "PDA", "ProjectManagement", "Presentation", "Spreadsheet", "WordProcessor",
+	"2DGraphics", "VectorGraphics", "RasterGraphics", "3DGraphics", "Scanning", "OCR",
+	"Photography", "Publishing", "Viewer", "TextTools", "DesktopSettings", "HardwareSettings",
+	"Printing", "PackageManager", "Dialup", "InstantMessaging", "Chat", "IRCClient", "Feed",
+	"FileTransfer", "HamRadio", "News", "P2P", "RemoteAccess", "Telephony", "TelephonyTools",
+	"VideoConference", "WebBrowser", "WebDevelopment", "Midi", "Mixer", "Sequencer", "Tuner",
+	"TV", "AudioVideoEditing", "Player", "Recorder", "DiscBurning", "ActionGame",
+	"AdventureGame", "ArcadeGame", "BoardGame", "BlocksGame", "CardGame", "KidsGame",
+	"LogicGame", "RolePlaying", "Shooter", "Simulation", "SportsGame", "StrategyGame", "Art",
+	"Construction", "Music", "Languages", "ArtificialIntelligence", "Astronomy", "Biology",
+	"Chemistry", "ComputerScience", "DataVisualization", "Economy", "Electricity", "Geography",
+	"Geology", "Geoscience", "History", "Humanities", "ImageProcessing", "Literature", "Maps",
+	"Math", "NumericalAnalysis", "MedicalSoftware", "Physics", "Robotics", "Spirituality",
+	"Sports", "ParallelComputing", "Amusement", "Archiving", "Compression", "Electronics",
+	"Emulator", "Engineering", "FileTools", "FileManager", "TerminalEmulator", "Filesystem",
+	"Monitor", "Security", "Accessibility", "Calculator", "Clock", "TextEditor",
+	"Documentation", "Adult", "Core", "KDE", "GNOME", "XFCE", "DDE", "GTK", "Qt", "Motif",
+	"Java", "ConsoleOnly",
+}
+
+// desktopReservedCategories may only be used together with OnlyShowIn
+var desktopReservedCategories = []string{"Screensaver", "TrayIcon", "Applet", "Shell"}
+
+// desktopEnvironments are the registered values for OnlyShowIn and NotShowIn
+var desktopEnvironments = []string{
+	"GNOME", "GNOME-Classic", "GNOME-Flashback", "KDE", "LXDE", "LXQt", "MATE", "Razor",
+	"ROX", "TDE", "Unity", "XFCE", "EDE", "Cinnamon", "Pantheon", "Budgie", "Enlightenment",
+	"DDE", "Endless", "Old",
+}
+
+var (
+	desktopKeyRegexp    = regexp.MustCompile(`^([A-Za-z0-9-]+)(\[([^\]]+)\])?$`)
+	desktopLocaleRegexp = regexp.MustCompile(`^[a-z]{2,3}(_[A-Z]{2}|_[0-9]{3})?(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+	// Restricted names of RFC 6838, section 4.2
+	mimeTypeRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}/[A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}$`)
+)
+
+type desktopEntry struct {
+	line  int
+	key   string
+	value string
+}
+
+type desktopGroup struct {
+	line    int
+	name    string
+	entries []desktopEntry
+}
+
+func (g *desktopGroup) get(key string) (desktopEntry, bool) {
+	for _, e := range g.entries {
+		if e.key == key {
+			return e, true
+		}
+	}
+	return desktopEntry{}, false
+}
+
+type desktopValidator struct {
+	problems []DesktopFileProblem
+}
+
+func (v *desktopValidator) report(severity LintSeverity, line int, group string, key string, format string, a ...interface{}) {
+	v.problems = append(v.problems, DesktopFileProblem{Line: line, Group: group, Key: key, Severity: severity, Message: fmt.Sprintf(format, a...)})
+}
+
+// ValidateDesktopEntry checks the contents of a desktop file against the Desktop Entry Specification
+// and returns all problems found, in the order of the lines they were found in
+func ValidateDesktopEntry(data []byte) []DesktopFileProblem {
+	v := &desktopValidator{}
+	groups := v.parse(data)
+	if len(groups) == 0 || groups[0].name != "Desktop Entry" {
+		v.report(LintError, 0, "", "", "The first group must be [Desktop Entry]")
+		for _, g := range groups {
+			if g.name == "Desktop Entry" {
+				v.checkDesktopEntry(g, groups)
+			}
+		}
+		return v.problems
+	}
+	v.checkDesktopEntry(groups[0], groups)
+	return v.problems
+}
+
+// parse splits data into groups and reports syntax errors
+func (v *desktopValidator) parse(data []byte) []*desktopGroup {
+	var groups []*desktopGroup
+	var current *desktopGroup
+	seenGroups := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if !utf8.ValidString(line) {
+			v.report(LintError, n, "", "", "Line is not valid UTF-8")
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				v.report(LintError, n, "", "", "Invalid group header %q", line)
+				current = nil
+				continue
+			}
+			name := line[1 : len(line)-1]
+			if name == "" || strings.ContainsAny(name, "[]") || strings.IndexFunc(name, func(r rune) bool { return r < 32 || r == 127 }) >= 0 {
+				v.report(LintError, n, name, "", "Invalid group name %q", name)
+			}
+			if seenGroups[name] {
+				v.report(LintError, n, name, "", "Duplicate group [%s]", name)
+			}
+			seenGroups[name] = true
+			current = &desktopGroup{line: n, name: name}
+			groups = append(groups, current)
+			continue
+		}
+		if current == nil {
+			v.report(LintError, n, "", "", "Key outside of a group: %q", line)
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			v.report(LintError, n, current.name, "", "Line is neither a comment, a group header nor a key=value pair: %q", line)
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !desktopKeyRegexp.MatchString(key) {
+			v.report(LintError, n, current.name, key, "Invalid key name, only A-Za-z0-9- are allowed, followed by an optional [locale]")
+			continue
+		}
+		if _, dup := current.get(key); dup {
+			v.report(LintError, n, current.name, key, "Duplicate key in group [%s]", current.name)
+			continue
+		}
+		current.entries = append(current.entries, desktopEntry{line: n, key: key, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		v.report(LintError, n+1, "", "", "Cannot read: %s", err)
+	}
+	return groups
+}
+
+// checkDesktopEntry checks the [Desktop Entry] group and the groups related to it
+func (v *desktopValidator) checkDesktopEntry(g *desktopGroup, groups []*desktopGroup) {
+	typ, ok := g.get("Type")
+	if !ok {
+		v.report(LintError, 0, g.name, "Type", "Required key is missing")
+	} else if typ.value != "Application" && typ.value != "Link" && typ.value != "Directory" {
+		v.report(LintError, typ.line, g.name, "Type", "Unknown type %q, must be Application, Link or Directory", typ.value)
+	}
+	if _, ok := g.get("Name"); !ok {
+		v.report(LintError, 0, g.name, "Name", "Required key is missing")
+	}
+	if version, ok := g.get("Version"); ok && !SliceContains([]string{"1.0", "1.1", "1.2", "1.3", "1.4", "1.5"}, version.value) {
+		v.report(LintWarning, version.line, g.name, "Version", "Unknown version %q of the Desktop Entry Specification", version.value)
+	}
+
+	v.checkKeys(g, desktopKeys, typ.value)
+
+	switch typ.value {
+	case "Application":
+		dbus, _ := g.get("DBusActivatable")
+		if _, ok := g.get("Exec"); !ok && dbus.value != "true" {
+			v.report(LintError, 0, g.name, "Exec", "Required key is missing for applications that are not DBusActivatable")
+		}
+	case "Link":
+		if _, ok := g.get("URL"); !ok {
+			v.report(LintError, 0, g.name, "URL", "Required key is missing for links")
+		}
+	}
+
+	only, hasOnly := g.get("OnlyShowIn")
+	not, hasNot := g.get("NotShowIn")
+	if hasOnly && hasNot {
+		v.report(LintError, not.line, g.name, "NotShowIn", "OnlyShowIn and NotShowIn must not both be used")
+	}
+	for _, e := range []desktopEntry{only, not} {
+		for _, de := range splitDesktopList(e.value) {
+			if !SliceContains(desktopEnvironments, de) && !strings.HasPrefix(de, "X-") {
+				v.report(LintError, e.line, g.name, e.key, "Unregistered desktop environment %q, use X-%s for unregistered values", de, de)
+			}
+		}
+	}
+
+	if e, ok := g.get("Exec"); ok {
+		v.checkExec(g.name, e)
+	}
+	if e, ok := g.get("Categories"); ok {
+		v.checkCategories(g.name, e, hasOnly)
+	}
+	if e, ok := g.get("MimeType"); ok {
+		for _, m := range splitDesktopList(e.value) {
+			if !mimeTypeRegexp.MatchString(m) {
+				v.report(LintError, e.line, g.name, e.key, "Invalid MIME type %q", m)
+			}
+		}
+	}
+	v.checkActions(g, groups)
+}
+
+// checkKeys checks the names, locales and values of all keys in g
+func (v *desktopValidator) checkKeys(g *desktopGroup, known map[string]desktopKey, typ string) {
+	for _, e := range g.entries {
+		m := desktopKeyRegexp.FindStringSubmatch(e.key)
+		base, locale := m[1], m[3]
+		if strings.HasPrefix(base, "X-") {
+			continue // Extensions may contain anything
+		}
+		k, ok := known[base]
+		if !ok {
+			v.report(LintError, e.line, g.name, e.key, "Unknown key, use X-%s for extensions", base)
+			continue
+		}
+		if k.deprecated {
+			v.report(LintWarning, e.line, g.name, e.key, "Deprecated key")
+		}
+		if k.types != nil && typ != "" && !SliceContains(k.types, typ) {
+			v.report(LintWarning, e.line, g.name, e.key, "Key is not used for Type=%s", typ)
+		}
+		if m[2] != "" {
+			if k.valueType != desktopLocaleString && k.valueType != desktopLocaleStrings && k.valueType != desktopIconString {
+				v.report(LintError, e.line, g.name, e.key, "Key cannot be localized")
+			} else if !desktopLocaleRegexp.MatchString(locale) {
+				v.report(LintError, e.line, g.name, e.key, "Invalid locale %q", locale)
+			}
+		}
+		v.checkValue(g.name, e, k.valueType)
+	}
+}
+
+// checkValue checks e against the value type
+func (v *desktopValidator) checkValue(group string, e desktopEntry, t desktopValueType) {
+	list := t == desktopStrings || t == desktopLocaleStrings
+	for i := 0; i < len(e.value); i++ {
+		c := e.value[i]
+		if c < 32 || c == 127 {
+			v.report(LintError, e.line, group, e.key, "Value contains a control character")
+			return
+		}
+		if c != '\\' {
+			continue
+		}
+		if i+1 == len(e.value) {
+			v.report(LintError, e.line, group, e.key, "Value ends with a lone backslash")
+			return
+		}
+		i++
+		if !strings.ContainsRune(`snrt\`, rune(e.value[i])) && !(list && e.value[i] == ';') {
+			v.report(LintError, e.line, group, e.key, "Invalid escape sequence \\%c", e.value[i])
+		}
+	}
+	switch t {
+	case desktopString, desktopStrings:
+		for _, r := range e.value {
+			if r > 127 {
+				v.report(LintError, e.line, group, e.key, "Value of type string must be ASCII")
+				break
+			}
+		}
+	case desktopBoolean:
+		if e.value != "true" && e.value != "false" {
+			v.report(LintError, e.line, group, e.key, "Value %q is not a boolean, must be true or false", e.value)
+		}
+	}
+	if list && e.value != "" && !strings.HasSuffix(e.value, ";") {
+		v.report(LintWarning, e.line, group, e.key, "List value should end with a semicolon")
+	}
+}
+
+// checkExec checks the quoting and the field codes of Exec, see
+// https://specifications.freedesktop.org/desktop-entry-spec/latest/exec-variables.html
+func (v *desktopValidator) checkExec(group string, e desktopEntry) {
+	// The value is unescaped as a string first, then the quoting rules apply
+	value := unescapeDesktopString(e.value)
+	var args []string
+	var arg strings.Builder
+	inArg, quoted := false, false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quoted && c == '\\':
+			if i+1 == len(value) || !strings.ContainsRune("\"`$\\", rune(value[i+1])) {
+				v.report(LintError, e.line, group, e.key, "Invalid escape inside of quotes, only \\\", \\`, \\$ and \\\\ are allowed")
+				return
+			}
+			i++
+			arg.WriteByte(value[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && c == ' ':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case !quoted && strings.IndexByte("\t\n'\\><~|&;$*?#()`", c) >= 0:
+			v.report(LintError, e.line, group, e.key, "Reserved character %q must be inside of quotes", c)
+			return
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		v.report(LintError, e.line, group, e.key, "Unterminated quote")
+		return
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		v.report(LintError, e.line, group, e.key, "Value is empty")
+		return
+	}
+
+	fileCodes := 0
+	for n, a := range args {
+		for i := 0; i < len(a); i++ {
+			if a[i] != '%' {
+				continue
+			}
+			if i+1 == len(a) {
+				v.report(LintError, e.line, group, e.key, "Incomplete field code at the end of %q", a)
+				break
+			}
+			i++
+			code := a[i]
+			switch code {
+			case '%', 'i', 'c', 'k':
+			case 'f', 'u':
+				fileCodes++
+			case 'F', 'U':
+				fileCodes++
+				if a != "%"+string(code) {
+					v.report(LintError, e.line, group, e.key, "Field code %%%c must be an argument of its own", code)
+				}
+			case 'd', 'D', 'n', 'N', 'v', 'm':
+				v.report(LintWarning, e.line, group, e.key, "Deprecated field code %%%c", code)
+			default:
+				v.report(LintError, e.line, group, e.key, "Invalid field code %%%c", code)
+			}
+			if n == 0 && code != '%' {
+				v.report(LintError, e.line, group, e.key, "The executable must not contain a field code")
+			}
+		}
+	}
+	if fileCodes > 1 {
+		v.report(LintError, e.line, group, e.key, "Only one of %%f, %%F, %%u and %%U may be used")
+	}
+}
+
+// checkCategories checks the categories against the registry of the Desktop Menu Specification
+func (v *desktopValidator) checkCategories(group string, e desktopEntry, hasOnlyShowIn bool) {
+	main := false
+	for _, c := range splitDesktopList(e.value) {
+		switch {
+		case SliceContains(desktopMainCategories, c):
+			main = true
+		case SliceContains(desktopAdditionalCategories, c), strings.HasPrefix(c, "X-"):
+		case SliceContains(desktopReservedCategories, c):
+			if !hasOnlyShowIn {
+				v.report(LintError, e.line, group, e.key, "Reserved category %q requires OnlyShowIn", c)
+			}
+		default:
+			v.report(LintError, e.line, group, e.key, "Unregistered category %q, use X-%s for unregistered values", c, c)
+		}
+	}
+	if !main {
+		v.report(LintWarning, e.line, group, e.key, "No main category, the application may end up in \"Other\" in menus")
+	}
+}
+
+// checkActions checks that the Actions key and the [Desktop Action ...] groups match
+func (v *desktopValidator) checkActions(g *desktopGroup, groups []*desktopGroup) {
+	actionsEntry, _ := g.get("Actions")
+	actions := splitDesktopList(actionsEntry.value)
+	for _, a := range actions {
+		found := false
+		for _, ag := range groups {
+			if ag.name == "Desktop Action "+a {
+				found = true
+			}
+		}
+		if !found {
+			v.report(LintError, actionsEntry.line, g.name, "Actions", "Action %q has no [Desktop Action %s] group", a, a)
+		}
+	}
+	for _, ag := range groups {
+		if ag == g {
+			continue
+		}
+		name := ag.name
+		if strings.HasPrefix(name, "X-") {
+			continue
+		}
+		id, ok := strings.CutPrefix(name, "Desktop Action ")
+		if !ok {
+			v.report(LintError, ag.line, name, "", "Unknown group, use [X-%s] for extensions", name)
+			continue
+		}
+		if !SliceContains(actions, id) {
+			v.report(LintWarning, ag.line, name, "", "Action %q is not listed in the Actions key", id)
+		}
+		if _, ok := ag.get("Name"); !ok {
+			v.report(LintError, ag.line, name, "Name", "Required key is missing")
+		}
+		v.checkKeys(ag, desktopActionKeys, "")
+		if e, ok := ag.get("Exec"); ok {
+			v.checkExec(name, e)
+		}
+	}
+}
+
+// splitDesktopList splits a list value at unescaped semicolons
+func splitDesktopList(value string) []string {
+	var items []string
+	var item strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && value[i+1] == ';' {
+			item.WriteByte(';')
+			i++
+			continue
+		}
+		if value[i] == ';' {
+			if item.Len() > 0 {
+				items = append(items, item.String())
+			}
+			item.Reset()
+			continue
+		}
+		item.WriteByte(value[i])
+	}
+	if item.Len() > 0 {
+		items = append(items, item.String())
+	}
+	return items
+}
+
+func unescapeDesktopString(value string) string {
+	return strings.NewReplacer(`\s`, " ", `\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`).Replace(value)
+}
+
+// ValidateDesktopFile validates a desktop file against the Desktop Entry Specification.
+// Returns a *DesktopFileValidationError if there are errors and prints all problems to stderr
+func ValidateDesktopFile(desktopfile string) error {
+	data, err := os.ReadFile(desktopfile)
+	if err != nil {
+		return err
+	}
+	problems := ValidateDesktopEntry(data)
+	hasErrors := false
+	for _, p := range problems {
+		os.Stderr.WriteString(desktopfile + ": " + p.String() + "\n")
+		if p.Severity == LintError {
+			hasErrors = true
+		}
+	}
+	if hasErrors {
+		os.Stderr.WriteString("ERROR: Desktop file contains errors. Please fix them. Please see https://standards.freedesktop.org/desktop-entry-spec/1.0\n")
+		return &DesktopFileValidationError{Path: desktopfile, Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package helpers_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+func TestValidateDesktopEntry(t *testing.T) {
+	valid := `# A comment
+[Desktop Entry]
+Version=1.5
+Type=Application
+Name=Example
+Name[de]=Beispiel
+Name[sr@latin]=Primer
+Comment=An example; with a semicolon
+Exec=example --flag="some value" %U
+Icon=example
+Categories=Graphics;2DGraphics;X-Custom;
+MimeType=image/png;image/svg+xml;
+Keywords[de]=Bild;Grafik;
+Actions=new-window;
+X-AppImage-Version=1.0
+
+[Desktop Action new-window]
+Name=New Window
+Exec=example --new-window
+`
+	if problems := helpers.ValidateDesktopEntry([]byte(valid)); len(problems) != 0 {
+		t.Fatal("Expected no problems, got", problems)
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"first group", "[Foo]\nName=x\n", "first group must be [Desktop Entry]"},
+		{"missing type", "[Desktop Entry]\nName=x\n", "Type: Required key"},
+		{"missing exec", "[Desktop Entry]\nType=Application\nName=x\n", "Exec: Required key"},
+		{"link without url", "[Desktop Entry]\nType=Link\nName=x\n", "URL: Required key"},
+		{"unknown key", "[Desktop Entry]\nType=Application\nName=x\nExec=x\nFoo=bar\n", "Unknown key"},
+		{"bad boolean", "[Desktop Entry]\nType=Application\nName=x\nExec=x\nTerminal=yes\n", "not a boolean"},
+		{"localized string", "[Desktop Entry]\nType=Application\nName=x\nExec[de]=x\n", "cannot be localized"},
+		{"bad locale", "[Desktop Entry]\nType=Application\nName[german]=x\nName=x\nExec=x\n", "Invalid locale"},
+		{"duplicate key", "[Desktop Entry]\nType=Application\nName=x\nName=y\nExec=x\n", "Duplicate key"},
+		{"bad escape", "[Desktop Entry]\nType=Application\nName=x\\y\nExec=x\n", "Invalid escape"},
+		{"field code", "[Desktop Entry]\nType=Application\nName=x\nExec=x %z\n", "Invalid field code %z"},
+		{"two file codes", "[Desktop Entry]\nType=Application\nName=x\nExec=x %f %U\n", "Only one of"},
+		{"list field code", "[Desktop Entry]\nType=Application\nName=x\nExec=x --files=%F\n", "argument of its own"},
+		{"unterminated quote", "[Desktop Entry]\nType=Application\nName=x\nExec=x \"foo\n", "Unterminated quote"},
+		{"reserved character", "[Desktop Entry]\nType=Application\nName=x\nExec=x > log\n", "Reserved character"},
+		{"category", "[Desktop Entry]\nType=Application\nName=x\nExec=x\nCategories=Utility;Foo;\n", "Unregistered category \"Foo\""},
+		{"mime type", "[Desktop Entry]\nType=Application\nName=x\nExec=x\nMimeType=image;\n", "Invalid MIME type"},
+		{"action group", "[Desktop Entry]\nType=Application\nName=x\nExec=x\nActions=a;b;\n[Desktop Action a]\nName=A\n", "Action \"b\" has no"},
+		{"action name", "[Desktop Entry]\nType=Application\nName=x\nExec=x\nActions=a;\n[Desktop Action a]\nExec=a\n", "Name: Required key"},
+		{"show in", "[Desktop Entry]\nType=Application\nName=x\nExec=x\nOnlyShowIn=KDE;\nNotShowIn=GNOME;\n", "must not both be used"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := helpers.ValidateDesktopEntry([]byte(tt.contents))
+			for _, p := range problems {
+				if p.Severity == helpers.LintError && strings.Contains(p.String(), tt.want) {
+					return
+				}
+			}
+			t.Errorf("Expected an error containing %q, got %v", tt.want, problems)
+		})
+	}
+
+	p := filepath.Join(t.TempDir(), "bad.desktop")
+	if err := os.WriteFile(p, []byte("[Desktop Entry]\nName=x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var verr *helpers.DesktopFileValidationError
+	if err := helpers.ValidateDesktopFile(p); !errors.As(err, &verr) || len(verr.Problems) == 0 {
+		t.Fatal("Expected a DesktopFileValidationError, got", err)
+	}
+}
@@ -35,6 +35,12 @@ func CalculateDigestSkippingRanges(f *os.File, ranges []ByteRange) hash.Hash {
 
 	h := sha256.New()
 
+	// Nothing to skip, e.g., because the runtime has no signature sections
+	if len(ranges) == 0 {
+		hashRange(f, h, 0, fi.Size())
+		return h
+	}
+
 	// Add to the hash the checksum for the area between Offset 0 and the first ByteRange
 	hashRange(f, h, 0, ranges[0].Offset)
 
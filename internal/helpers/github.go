@@ -42,32 +42,73 @@ func GetCommitMessageForLatestCommit(ui UpdateInformation) (string, error) {
 
 	} else {
 
-		return "", errors.New("Not yet implemented for this transport mechanism")
+		// Other transport mechanisms do not know about commits, use the changelog of the release instead
+		rel, err := ui.ResolveLatest()
+		if err != nil {
+			return "", err
+		}
+		return ui.Changelog(rel)
 	}
 }
 
 // GetReleaseURL gets the URL message for the latest release
-// (currently only on GitHub) matching the given UpdateInformation. Returns commit string and err
+// matching the given UpdateInformation. Returns commit string and err
 func GetReleaseURL(ui UpdateInformation) (string, error) {
+	rel, err := ui.ResolveLatest()
+	if err != nil {
+		return "", err
+	}
+	if rel.ReleaseURL == "" {
+		return "", errors.New("GetReleaseURL: Could not get URL")
+	}
+	return rel.ReleaseURL, nil
+}
 
-	if ui.transportmechanism == "gh-releases-zsync" {
-
-		client := github.NewClient(nil)
+// gh-releases-zsync|<username>|<repository>|<tag or latest>|<file name pattern of the .zsync file>
+type gitHubTransport struct{}
 
-		release, _, err := client.Repositories.GetReleaseByTag(context.Background(), ui.username, ui.repository, ui.releasename)
-		if err == nil {
-			// log.Println("github", release.GetHTMLURL())
-			// log.Println("github", release.GetBody())
-			// log.Println("github", release.GetAssetsURL())
-			// log.Println("github", release.GetTagName())         // E.g., "continuous"
-			// log.Println("github", release.GetTargetCommitish()) // E.g., "a4039871c082489b4ac5c3b0ab98d3617c408e53"
+func (gitHubTransport) Validate(fields []string) error {
+	return checkFieldCount(fields, 4, "gh-releases-zsync|<username>|<repository>|<tag or latest>|<file name pattern of the .zsync file>")
+}
 
-			return release.GetHTMLURL(), nil
-		} else {
-			return "", err
-		}
+func (gitHubTransport) ResolveLatest(ui UpdateInformation) (UpdateRelease, error) {
+	client := github.NewClient(nil)
+	var release *github.RepositoryRelease
+	var err error
+	// Please note that pre-releases are not being considered when using "latest"
+	if ui.releasename == "latest" {
+		release, _, err = client.Repositories.GetLatestRelease(context.Background(), ui.username, ui.repository)
+	} else {
+		release, _, err = client.Repositories.GetReleaseByTag(context.Background(), ui.username, ui.repository, ui.releasename)
+	}
+	if err != nil {
+		return UpdateRelease{}, err
+	}
+	rel := UpdateRelease{
+		Name:       release.GetTagName(),
+		ReleaseURL: release.GetHTMLURL(),
+		changelog:  release.GetBody(),
+		assets:     map[string]string{},
 	}
-	return "", errors.New("GetReleaseURL: Could not get URL")
+	var names []string
+	for _, asset := range release.Assets {
+		rel.assets[asset.GetName()] = asset.GetBrowserDownloadURL()
+		names = append(names, asset.GetName())
+	}
+	name, ok := newestMatching(names, ui.filename)
+	if !ok {
+		return rel, errors.New("no asset matching " + ui.filename + " in release " + release.GetTagName() + " of " + ui.username + "/" + ui.repository)
+	}
+	rel.ZsyncURL = rel.assets[name]
+	return rel, nil
+}
+
+func (gitHubTransport) FetchZsync(ui UpdateInformation, rel UpdateRelease) (*ZsyncControl, error) {
+	return fetchReleaseZsync(rel)
+}
+
+func (gitHubTransport) Changelog(ui UpdateInformation, rel UpdateRelease) (string, error) {
+	return releaseChangelog(rel)
 }
 
 // GetCommitMessageForThisCommitOnTravis returns a string with the most
@@ -99,7 +140,3 @@ func GetCommitMessageForThisCommitOnTravis() (string, error) {
 	}
 
 }
-
-// TODO: uploadtool functionality
-// Create continuous release, upload files to it
-// See the existing Go tools for GitHub Releases
@@ -0,0 +1,84 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+)
+
+// gitlab-releases-zsync|<GitLab instance, e.g., gitlab.com>|<project path, e.g., group/project>|<tag or latest>|<file name pattern of the .zsync file>
+// The files are looked up among the links of the release, which usually point to
+// generic packages. For private projects, set $GITLAB_TOKEN to a token with read_api scope
+type gitLabTransport struct{}
+
+type gitLabRelease struct {
+	TagName     string `json:"tag_name"`
+	Description string `json:"description"`
+	Links       struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+	Assets struct {
+		Links []struct {
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+func (gitLabTransport) Validate(fields []string) error {
+	return checkFieldCount(fields, 4, "gitlab-releases-zsync|<GitLab instance>|<project path>|<tag or latest>|<file name pattern of the .zsync file>")
+}
+
+func (gitLabTransport) ResolveLatest(ui UpdateInformation) (UpdateRelease, error) {
+	base := baseURLForHost(ui.fields[0])
+	project, tag, pattern := ui.fields[1], ui.fields[2], ui.fields[3]
+	apiURL := base + "/api/v4/projects/" + url.PathEscape(project) + "/releases/"
+	if tag == "latest" {
+		apiURL += "permalink/latest"
+	} else {
+		apiURL += url.PathEscape(tag)
+	}
+	authorize := authorizeHost(base, "PRIVATE-TOKEN", os.Getenv("GITLAB_TOKEN"))
+	resp, err := httpGet(apiURL, authorize, "application/json")
+	if err != nil {
+		return UpdateRelease{}, err
+	}
+	defer resp.Body.Close()
+	var release gitLabRelease
+	if err = json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return UpdateRelease{}, errors.New("could not parse the release from " + apiURL + ": " + err.Error())
+	}
+
+	rel := UpdateRelease{
+		Name:       release.TagName,
+		ReleaseURL: release.Links.Self,
+		changelog:  release.Description,
+		assets:     map[string]string{},
+		authorize:  authorize,
+	}
+	var names []string
+	for _, link := range release.Assets.Links {
+		u := link.DirectAssetURL
+		if u == "" {
+			u = link.URL
+		}
+		rel.assets[link.Name] = u
+		names = append(names, link.Name)
+	}
+	name, ok := newestMatching(names, pattern)
+	if !ok {
+		return rel, errors.New("no release link matching " + pattern + " in release " + release.TagName + " of " + project)
+	}
+	rel.ZsyncURL = rel.assets[name]
+	return rel, nil
+}
+
+func (gitLabTransport) FetchZsync(ui UpdateInformation, rel UpdateRelease) (*ZsyncControl, error) {
+	return fetchReleaseZsync(rel)
+}
+
+func (gitLabTransport) Changelog(ui UpdateInformation, rel UpdateRelease) (string, error) {
+	return releaseChangelog(rel)
+}
@@ -11,7 +11,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/hashicorp/go-version"
@@ -255,20 +254,6 @@ func GetValuesForAllDesktopFiles(key string) []string {
 	return results
 }
 
-// ValidateDesktopFile validates a desktop file using the desktop-file-validate tool on the $PATH
-// Returns error if validation fails and prints any errors to stderr
-func ValidateDesktopFile(desktopfile string) error {
-	cmd := exec.Command("desktop-file-validate", desktopfile)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		PrintError("desktop-file-validate", err)
-		fmt.Printf("%s", string(out))
-		os.Stderr.WriteString("ERROR: Desktop file contains errors. Please fix them. Please see https://standards.freedesktop.org/desktop-entry-spec/1.0\n")
-		return err
-	}
-	return nil
-}
-
 // ValidateAppStreamMetainfoFile validates an AppStream metainfo file using the appstreamcli tool on the $PATH
 // Returns error if validation fails and prints any errors to stderr
 func ValidateAppStreamMetainfoFile(appdirpath string) error {
@@ -508,32 +493,6 @@ func ReplaceTextInFile(path string, search string, replace string) error {
 	return nil
 }
 
-// FindMostRecentFile returns the most recent file
-// from a slice of files, (currently) based on its mtime
-// based on https://stackoverflow.com/a/45579190
-// TODO: mtime may be fast, but is it "good enough" for our purposes?
-func FindMostRecentFile(files []string) string {
-	var modTime time.Time
-	var names []string
-	for _, f := range files {
-		fi, _ := os.Stat(f)
-		if fi.Mode().IsRegular() {
-			if !fi.ModTime().Before(modTime) {
-				if fi.ModTime().After(modTime) {
-					modTime = fi.ModTime()
-					names = names[:0]
-				}
-				names = append(names, f)
-			}
-		}
-	}
-	if len(names) > 0 {
-		fmt.Println(modTime, names[0]) // Most recent
-		return names[0]                // Most recent
-	}
-	return ""
-}
-
 // Check for needed files on $PATH. Returns err
 func CheckForNeededTools(tools []string) error {
 	for _, t := range tools {
@@ -0,0 +1,581 @@
+package helpers
+
+// Lint checks an AppDir or the contents of an AppImage for common mistakes.
+// It works on an fs.FS so that it can be used on AppDirs (os.DirFS) as well as
+// on the squashfs inside of an AppImage, by appimagetool and by appimaged alike.
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png" // Register the PNG decoder for image.DecodeConfig
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	issvg "github.com/h2non/go-is-svg"
+	"gopkg.in/ini.v1"
+)
+
+// LintSeverity is the severity of a lint finding. The values match the levels used by SARIF
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+	LintNote    LintSeverity = "note"
+)
+
+// LintRule describes a check done by Lint
+type LintRule struct {
+	ID          string       `json:"id"`
+	Severity    LintSeverity `json:"severity"`
+	Description string       `json:"description"`
+}
+
+// LintRules are all the checks done by Lint
+var LintRules = []LintRule{
+	{"D001", LintError, "There must be exactly one desktop file in the top-level directory"},
+	{"D002", LintError, "The desktop file must be parseable and contain the required keys"},
+	{"D003", LintError, "The Icon= key of the desktop file must not contain a path or a suffix"},
+	{"D004", LintNote, "The desktop file should contain X-AppImage-Version"},
+	{"D005", LintError, "The desktop file must follow the Desktop Entry Specification"},
+	{"D006", LintWarning, "The desktop file should follow the recommendations of the Desktop Entry Specification"},
+	{"D007", LintError, "X-AppImage-Permissions must only list known permissions"},
+	{"A001", LintError, "There must be an AppRun file in the top-level directory"},
+	{"A002", LintError, "AppRun must be executable"},
+	{"I001", LintError, "The icon named in the desktop file must exist in the top-level directory"},
+	{"I002", LintWarning, "PNG icons should be square and use one of the standard sizes"},
+	{"I003", LintWarning, "There should be a .DirIcon in the top-level directory"},
+	{"I004", LintWarning, ".DirIcon should be a PNG file"},
+	{"E001", LintError, "All ELF files must be for the same architecture"},
+	{"E002", LintWarning, "Libraries needed by ELF files should be bundled unless they are on the excludelist"},
+	{"E003", LintWarning, "Libraries on the excludelist should not be bundled"},
+	{"P001", LintWarning, "Files and directories must be readable by others"},
+	{"P002", LintWarning, "Files and directories should not be writable by others"},
+	{"S001", LintNote, "There should be AppStream metadata in usr/share/metainfo"},
+	{"S002", LintError, "AppStream metadata must be well-formed and contain id, name, summary and metadata_license"},
+	{"S003", LintError, "The AppStream launchable must match the desktop file"},
+	{"U001", LintError, "The update information must be valid"},
+}
+
+// LintRuleByID returns the rule with the given ID
+func LintRuleByID(id string) (LintRule, bool) {
+	for _, r := range LintRules {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return LintRule{}, false
+}
+
+// LintFinding is a problem found by Lint
+type LintFinding struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Path     string       `json:"path,omitempty"`
+	Message  string       `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	if f.Path == "" {
+		return fmt.Sprintf("%s %s: %s", f.Severity, f.Rule, f.Message)
+	}
+	return fmt.Sprintf("%s %s: %s: %s", f.Severity, f.Rule, f.Path, f.Message)
+}
+
+// LintOptions configures Lint
+type LintOptions struct {
+	// ExcludedLibraries are expected to be provided by the target system.
+	// The library checks (E002, E003) are skipped if this is empty
+	ExcludedLibraries []string
+	// UpdateInformation gets validated if it is not empty
+	UpdateInformation string
+	// Disabled contains IDs of rules that should not be checked
+	Disabled []string
+	// Only contains the IDs of the only rules that should be checked, e.g., the cheap ones; all if it is empty
+	Only []string
+}
+
+type linter struct {
+	fsys     fs.FS
+	opts     LintOptions
+	findings []LintFinding
+}
+
+// enabled returns true if any of rules is to be checked
+func (l *linter) enabled(rules ...string) bool {
+	for _, rule := range rules {
+		if !SliceContains(l.opts.Disabled, rule) && (len(l.opts.Only) == 0 || SliceContains(l.opts.Only, rule)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) report(rule string, p string, format string, a ...interface{}) {
+	if !l.enabled(rule) {
+		return
+	}
+	r, _ := LintRuleByID(rule)
+	l.findings = append(l.findings, LintFinding{Rule: rule, Severity: r.Severity, Path: p, Message: fmt.Sprintf(format, a...)})
+}
+
+// Lint checks the AppDir in fsys (e.g., os.DirFS(appdir) or the squashfs of an AppImage)
+// and returns the findings, sorted by path
+func Lint(fsys fs.FS, opts LintOptions) []LintFinding {
+	l := &linter{fsys: fsys, opts: opts}
+	// The desktop file is needed by the other checks, all others are skipped unless one of their rules is checked
+	desktop := l.lintDesktopFile()
+	if l.enabled("A001", "A002") {
+		l.lintAppRun()
+	}
+	if l.enabled("I001", "I002", "I003", "I004") {
+		l.lintIcons(desktop)
+	}
+	if l.enabled("P001", "P002", "E001", "E002", "E003") {
+		l.lintFiles()
+	}
+	if l.enabled("S001", "S002", "S003") {
+		l.lintAppStream(desktop)
+	}
+	if opts.UpdateInformation != "" && l.enabled("U001") {
+		if err := ValidateUpdateInformation(opts.UpdateInformation); err != nil {
+			l.report("U001", "", "%s", err)
+		}
+	}
+	sort.SliceStable(l.findings, func(i, j int) bool { return l.findings[i].Path < l.findings[j].Path })
+	return l.findings
+}
+
+// LintHasErrors returns true if any of the findings is an error
+func LintHasErrors(findings []LintFinding) bool {
+	for _, f := range findings {
+		if f.Severity == LintError {
+			return true
+		}
+	}
+	return false
+}
+
+// lintDesktopFile checks the top-level desktop file and returns its name
+func (l *linter) lintDesktopFile() string {
+	entries, err := fs.ReadDir(l.fsys, ".")
+	if err != nil {
+		l.report("D001", "", "Cannot read the top-level directory: %s", err)
+		return ""
+	}
+	var desktopFiles []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".desktop") {
+			desktopFiles = append(desktopFiles, e.Name())
+		}
+	}
+	if len(desktopFiles) != 1 {
+		l.report("D001", "", "Found %d top-level desktop files: %s", len(desktopFiles), strings.Join(desktopFiles, ", "))
+		if len(desktopFiles) == 0 {
+			return ""
+		}
+	}
+	name := desktopFiles[0]
+	data, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		l.report("D002", name, "Cannot read the desktop file: %s", err)
+		return ""
+	}
+	if l.enabled("D005", "D006") {
+		for _, p := range ValidateDesktopEntry(data) {
+			if p.Severity == LintError {
+				l.report("D005", name, "%s", strings.TrimPrefix(p.String(), "error: "))
+			} else {
+				l.report("D006", name, "%s", strings.TrimPrefix(p.String(), "warning: "))
+			}
+		}
+	}
+	d, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, data) // Do not cripple lines that contain ";"
+	if err != nil {
+		l.report("D002", name, "Cannot parse the desktop file: %s", err)
+		return ""
+	}
+	s := d.Section("Desktop Entry")
+	for _, k := range []string{"Categories", "Name", "Exec", "Type", "Icon"} {
+		if !s.HasKey(k) {
+			l.report("D002", name, "Missing %s= key", k)
+		}
+	}
+	icon := s.Key("Icon").String()
+	if strings.Contains(icon, "/") {
+		l.report("D003", name, "Icon=%s contains a path", icon)
+	}
+	for _, suffix := range []string{".png", ".svg", ".svgz", ".xpm"} {
+		if strings.HasSuffix(icon, suffix) {
+			l.report("D003", name, "Icon=%s has a suffix, please remove it", icon)
+		}
+	}
+	if !s.HasKey("X-AppImage-Version") {
+		l.report("D004", name, "No X-AppImage-Version= key")
+	}
+	if s.HasKey(PermissionsKey) {
+		if _, err = ParsePermissions(s.Key(PermissionsKey).String()); err != nil {
+			l.report("D007", name, "%s: %s", PermissionsKey, err)
+		}
+	}
+	return name
+}
+
+func (l *linter) lintAppRun() {
+	info, err := fs.Stat(l.fsys, "AppRun")
+	if err != nil {
+		l.report("A001", "AppRun", "AppRun is missing or a broken symlink")
+		return
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		l.report("A002", "AppRun", "AppRun is not an executable file (mode %s)", info.Mode())
+	}
+}
+
+// standardIconSizes are the sizes of the hicolor icon theme
+var standardIconSizes = []int{8, 16, 22, 24, 32, 36, 48, 64, 72, 96, 128, 192, 256, 512}
+
+func (l *linter) lintIcons(desktop string) {
+	if desktop != "" {
+		data, _ := fs.ReadFile(l.fsys, desktop)
+		d, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, data)
+		if err == nil && d.Section("Desktop Entry").HasKey("Icon") {
+			icon := d.Section("Desktop Entry").Key("Icon").String()
+			found := false
+			for _, suffix := range []string{".png", ".svg", ".svgz", ".xpm"} {
+				p := icon + suffix
+				data, err := fs.ReadFile(l.fsys, p)
+				if err != nil {
+					continue
+				}
+				found = true
+				if suffix == ".png" {
+					l.lintPNGIcon(p, data)
+				} else if suffix == ".svg" && !issvg.Is(data) {
+					l.report("I002", p, "Not an SVG file")
+				}
+			}
+			if !found {
+				l.report("I001", "", "Icon %s.png, .svg or .xpm not found in the top-level directory", icon)
+			}
+		}
+	}
+	data, err := fs.ReadFile(l.fsys, ".DirIcon")
+	if err != nil {
+		l.report("I003", ".DirIcon", "No .DirIcon, hence there will be no thumbnail")
+	} else if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "png" {
+		l.report("I004", ".DirIcon", "Not a PNG file, file managers may not show it as a thumbnail")
+	}
+}
+
+func (l *linter) lintPNGIcon(p string, data []byte) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "png" {
+		l.report("I002", p, "Not a valid PNG file")
+		return
+	}
+	if cfg.Width != cfg.Height {
+		l.report("I002", p, "Icon is not square (%dx%d)", cfg.Width, cfg.Height)
+		return
+	}
+	for _, s := range standardIconSizes {
+		if s == cfg.Width {
+			return
+		}
+	}
+	l.report("I002", p, "Icon size %dx%d is not one of the standard sizes", cfg.Width, cfg.Height)
+}
+
+// lintFiles walks all files, checks their permissions and the ELF files among them
+func (l *linter) lintFiles() {
+	archs := map[string][]string{} // Architecture to files
+	bundled := map[string]bool{}   // Names of all files, to find libraries
+	needed := map[string][]string{}
+
+	fs.WalkDir(l.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			l.report("P001", p, "Cannot read: %s", err)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		bundled[d.Name()] = true
+		if l.isSymlink(p, d) {
+			return nil
+		}
+		m := info.Mode()
+		if m&0004 == 0 || (m.IsDir() && m&0001 == 0) {
+			l.report("P001", p, "Not readable by others (mode %s)", m)
+		}
+		if m&0002 != 0 {
+			l.report("P002", p, "Writable by others (mode %s)", m)
+		}
+		if !m.IsRegular() || info.Size() < 64 {
+			return nil
+		}
+		ef, err := l.openELF(p)
+		if err != nil || ef == nil {
+			return nil
+		}
+		defer ef.Close()
+		arch := elfArchitecture(ef)
+		archs[arch] = append(archs[arch], p)
+		if soname, err := ef.DynString(elf.DT_SONAME); err == nil && len(soname) > 0 {
+			bundled[soname[0]] = true
+		}
+		libs, _ := ef.ImportedLibraries()
+		for _, lib := range libs {
+			needed[lib] = append(needed[lib], p)
+		}
+		return nil
+	})
+
+	if len(archs) > 1 {
+		var parts []string
+		for arch, files := range archs {
+			parts = append(parts, fmt.Sprintf("%s (e.g., %s)", arch, files[0]))
+		}
+		sort.Strings(parts)
+		l.report("E001", "", "Found ELF files for multiple architectures: %s", strings.Join(parts, ", "))
+	}
+
+	if len(l.opts.ExcludedLibraries) == 0 {
+		return
+	}
+	var libs []string
+	for lib := range needed {
+		libs = append(libs, lib)
+	}
+	sort.Strings(libs)
+	for _, lib := range libs {
+		if !bundled[lib] && !SliceContains(l.opts.ExcludedLibraries, lib) {
+			l.report("E002", needed[lib][0], "Needs %s which is neither bundled nor on the excludelist", lib)
+		}
+	}
+	for _, lib := range l.opts.ExcludedLibraries {
+		if bundled[lib] {
+			l.report("E003", "", "%s is bundled although it is on the excludelist", lib)
+		}
+	}
+}
+
+// isSymlink returns true if p is a symlink. The FileInfo of the squashfs reader
+// does not know about symlinks, hence ask the file itself if it can tell
+func (l *linter) isSymlink(p string, d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink != 0 {
+		return true
+	}
+	if d.IsDir() {
+		return false
+	}
+	f, err := l.fsys.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	s, ok := f.(interface{ IsSymlink() bool })
+	return ok && s.IsSymlink()
+}
+
+type closerELF struct {
+	*elf.File
+	c io.Closer
+}
+
+func (e closerELF) Close() error {
+	e.File.Close()
+	return e.c.Close()
+}
+
+// openELF returns the parsed ELF file at p, or nil if it is not an ELF file
+func (l *linter) openELF(p string) (*closerELF, error) {
+	f, err := l.fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	if _, err = io.ReadFull(f, magic); err != nil || string(magic) != elf.ELFMAG {
+		f.Close()
+		return nil, err
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		// Not every fs.FS supports random access, hence read the whole file
+		rest, err := io.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		ra = bytes.NewReader(append(magic, rest...))
+	}
+	ef, err := elf.NewFile(ra)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &closerELF{ef, f}, nil
+}
+
+// elfArchitecture returns the architecture name as used in AppImage file names
+func elfArchitecture(ef *closerELF) string {
+	switch ef.Machine {
+	case elf.EM_X86_64:
+		return "x86_64"
+	case elf.EM_386:
+		return "i686"
+	case elf.EM_ARM:
+		return "armhf"
+	case elf.EM_AARCH64:
+		return "aarch64"
+	}
+	return ef.Machine.String()
+}
+
+type appStreamComponent struct {
+	ID              string   `xml:"id"`
+	Name            []string `xml:"name"`
+	Summary         []string `xml:"summary"`
+	MetadataLicense string   `xml:"metadata_license"`
+	Launchables     []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"launchable"`
+}
+
+func (l *linter) lintAppStream(desktop string) {
+	var files []string
+	for _, dir := range []string{"usr/share/metainfo", "usr/share/appdata"} {
+		entries, _ := fs.ReadDir(l.fsys, dir)
+		for _, e := range entries {
+			if strings.HasSuffix(e.Name(), ".appdata.xml") || strings.HasSuffix(e.Name(), ".metainfo.xml") {
+				files = append(files, path.Join(dir, e.Name()))
+			}
+		}
+	}
+	if len(files) == 0 {
+		l.report("S001", "", "No AppStream metadata found")
+		return
+	}
+	for _, p := range files {
+		data, err := fs.ReadFile(l.fsys, p)
+		if err != nil {
+			l.report("S002", p, "Cannot read: %s", err)
+			continue
+		}
+		var c appStreamComponent
+		if err = xml.Unmarshal(data, &c); err != nil {
+			l.report("S002", p, "Not well-formed: %s", err)
+			continue
+		}
+		var missing []string
+		if strings.TrimSpace(c.ID) == "" {
+			missing = append(missing, "id")
+		}
+		if len(c.Name) == 0 {
+			missing = append(missing, "name")
+		}
+		if len(c.Summary) == 0 {
+			missing = append(missing, "summary")
+		}
+		if strings.TrimSpace(c.MetadataLicense) == "" {
+			missing = append(missing, "metadata_license")
+		}
+		if len(missing) > 0 {
+			l.report("S002", p, "Missing %s", strings.Join(missing, ", "))
+		}
+		if desktop == "" {
+			continue
+		}
+		found := false
+		for _, la := range c.Launchables {
+			if la.Type == "desktop-id" {
+				found = true
+				if strings.TrimSpace(la.Value) != desktop {
+					l.report("S003", p, "Launchable %s does not match the desktop file %s", strings.TrimSpace(la.Value), desktop)
+				}
+			}
+		}
+		if !found {
+			l.report("S003", p, "No <launchable type=\"desktop-id\">%s</launchable>", desktop)
+		}
+	}
+}
+
+// WriteLintReport writes the findings to w in the given format, which can be
+// "text" (one line per finding), "json" or "sarif" (for code scanning in CI)
+func WriteLintReport(w io.Writer, findings []LintFinding, format string, toolName string) error {
+	switch format {
+	case "", "text":
+		for _, f := range findings {
+			if _, err := fmt.Fprintln(w, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		if findings == nil {
+			findings = []LintFinding{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(findings)
+	case "sarif":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sarifReport(findings, toolName))
+	}
+	return errors.New("unknown lint report format: " + format)
+}
+
+// sarifReport converts the findings to SARIF 2.1.0,
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+func sarifReport(findings []LintFinding, toolName string) map[string]interface{} {
+	rules := []map[string]interface{}{}
+	for _, r := range LintRules {
+		rules = append(rules, map[string]interface{}{
+			"id":                   r.ID,
+			"shortDescription":     map[string]string{"text": r.Description},
+			"defaultConfiguration": map[string]string{"level": string(r.Severity)},
+		})
+	}
+	results := []map[string]interface{}{}
+	for _, f := range findings {
+		result := map[string]interface{}{
+			"ruleId":  f.Rule,
+			"level":   string(f.Severity),
+			"message": map[string]string{"text": f.Message},
+		}
+		if f.Path != "" {
+			result["locations"] = []map[string]interface{}{{
+				"physicalLocation": map[string]interface{}{
+					"artifactLocation": map[string]string{"uri": f.Path},
+				},
+			}}
+		}
+		results = append(results, result)
+	}
+	return map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []map[string]interface{}{{
+			"tool": map[string]interface{}{
+				"driver": map[string]interface{}{
+					"name":           toolName,
+					"informationUri": "https://github.com/probonopd/go-appimage",
+					"rules":          rules,
+				},
+			},
+			"results": results,
+		}},
+	}
+}
@@ -0,0 +1,86 @@
+package helpers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"testing"
+	"testing/fstest"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+func TestLint(t *testing.T) {
+	icon := func(w, h int) []byte {
+		var buf bytes.Buffer
+		png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)))
+		return buf.Bytes()
+	}
+	desktop := "[Desktop Entry]\nType=Application\nName=App\nExec=app\nIcon=app\nCategories=Utility;\nX-AppImage-Version=1.0\nX-AppImage-Permissions=network;audio;\n"
+	metainfo := `<component type="desktop-application">
+  <id>org.example.app</id>
+  <name>App</name>
+  <summary>An app</summary>
+  <metadata_license>MIT</metadata_license>
+  <launchable type="desktop-id">app.desktop</launchable>
+</component>`
+	good := fstest.MapFS{
+		"app.desktop": {Data: []byte(desktop), Mode: 0644},
+		"app.png":     {Data: icon(256, 256), Mode: 0644},
+		".DirIcon":    {Data: icon(256, 256), Mode: 0644},
+		"AppRun":      {Data: []byte("#!/bin/sh\n"), Mode: 0755},
+		"usr/share/metainfo/org.example.app.appdata.xml": {Data: []byte(metainfo), Mode: 0644},
+	}
+	if findings := helpers.Lint(good, helpers.LintOptions{}); len(findings) != 0 {
+		t.Fatal("Expected no findings for a good AppDir, got", findings)
+	}
+
+	bad := fstest.MapFS{
+		"app.desktop": {Data: []byte("[Desktop Entry]\nType=Application\nName=App\nIcon=app.png\nX-AppImage-Permissions=network;camera;\n"), Mode: 0644},
+		"app.png":     {Data: icon(100, 50), Mode: 0644},
+		"AppRun":      {Data: []byte("#!/bin/sh\n"), Mode: 0646},
+		"usr/share/metainfo/org.example.app.appdata.xml": {Data: []byte("<component><id>x</id>"), Mode: 0640},
+	}
+	findings := helpers.Lint(bad, helpers.LintOptions{UpdateInformation: "nonsense", Disabled: []string{"D004"}})
+	got := map[string]bool{}
+	for _, f := range findings {
+		got[f.Rule] = true
+	}
+	for _, rule := range []string{"D002", "D003", "D007", "A002", "I001", "I003", "P001", "P002", "S002", "U001"} {
+		if !got[rule] {
+			t.Error("Expected a finding for", rule, "got", findings)
+		}
+	}
+	if got["D004"] {
+		t.Error("D004 should have been disabled")
+	}
+	if !helpers.LintHasErrors(findings) {
+		t.Error("Expected errors")
+	}
+	for _, f := range helpers.Lint(bad, helpers.LintOptions{UpdateInformation: "nonsense", Only: []string{"D002", "U001"}}) {
+		if f.Rule != "D002" && f.Rule != "U001" {
+			t.Error("Expected only D002 and U001 to be checked, got", f)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := helpers.WriteLintReport(&buf, findings, "sarif", "test"); err != nil {
+		t.Fatal(err)
+	}
+	var sarif struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				RuleID string
+				Level  string
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &sarif); err != nil {
+		t.Fatal(err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != len(findings) {
+		t.Fatal("Unexpected SARIF output:", buf.String())
+	}
+}
@@ -0,0 +1,153 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// oci-zsync|<registry>/<repository>|<tag>|<file name pattern of the .zsync file>
+// The AppImage and its .zsync file are layers of an OCI artifact (e.g., pushed with oras),
+// named by their org.opencontainers.image.title annotations.
+// Anonymous bearer tokens are requested as needed, e.g., for ghcr.io
+type ociTransport struct{}
+
+type ociManifest struct {
+	Layers []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func (ociTransport) Validate(fields []string) error {
+	if err := checkFieldCount(fields, 3, "oci-zsync|<registry>/<repository>|<tag>|<file name pattern of the .zsync file>"); err != nil {
+		return err
+	}
+	if !strings.Contains(strings.TrimPrefix(strings.TrimPrefix(fields[0], "http://"), "https://"), "/") {
+		return errors.New("Update information isn't valid, the repository is missing after the registry")
+	}
+	return nil
+}
+
+// splitOCIReference splits "registry/repository" into the base URL of the registry and the repository
+func splitOCIReference(ref string) (string, string) {
+	scheme := "https://"
+	for _, s := range []string{"http://", "https://"} {
+		if strings.HasPrefix(ref, s) {
+			scheme = s
+			ref = strings.TrimPrefix(ref, s)
+		}
+	}
+	registry, repository, _ := strings.Cut(ref, "/")
+	return scheme + registry, repository
+}
+
+func (ociTransport) ResolveLatest(ui UpdateInformation) (UpdateRelease, error) {
+	base, repository := splitOCIReference(ui.fields[0])
+	tag, pattern := ui.fields[1], ui.fields[2]
+	manifestURL := base + "/v2/" + repository + "/manifests/" + url.PathEscape(tag)
+	accept := []string{"application/vnd.oci.image.manifest.v1+json", "application/vnd.docker.distribution.manifest.v2+json"}
+
+	var authorize func(*http.Request)
+	resp, err := httpGet(manifestURL, nil, accept...)
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		var token string
+		if token, err = ociToken(resp.Header.Get("WWW-Authenticate"), repository); err != nil {
+			return UpdateRelease{}, err
+		}
+		authorize = authorizeHost(base, "Authorization", "Bearer "+token)
+		resp, err = httpGet(manifestURL, authorize, accept...)
+	}
+	if err != nil {
+		return UpdateRelease{}, err
+	}
+	defer resp.Body.Close()
+	var manifest ociManifest
+	if err = json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return UpdateRelease{}, errors.New("could not parse the manifest from " + manifestURL + ": " + err.Error())
+	}
+
+	rel := UpdateRelease{
+		Name:      tag,
+		changelog: manifest.Annotations["org.opencontainers.image.description"],
+		assets:    map[string]string{},
+		authorize: authorize,
+	}
+	if version := manifest.Annotations["org.opencontainers.image.version"]; version != "" {
+		rel.Name = version
+	}
+	rel.ReleaseURL = manifest.Annotations["org.opencontainers.image.source"]
+	var names []string
+	for _, layer := range manifest.Layers {
+		title := layer.Annotations["org.opencontainers.image.title"]
+		if title == "" {
+			continue
+		}
+		rel.assets[title] = base + "/v2/" + repository + "/blobs/" + layer.Digest
+		names = append(names, title)
+	}
+	name, ok := newestMatching(names, pattern)
+	if !ok {
+		return rel, errors.New("no layer titled " + pattern + " in " + ui.fields[0] + ":" + tag)
+	}
+	rel.ZsyncURL = rel.assets[name]
+	return rel, nil
+}
+
+// ociToken gets an anonymous pull token as described by the WWW-Authenticate header, see
+// https://distribution.github.io/distribution/spec/auth/token/
+func ociToken(challenge string, repository string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", errors.New("unsupported authentication scheme of the registry: " + challenge)
+	}
+	values := map[string]string{}
+	for _, p := range strings.Split(params, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if ok {
+			values[k] = strings.Trim(v, `"`)
+		}
+	}
+	if values["realm"] == "" {
+		return "", errors.New("no realm in the authentication challenge of the registry: " + challenge)
+	}
+	q := url.Values{}
+	if values["service"] != "" {
+		q.Set("service", values["service"])
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	q.Set("scope", scope)
+	resp, err := httpGet(values["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("the registry did not return a token")
+	}
+	return token.Token, nil
+}
+
+func (ociTransport) FetchZsync(ui UpdateInformation, rel UpdateRelease) (*ZsyncControl, error) {
+	return fetchReleaseZsync(rel)
+}
+
+func (ociTransport) Changelog(ui UpdateInformation, rel UpdateRelease) (string, error) {
+	return releaseChangelog(rel)
+}
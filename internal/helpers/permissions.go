@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// PermissionsKey is the key in the desktop file of an AppImage that declares what
+// the application needs to be allowed to do, e.g., X-AppImage-Permissions=network;audio;
+// When it is present, appimaged runs the application in a sandbox that only grants
+// the listed permissions. An empty value means that nothing needs to be granted
+const PermissionsKey = "X-AppImage-Permissions"
+
+// Permissions that can be declared in X-AppImage-Permissions
+const (
+	PermissionNetwork = "network" // Access the network
+	PermissionHome    = "home"    // Read and write the home directory of the user
+	PermissionAudio   = "audio"   // Play and record sound
+	PermissionDevices = "devices" // Access hardware devices, e.g., webcams and USB devices
+	PermissionDBus    = "dbus"    // Talk to other applications over the D-Bus session bus
+)
+
+// AllPermissions are all permissions that can be declared, in the order in which they are formatted
+var AllPermissions = []string{PermissionNetwork, PermissionHome, PermissionAudio, PermissionDevices, PermissionDBus}
+
+// ParsePermissions parses a list of permissions separated by ";" (as in desktop files) or ","
+// and returns it without duplicates, in the order of AllPermissions
+func ParsePermissions(s string) ([]string, error) {
+	permissions := []string{}
+	for _, p := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ',' }) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !SliceContains(AllPermissions, p) {
+			return nil, errors.New("unknown permission " + p + " (known are " + strings.Join(AllPermissions, ", ") + ")")
+		}
+		permissions = AppendIfMissing(permissions, p)
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissionIndex(permissions[i]) < permissionIndex(permissions[j])
+	})
+	return permissions, nil
+}
+
+// FormatPermissions formats permissions as the value of X-AppImage-Permissions
+func FormatPermissions(permissions []string) string {
+	if len(permissions) == 0 {
+		return ""
+	}
+	return strings.Join(permissions, ";") + ";"
+}
+
+func permissionIndex(p string) int {
+	for i, known := range AllPermissions {
+		if known == p {
+			return i
+		}
+	}
+	return len(AllPermissions)
+}
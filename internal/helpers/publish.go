@@ -0,0 +1,409 @@
+package helpers
+
+// Publishers upload AppImages and their .zsync files to releases on GitHub or GitLab,
+// which is what https://github.com/probonopd/uploadtool used to do for us.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// PublishRelease describes the release to which files are published
+type PublishRelease struct {
+	Tag    string // "continuous" for builds of the main branch, otherwise the name of the git tag
+	Commit string // The commit that was built; the "continuous" tag is moved there
+	Notes  string // Release notes; if empty, the message of Commit is used
+}
+
+// Prerelease returns whether the release should be marked as a pre-release
+func (r PublishRelease) Prerelease() bool {
+	return r.Tag == "continuous"
+}
+
+// Publisher publishes files to a release, creating the release if it does not exist yet
+// and replacing assets of the same name
+type Publisher interface {
+	// Publish uploads files to the release and returns the URL of the release
+	Publish(release PublishRelease, files ...string) (string, error)
+}
+
+// PublisherFromEnvironment returns the Publisher and the release for the CI system it runs on,
+// based on its environment variables, or nil if it does not run on a supported CI system
+// or if this is a build of a pull request. Returns an error if the token is missing
+func PublisherFromEnvironment() (Publisher, PublishRelease, error) {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true" || os.Getenv("GITHUB_REPOSITORY") != "":
+		if strings.Contains(os.Getenv("GITHUB_REF"), "/pull/") {
+			return nil, PublishRelease{}, nil
+		}
+		parts := strings.Split(os.Getenv("GITHUB_REPOSITORY"), "/")
+		if len(parts) != 2 {
+			return nil, PublishRelease{}, errors.New("cannot split $GITHUB_REPOSITORY: " + os.Getenv("GITHUB_REPOSITORY"))
+		}
+		p, err := NewGitHubPublisher(os.Getenv("GITHUB_API_URL"), "", os.Getenv("GITHUB_TOKEN"), parts[0], parts[1])
+		release := PublishRelease{Tag: "continuous", Commit: os.Getenv("GITHUB_SHA")}
+		if strings.HasPrefix(os.Getenv("GITHUB_REF"), "refs/tags/") {
+			release.Tag = strings.TrimPrefix(os.Getenv("GITHUB_REF"), "refs/tags/")
+		}
+		if err != nil {
+			return nil, release, err
+		}
+		return p, release, nil
+	case os.Getenv("TRAVIS_REPO_SLUG") != "":
+		if os.Getenv("TRAVIS_PULL_REQUEST") != "false" {
+			return nil, PublishRelease{}, nil
+		}
+		parts := strings.Split(os.Getenv("TRAVIS_REPO_SLUG"), "/")
+		if len(parts) != 2 {
+			return nil, PublishRelease{}, errors.New("cannot split $TRAVIS_REPO_SLUG: " + os.Getenv("TRAVIS_REPO_SLUG"))
+		}
+		p, err := NewGitHubPublisher("", "", os.Getenv("GITHUB_TOKEN"), parts[0], parts[1])
+		release := PublishRelease{Tag: "continuous", Commit: os.Getenv("TRAVIS_COMMIT")}
+		if os.Getenv("TRAVIS_TAG") != "" {
+			release.Tag = os.Getenv("TRAVIS_TAG")
+		}
+		if err != nil {
+			return nil, release, err
+		}
+		return p, release, nil
+	case os.Getenv("GITLAB_CI") != "":
+		if os.Getenv("CI_MERGE_REQUEST_IID") != "" {
+			return nil, PublishRelease{}, nil
+		}
+		p := &GitLabPublisher{
+			APIURL:  os.Getenv("CI_API_V4_URL"),
+			Project: os.Getenv("CI_PROJECT_PATH"),
+			Token:   os.Getenv("GITLAB_TOKEN"),
+		}
+		release := PublishRelease{Tag: "continuous", Commit: os.Getenv("CI_COMMIT_SHA"), Notes: os.Getenv("CI_COMMIT_MESSAGE")}
+		if os.Getenv("CI_COMMIT_TAG") != "" {
+			release.Tag = os.Getenv("CI_COMMIT_TAG")
+		}
+		if p.APIURL == "" || p.Project == "" || p.Token == "" {
+			return nil, release, errors.New("$CI_API_V4_URL, $CI_PROJECT_PATH and $GITLAB_TOKEN are needed to publish on GitLab, $GITLAB_TOKEN needs the api scope")
+		}
+		return p, release, nil
+	}
+	return nil, PublishRelease{}, nil
+}
+
+// GitHubPublisher publishes to GitHub Releases
+type GitHubPublisher struct {
+	Owner  string
+	Repo   string
+	client *github.Client
+}
+
+// NewGitHubPublisher returns a GitHubPublisher for the repository owner/repo.
+// apiURL and uploadURL can be empty for github.com
+func NewGitHubPublisher(apiURL string, uploadURL string, token string, owner string, repo string) (*GitHubPublisher, error) {
+	if token == "" {
+		return nil, errors.New("$GITHUB_TOKEN is needed to publish on GitHub, you can get one from https://github.com/settings/tokens")
+	}
+	client := github.NewClient(&http.Client{Transport: tokenTransport{token}})
+	if apiURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(apiURL, "/") + "/")
+		if err != nil {
+			return nil, err
+		}
+		client.BaseURL = u
+		// GitHub Enterprise Server takes uploads at /api/uploads instead of uploads.github.com
+		if uploadURL == "" && u.Host != "api.github.com" {
+			uploadURL = strings.TrimSuffix(strings.TrimSuffix(apiURL, "/"), "/v3") + "/uploads"
+		}
+	}
+	if uploadURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(uploadURL, "/") + "/")
+		if err != nil {
+			return nil, err
+		}
+		client.UploadURL = u
+	}
+	return &GitHubPublisher{Owner: owner, Repo: repo, client: client}, nil
+}
+
+type tokenTransport struct {
+	token string
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+t.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Publish uploads files to the release. Each file is uploaded under a temporary name first,
+// so that an asset of the same name is only replaced once the new one is complete
+func (p *GitHubPublisher) Publish(release PublishRelease, files ...string) (string, error) {
+	ctx := context.Background()
+	if release.Notes == "" && release.Commit != "" {
+		if commit, _, err := p.client.Git.GetCommit(ctx, p.Owner, p.Repo, release.Commit); err == nil {
+			release.Notes = commit.GetMessage()
+		}
+	}
+
+	rel, resp, err := p.client.Repositories.GetReleaseByTag(ctx, p.Owner, p.Repo, release.Tag)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return "", err
+	}
+	if err != nil {
+		fmt.Println("Creating release", release.Tag, "of", p.Owner+"/"+p.Repo)
+		rel, _, err = p.client.Repositories.CreateRelease(ctx, p.Owner, p.Repo, &github.RepositoryRelease{
+			TagName:         github.String(release.Tag),
+			TargetCommitish: stringOrNil(release.Commit),
+			Name:            github.String(release.Tag),
+			Body:            github.String(release.Notes),
+			Prerelease:      github.Bool(release.Prerelease()),
+		})
+		if err != nil {
+			return "", err
+		}
+	} else {
+		fmt.Println("Updating release", release.Tag, "of", p.Owner+"/"+p.Repo)
+		// The continuous release follows the branch. The notes of other releases
+		// may have been written by hand, so they are only set when creating them
+		if release.Prerelease() && release.Commit != "" {
+			_, _, err = p.client.Git.UpdateRef(ctx, p.Owner, p.Repo, &github.Reference{
+				Ref:    github.String("tags/" + release.Tag),
+				Object: &github.GitObject{SHA: github.String(release.Commit)},
+			}, true)
+			if err != nil {
+				return "", err
+			}
+		}
+		if release.Prerelease() && release.Notes != "" {
+			rel, _, err = p.client.Repositories.EditRelease(ctx, p.Owner, p.Repo, rel.GetID(), &github.RepositoryRelease{Body: github.String(release.Notes)})
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	assets := map[string]int64{}
+	for _, asset := range rel.Assets {
+		assets[asset.GetName()] = asset.GetID()
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		temporary := name + ".uploading"
+		// Left over from a failed upload
+		if id, ok := assets[temporary]; ok {
+			if _, err = p.client.Repositories.DeleteReleaseAsset(ctx, p.Owner, p.Repo, id); err != nil {
+				return "", err
+			}
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Println("Uploading", name, "to release", release.Tag)
+		uploaded, _, err := p.client.Repositories.UploadReleaseAsset(ctx, p.Owner, p.Repo, rel.GetID(), &github.UploadOptions{Name: temporary}, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		if id, ok := assets[name]; ok {
+			if _, err = p.client.Repositories.DeleteReleaseAsset(ctx, p.Owner, p.Repo, id); err != nil {
+				return "", err
+			}
+		}
+		if _, _, err = p.client.Repositories.EditReleaseAsset(ctx, p.Owner, p.Repo, uploaded.GetID(), &github.ReleaseAsset{Name: github.String(name)}); err != nil {
+			return "", err
+		}
+	}
+	return rel.GetHTMLURL(), nil
+}
+
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// GitLabPublisher publishes to GitLab Releases. The files are uploaded to the generic package
+// registry of the project, in a package named "AppImage" with the tag as the version,
+// and linked from the release
+type GitLabPublisher struct {
+	APIURL  string // E.g., https://gitlab.com/api/v4
+	Project string // Path or ID of the project, e.g., group/project
+	Token   string // Personal, group or project access token
+}
+
+type gitLabPackageFile struct {
+	ID        int64  `json:"id"`
+	PackageID int64  `json:"package_id"`
+	FileName  string `json:"file_name"`
+}
+
+type gitLabLink struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Publish uploads files to the release. GitLab serves the most recently uploaded file
+// of a package at the same URL, so files are replaced atomically; older files of the same name are deleted afterwards
+func (p *GitLabPublisher) Publish(release PublishRelease, files ...string) (string, error) {
+	project := p.APIURL + "/projects/" + url.PathEscape(p.Project)
+	if release.Notes == "" && release.Commit != "" {
+		var commit struct {
+			Message string `json:"message"`
+		}
+		if err := p.request(http.MethodGet, project+"/repository/commits/"+url.PathEscape(release.Commit), nil, &commit); err == nil {
+			release.Notes = commit.Message
+		}
+	}
+
+	var rel struct {
+		Links struct {
+			Self string `json:"self"`
+		} `json:"_links"`
+	}
+	releaseURL := project + "/releases/" + url.PathEscape(release.Tag)
+	err := p.request(http.MethodGet, releaseURL, nil, &rel)
+	var status httpStatusError
+	if errors.As(err, &status) && status.code == http.StatusNotFound {
+		fmt.Println("Creating release", release.Tag, "of", p.Project)
+		// GitLab has no API to move tags, hence the continuous tag stays where it was created
+		err = p.request(http.MethodPost, project+"/releases", map[string]string{
+			"tag_name":    release.Tag,
+			"ref":         release.Commit,
+			"name":        release.Tag,
+			"description": release.Notes,
+		}, &rel)
+	} else if err == nil && release.Prerelease() && release.Notes != "" {
+		// As on GitHub, only the notes of the continuous release follow the commits
+		fmt.Println("Updating release", release.Tag, "of", p.Project)
+		err = p.request(http.MethodPut, releaseURL, map[string]string{"description": release.Notes}, &rel)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var links []gitLabLink
+	if err = p.request(http.MethodGet, releaseURL+"/assets/links", nil, &links); err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		packageURL := project + "/packages/generic/AppImage/" + url.PathEscape(release.Tag) + "/" + url.PathEscape(name)
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Println("Uploading", name, "to release", release.Tag)
+		var uploaded gitLabPackageFile
+		err = p.request(http.MethodPut, packageURL+"?select=package_file", f, &uploaded)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+
+		link := map[string]string{"name": name, "url": packageURL, "link_type": "package"}
+		err = p.request(http.MethodPost, releaseURL+"/assets/links", link, nil)
+		for _, l := range links {
+			if l.Name == name {
+				err = nil
+				if l.URL != packageURL {
+					err = p.request(http.MethodPut, fmt.Sprintf("%s/assets/links/%d", releaseURL, l.ID), link, nil)
+				}
+				break
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+
+		// Delete the files that were replaced
+		packageFiles := fmt.Sprintf("%s/packages/%d/package_files", project, uploaded.PackageID)
+		var older []gitLabPackageFile
+		for page := "1"; page != ""; {
+			var files []gitLabPackageFile
+			header, err := p.requestHeader(http.MethodGet, packageFiles+"?per_page=100&page="+page, nil, &files)
+			if err != nil {
+				return "", err
+			}
+			older = append(older, files...)
+			page = header.Get("X-Next-Page")
+		}
+		for _, o := range older {
+			if o.FileName == name && o.ID != uploaded.ID {
+				if err = p.request(http.MethodDelete, fmt.Sprintf("%s/%d", packageFiles, o.ID), nil, nil); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	return rel.Links.Self, nil
+}
+
+type httpStatusError struct {
+	code    int
+	message string
+}
+
+func (e httpStatusError) Error() string {
+	return e.message
+}
+
+// request sends body (JSON, or the contents of a file) to u and decodes the response into out, if not nil
+func (p *GitLabPublisher) request(method string, u string, body interface{}, out interface{}) error {
+	_, err := p.requestHeader(method, u, body, out)
+	return err
+}
+
+// requestHeader is like request, and returns the header of the response, e.g., to follow its pages
+func (p *GitLabPublisher) requestHeader(method string, u string, body interface{}, out interface{}) (http.Header, error) {
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case *os.File:
+		reader = b
+		contentType = "application/octet-stream"
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := body.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil {
+			req.ContentLength = fi.Size()
+		}
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("PRIVATE-TOKEN", p.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, httpStatusError{resp.StatusCode, method + " " + u + ": " + resp.Status + " " + strings.TrimSpace(string(message))}
+	}
+	if out == nil {
+		return resp.Header, nil
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,359 @@
+package helpers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+type fakeAsset struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	contents string
+}
+
+// fakeGitHub implements the parts of the GitHub API that GitHubPublisher uses
+type fakeGitHub struct {
+	sync.Mutex
+	releases map[string]*fakeGitHubRelease
+	tags     map[string]string
+	nextID   int64
+}
+
+type fakeGitHubRelease struct {
+	ID         int64        `json:"id"`
+	TagName    string       `json:"tag_name"`
+	Body       string       `json:"body"`
+	Prerelease bool         `json:"prerelease"`
+	HTMLURL    string       `json:"html_url"`
+	Assets     []*fakeAsset `json:"assets"`
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if r.Header.Get("Authorization") != "token secret" {
+		http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+		return
+	}
+	f.nextID++
+	p := strings.TrimPrefix(r.URL.Path, "/api/v3/repos/owner/repo")
+	switch {
+	case r.Method == http.MethodGet && p == "/git/commits/abc":
+		fmt.Fprint(w, `{"sha": "abc", "message": "Fix all the bugs"}`)
+	case r.Method == http.MethodGet && strings.HasPrefix(p, "/releases/tags/"):
+		rel, ok := f.releases[strings.TrimPrefix(p, "/releases/tags/")]
+		if !ok {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(rel)
+	case r.Method == http.MethodPost && p == "/releases":
+		var rel fakeGitHubRelease
+		var commit struct {
+			TargetCommitish string `json:"target_commitish"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &rel)
+		json.Unmarshal(data, &commit)
+		rel.ID, rel.HTMLURL = f.nextID, "https://github.com/owner/repo/releases/tag/"+rel.TagName
+		f.releases[rel.TagName] = &rel
+		f.tags[rel.TagName] = commit.TargetCommitish
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rel)
+	case r.Method == http.MethodPatch && strings.HasPrefix(p, "/git/refs/tags/"):
+		var ref struct {
+			SHA   string `json:"sha"`
+			Force bool   `json:"force"`
+		}
+		json.NewDecoder(r.Body).Decode(&ref)
+		f.tags[strings.TrimPrefix(p, "/git/refs/tags/")] = ref.SHA
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodPatch && strings.HasPrefix(p, "/releases/assets/"):
+		asset := f.asset(p)
+		json.NewDecoder(r.Body).Decode(asset)
+		json.NewEncoder(w).Encode(asset)
+	case r.Method == http.MethodDelete && strings.HasPrefix(p, "/releases/assets/"):
+		for _, rel := range f.releases {
+			for i, a := range rel.Assets {
+				if strconv.FormatInt(a.ID, 10) == strings.TrimPrefix(p, "/releases/assets/") {
+					rel.Assets = append(rel.Assets[:i], rel.Assets[i+1:]...)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+		}
+		http.NotFound(w, r)
+	case r.Method == http.MethodPatch && strings.HasPrefix(p, "/releases/"):
+		for _, rel := range f.releases {
+			if "/releases/"+strconv.FormatInt(rel.ID, 10) == p {
+				json.NewDecoder(r.Body).Decode(rel)
+				json.NewEncoder(w).Encode(rel)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/uploads/repos/owner/repo/releases/"):
+		for _, rel := range f.releases {
+			if strings.HasSuffix(r.URL.Path, "/releases/"+strconv.FormatInt(rel.ID, 10)+"/assets") {
+				data, _ := io.ReadAll(r.Body)
+				asset := &fakeAsset{ID: f.nextID, Name: r.URL.Query().Get("name"), contents: string(data)}
+				rel.Assets = append(rel.Assets, asset)
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(asset)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusTeapot)
+	}
+}
+
+func (f *fakeGitHub) asset(p string) *fakeAsset {
+	for _, rel := range f.releases {
+		for _, a := range rel.Assets {
+			if strconv.FormatInt(a.ID, 10) == strings.TrimPrefix(p, "/releases/assets/") {
+				return a
+			}
+		}
+	}
+	return &fakeAsset{}
+}
+
+// writeBuild writes an AppImage and .zsync file with the given contents
+func writeBuild(t *testing.T, contents string) []string {
+	dir := t.TempDir()
+	appimage := filepath.Join(dir, "App-x86_64.AppImage")
+	if err := os.WriteFile(appimage, []byte(contents), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(appimage+".zsync", []byte("zsync for "+contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return []string{appimage, appimage + ".zsync"}
+}
+
+func TestGitHubPublisher(t *testing.T) {
+	fake := &fakeGitHub{releases: map[string]*fakeGitHubRelease{}, tags: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	if _, err := helpers.NewGitHubPublisher(server.URL+"/api/v3", "", "", "owner", "repo"); err == nil {
+		t.Error("Expected an error without a token")
+	}
+	p, err := helpers.NewGitHubPublisher(server.URL+"/api/v3", "", "secret", "owner", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := p.Publish(helpers.PublishRelease{Tag: "continuous", Commit: "abc"}, writeBuild(t, "first build")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://github.com/owner/repo/releases/tag/continuous" {
+		t.Error("Wrong release URL:", u)
+	}
+	rel := fake.releases["continuous"]
+	if rel == nil || rel.Body != "Fix all the bugs" || !rel.Prerelease || fake.tags["continuous"] != "abc" {
+		t.Fatalf("Wrong release: %+v %v", rel, fake.tags)
+	}
+
+	// Publishing again replaces the assets and moves the tag
+	fake.tags["continuous"] = "old"
+	if _, err = p.Publish(helpers.PublishRelease{Tag: "continuous", Commit: "def", Notes: "Second build"}, writeBuild(t, "second build")...); err != nil {
+		t.Fatal(err)
+	}
+	if rel.Body != "Second build" || fake.tags["continuous"] != "def" {
+		t.Errorf("Release not updated: %+v %v", rel, fake.tags)
+	}
+	var assets []string
+	for _, a := range rel.Assets {
+		assets = append(assets, a.Name+": "+a.contents)
+	}
+	sort.Strings(assets)
+	if strings.Join(assets, ", ") != "App-x86_64.AppImage.zsync: zsync for second build, App-x86_64.AppImage: second build" {
+		t.Error("Wrong assets:", assets)
+	}
+
+	// The notes of other releases are only set when they are created
+	fake.releases["1.0"] = &fakeGitHubRelease{ID: 100, TagName: "1.0", Body: "Written by hand"}
+	if _, err = p.Publish(helpers.PublishRelease{Tag: "1.0", Commit: "abc", Notes: "Commit message"}, writeBuild(t, "1.0")...); err != nil {
+		t.Fatal(err)
+	}
+	if fake.releases["1.0"].Body != "Written by hand" || len(fake.releases["1.0"].Assets) != 2 {
+		t.Errorf("Wrong release: %+v", fake.releases["1.0"])
+	}
+}
+
+// fakeGitLab implements the parts of the GitLab API that GitLabPublisher uses
+type fakeGitLab struct {
+	sync.Mutex
+	releases map[string]string // Tag to description
+	links    []map[string]interface{}
+	files    []map[string]interface{}
+	contents map[float64]string
+	nextID   float64
+}
+
+func (f *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+		http.Error(w, `{"message": "401 Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	f.nextID++
+	p := strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/projects/group%2Fproject")
+	var body map[string]interface{}
+	if r.Header.Get("Content-Type") == "application/json" {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	release := func(tag string) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"tag_name": tag, "description": f.releases[tag],
+			"_links": map[string]string{"self": "https://gitlab.com/group/project/-/releases/" + tag}})
+	}
+	switch {
+	case r.Method == http.MethodGet && p == "/repository/commits/abc":
+		fmt.Fprint(w, `{"id": "abc", "message": "Fix all the bugs"}`)
+	case r.Method == http.MethodGet && p == "/releases/continuous":
+		if _, ok := f.releases["continuous"]; !ok {
+			http.Error(w, `{"message": "404 Not Found"}`, http.StatusNotFound)
+			return
+		}
+		release("continuous")
+	case r.Method == http.MethodPost && p == "/releases":
+		f.releases[body["tag_name"].(string)] = body["description"].(string)
+		w.WriteHeader(http.StatusCreated)
+		release(body["tag_name"].(string))
+	case r.Method == http.MethodPut && p == "/releases/continuous":
+		f.releases["continuous"] = body["description"].(string)
+		release("continuous")
+	case r.Method == http.MethodGet && p == "/releases/continuous/assets/links":
+		json.NewEncoder(w).Encode(f.links)
+	case r.Method == http.MethodPost && p == "/releases/continuous/assets/links":
+		for _, l := range f.links {
+			if l["name"] == body["name"] {
+				http.Error(w, `{"message": "has already been taken"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		body["id"] = f.nextID
+		f.links = append(f.links, body)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(body)
+	case r.Method == http.MethodPut && strings.HasPrefix(p, "/packages/generic/AppImage/continuous/"):
+		data, _ := io.ReadAll(r.Body)
+		file := map[string]interface{}{"id": f.nextID, "package_id": 7, "file_name": strings.TrimPrefix(p, "/packages/generic/AppImage/continuous/")}
+		f.files = append(f.files, file)
+		f.contents[f.nextID] = string(data)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(file)
+	case r.Method == http.MethodGet && p == "/packages/7/package_files":
+		// One file per page, so that the pages have to be followed
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 || page > len(f.files) {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		if page < len(f.files) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		}
+		json.NewEncoder(w).Encode(f.files[page-1 : page])
+	case r.Method == http.MethodDelete && strings.HasPrefix(p, "/packages/7/package_files/"):
+		for i, file := range f.files {
+			if fmt.Sprint(file["id"]) == strings.TrimPrefix(p, "/packages/7/package_files/") {
+				f.files = append(f.files[:i], f.files[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusTeapot)
+	}
+}
+
+func TestGitLabPublisher(t *testing.T) {
+	fake := &fakeGitLab{releases: map[string]string{}, contents: map[float64]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	p := &helpers.GitLabPublisher{APIURL: server.URL + "/api/v4", Project: "group/project", Token: "secret"}
+	u, err := p.Publish(helpers.PublishRelease{Tag: "continuous", Commit: "abc"}, writeBuild(t, "first build")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://gitlab.com/group/project/-/releases/continuous" || fake.releases["continuous"] != "Fix all the bugs" {
+		t.Errorf("Wrong release: %s %v", u, fake.releases)
+	}
+	if _, err = p.Publish(helpers.PublishRelease{Tag: "continuous", Commit: "def", Notes: "Second build"}, writeBuild(t, "second build")...); err != nil {
+		t.Fatal(err)
+	}
+	if fake.releases["continuous"] != "Second build" {
+		t.Error("Release not updated:", fake.releases)
+	}
+	var files []string
+	for _, file := range fake.files {
+		files = append(files, fmt.Sprint(file["file_name"], ": ", fake.contents[file["id"].(float64)]))
+	}
+	sort.Strings(files)
+	if strings.Join(files, ", ") != "App-x86_64.AppImage.zsync: zsync for second build, App-x86_64.AppImage: second build" {
+		t.Error("Wrong package files:", files)
+	}
+	if len(fake.links) != 2 || fake.links[0]["url"] != server.URL+"/api/v4/projects/group%2Fproject/packages/generic/AppImage/continuous/App-x86_64.AppImage" {
+		t.Error("Wrong release links:", fake.links)
+	}
+}
+
+func TestPublisherFromEnvironment(t *testing.T) {
+	for _, v := range []string{"GITHUB_ACTIONS", "GITHUB_REPOSITORY", "GITHUB_REF", "GITHUB_SHA", "GITHUB_TOKEN", "GITHUB_API_URL",
+		"TRAVIS_REPO_SLUG", "GITLAB_CI", "CI_MERGE_REQUEST_IID", "CI_COMMIT_TAG", "GITLAB_TOKEN"} {
+		t.Setenv(v, "")
+	}
+	if p, _, err := helpers.PublisherFromEnvironment(); p != nil || err != nil {
+		t.Error("Expected no publisher outside of CI, got", p, err)
+	}
+
+	t.Setenv("GITHUB_REPOSITORY", "owner/repo")
+	t.Setenv("GITHUB_REF", "refs/pull/421/merge")
+	if p, _, err := helpers.PublisherFromEnvironment(); p != nil || err != nil {
+		t.Error("Expected no publisher for pull requests, got", p, err)
+	}
+	t.Setenv("GITHUB_REF", "refs/tags/v1.0")
+	if p, _, err := helpers.PublisherFromEnvironment(); p != nil || err == nil {
+		t.Error("Expected an error and no publisher without $GITHUB_TOKEN, got", p, err)
+	}
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("GITHUB_SHA", "abc")
+	p, release, err := helpers.PublisherFromEnvironment()
+	if gh, ok := p.(*helpers.GitHubPublisher); !ok || err != nil || gh.Owner != "owner" || gh.Repo != "repo" || release.Tag != "v1.0" || release.Commit != "abc" || release.Prerelease() {
+		t.Errorf("Wrong publisher for GitHub Actions: %+v %+v %v", p, release, err)
+	}
+	t.Setenv("GITHUB_REPOSITORY", "")
+
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_API_V4_URL", "https://gitlab.example.com/api/v4")
+	t.Setenv("CI_PROJECT_PATH", "group/project")
+	t.Setenv("CI_COMMIT_SHA", "def")
+	t.Setenv("CI_COMMIT_MESSAGE", "Fix all the bugs")
+	if p, _, err := helpers.PublisherFromEnvironment(); p != nil || err == nil {
+		t.Error("Expected an error and no publisher without $GITLAB_TOKEN, got", p, err)
+	}
+	t.Setenv("GITLAB_TOKEN", "secret")
+	p, release, err = helpers.PublisherFromEnvironment()
+	if gl, ok := p.(*helpers.GitLabPublisher); !ok || err != nil || gl.Token != "secret" || gl.Project != "group/project" ||
+		release.Tag != "continuous" || release.Notes != "Fix all the bugs" || !release.Prerelease() {
+		t.Errorf("Wrong publisher for GitLab CI: %+v %+v %v", p, release, err)
+	}
+}
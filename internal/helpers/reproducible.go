@@ -0,0 +1,46 @@
+package helpers
+
+// Helpers for reproducible builds, see https://reproducible-builds.org/docs/source-date-epoch/
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SourceDateEpoch returns the time set in $SOURCE_DATE_EPOCH.
+// The boolean is false if the variable is not set
+func SourceDateEpoch() (time.Time, bool, error) {
+	s := os.Getenv("SOURCE_DATE_EPOCH")
+	if s == "" {
+		return time.Unix(0, 0), false, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return time.Unix(0, 0), true, errors.New("SOURCE_DATE_EPOCH must be a non-negative integer, got " + s)
+	}
+	return time.Unix(n, 0), true, nil
+}
+
+// NormalizeSquashfsTree makes the metadata of all entries below root independent of
+// the machine the tree was built on: everything gets owned by root, gets the
+// modification time mtime, and gets 0755 or 0644 permissions depending on whether
+// anyone could execute it. Setuid, setgid and sticky bits get dropped
+func NormalizeSquashfsTree(root *SquashfsEntry, mtime time.Time) {
+	root.UID = 0
+	root.GID = 0
+	root.ModTime = mtime
+	perm := fs.FileMode(0644)
+	switch {
+	case root.Mode&fs.ModeSymlink != 0:
+		perm = 0777
+	case root.Mode.IsDir() || root.Mode&0111 != 0:
+		perm = 0755
+	}
+	root.Mode = root.Mode.Type() | perm
+	for _, c := range root.Children {
+		NormalizeSquashfsTree(c, mtime)
+	}
+}
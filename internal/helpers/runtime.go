@@ -0,0 +1,126 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// RuntimeSums is the name of the file that lists the sha256 digests of the runtimes
+// that are known to be good, in the format of sha256sum
+const RuntimeSums = "SHA256SUMS"
+
+// Runtime is an AppImage type 2 runtime named runtime-<arch>
+type Runtime struct {
+	Arch     string
+	Size     int64
+	SHA256   string // Empty if the runtime is not there
+	Pinned   string // The sha256 digest that the runtime must have, empty if it is not known
+	Embedded bool
+}
+
+// Name returns the file name of the runtime
+func (r Runtime) Name() string {
+	return "runtime-" + r.Arch
+}
+
+// Verify returns an error unless the runtime is there and has the digest that is pinned for it
+func (r Runtime) Verify() error {
+	if !r.Embedded {
+		return errors.New(r.Name() + " is not there")
+	}
+	if r.Pinned == "" {
+		return errors.New("no sha256 digest is pinned for " + r.Name())
+	}
+	if r.SHA256 != r.Pinned {
+		return errors.New(r.Name() + " has the sha256 digest " + r.SHA256 + " rather than the pinned " + r.Pinned)
+	}
+	return nil
+}
+
+// ReadRuntimes returns the runtimes in fsys, and those that have a digest pinned for them
+// in its RuntimeSums file, sorted by architecture
+func ReadRuntimes(fsys fs.FS) ([]Runtime, error) {
+	runtimes := map[string]*Runtime{}
+	f, err := fsys.Open(RuntimeSums)
+	if err == nil {
+		sums, err := ReadRuntimeSums(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for name, sum := range sums {
+			if arch := strings.TrimPrefix(name, "runtime-"); arch != name {
+				runtimes[arch] = &Runtime{Arch: arch, Pinned: sum}
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	names, err := fs.Glob(fsys, "runtime-*")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		arch := strings.TrimPrefix(name, "runtime-")
+		if runtimes[arch] == nil {
+			runtimes[arch] = &Runtime{Arch: arch}
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		runtimes[arch].SHA256, runtimes[arch].Size, err = RuntimeDigest(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		runtimes[arch].Embedded = true
+	}
+
+	var out []Runtime
+	for _, r := range runtimes {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Arch < out[j].Arch })
+	return out, nil
+}
+
+// ReadRuntimeSums reads the digests from r in the format of sha256sum,
+// ignoring empty lines and comments starting with #
+func ReadRuntimeSums(r io.Reader) (map[string]string, error) {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, errors.New("not a sha256sum line: " + line)
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			return nil, errors.New("not a sha256sum line: " + line)
+		}
+		// sha256sum marks files that were read in binary mode with *
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums, scanner.Err()
+}
+
+// RuntimeDigest returns the sha256 digest of r in hex, and its size
+func RuntimeDigest(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadRuntimes(t *testing.T) {
+	digest := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	fsys := fstest.MapFS{
+		"runtime-x86_64":  {Data: []byte("x86_64")},
+		"runtime-aarch64": {Data: []byte("tampered")},
+		"runtime-armhf":   {Data: []byte("armhf")},
+		RuntimeSums: {Data: []byte("# Pinned runtimes\n\n" +
+			digest("x86_64") + "  runtime-x86_64\n" +
+			digest("aarch64") + " *runtime-aarch64\n" +
+			strings.ToUpper(digest("i686")) + "  runtime-i686\n")},
+	}
+	runtimes, err := ReadRuntimes(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archs []string
+	for _, r := range runtimes {
+		archs = append(archs, r.Arch)
+	}
+	if strings.Join(archs, " ") != "aarch64 armhf i686 x86_64" {
+		t.Fatal("Expected the runtimes that are there or pinned, sorted, got", archs)
+	}
+	if r := runtimes[3]; r.Verify() != nil || r.Size != 6 || r.Name() != "runtime-x86_64" {
+		t.Error("Expected runtime-x86_64 to have the pinned digest:", r.Verify(), r)
+	}
+	for _, r := range runtimes[:3] {
+		if err := r.Verify(); err == nil {
+			t.Error("Expected", r.Name(), "not to be verified")
+		}
+	}
+	if runtimes[2].Embedded || runtimes[2].Pinned != digest("i686") {
+		t.Error("Expected runtime-i686 to be pinned but not there:", runtimes[2])
+	}
+
+	fsys[RuntimeSums] = &fstest.MapFile{Data: []byte("abc runtime-x86_64\n")}
+	if _, err := ReadRuntimes(fsys); err == nil {
+		t.Error("Expected an error for a line that is not in the format of sha256sum")
+	}
+}
@@ -0,0 +1,778 @@
+package helpers
+
+// Native squashfs 4.0 writer so that we do not need to shell out to mksquashfs
+// (which needs to be recent enough for -offset) when building AppImages.
+// The on-disk format is documented at
+// https://dr-emann.github.io/squashfs/squashfs.html
+// TODO: Deduplicate identical files, support xattrs and hard links
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	squashfsMagic            = 0x73717368
+	squashfsMetadataSize     = 8192
+	squashfsMetadataNoComp   = 0x8000
+	squashfsDataNoComp       = 1 << 24
+	squashfsNoXattrs         = 0x200
+	squashfsInvalid          = 0xFFFFFFFFFFFFFFFF
+	squashfsNoFragment       = 0xFFFFFFFF
+	squashfsDirHeaderMax     = 256
+	squashfsFragsPerBlock    = squashfsMetadataSize / 16
+	squashfsIdsPerBlock      = squashfsMetadataSize / 4
+	SquashfsDefaultBlockSize = 1024 * 1024
+)
+
+// Inode types as used in the inode table (basic types are also used in directory entries)
+const (
+	squashfsDirType = iota + 1
+	squashfsFileType
+	squashfsSymlinkType
+	squashfsBlockDevType
+	squashfsCharDevType
+	squashfsFifoType
+	squashfsSocketType
+	squashfsLDirType
+	squashfsLFileType
+)
+
+// SquashfsCompressors maps the compression names understood by mksquashfs -comp
+// to the compression ids stored in the squashfs superblock
+var SquashfsCompressors = map[string]uint16{
+	"gzip": 1,
+	"xz":   4,
+	"zstd": 6,
+}
+
+// SquashfsOptions controls how a squashfs image is written
+type SquashfsOptions struct {
+	Compression string    // One of the keys of SquashfsCompressors, defaults to zstd
+	BlockSize   int       // Power of two between 4 KiB and 1 MiB, defaults to 1 MiB
+	FSTime      time.Time // Stored as the filesystem creation time in the superblock
+	RootOwned   bool      // Make all files owned by root, like mksquashfs -root-owned
+	// Reproducible normalizes ownership, permissions and modification times of all
+	// files with NormalizeSquashfsTree, using FSTime as the modification time
+	Reproducible bool
+}
+
+// SquashfsEntry is a node of the file tree that gets written into a squashfs image.
+// Mode carries the file type bits (fs.ModeDir, fs.ModeSymlink, ...) in addition to the permissions
+type SquashfsEntry struct {
+	Name     string
+	Mode     fs.FileMode
+	UID      uint32
+	GID      uint32
+	ModTime  time.Time
+	Size     int64                         // Regular files only
+	Open     func() (io.ReadCloser, error) // Regular files only
+	Target   string                        // Symlinks only
+	Rdev     uint32                        // Device nodes only, in the kernel's new encoding
+	Children []*SquashfsEntry              // Directories only
+
+	inodeNumber uint32
+	inodeRef    uint64
+}
+
+// Child returns the direct child with the given name, or nil
+func (e *SquashfsEntry) Child(name string) *SquashfsEntry {
+	for _, c := range e.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// SquashfsTreeFromDir builds a SquashfsEntry tree from the directory dir on disk.
+// The contents of regular files are only read when the image is written
+func SquashfsTreeFromDir(dir string) (*SquashfsEntry, error) {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(dir + " is not a directory")
+	}
+	return squashfsEntryFromFileInfo(dir, info)
+}
+
+func squashfsEntryFromFileInfo(path string, info fs.FileInfo) (*SquashfsEntry, error) {
+	e := &SquashfsEntry{
+		Name:    info.Name(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		e.UID = st.Uid
+		e.GID = st.Gid
+		e.Rdev = squashfsEncodeDev(uint64(st.Rdev))
+	}
+	switch {
+	case info.IsDir():
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, de := range entries {
+			ci, err := de.Info()
+			if err != nil {
+				return nil, err
+			}
+			c, err := squashfsEntryFromFileInfo(filepath.Join(path, de.Name()), ci)
+			if err != nil {
+				return nil, err
+			}
+			e.Children = append(e.Children, c)
+		}
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		e.Target = target
+	case info.Mode().IsRegular():
+		e.Size = info.Size()
+		e.Open = func() (io.ReadCloser, error) { return os.Open(path) }
+	}
+	return e, nil
+}
+
+// squashfsEncodeDev converts a Linux dev_t into the encoding used by squashfs
+func squashfsEncodeDev(dev uint64) uint32 {
+	major := uint32((dev >> 8) & 0xfff)
+	minor := uint32((dev & 0xff) | ((dev >> 12) & 0xfff00))
+	return (minor & 0xff) | (major << 8) | ((minor &^ 0xff) << 12)
+}
+
+// MakeSquashfs writes the contents of srcDir as a squashfs image into target,
+// starting at offset so that a runtime can be put in front of it later.
+// target is truncated, which corresponds to mksquashfs -noappend
+func MakeSquashfs(srcDir string, target string, offset int64, opts SquashfsOptions) error {
+	root, err := SquashfsTreeFromDir(srcDir)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	_, err = WriteSquashfs(f, offset, root, opts)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteSquashfs writes the tree below root as a squashfs image into w at offset.
+// Returns the size of the image including the padding to 4 KiB
+func WriteSquashfs(w io.WriterAt, offset int64, root *SquashfsEntry, opts SquashfsOptions) (int64, error) {
+	if opts.Compression == "" {
+		opts.Compression = "zstd"
+	}
+	if opts.BlockSize == 0 {
+		opts.BlockSize = SquashfsDefaultBlockSize
+	}
+	if opts.BlockSize < 4096 || opts.BlockSize > SquashfsDefaultBlockSize || opts.BlockSize&(opts.BlockSize-1) != 0 {
+		return 0, fmt.Errorf("invalid squashfs block size %d", opts.BlockSize)
+	}
+	if !root.Mode.IsDir() {
+		return 0, errors.New("the root of a squashfs image needs to be a directory")
+	}
+	if opts.Reproducible {
+		NormalizeSquashfsTree(root, opts.FSTime)
+	}
+	c, err := newSquashfsCompressor(opts.Compression, opts.BlockSize)
+	if err != nil {
+		return 0, err
+	}
+	sw := &squashfsWriter{
+		w:      w,
+		offset: offset,
+		pos:    96, // The superblock gets written last
+		opts:   opts,
+		comp:   c,
+		ids:    map[uint32]uint16{},
+	}
+	sw.inodes.comp = c
+	sw.dirs.comp = c
+	return sw.write(root)
+}
+
+// ReadSquashfsOptions reads the compression, block size and filesystem time from the
+// superblock of the squashfs image at offset in r, e.g., to rebuild it with the same settings
+func ReadSquashfsOptions(r io.ReaderAt, offset int64) (SquashfsOptions, error) {
+	var sb [96]byte
+	if _, err := r.ReadAt(sb[:], offset); err != nil {
+		return SquashfsOptions{}, err
+	}
+	if binary.LittleEndian.Uint32(sb[0:]) != squashfsMagic {
+		return SquashfsOptions{}, errors.New("no squashfs superblock found")
+	}
+	opts := SquashfsOptions{
+		FSTime:    time.Unix(int64(binary.LittleEndian.Uint32(sb[8:])), 0),
+		BlockSize: int(binary.LittleEndian.Uint32(sb[12:])),
+		RootOwned: true,
+	}
+	comp := binary.LittleEndian.Uint16(sb[20:])
+	for name, id := range SquashfsCompressors {
+		if id == comp {
+			opts.Compression = name
+		}
+	}
+	if opts.Compression == "" {
+		return opts, fmt.Errorf("unsupported squashfs compression id %d", comp)
+	}
+	return opts, nil
+}
+
+type squashfsCompressor interface {
+	compress(in []byte) ([]byte, error)
+}
+
+type squashfsZstd struct{ enc *zstd.Encoder }
+
+func (z squashfsZstd) compress(in []byte) ([]byte, error) {
+	return z.enc.EncodeAll(in, nil), nil
+}
+
+type squashfsXz struct{ blockSize int }
+
+func (x squashfsXz) compress(in []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	// The kernel only knows about CRC32 and the dictionary must not be larger than the block size
+	cfg := xz.WriterConfig{DictCap: x.blockSize, CheckSum: xz.CRC32}
+	xw, err := cfg.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = xw.Write(in); err != nil {
+		return nil, err
+	}
+	if err = xw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type squashfsGzip struct{}
+
+func (squashfsGzip) compress(in []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(in); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newSquashfsCompressor(name string, blockSize int) (squashfsCompressor, error) {
+	switch name {
+	case "zstd":
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression), zstd.WithEncoderCRC(false))
+		if err != nil {
+			return nil, err
+		}
+		return squashfsZstd{enc}, nil
+	case "xz":
+		return squashfsXz{blockSize}, nil
+	case "gzip":
+		return squashfsGzip{}, nil
+	}
+	return nil, errors.New("unsupported squashfs compression: " + name + " (supported are zstd, xz, gzip)")
+}
+
+// squashfsMetadata collects metadata (inodes, directory listings, ...) and
+// splits it into compressed 8 KiB blocks
+type squashfsMetadata struct {
+	comp    squashfsCompressor
+	out     bytes.Buffer
+	pending []byte
+}
+
+// position returns the location of the next byte written, as the start of
+// its metadata block relative to the table and the offset inside of the block
+func (m *squashfsMetadata) position() (uint32, uint16) {
+	return uint32(m.out.Len()), uint16(len(m.pending))
+}
+
+func (m *squashfsMetadata) write(b []byte) error {
+	m.pending = append(m.pending, b...)
+	for len(m.pending) >= squashfsMetadataSize {
+		if err := m.flush(squashfsMetadataSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *squashfsMetadata) flush(n int) error {
+	block := m.pending[:n]
+	c, err := m.comp.compress(block)
+	if err != nil {
+		return err
+	}
+	if len(c) < len(block) {
+		binary.Write(&m.out, binary.LittleEndian, uint16(len(c)))
+		m.out.Write(c)
+	} else {
+		binary.Write(&m.out, binary.LittleEndian, uint16(len(block))|squashfsMetadataNoComp)
+		m.out.Write(block)
+	}
+	m.pending = append([]byte{}, m.pending[n:]...)
+	return nil
+}
+
+// finish flushes the last, possibly short, block and returns the whole table
+func (m *squashfsMetadata) finish() ([]byte, error) {
+	if len(m.pending) > 0 {
+		if err := m.flush(len(m.pending)); err != nil {
+			return nil, err
+		}
+	}
+	return m.out.Bytes(), nil
+}
+
+type squashfsWriter struct {
+	w      io.WriterAt
+	offset int64
+	pos    int64 // Relative to the start of the squashfs image
+	opts   SquashfsOptions
+	comp   squashfsCompressor
+
+	inodes     squashfsMetadata
+	dirs       squashfsMetadata
+	inodeCount uint32
+
+	fragments []byte // Fragment table entries
+	fragCount uint32
+	fragBuf   []byte
+
+	ids     map[uint32]uint16
+	idOrder []uint32
+}
+
+func (sw *squashfsWriter) writeRaw(b []byte) error {
+	_, err := sw.w.WriteAt(b, sw.offset+sw.pos)
+	sw.pos += int64(len(b))
+	return err
+}
+
+func (sw *squashfsWriter) write(root *SquashfsEntry) (int64, error) {
+	// Number the inodes so that the entries of every directory get consecutive numbers
+	// and the root directory gets the highest one, like mksquashfs does
+	sw.numberChildren(root)
+	sw.inodeCount++
+	root.inodeNumber = sw.inodeCount
+
+	if err := sw.writeDir(root, sw.inodeCount+1); err != nil {
+		return 0, err
+	}
+	if err := sw.flushFragment(); err != nil {
+		return 0, err
+	}
+
+	inodeTable, err := sw.inodes.finish()
+	if err != nil {
+		return 0, err
+	}
+	inodeTableStart := sw.pos
+	if err = sw.writeRaw(inodeTable); err != nil {
+		return 0, err
+	}
+	dirTable, err := sw.dirs.finish()
+	if err != nil {
+		return 0, err
+	}
+	dirTableStart := sw.pos
+	if err = sw.writeRaw(dirTable); err != nil {
+		return 0, err
+	}
+	fragTableStart, err := sw.writeLookupTable(sw.fragments, squashfsFragsPerBlock*16)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]byte, 4*len(sw.idOrder))
+	for i, id := range sw.idOrder {
+		binary.LittleEndian.PutUint32(ids[4*i:], id)
+	}
+	idTableStart, err := sw.writeLookupTable(ids, squashfsIdsPerBlock*4)
+	if err != nil {
+		return 0, err
+	}
+	bytesUsed := sw.pos
+
+	// Pad to 4 KiB like mksquashfs does, so that the image can be used with loop devices
+	if pad := bytesUsed % 4096; pad != 0 {
+		if err = sw.writeRaw(make([]byte, 4096-pad)); err != nil {
+			return 0, err
+		}
+	}
+
+	sb := struct {
+		Magic, InodeCount, ModTime, BlockSize, FragCount       uint32
+		CompType, BlockLog, Flags, IdCount, VerMaj, VerMin     uint16
+		RootInodeRef, BytesUsed, IdTableStart, XattrTableStart uint64
+		InodeTableStart, DirTableStart, FragTableStart         uint64
+		ExportTableStart                                       uint64
+	}{
+		Magic:            squashfsMagic,
+		InodeCount:       sw.inodeCount,
+		ModTime:          uint32(sw.opts.FSTime.Unix()),
+		BlockSize:        uint32(sw.opts.BlockSize),
+		FragCount:        sw.fragCount,
+		CompType:         SquashfsCompressors[sw.opts.Compression],
+		BlockLog:         uint16(math.Log2(float64(sw.opts.BlockSize))),
+		Flags:            squashfsNoXattrs,
+		IdCount:          uint16(len(sw.idOrder)),
+		VerMaj:           4,
+		VerMin:           0,
+		RootInodeRef:     root.inodeRef,
+		BytesUsed:        uint64(bytesUsed),
+		IdTableStart:     uint64(idTableStart),
+		XattrTableStart:  squashfsInvalid,
+		InodeTableStart:  uint64(inodeTableStart),
+		DirTableStart:    uint64(dirTableStart),
+		FragTableStart:   uint64(fragTableStart),
+		ExportTableStart: squashfsInvalid,
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, sb)
+	if _, err = sw.w.WriteAt(buf.Bytes(), sw.offset); err != nil {
+		return 0, err
+	}
+	return sw.pos, nil
+}
+
+// writeLookupTable writes data as metadata blocks followed by the list of
+// their locations, which is what the superblock points to
+func (sw *squashfsWriter) writeLookupTable(data []byte, perBlock int) (int64, error) {
+	var lookup []byte
+	for i := 0; i < len(data); i += perBlock {
+		end := i + perBlock
+		if end > len(data) {
+			end = len(data)
+		}
+		m := squashfsMetadata{comp: sw.comp}
+		m.write(data[i:end])
+		block, err := m.finish()
+		if err != nil {
+			return 0, err
+		}
+		lookup = binary.LittleEndian.AppendUint64(lookup, uint64(sw.pos))
+		if err = sw.writeRaw(block); err != nil {
+			return 0, err
+		}
+	}
+	start := sw.pos
+	return start, sw.writeRaw(lookup)
+}
+
+func sortedSquashfsChildren(e *SquashfsEntry) []*SquashfsEntry {
+	children := append([]*SquashfsEntry{}, e.Children...)
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return children
+}
+
+func (sw *squashfsWriter) numberChildren(dir *SquashfsEntry) {
+	children := sortedSquashfsChildren(dir)
+	for _, c := range children {
+		if c.Mode.IsDir() {
+			sw.numberChildren(c)
+		}
+	}
+	for _, c := range children {
+		sw.inodeCount++
+		c.inodeNumber = sw.inodeCount
+	}
+}
+
+func (sw *squashfsWriter) id(id uint32) uint16 {
+	if sw.opts.RootOwned {
+		id = 0
+	}
+	if i, ok := sw.ids[id]; ok {
+		return i
+	}
+	i := uint16(len(sw.idOrder))
+	sw.ids[id] = i
+	sw.idOrder = append(sw.idOrder, id)
+	return i
+}
+
+func squashfsPermissions(m fs.FileMode) uint16 {
+	p := uint16(m.Perm())
+	if m&fs.ModeSetuid != 0 {
+		p |= 04000
+	}
+	if m&fs.ModeSetgid != 0 {
+		p |= 02000
+	}
+	if m&fs.ModeSticky != 0 {
+		p |= 01000
+	}
+	return p
+}
+
+// writeInode appends an inode with the given type and body to the inode table
+// and remembers where it was written
+func (sw *squashfsWriter) writeInode(e *SquashfsEntry, inodeType uint16, body []byte) error {
+	block, off := sw.inodes.position()
+	e.inodeRef = uint64(block)<<16 | uint64(off)
+	var hdr [16]byte
+	binary.LittleEndian.PutUint16(hdr[0:], inodeType)
+	binary.LittleEndian.PutUint16(hdr[2:], squashfsPermissions(e.Mode))
+	binary.LittleEndian.PutUint16(hdr[4:], sw.id(e.UID))
+	binary.LittleEndian.PutUint16(hdr[6:], sw.id(e.GID))
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(e.ModTime.Unix()))
+	binary.LittleEndian.PutUint32(hdr[12:], e.inodeNumber)
+	if err := sw.inodes.write(hdr[:]); err != nil {
+		return err
+	}
+	return sw.inodes.write(body)
+}
+
+// basicType returns the inode type used for e in directory entries
+func basicType(e *SquashfsEntry) uint16 {
+	switch m := e.Mode; {
+	case m.IsDir():
+		return squashfsDirType
+	case m&fs.ModeSymlink != 0:
+		return squashfsSymlinkType
+	case m&fs.ModeDevice != 0 && m&fs.ModeCharDevice != 0:
+		return squashfsCharDevType
+	case m&fs.ModeDevice != 0:
+		return squashfsBlockDevType
+	case m&fs.ModeNamedPipe != 0:
+		return squashfsFifoType
+	case m&fs.ModeSocket != 0:
+		return squashfsSocketType
+	}
+	return squashfsFileType
+}
+
+func (sw *squashfsWriter) writeDir(dir *SquashfsEntry, parent uint32) error {
+	children := sortedSquashfsChildren(dir)
+	subdirs := uint32(0)
+	for _, c := range children {
+		var err error
+		switch basicType(c) {
+		case squashfsDirType:
+			subdirs++
+			err = sw.writeDir(c, dir.inodeNumber)
+		case squashfsFileType:
+			err = sw.writeFile(c)
+		case squashfsSymlinkType:
+			body := binary.LittleEndian.AppendUint32(nil, 1)
+			body = binary.LittleEndian.AppendUint32(body, uint32(len(c.Target)))
+			err = sw.writeInode(c, squashfsSymlinkType, append(body, c.Target...))
+		case squashfsBlockDevType, squashfsCharDevType:
+			body := binary.LittleEndian.AppendUint32(nil, 1)
+			err = sw.writeInode(c, basicType(c), binary.LittleEndian.AppendUint32(body, c.Rdev))
+		default:
+			err = sw.writeInode(c, basicType(c), binary.LittleEndian.AppendUint32(nil, 1))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Directory listing: a header followed by up to 256 entries which all
+	// have their inodes in the same metadata block
+	var listing []byte
+	var hdrStart uint32
+	var hdrBase uint32
+	hdrPos, count := -1, 0
+	for _, c := range children {
+		if len(c.Name) == 0 || len(c.Name) > 256 {
+			return errors.New("invalid file name length: " + c.Name)
+		}
+		start := uint32(c.inodeRef >> 16)
+		diff := int64(c.inodeNumber) - int64(hdrBase)
+		if hdrPos < 0 || count == squashfsDirHeaderMax || start != hdrStart || diff < math.MinInt16 || diff > math.MaxInt16 {
+			hdrPos = len(listing)
+			count = 0
+			hdrStart = start
+			hdrBase = c.inodeNumber
+			diff = 0
+			listing = append(listing, make([]byte, 12)...)
+			binary.LittleEndian.PutUint32(listing[hdrPos+4:], hdrStart)
+			binary.LittleEndian.PutUint32(listing[hdrPos+8:], hdrBase)
+		}
+		count++
+		binary.LittleEndian.PutUint32(listing[hdrPos:], uint32(count-1))
+		listing = binary.LittleEndian.AppendUint16(listing, uint16(c.inodeRef&0xFFFF))
+		listing = binary.LittleEndian.AppendUint16(listing, uint16(int16(diff)))
+		listing = binary.LittleEndian.AppendUint16(listing, basicType(c))
+		listing = binary.LittleEndian.AppendUint16(listing, uint16(len(c.Name)-1))
+		listing = append(listing, c.Name...)
+	}
+	block, off := sw.dirs.position()
+	if err := sw.dirs.write(listing); err != nil {
+		return err
+	}
+
+	// The size includes 3 bytes for the "." and ".." entries that are not actually stored
+	size := uint32(len(listing) + 3)
+	if size <= math.MaxUint16 {
+		body := binary.LittleEndian.AppendUint32(nil, block)
+		body = binary.LittleEndian.AppendUint32(body, 2+subdirs)
+		body = binary.LittleEndian.AppendUint16(body, uint16(size))
+		body = binary.LittleEndian.AppendUint16(body, off)
+		body = binary.LittleEndian.AppendUint32(body, parent)
+		return sw.writeInode(dir, squashfsDirType, body)
+	}
+	body := binary.LittleEndian.AppendUint32(nil, 2+subdirs)
+	body = binary.LittleEndian.AppendUint32(body, size)
+	body = binary.LittleEndian.AppendUint32(body, block)
+	body = binary.LittleEndian.AppendUint32(body, parent)
+	body = binary.LittleEndian.AppendUint16(body, 0) // No directory index
+	body = binary.LittleEndian.AppendUint16(body, off)
+	body = binary.LittleEndian.AppendUint32(body, squashfsNoFragment) // No xattrs
+	return sw.writeInode(dir, squashfsLDirType, body)
+}
+
+func (sw *squashfsWriter) writeFile(e *SquashfsEntry) error {
+	blocksStart := sw.pos
+	var blockSizes []uint32
+	var sparse uint64
+	fragIndex, fragOffset := uint32(squashfsNoFragment), uint32(0)
+	var size int64
+
+	if e.Size > 0 {
+		r, err := e.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		buf := make([]byte, sw.opts.BlockSize)
+		for {
+			n, err := io.ReadFull(r, buf)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			size += int64(n)
+			if len(blockSizes) == 0 && n < sw.opts.BlockSize {
+				// Small files go into a fragment block that is shared with other small files
+				fragIndex, fragOffset, err = sw.addFragment(buf[:n])
+				if err != nil {
+					return err
+				}
+				break
+			}
+			if isZero(buf[:n]) {
+				blockSizes = append(blockSizes, 0)
+				sparse += uint64(n)
+			} else {
+				s, err := sw.writeDataBlock(buf[:n])
+				if err != nil {
+					return err
+				}
+				blockSizes = append(blockSizes, s)
+			}
+			if n < sw.opts.BlockSize {
+				break
+			}
+		}
+		if size != e.Size {
+			return fmt.Errorf("size of %s changed while writing the squashfs image", e.Name)
+		}
+	}
+
+	inodeType := uint16(squashfsFileType)
+	var body []byte
+	if blocksStart > math.MaxUint32 || size > math.MaxUint32 || sparse > 0 {
+		inodeType = squashfsLFileType
+		body = binary.LittleEndian.AppendUint64(nil, uint64(blocksStart))
+		body = binary.LittleEndian.AppendUint64(body, uint64(size))
+		body = binary.LittleEndian.AppendUint64(body, sparse)
+		body = binary.LittleEndian.AppendUint32(body, 1)
+		body = binary.LittleEndian.AppendUint32(body, fragIndex)
+		body = binary.LittleEndian.AppendUint32(body, fragOffset)
+		body = binary.LittleEndian.AppendUint32(body, squashfsNoFragment) // No xattrs
+	} else {
+		body = binary.LittleEndian.AppendUint32(nil, uint32(blocksStart))
+		body = binary.LittleEndian.AppendUint32(body, fragIndex)
+		body = binary.LittleEndian.AppendUint32(body, fragOffset)
+		body = binary.LittleEndian.AppendUint32(body, uint32(size))
+	}
+	for _, s := range blockSizes {
+		body = binary.LittleEndian.AppendUint32(body, s)
+	}
+	return sw.writeInode(e, inodeType, body)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeDataBlock compresses and writes a data block, returning its size
+// as stored in the block list of the inode
+func (sw *squashfsWriter) writeDataBlock(b []byte) (uint32, error) {
+	c, err := sw.comp.compress(b)
+	if err != nil {
+		return 0, err
+	}
+	if len(c) < len(b) {
+		return uint32(len(c)), sw.writeRaw(c)
+	}
+	return uint32(len(b)) | squashfsDataNoComp, sw.writeRaw(b)
+}
+
+func (sw *squashfsWriter) addFragment(b []byte) (uint32, uint32, error) {
+	if len(sw.fragBuf)+len(b) > sw.opts.BlockSize {
+		if err := sw.flushFragment(); err != nil {
+			return 0, 0, err
+		}
+	}
+	off := uint32(len(sw.fragBuf))
+	sw.fragBuf = append(sw.fragBuf, b...)
+	return sw.fragCount, off, nil
+}
+
+func (sw *squashfsWriter) flushFragment() error {
+	if len(sw.fragBuf) == 0 {
+		return nil
+	}
+	start := sw.pos
+	s, err := sw.writeDataBlock(sw.fragBuf)
+	if err != nil {
+		return err
+	}
+	sw.fragments = binary.LittleEndian.AppendUint64(sw.fragments, uint64(start))
+	sw.fragments = binary.LittleEndian.AppendUint32(sw.fragments, s)
+	sw.fragments = binary.LittleEndian.AppendUint32(sw.fragments, 0)
+	sw.fragCount++
+	sw.fragBuf = sw.fragBuf[:0]
+	return nil
+}
@@ -0,0 +1,139 @@
+package helpers_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CalebQ42/squashfs"
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+func TestMakeSquashfs(t *testing.T) {
+	src := t.TempDir()
+	big := bytes.Repeat([]byte("0123456789abcdef"), 5000) // Larger than the block size used below, not a multiple of it
+	sparse := append(make([]byte, 3*4096), []byte("end")...)
+	files := map[string][]byte{
+		"AppRun":                 []byte("#!/bin/sh\necho hello\n"),
+		"usr/bin/app":            big,
+		"usr/lib/sparse":         sparse,
+		"usr/share/empty":        {},
+		"usr/share/doc/app/copy": []byte("MIT"),
+	}
+	for name, content := range files {
+		p := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, content, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Enough entries to need several directory headers and an extended directory inode
+	many := filepath.Join(src, "usr/share/many")
+	os.MkdirAll(many, 0755)
+	for i := 0; i < 3000; i++ {
+		name := fmt.Sprintf("file-with-a-long-name-%04d", i)
+		if i%1000 == 999 {
+			files["usr/share/many/"+name] = []byte(name)
+		}
+		if err := os.WriteFile(filepath.Join(many, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("usr/bin/app", filepath.Join(src, "app")); err != nil {
+		t.Fatal(err)
+	}
+
+	fstime := time.Unix(1600000000, 0)
+	for comp := range helpers.SquashfsCompressors {
+		target := filepath.Join(t.TempDir(), "test.squashfs")
+		const offset = 1234
+		err := helpers.MakeSquashfs(src, target, offset, helpers.SquashfsOptions{
+			Compression: comp,
+			BlockSize:   4096,
+			FSTime:      fstime,
+			RootOwned:   true,
+		})
+		if err != nil {
+			t.Fatal(comp, err)
+		}
+		f, err := os.Open(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		rdr, err := squashfs.NewReaderAtOffset(f, offset)
+		if err != nil {
+			t.Fatal(comp, err)
+		}
+		if !rdr.ModTime().Equal(fstime) {
+			t.Error(comp, "wrong fstime", rdr.ModTime())
+		}
+		for name, content := range files {
+			got, err := rdr.ReadFile(name)
+			if err != nil {
+				t.Fatal(comp, name, err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Error(comp, "content mismatch for", name)
+			}
+		}
+		entries, err := rdr.ReadDir("usr/share/many")
+		if err != nil || len(entries) != 3000 {
+			t.Error(comp, "could not list large directory", len(entries), err)
+		}
+		info, err := rdr.Stat("AppRun")
+		if err != nil || info.Mode().Perm() != 0755 {
+			t.Error(comp, "wrong permissions for AppRun", err)
+		}
+		sym, err := rdr.Open("app")
+		if err != nil {
+			t.Fatal(comp, err)
+		}
+		if sym.(*squashfs.File).SymlinkPath() != "usr/bin/app" {
+			t.Error(comp, "wrong symlink target")
+		}
+		err = fs.WalkDir(rdr, ".", func(path string, d fs.DirEntry, err error) error {
+			return err
+		})
+		if err != nil {
+			t.Error(comp, err)
+		}
+		st, _ := f.Stat()
+		if (st.Size()-offset)%4096 != 0 {
+			t.Error(comp, "image is not padded to 4 KiB")
+		}
+	}
+}
+
+func TestMakeSquashfsReproducible(t *testing.T) {
+	var images [][]byte
+	for i, perm := range []os.FileMode{0700, 0755} {
+		src := t.TempDir()
+		os.MkdirAll(filepath.Join(src, "usr/bin"), 0755)
+		p := filepath.Join(src, "usr/bin/app")
+		if err := os.WriteFile(p, []byte("binary"), perm); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, time.Now(), time.Unix(int64(i), 0))
+		target := filepath.Join(t.TempDir(), "test.squashfs")
+		err := helpers.MakeSquashfs(src, target, 0, helpers.SquashfsOptions{
+			FSTime:       time.Unix(1600000000, 0),
+			RootOwned:    true,
+			Reproducible: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := os.ReadFile(target)
+		images = append(images, b)
+	}
+	if !bytes.Equal(images[0], images[1]) {
+		t.Error("Reproducible builds differ")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"debug/elf"
 	"errors"
 	"net/url"
+	"os"
 	"strings"
 )
 
@@ -28,11 +29,12 @@ import (
 
 // Please note that pre-releases are not being considered when using "latest".
 // You will have to explicitly provide the name of a release.
-// When using e.g., uploadtool, the name of the release created will
+// When appimagetool publishes builds of a branch, the name of the release created will
 // always be "continuous",
 // hence, you can just specify that value instead of "latest".
 type UpdateInformation struct {
 	transportmechanism string
+	fields             []string // Everything after the transport mechanism
 	fileurl            string
 	username           string
 	repository         string
@@ -56,33 +58,37 @@ func NewUpdateInformationFromString(updateinformation string) (UpdateInformation
 	}
 
 	ui.transportmechanism = parts[0]
+	ui.fields = parts[1:]
 	if ui.transportmechanism == "zsync" {
-		if len(parts) < 2 {
-			return ui, errors.New("Update information isn't valid")
-		}
 		ui.fileurl = parts[1]
 	} else if ui.transportmechanism == "gh-releases-zsync" {
-		if len(parts) < 5 {
-			return ui, errors.New("Update information isn't valid")
-		}
 		ui.username = parts[1]
 		ui.repository = parts[2]
 		ui.releasename = parts[3]
 		ui.filename = parts[4]
 	} else if ui.transportmechanism == "bintray-zsync" {
-		if len(parts) < 5 {
-			return ui, errors.New("Update information isn't valid")
-		}
 		ui.username = parts[1]
 		ui.repository = parts[2]
 		ui.packagename = parts[3]
 		ui.filename = parts[4] // a.k.a. "zsync path"
-	} else {
-		return ui, errors.New("The transport mechanism in update information is not yet implemented")
 	}
 	return ui, nil
 }
 
+// TransportMechanism returns the transport mechanism, e.g., "gh-releases-zsync"
+func (ui UpdateInformation) TransportMechanism() string {
+	return ui.transportmechanism
+}
+
+// Fields returns the fields of the update information that follow the transport mechanism
+func (ui UpdateInformation) Fields() []string {
+	return ui.fields
+}
+
+func (ui UpdateInformation) String() string {
+	return strings.Join(append([]string{ui.transportmechanism}, ui.fields...), "|")
+}
+
 // ValidateUpdateInformation validates an updateinformation string,
 // returns error.
 // TODO: Build this into NewUpdateInformationFromString and get rid of it?
@@ -91,16 +97,10 @@ func ValidateUpdateInformation(updateinformation string) error {
 	if len(parts) < 2 {
 		return errors.New("Update information isn't valid")
 	}
-	// Check for allowed transport mechanisms,
+	// Check for registered transport mechanisms,
 	// https://github.com/AppImage/AppImageSpec/blob/master/draft.md#update-information
-	transportMechanisms := []string{"zsync", "bintray-zsync", "gh-releases-zsync"}
-	detectedTm := ""
-	for _, tm := range transportMechanisms {
-		if parts[0] != tm {
-			detectedTm = tm
-		}
-	}
-	if detectedTm == "" {
+	transport, ok := updateTransports[parts[0]]
+	if !ok {
 		return errors.New("Invalid transport mechanism in update information")
 	}
 
@@ -111,14 +111,11 @@ func ValidateUpdateInformation(updateinformation string) error {
 	if err != nil {
 		return errors.New("Cannot parse URL in update information")
 	}
-	if detectedTm == "zsync" && u.Scheme == "" { // FIXME: This apparently never triggers, why?
-		return errors.New("Scheme is missing in update information, zsync needs e.,g,. http:// or https://")
-	}
 	if strings.HasSuffix(u.Path, ".zsync") == false {
 		return errors.New("Update information '" + updateinformation + "' does not end in .zsync")
 	}
 
-	return nil
+	return transport.Validate(parts[1:])
 }
 
 func getChangelogHeadlineForUpdateInformation(updateinformation string) string {
@@ -151,3 +148,27 @@ func ReadUpdateInfo(appImagePath string) (string, error) {
 
 	return updInfoStr, nil
 }
+
+// ReadType1UpdateInfo reads the update information of a type 1 AppImage, which is stored
+// in the application use area of the ISO 9660 primary volume descriptor, see
+// https://github.com/AppImage/AppImageSpec/blob/master/draft.md#type-1-image-format
+func ReadType1UpdateInfo(appImagePath string) (string, error) {
+	f, err := os.Open(appImagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data := make([]byte, 512)
+	if _, err = f.ReadAt(data, 33651); err != nil {
+		return "", errors.New("unable to read update information from the ISO 9660 header")
+	}
+	str_end := bytes.IndexByte(data, 0)
+	if str_end == -1 {
+		str_end = len(data)
+	}
+	updInfoStr := strings.TrimSpace(string(data[:str_end]))
+	if updInfoStr == "" {
+		return "", errors.New("no update information found")
+	}
+	return updInfoStr, nil
+}
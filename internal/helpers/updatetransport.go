@@ -0,0 +1,353 @@
+package helpers
+
+// Update transports know how to find the most recent release for a transport mechanism
+// of the update information (the part before the first "|"), how to get its .zsync file,
+// and how to get its changelog. New transport mechanisms can be added with RegisterUpdateTransport.
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// UpdateTransport resolves update information of one transport mechanism
+type UpdateTransport interface {
+	// Validate checks the fields of the update information that follow the transport mechanism
+	Validate(fields []string) error
+	// ResolveLatest finds the most recent release
+	ResolveLatest(ui UpdateInformation) (UpdateRelease, error)
+	// FetchZsync downloads and parses the .zsync file of the release
+	FetchZsync(ui UpdateInformation, rel UpdateRelease) (*ZsyncControl, error)
+	// Changelog returns the release notes of the release, or ErrNoChangelog
+	Changelog(ui UpdateInformation, rel UpdateRelease) (string, error)
+}
+
+// UpdateRelease is a release found by an UpdateTransport
+type UpdateRelease struct {
+	Name       string // Name or tag of the release, or file name if there is nothing better
+	ReleaseURL string // Web page of the release, if there is one
+	ZsyncURL   string
+	changelog  string
+	assets     map[string]string  // File names of the release to their URLs
+	authorize  func(*http.Request) // Adds credentials to requests, if needed
+}
+
+// ErrNoChangelog is returned by UpdateTransport.Changelog if there is no changelog
+var ErrNoChangelog = errors.New("no changelog available for this transport mechanism")
+
+var updateTransports = map[string]UpdateTransport{}
+
+// RegisterUpdateTransport registers the UpdateTransport for a transport mechanism
+func RegisterUpdateTransport(transportmechanism string, t UpdateTransport) {
+	updateTransports[transportmechanism] = t
+}
+
+func init() {
+	RegisterUpdateTransport("zsync", zsyncTransport{})
+	RegisterUpdateTransport("gh-releases-zsync", gitHubTransport{})
+	RegisterUpdateTransport("gitlab-releases-zsync", gitLabTransport{})
+	RegisterUpdateTransport("http-dir-zsync", httpDirTransport{})
+	RegisterUpdateTransport("oci-zsync", ociTransport{})
+	RegisterUpdateTransport("bintray-zsync", bintrayTransport{})
+}
+
+func (ui UpdateInformation) transport() (UpdateTransport, error) {
+	t, ok := updateTransports[ui.transportmechanism]
+	if !ok {
+		return nil, errors.New("The transport mechanism " + ui.transportmechanism + " is not yet implemented")
+	}
+	return t, nil
+}
+
+// ResolveLatest finds the most recent release using the transport of the update information
+func (ui UpdateInformation) ResolveLatest() (UpdateRelease, error) {
+	t, err := ui.transport()
+	if err != nil {
+		return UpdateRelease{}, err
+	}
+	return t.ResolveLatest(ui)
+}
+
+// FetchZsync downloads and parses the .zsync file of rel
+func (ui UpdateInformation) FetchZsync(rel UpdateRelease) (*ZsyncControl, error) {
+	t, err := ui.transport()
+	if err != nil {
+		return nil, err
+	}
+	return t.FetchZsync(ui, rel)
+}
+
+// Changelog returns the release notes of rel, or ErrNoChangelog
+func (ui UpdateInformation) Changelog(rel UpdateRelease) (string, error) {
+	t, err := ui.transport()
+	if err != nil {
+		return "", err
+	}
+	return t.Changelog(ui, rel)
+}
+
+// fetchReleaseZsync is what most transports do for FetchZsync: the target of the .zsync file
+// is looked up among the assets of the release, or resolved relative to the .zsync file
+func fetchReleaseZsync(rel UpdateRelease) (*ZsyncControl, error) {
+	return fetchZsyncControl(rel.ZsyncURL, rel.assets, rel.authorize)
+}
+
+// releaseChangelog is what most transports do for Changelog
+func releaseChangelog(rel UpdateRelease) (string, error) {
+	if rel.changelog == "" {
+		return "", ErrNoChangelog
+	}
+	return rel.changelog, nil
+}
+
+// authorizeHost returns a function that sets header to value on requests to the host of baseURL only,
+// so that credentials do not leak to other hosts that assets may be stored on
+func authorizeHost(baseURL string, header string, value string) func(*http.Request) {
+	u, err := url.Parse(baseURL)
+	if err != nil || value == "" {
+		return nil
+	}
+	return func(req *http.Request) {
+		if req.URL.Host == u.Host {
+			req.Header.Set(header, value)
+		}
+	}
+}
+
+// httpGet gets u, adding credentials if needed. Fails unless the status is 200
+func httpGet(u string, authorize func(*http.Request), accept ...string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authorize != nil {
+		authorize(req)
+	}
+	for _, a := range accept {
+		req.Header.Add("Accept", a)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return resp, errors.New("could not get " + u + ": " + resp.Status)
+	}
+	return resp, nil
+}
+
+// baseURLForHost returns https://host unless host already contains a scheme
+func baseURLForHost(host string) string {
+	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
+		return strings.TrimSuffix(host, "/")
+	}
+	return "https://" + strings.TrimSuffix(host, "/")
+}
+
+// checkFieldCount checks that there are n fields after the transport mechanism
+func checkFieldCount(fields []string, n int, format string) error {
+	if len(fields) != n {
+		return errors.New("Update information isn't valid, the format is " + format)
+	}
+	for _, f := range fields {
+		if f == "" {
+			return errors.New("Update information isn't valid, the format is " + format)
+		}
+	}
+	return nil
+}
+
+// newestMatching returns the name among names that matches pattern and looks most recent,
+// comparing the numbers in the names numerically
+func newestMatching(names []string, pattern string) (string, bool) {
+	var matching []string
+	for _, n := range names {
+		if ok, _ := path.Match(pattern, n); ok {
+			matching = append(matching, n)
+		}
+	}
+	if len(matching) == 0 {
+		return "", false
+	}
+	sort.Slice(matching, func(i, j int) bool { return naturalLess(matching[i], matching[j]) })
+	return matching[len(matching)-1], true
+}
+
+var digitsRegexp = regexp.MustCompile(`[0-9]+|[^0-9]+`)
+
+// naturalLess compares a and b so that "App-1.10" is greater than "App-1.9"
+func naturalLess(a, b string) bool {
+	pa, pb := digitsRegexp.FindAllString(a, -1), digitsRegexp.FindAllString(b, -1)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] == pb[i] {
+			continue
+		}
+		da, db := pa[i][0] >= '0' && pa[i][0] <= '9', pb[i][0] >= '0' && pb[i][0] <= '9'
+		if da && db {
+			na, nb := strings.TrimLeft(pa[i], "0"), strings.TrimLeft(pb[i], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		return pa[i] < pb[i]
+	}
+	return len(pa) < len(pb)
+}
+
+// zsync|https://example.com/App-latest-x86_64.AppImage.zsync
+type zsyncTransport struct{}
+
+func (zsyncTransport) Validate(fields []string) error {
+	if err := checkFieldCount(fields, 1, "zsync|<URL of the .zsync file>"); err != nil {
+		return err
+	}
+	u, err := url.Parse(fields[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Scheme is missing in update information, zsync needs e.,g,. http:// or https://")
+	}
+	return nil
+}
+
+func (zsyncTransport) ResolveLatest(ui UpdateInformation) (UpdateRelease, error) {
+	return UpdateRelease{Name: path.Base(ui.fields[0]), ZsyncURL: ui.fields[0]}, nil
+}
+
+func (zsyncTransport) FetchZsync(ui UpdateInformation, rel UpdateRelease) (*ZsyncControl, error) {
+	return fetchReleaseZsync(rel)
+}
+
+func (zsyncTransport) Changelog(ui UpdateInformation, rel UpdateRelease) (string, error) {
+	return "", ErrNoChangelog
+}
+
+// http-dir-zsync|<URL of a directory listing or S3-compatible bucket listing>|<file name pattern of the .zsync file>
+// The most recent file is determined by comparing the file names matching the pattern,
+// e.g., App-1.10-x86_64.AppImage.zsync is more recent than App-1.9-x86_64.AppImage.zsync
+type httpDirTransport struct{}
+
+func (httpDirTransport) Validate(fields []string) error {
+	if err := checkFieldCount(fields, 2, "http-dir-zsync|<URL of the directory>|<file name pattern of the .zsync file>"); err != nil {
+		return err
+	}
+	u, err := url.Parse(fields[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Scheme is missing in update information, http-dir-zsync needs e.,g,. http:// or https://")
+	}
+	if strings.Contains(fields[1], "/") {
+		return errors.New("The file name pattern in update information must not contain a /")
+	}
+	return nil
+}
+
+type s3ListBucketResult struct {
+	IsTruncated bool
+	Contents    []struct {
+		Key string
+	}
+}
+
+var hrefRegexp = regexp.MustCompile(`(?i)href\s*=\s*["']([^"']+)["']`)
+
+func (httpDirTransport) ResolveLatest(ui UpdateInformation) (UpdateRelease, error) {
+	listURL, _ := url.Parse(ui.fields[0])
+	assets := map[string]string{}
+	marker := ""
+	// S3 returns at most 1000 keys per request, continue after the last one if there are more
+	for page := 0; page < 100; page++ {
+		u := *listURL
+		if marker != "" {
+			q := u.Query()
+			q.Set("marker", marker)
+			u.RawQuery = q.Encode()
+		}
+		resp, err := httpGet(u.String(), nil)
+		if err != nil {
+			return UpdateRelease{}, err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return UpdateRelease{}, err
+		}
+
+		var s3 s3ListBucketResult
+		if xml.Unmarshal(data, &s3) == nil && strings.Contains(string(data), "<ListBucketResult") {
+			// Keys are relative to the bucket, which is the path of the listing URL
+			base := *listURL
+			base.RawQuery = ""
+			if !strings.HasSuffix(base.Path, "/") {
+				base.Path += "/"
+			}
+			for _, c := range s3.Contents {
+				obj := base
+				obj.Path = base.Path + c.Key
+				obj.RawPath = ""
+				assets[path.Base(c.Key)] = obj.String()
+				marker = c.Key
+			}
+			if s3.IsTruncated && marker != "" {
+				continue
+			}
+			break
+		}
+
+		// Otherwise it is an HTML directory listing
+		for _, m := range hrefRegexp.FindAllStringSubmatch(string(data), -1) {
+			link, err := listURL.Parse(m[1])
+			if err != nil || link.RawQuery != "" || strings.HasSuffix(link.Path, "/") {
+				continue
+			}
+			assets[path.Base(link.Path)] = link.String()
+		}
+		break
+	}
+
+	var names []string
+	for name := range assets {
+		names = append(names, name)
+	}
+	name, ok := newestMatching(names, ui.fields[1])
+	if !ok {
+		return UpdateRelease{}, errors.New("no file matching " + ui.fields[1] + " in " + ui.fields[0])
+	}
+	return UpdateRelease{Name: name, ReleaseURL: ui.fields[0], ZsyncURL: assets[name], assets: assets}, nil
+}
+
+func (httpDirTransport) FetchZsync(ui UpdateInformation, rel UpdateRelease) (*ZsyncControl, error) {
+	return fetchReleaseZsync(rel)
+}
+
+func (httpDirTransport) Changelog(ui UpdateInformation, rel UpdateRelease) (string, error) {
+	return "", ErrNoChangelog
+}
+
+// bintray-zsync|<username>|<repository>|<package name>|<zsync path>
+// Bintray has been shut down, so the update information is still valid but cannot be resolved anymore
+type bintrayTransport struct{}
+
+func (bintrayTransport) Validate(fields []string) error {
+	return checkFieldCount(fields, 4, "bintray-zsync|<username>|<repository>|<package name>|<zsync path>")
+}
+
+func (bintrayTransport) ResolveLatest(ui UpdateInformation) (UpdateRelease, error) {
+	return UpdateRelease{}, errors.New("Bintray has been shut down, please ask the author for new update information")
+}
+
+func (bintrayTransport) FetchZsync(ui UpdateInformation, rel UpdateRelease) (*ZsyncControl, error) {
+	return nil, errors.New("Bintray has been shut down, please ask the author for new update information")
+}
+
+func (bintrayTransport) Changelog(ui UpdateInformation, rel UpdateRelease) (string, error) {
+	return "", ErrNoChangelog
+}
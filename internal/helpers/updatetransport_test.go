@@ -0,0 +1,153 @@
+package helpers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-zsyncmake/zsync"
+)
+
+func TestUpdateTransports(t *testing.T) {
+	for _, good := range []string{
+		"zsync|https://example.com/App-latest-x86_64.AppImage.zsync",
+		"gitlab-releases-zsync|gitlab.com|group/project|latest|App-*-x86_64.AppImage.zsync",
+		"http-dir-zsync|https://bucket.s3.example.com/?prefix=app/|App-*-x86_64.AppImage.zsync",
+		"oci-zsync|ghcr.io/user/app|stable|App-*-x86_64.AppImage.zsync",
+		"bintray-zsync|user|repo|package|App-_latestVersion-x86_64.AppImage.zsync",
+	} {
+		if err := helpers.ValidateUpdateInformation(good); err != nil {
+			t.Errorf("Despite correct updateinformation it was deemed corrupt: %s: %s", good, err)
+		}
+	}
+	for _, bad := range []string{
+		"foo-zsync|https://example.com/App.AppImage.zsync",
+		"gitlab-releases-zsync|gitlab.com|group/project|App-*-x86_64.AppImage.zsync",
+		"http-dir-zsync|example.com/apps/|App-*-x86_64.AppImage.zsync",
+		"http-dir-zsync|https://example.com/apps/|sub/App-*-x86_64.AppImage.zsync",
+		"oci-zsync|ghcr.io|stable|App-*-x86_64.AppImage.zsync",
+	} {
+		if err := helpers.ValidateUpdateInformation(bad); err == nil {
+			t.Errorf("Despite corrupt updateinformation it was deemed correct: %s", bad)
+		}
+	}
+
+	// The same AppImage and .zsync file are served in the ways the transports expect
+	dir := t.TempDir()
+	appimage := filepath.Join(dir, "App-1.10-x86_64.AppImage")
+	if err := os.WriteFile(appimage, []byte(strings.Repeat("AppImage contents ", 1000)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	zsync.ZsyncMake(appimage, zsync.Options{Url: filepath.Base(appimage)})
+	zsyncData, err := os.ReadFile(appimage + ".zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(dir, filepath.Base(r.URL.Path)))
+	})
+	mux.HandleFunc("/html/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><a href="?C=N;O=D">Name</a> <a href="../">Parent</a>
+<a href="App-1.9-x86_64.AppImage.zsync">old</a> <a href="/files/App-1.10-x86_64.AppImage.zsync">new</a>
+<a href="App-1.2-x86_64.AppImage.zsync">older</a></html>`)
+	})
+	mux.HandleFunc("/bucket/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("prefix") == "" {
+			http.ServeFile(w, r, filepath.Join(dir, filepath.Base(r.URL.Path)))
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><IsTruncated>false</IsTruncated>
+<Contents><Key>app/App-1.9-x86_64.AppImage.zsync</Key></Contents>
+<Contents><Key>app/App-1.10-x86_64.AppImage.zsync</Key></Contents>
+<Contents><Key>app/App-1.10-x86_64.AppImage</Key></Contents></ListBucketResult>`)
+	})
+	mux.HandleFunc("/api/v4/projects/group%2Fproject/releases/permalink/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v1.10", "description": "Fixed all the bugs", "_links": {"self": "%s/group/project/-/releases/v1.10"},
+"assets": {"links": [{"name": "App-1.10-x86_64.AppImage.zsync", "url": "%s/files/App-1.10-x86_64.AppImage.zsync"},
+{"name": "App-1.10-x86_64.AppImage", "url": "%s/files/App-1.10-x86_64.AppImage"}]}}`, server.URL, server.URL, server.URL)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") != "repository:user/app:pull" {
+			http.Error(w, "wrong scope", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"token": "secret"}`)
+	})
+	mux.HandleFunc("/v2/user/app/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/user/app/manifests/stable":
+			fmt.Fprint(w, `{"schemaVersion": 2, "annotations": {"org.opencontainers.image.version": "1.10", "org.opencontainers.image.description": "Fixed all the bugs"},
+"layers": [{"digest": "sha256:aaa", "annotations": {"org.opencontainers.image.title": "App-1.10-x86_64.AppImage"}},
+{"digest": "sha256:bbb", "annotations": {"org.opencontainers.image.title": "App-1.10-x86_64.AppImage.zsync"}}]}`)
+		case "/v2/user/app/blobs/sha256:aaa":
+			http.ServeFile(w, r, appimage)
+		case "/v2/user/app/blobs/sha256:bbb":
+			w.Write(zsyncData)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		updateinformation string
+		zsyncURL          string
+		targetURL         string
+		changelog         string
+	}{
+		{"zsync|" + server.URL + "/files/App-1.10-x86_64.AppImage.zsync",
+			server.URL + "/files/App-1.10-x86_64.AppImage.zsync", server.URL + "/files/App-1.10-x86_64.AppImage", ""},
+		{"http-dir-zsync|" + server.URL + "/html/|App-*-x86_64.AppImage.zsync",
+			server.URL + "/files/App-1.10-x86_64.AppImage.zsync", server.URL + "/files/App-1.10-x86_64.AppImage", ""},
+		{"http-dir-zsync|" + server.URL + "/bucket/?prefix=app/|App-*-x86_64.AppImage.zsync",
+			server.URL + "/bucket/app/App-1.10-x86_64.AppImage.zsync", server.URL + "/bucket/app/App-1.10-x86_64.AppImage", ""},
+		{"gitlab-releases-zsync|" + server.URL + "|group/project|latest|App-*-x86_64.AppImage.zsync",
+			server.URL + "/files/App-1.10-x86_64.AppImage.zsync", server.URL + "/files/App-1.10-x86_64.AppImage", "Fixed all the bugs"},
+		{"oci-zsync|" + server.URL + "/user/app|stable|App-*-x86_64.AppImage.zsync",
+			server.URL + "/v2/user/app/blobs/sha256:bbb", server.URL + "/v2/user/app/blobs/sha256:aaa", "Fixed all the bugs"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Split(tt.updateinformation, "|")[0], func(t *testing.T) {
+			ui, err := helpers.NewUpdateInformationFromString(tt.updateinformation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel, err := ui.ResolveLatest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rel.ZsyncURL != tt.zsyncURL {
+				t.Errorf("Expected the .zsync file at %s, got %s", tt.zsyncURL, rel.ZsyncURL)
+			}
+			zc, err := ui.FetchZsync(rel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if zc.URL != tt.targetURL {
+				t.Errorf("Expected the target at %s, got %s", tt.targetURL, zc.URL)
+			}
+			changelog, err := ui.Changelog(rel)
+			if changelog != tt.changelog || (tt.changelog == "" && err != helpers.ErrNoChangelog) {
+				t.Errorf("Unexpected changelog %q, %v", changelog, err)
+			}
+			if _, err = helpers.ZsyncUpdate(zc, "", filepath.Join(t.TempDir(), zc.Filename)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+// Criteria that can be used to decide which of several AppImages of the same application
+// is the most recent one, see VersionPrecedence
+const (
+	PrecedenceVersion = "version" // X-AppImage-Version, as a semantic version if possible, otherwise like Debian versions
+	PrecedenceSemver  = "semver"  // X-AppImage-Version, only if both are semantic versions
+	PrecedenceDebian  = "debian"  // X-AppImage-Version, always like Debian versions
+	PrecedenceFSTime  = "fstime"  // Creation time of the squashfs filesystem, i.e., build time
+	PrecedenceMTime   = "mtime"   // Modification time of the file, i.e., usually download or copy time
+)
+
+// DefaultVersionPrecedence is the order in which the criteria are consulted by default.
+// The file mtime comes last because copying an old AppImage would otherwise make it the newest
+var DefaultVersionPrecedence = []string{PrecedenceVersion, PrecedenceFSTime, PrecedenceMTime}
+
+// VersionCandidate describes one of several AppImages of the same application.
+// Empty or zero fields are unknown and are not used for comparison
+type VersionCandidate struct {
+	Path    string
+	Version string
+	FSTime  time.Time
+	MTime   time.Time
+}
+
+// ParseVersionPrecedence parses a comma-separated list of criteria such as "version,fstime,mtime"
+func ParseVersionPrecedence(s string) ([]string, error) {
+	var precedence []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch p {
+		case "":
+			continue
+		case PrecedenceVersion, PrecedenceSemver, PrecedenceDebian, PrecedenceFSTime, PrecedenceMTime:
+			precedence = append(precedence, p)
+		default:
+			return nil, errors.New("unknown version precedence criterion: " + p)
+		}
+	}
+	if len(precedence) == 0 {
+		return nil, errors.New("no version precedence criteria in: " + s)
+	}
+	return precedence, nil
+}
+
+// CompareVersionCandidates returns -1 if a is older than b, 1 if a is newer than b,
+// and 0 if the criteria in precedence cannot tell them apart.
+// Criteria for which one of the candidates lacks information are skipped
+func CompareVersionCandidates(a, b VersionCandidate, precedence []string) int {
+	for _, p := range precedence {
+		var c int
+		switch p {
+		case PrecedenceVersion, PrecedenceSemver, PrecedenceDebian:
+			if a.Version == "" || b.Version == "" {
+				continue
+			}
+			switch p {
+			case PrecedenceVersion:
+				c = CompareVersions(a.Version, b.Version)
+			case PrecedenceSemver:
+				c, _ = CompareSemanticVersions(a.Version, b.Version)
+			case PrecedenceDebian:
+				c = CompareDebianVersions(a.Version, b.Version)
+			}
+		case PrecedenceFSTime:
+			c = compareTimes(a.FSTime, b.FSTime)
+		case PrecedenceMTime:
+			c = compareTimes(a.MTime, b.MTime)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareTimes(a, b time.Time) int {
+	if a.IsZero() || b.IsZero() {
+		return 0
+	}
+	return a.Compare(b)
+}
+
+// MostRecentVersionCandidate returns the most recent of the candidates according to precedence.
+// Of several equally recent candidates, the first one is returned
+func MostRecentVersionCandidate(candidates []VersionCandidate, precedence []string) (VersionCandidate, bool) {
+	if len(candidates) == 0 {
+		return VersionCandidate{}, false
+	}
+	mostRecent := candidates[0]
+	for _, c := range candidates[1:] {
+		if CompareVersionCandidates(c, mostRecent, precedence) > 0 {
+			mostRecent = c
+		}
+	}
+	return mostRecent, true
+}
+
+// CompareVersions compares two version strings and returns -1, 0 or 1.
+// If both are semantic versions (optionally prefixed with "v"), they are compared
+// as described on https://semver.org, so that "1.0.0-rc1" is older than "1.0.0".
+// Otherwise they are compared like Debian package versions, which also works
+// for things like dates and "continuous-20200101" reasonably well
+func CompareVersions(a, b string) int {
+	if c, ok := CompareSemanticVersions(a, b); ok {
+		return c
+	}
+	return CompareDebianVersions(a, b)
+}
+
+// CompareSemanticVersions compares two semantic versions. It returns false
+// if either of them cannot be parsed
+func CompareSemanticVersions(a, b string) (int, bool) {
+	va, err := version.NewSemver(strings.TrimSpace(a))
+	if err != nil {
+		return 0, false
+	}
+	vb, err := version.NewSemver(strings.TrimSpace(b))
+	if err != nil {
+		return 0, false
+	}
+	return va.Compare(vb), true
+}
+
+// CompareDebianVersions compares [epoch:]upstream[-revision] versions the way dpkg does,
+// see https://www.debian.org/doc/debian-policy/ch-controlfields.html#version.
+// A leading "v" as in "v1.2" is ignored because it is so common in tags
+func CompareDebianVersions(a, b string) int {
+	ea, ua, ra := splitDebianVersion(a)
+	eb, ub, rb := splitDebianVersion(b)
+	if c := compareDebianPart(ea, eb); c != 0 {
+		return c
+	}
+	if c := compareDebianPart(ua, ub); c != 0 {
+		return c
+	}
+	return compareDebianPart(ra, rb)
+}
+
+func splitDebianVersion(v string) (epoch string, upstream string, revision string) {
+	v = strings.TrimSpace(v)
+	if e, rest, ok := strings.Cut(v, ":"); ok && e != "" && strings.Trim(e, "0123456789") == "" {
+		epoch, v = e, rest
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		v, revision = v[:i], v[i+1:]
+	}
+	if len(v) > 1 && (v[0] == 'v' || v[0] == 'V') && isDigit(v[1]) {
+		v = v[1:]
+	}
+	return epoch, v, revision
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// debianOrder sorts "~" before everything, even the end of the string,
+// and letters before all other non-digits
+func debianOrder(s string, i int) int {
+	if i >= len(s) || isDigit(s[i]) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case c == '~':
+		return -1
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+// compareDebianPart implements verrevcmp from dpkg
+func compareDebianPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := debianOrder(a, i), debianOrder(b, j)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
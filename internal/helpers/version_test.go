@@ -0,0 +1,68 @@
+package helpers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.9", "1.10", -1},
+		{"v2.0.1", "2.0.0", 1},
+		{"1.0.0-rc1", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0+build1", "1.0.0+build2", 0},
+		{"1.0~beta1", "1.0", -1},
+		{"1:0.9", "2.0", 1},
+		{"2.30-1ubuntu1", "2.30-1ubuntu2", -1},
+		{"1.2.3a", "1.2.3", 1},
+		{"continuous-20200102", "continuous-20200101", 1},
+		{"git20191231.abcdef", "git20200101.123456", -1},
+	}
+	for _, tt := range tests {
+		if got := helpers.CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := helpers.CompareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestMostRecentVersionCandidate(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	candidates := []helpers.VersionCandidate{
+		{Path: "new.AppImage", Version: "1.10", FSTime: day(10), MTime: day(10)},
+		{Path: "copied.AppImage", Version: "1.9", FSTime: day(9), MTime: day(20)},
+		{Path: "rebuilt.AppImage", Version: "1.10", FSTime: day(11), MTime: day(11)},
+		{Path: "unversioned.AppImage", FSTime: day(1), MTime: day(1)},
+	}
+	tests := []struct {
+		precedence string
+		want       string
+	}{
+		{"version,fstime,mtime", "rebuilt.AppImage"},
+		{"version,mtime", "rebuilt.AppImage"},
+		{"mtime", "copied.AppImage"},
+		{"fstime", "rebuilt.AppImage"},
+	}
+	for _, tt := range tests {
+		precedence, err := helpers.ParseVersionPrecedence(tt.precedence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := helpers.MostRecentVersionCandidate(candidates, precedence)
+		if !ok || got.Path != tt.want {
+			t.Errorf("With precedence %s, expected %s, got %s", tt.precedence, tt.want, got.Path)
+		}
+	}
+	if _, err := helpers.ParseVersionPrecedence("version,size"); err == nil {
+		t.Error("Unknown criterion was accepted")
+	}
+}
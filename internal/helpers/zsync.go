@@ -0,0 +1,416 @@
+package helpers
+
+// Native zsync client, see http://zsync.moria.org.uk/paper/
+// It reuses the blocks of a local file (e.g., the AppImage that is being updated)
+// and downloads only the blocks that are missing with HTTP range requests.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/md4"
+)
+
+// ZsyncControl is the parsed contents of a .zsync control file
+type ZsyncControl struct {
+	Filename   string
+	MTime      time.Time
+	BlockSize  int
+	Length     int64
+	SeqMatches int
+	WeakLen    int
+	StrongLen  int
+	URL        string // Absolute URL of the target file
+	SHA1       string
+	weak       []uint32 // Weak checksum of each block, masked to WeakLen bytes
+	strong     [][]byte // Strong checksum of each block, StrongLen bytes
+	authorize  func(*http.Request)
+}
+
+// ZsyncStats tells how much of the target file was reused and how much was downloaded
+type ZsyncStats struct {
+	Reused     int64
+	Downloaded int64
+}
+
+// FetchZsyncControl downloads and parses the .zsync file at controlURL.
+// The URL of the target file is resolved relative to controlURL
+func FetchZsyncControl(controlURL string) (*ZsyncControl, error) {
+	return fetchZsyncControl(controlURL, nil, nil)
+}
+
+// fetchZsyncControl is FetchZsyncControl for UpdateTransports. If the target of the
+// .zsync file is a relative URL, it is looked up by its file name in assets first.
+// authorize adds credentials to all requests
+func fetchZsyncControl(controlURL string, assets map[string]string, authorize func(*http.Request)) (*ZsyncControl, error) {
+	resp, err := httpGet(controlURL, authorize)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	zc, err := ParseZsyncControl(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	zc.authorize = authorize
+	if u, err := url.Parse(zc.URL); err == nil && !u.IsAbs() {
+		if asset, ok := assets[path.Base(u.Path)]; ok {
+			zc.URL = asset
+			return zc, nil
+		}
+	}
+	base, err := url.Parse(controlURL)
+	if err != nil {
+		return nil, err
+	}
+	target, err := base.Parse(zc.URL)
+	if err != nil {
+		return nil, err
+	}
+	zc.URL = target.String()
+	return zc, nil
+}
+
+// ParseZsyncControl parses a .zsync control file
+func ParseZsyncControl(r io.Reader) (*ZsyncControl, error) {
+	br := bufio.NewReader(r)
+	zc := &ZsyncControl{SeqMatches: 1, WeakLen: 4, StrongLen: 16}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, errors.New("zsync file ends in the header")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, errors.New("invalid line in zsync header: " + line)
+		}
+		switch key {
+		case "zsync":
+			// Version of the tool that made the file, nothing to check
+		case "Filename":
+			// The name the update gets written to next to the old version, which the server must not
+			// be able to point anywhere else
+			if value == "." || value == ".." || strings.ContainsAny(value, "/\\\x00") {
+				return nil, errors.New("invalid Filename in zsync header: " + value)
+			}
+			zc.Filename = value
+		case "MTime":
+			zc.MTime, _ = time.Parse(time.RFC1123Z, value)
+		case "Blocksize":
+			zc.BlockSize, err = strconv.Atoi(value)
+		case "Length":
+			zc.Length, err = strconv.ParseInt(value, 10, 64)
+		case "Hash-Lengths":
+			parts := strings.Split(value, ",")
+			if len(parts) != 3 {
+				return nil, errors.New("invalid Hash-Lengths in zsync header: " + value)
+			}
+			if zc.SeqMatches, err = strconv.Atoi(parts[0]); err == nil {
+				if zc.WeakLen, err = strconv.Atoi(parts[1]); err == nil {
+					zc.StrongLen, err = strconv.Atoi(parts[2])
+				}
+			}
+		case "URL":
+			zc.URL = value
+		case "SHA-1":
+			zc.SHA1 = strings.ToLower(value)
+		case "Z-URL", "Z-Map2", "Recompress":
+			return nil, errors.New("compressed zsync targets are not supported")
+		}
+		if err != nil {
+			return nil, errors.New("invalid " + key + " in zsync header: " + value)
+		}
+	}
+	if zc.Filename == "" || zc.BlockSize <= 0 || zc.BlockSize&(zc.BlockSize-1) != 0 || zc.Length < 0 || zc.URL == "" || len(zc.SHA1) != 40 ||
+		zc.SeqMatches < 1 || zc.SeqMatches > 2 || zc.WeakLen < 1 || zc.WeakLen > 4 || zc.StrongLen < 1 || zc.StrongLen > 16 {
+		return nil, errors.New("incomplete or invalid zsync header")
+	}
+
+	n := zc.blocks()
+	checksums := make([]byte, n*(zc.WeakLen+zc.StrongLen))
+	if _, err := io.ReadFull(br, checksums); err != nil {
+		return nil, errors.New("zsync file is truncated")
+	}
+	zc.weak = make([]uint32, n)
+	zc.strong = make([][]byte, n)
+	for i := 0; i < n; i++ {
+		entry := checksums[i*(zc.WeakLen+zc.StrongLen):]
+		w := make([]byte, 4)
+		copy(w[4-zc.WeakLen:], entry[:zc.WeakLen])
+		zc.weak[i] = binary.BigEndian.Uint32(w)
+		zc.strong[i] = entry[zc.WeakLen : zc.WeakLen+zc.StrongLen]
+	}
+	return zc, nil
+}
+
+func (zc *ZsyncControl) blocks() int {
+	return int((zc.Length + int64(zc.BlockSize) - 1) / int64(zc.BlockSize))
+}
+
+// weakMask masks the rolling checksum to the bytes that are stored in the control file
+func (zc *ZsyncControl) weakMask() uint32 {
+	return uint32(0xffffffff) >> (8 * (4 - zc.WeakLen))
+}
+
+// rsum is the rolling checksum of zsync (and rsync)
+type rsum struct {
+	a, b uint16
+}
+
+func newRsum(block []byte) rsum {
+	var r rsum
+	l := uint16(len(block))
+	for _, c := range block {
+		r.a += uint16(c)
+		r.b += l * uint16(c)
+		l--
+	}
+	return r
+}
+
+// roll removes out from the start of the window and adds in at its end
+func (r *rsum) roll(out, in byte, blockSize int) {
+	r.a += uint16(in) - uint16(out)
+	r.b += r.a - uint16(blockSize)*uint16(out)
+}
+
+func (r rsum) value() uint32 {
+	return uint32(r.a)<<16 | uint32(r.b)
+}
+
+func (zc *ZsyncControl) strongMatches(i int, block []byte) bool {
+	h := md4.New()
+	h.Write(block)
+	return bytes.Equal(h.Sum(nil)[:zc.StrongLen], zc.strong[i])
+}
+
+// ZsyncUpdate assembles the target file described by zc at destination. Blocks are
+// reused from the local file seed where possible, the rest is downloaded from zc.URL.
+// The result is verified against the SHA-1 in the control file before it is moved to destination
+func ZsyncUpdate(zc *ZsyncControl, seed string, destination string) (ZsyncStats, error) {
+	var stats ZsyncStats
+	tmp, err := os.CreateTemp(filepath.Dir(destination), "."+filepath.Base(destination)+".*.part")
+	if err != nil {
+		return stats, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err = tmp.Truncate(zc.Length); err != nil {
+		return stats, err
+	}
+
+	have := make([]bool, zc.blocks())
+	if seed != "" {
+		if stats.Reused, err = zc.reuseBlocks(seed, tmp, have); err != nil {
+			return stats, err
+		}
+	}
+	if stats.Downloaded, err = zc.downloadMissingBlocks(tmp, have); err != nil {
+		return stats, err
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return stats, err
+	}
+	h := sha1.New()
+	if _, err = io.Copy(h, tmp); err != nil {
+		return stats, err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != zc.SHA1 {
+		return stats, errors.New("SHA-1 of the assembled file is " + sum + " but should be " + zc.SHA1)
+	}
+	if err = tmp.Chmod(0755); err != nil {
+		return stats, err
+	}
+	if err = tmp.Close(); err != nil {
+		return stats, err
+	}
+	if !zc.MTime.IsZero() {
+		os.Chtimes(tmp.Name(), zc.MTime, zc.MTime)
+	}
+	return stats, os.Rename(tmp.Name(), destination)
+}
+
+// reuseBlocks looks for blocks of the target in seed using the rolling checksum
+// and writes them into out. Returns the number of bytes reused
+func (zc *ZsyncControl) reuseBlocks(seed string, out io.WriterAt, have []bool) (int64, error) {
+	f, err := os.Open(seed)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	mask := zc.weakMask()
+	index := map[uint32][]int{}
+	for i, w := range zc.weak {
+		index[w] = append(index[w], i)
+	}
+
+	bs := zc.BlockSize
+	window := bs * zc.SeqMatches // Bytes needed to check a match, including the following blocks
+	chunk := 256 * bs
+	buf := make([]byte, 0, chunk+window)
+	eof := false
+	var reused int64
+
+	for {
+		// Refill the buffer, keeping the bytes that have not been looked at yet
+		for !eof && len(buf) < cap(buf) {
+			n, err := f.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF {
+				// The last block of the target is padded with zeros, so pad the seed, too
+				eof = true
+				buf = append(buf, make([]byte, bs)...)
+			} else if err != nil {
+				return reused, err
+			}
+		}
+		if len(buf) < bs {
+			break
+		}
+		// Positions up to limit have enough bytes after them to check the following blocks
+		limit := len(buf) - window
+		if eof {
+			limit = len(buf) - bs
+		}
+		pos := 0
+		r := newRsum(buf[:bs])
+		for pos <= limit {
+			matched := 0
+			for _, i := range index[r.value()&mask] {
+				if have[i] {
+					continue
+				}
+				if !zc.strongMatches(i, buf[pos:pos+bs]) {
+					continue
+				}
+				// With sequence matches, the checksums are only unique enough together with the next block
+				if zc.SeqMatches > 1 && i+1 < len(have) {
+					if pos+2*bs > len(buf) {
+						continue
+					}
+					next := buf[pos+bs : pos+2*bs]
+					if newRsum(next).value()&mask != zc.weak[i+1] || !zc.strongMatches(i+1, next) {
+						continue
+					}
+				}
+				for j := i; j < i+zc.SeqMatches && j < len(have); j++ {
+					if have[j] {
+						continue
+					}
+					have[j] = true
+					start := int64(j) * int64(bs)
+					length := int64(bs)
+					if start+length > zc.Length {
+						length = zc.Length - start
+					}
+					block := buf[pos+(j-i)*bs : pos+(j-i)*bs+int(length)]
+					if _, err := out.WriteAt(block, start); err != nil {
+						return reused, err
+					}
+					reused += length
+				}
+				matched = bs
+				break
+			}
+			if matched > 0 {
+				pos += matched
+				if pos <= limit {
+					r = newRsum(buf[pos : pos+bs])
+				}
+				continue
+			}
+			if pos == limit {
+				pos++
+				break
+			}
+			r.roll(buf[pos], buf[pos+bs], bs)
+			pos++
+		}
+		if eof {
+			break
+		}
+		// Keep the bytes that were not fully looked at
+		buf = append(buf[:0], buf[pos:]...)
+	}
+	return reused, nil
+}
+
+// downloadMissingBlocks downloads the blocks not in have with HTTP range requests
+// and writes them into out. Returns the number of bytes downloaded
+func (zc *ZsyncControl) downloadMissingBlocks(out io.WriterAt, have []bool) (int64, error) {
+	var downloaded int64
+	bs := int64(zc.BlockSize)
+	for i := 0; i < len(have); {
+		if have[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(have) && !have[j] && j-i < 256 { // Ranges of at most 256 blocks per request
+			j++
+		}
+		start := int64(i) * bs
+		end := int64(j)*bs - 1
+		if end >= zc.Length {
+			end = zc.Length - 1
+		}
+		n, whole, err := zc.downloadRange(out, start, end)
+		downloaded += n
+		if err != nil || whole {
+			return downloaded, err
+		}
+		i = j
+	}
+	return downloaded, nil
+}
+
+// downloadRange downloads the bytes from start to end (inclusive) of the target file.
+// If the server does not support range requests, the whole file gets written and whole is true
+func (zc *ZsyncControl) downloadRange(out io.WriterAt, start int64, end int64) (n int64, whole bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, zc.URL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if zc.authorize != nil {
+		zc.authorize(req)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		start, end, whole = 0, zc.Length-1, true
+	default:
+		return 0, false, errors.New("could not download " + zc.URL + ": " + resp.Status)
+	}
+	n, err = io.Copy(io.NewOffsetWriter(out, start), io.LimitReader(resp.Body, end-start+1))
+	if err == nil && n != end-start+1 {
+		err = errors.New("short read while downloading " + zc.URL)
+	}
+	return n, whole, err
+}
+
@@ -0,0 +1,92 @@
+package helpers_test
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-zsyncmake/zsync"
+)
+
+func TestZsyncUpdate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+	// The new version shares most of its contents with the old one, but at shifted offsets
+	common1, common2 := random(300*1024), random(200*1024+123)
+	oldData := append(append(append([]byte{}, common1...), random(5000)...), common2...)
+	newData := append(append(append(append([]byte{}, random(777)...), common1...), random(10000)...), common2...)
+
+	serverDir := t.TempDir()
+	target := filepath.Join(serverDir, "App-2.0-x86_64.AppImage")
+	if err := os.WriteFile(target, newData, 0755); err != nil {
+		t.Fatal(err)
+	}
+	zsync.ZsyncMake(target, zsync.Options{Url: filepath.Base(target)})
+	server := httptest.NewServer(http.FileServer(http.Dir(serverDir)))
+	defer server.Close()
+
+	zc, err := helpers.FetchZsyncControl(server.URL + "/App-2.0-x86_64.AppImage.zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zc.Filename != "App-2.0-x86_64.AppImage" || zc.Length != int64(len(newData)) || zc.URL != server.URL+"/App-2.0-x86_64.AppImage" {
+		t.Fatalf("Unexpected control file contents: %+v", zc)
+	}
+
+	localDir := t.TempDir()
+	seed := filepath.Join(localDir, "App-1.0-x86_64.AppImage")
+	if err = os.WriteFile(seed, oldData, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(localDir, zc.Filename)
+	stats, err := helpers.ZsyncUpdate(zc, seed, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, newData) {
+		t.Fatal("The assembled file differs from the target")
+	}
+	if stats.Reused+stats.Downloaded != int64(len(newData)) {
+		t.Error("Reused and downloaded bytes do not add up:", stats)
+	}
+	// Everything except for the new random data and the blocks around it should have been reused
+	if stats.Downloaded > 20*1024 {
+		t.Error("Downloaded too much:", stats)
+	}
+
+	// Without a seed, everything gets downloaded
+	dest = filepath.Join(localDir, "full.AppImage")
+	stats, err = helpers.ZsyncUpdate(zc, "", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Downloaded != int64(len(newData)) {
+		t.Error("Expected a full download:", stats)
+	}
+	if got, _ = os.ReadFile(dest); !bytes.Equal(got, newData) {
+		t.Fatal("The downloaded file differs from the target")
+	}
+}
+
+func TestZsyncControlFilename(t *testing.T) {
+	header := "zsync: 0.6.2\nBlocksize: 2048\nLength: 1\nHash-Lengths: 1,4,16\nURL: App.AppImage\nSHA-1: " + strings.Repeat("0", 40) + "\n"
+	for _, name := range []string{"", ".", "..", "../App.AppImage", "/home/me/.bashrc", "sub/App.AppImage"} {
+		if _, err := helpers.ParseZsyncControl(strings.NewReader("Filename: " + name + "\n" + header + "\n")); err == nil {
+			t.Errorf("Expected an error for the Filename %q", name)
+		}
+	}
+}
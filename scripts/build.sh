@@ -42,6 +42,11 @@ help_message() {
   echo "-pc"
   echo "  Pre-Clean the build directory before building"
   echo ""
+  echo "-pr"
+  echo "  Pin the runtimes of the given release of https://github.com/probonopd/static-tools for appimagetool,"
+  echo "  i.e., write the release and the digests of its runtimes to src/appimagetool/runtimes/SHA256SUMS"
+  echo "  ex: build.sh -pr 2.0"
+  echo ""
   echo "-h"
   echo "  Prints this message"
   exit 0
@@ -69,6 +74,32 @@ set_arch_env () {
   fi
 }
 
+# Downloads the runtimes that get built into appimagetool from the release of static-tools that is
+# pinned in src/appimagetool/runtimes/SHA256SUMS and checks them against the digests there.
+# With -pr, downloads them from the given release and writes it and their digests there first.
+# As long as nothing is pinned, the runtimes of the continuous release are put next to appimagetool instead
+get_runtimes () {
+  local RUNTIMES=$PROJECT/src/appimagetool/runtimes
+  local RELEASE=$PINRUNTIMES
+  if [ -z "$RELEASE" ]; then
+    RELEASE=$(sed -n 's/^# release: //p' $RUNTIMES/SHA256SUMS)
+  fi
+  if [ -z "$PINRUNTIMES" ] && ( [ -z "$RELEASE" ] || ! grep -q -v -e '^#' -e '^$' $RUNTIMES/SHA256SUMS ); then
+    echo "No runtimes are pinned in $RUNTIMES/SHA256SUMS, bundling the runtimes of the continuous release"
+    echo "Pin the runtimes of a release of https://github.com/probonopd/static-tools with -pr <release>"
+    UNPINNEDRUNTIMES=true
+    return
+  fi
+  for arch in aarch64 armhf i686 x86_64; do
+    wget -q https://github.com/probonopd/static-tools/releases/download/$RELEASE/runtime-fuse3-$arch -O $RUNTIMES/runtime-$arch
+    CLEANUP+=($RUNTIMES/runtime-$arch)
+  done
+  if [ ! -z "$PINRUNTIMES" ]; then
+    ( cd $RUNTIMES ; grep '^#' SHA256SUMS | grep -v '^# release: ' > SHA256SUMS.new ; echo "# release: $RELEASE" >> SHA256SUMS.new ; sha256sum runtime-* >> SHA256SUMS.new ; mv SHA256SUMS.new SHA256SUMS )
+  fi
+  ( cd $RUNTIMES ; grep -v -e '^#' -e '^$' SHA256SUMS | sha256sum -c - )
+}
+
 # Build the given program at the given architecture. Used via build $arch $program
 build () {
   set_arch_env $1
@@ -120,14 +151,15 @@ NoDisplay=true
 EOF
   elif [ $PROG == appimagetool ]; then
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/appstreamcli-$AIARCH -O appstreamcli )
-    ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/desktop-file-validate-$AIARCH -O desktop-file-validate )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/mksquashfs-$AIARCH -O mksquashfs )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/patchelf-$AIARCH -O patchelf )
-    ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-aarch64 -O runtime-aarch64 )
-    ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-armhf -O runtime-armhf )
-    ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-i686 -O runtime-i686 )
-    ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-x86_64 -O runtime-x86_64 )     
-    ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/uploadtool/raw/master/upload.sh -O uploadtool )
+    # The runtimes are built into appimagetool once they are pinned
+    if [ ! -z "$UNPINNEDRUNTIMES" ]; then
+      ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-aarch64 -O runtime-aarch64 )
+      ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-armhf -O runtime-armhf )
+      ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-i686 -O runtime-i686 )
+      ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-x86_64 -O runtime-x86_64 )
+    fi
     cat > $BUILDDIR/$PROG-$ARCH.AppDir/appimagetool.desktop <<\EOF
 [Desktop Entry]
 Type=Application
@@ -141,14 +173,12 @@ NoDisplay=true
 EOF
   elif [ $PROG == mkappimage ]; then
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/appstreamcli-$AIARCH -O appstreamcli )
-    ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/desktop-file-validate-$AIARCH -O desktop-file-validate )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/mksquashfs-$AIARCH -O mksquashfs )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/patchelf-$AIARCH -O patchelf )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-aarch64 -O runtime-aarch64 )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-armhf -O runtime-armhf )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-i686 -O runtime-i686 )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/runtime-fuse3-x86_64 -O runtime-x86_64 )    
-    ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/uploadtool/raw/master/upload.sh -O uploadtool )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/bsdtar-$AIARCH -O bsdtar )
     ( cd $BUILDDIR/$PROG-$ARCH.AppDir/usr/bin/ ; wget -c https://github.com/probonopd/static-tools/releases/download/continuous/unsquashfs-$AIARCH -O unsquashfs )
     cat > $BUILDDIR/$PROG-$ARCH.AppDir/mkappimage.desktop <<\EOF
@@ -187,6 +217,9 @@ while [ $# -gt 0 ]; do
       DONTCLEAN=true;;
     -pc)
       PRECLEAN=true;;
+    -pr)
+      PINRUNTIMES=$2
+      shift;;
     -h)
       help_message;;
     help)
@@ -257,6 +290,8 @@ fi
 
 PATH=$BUILDDIR/zig:$PATH
 
+get_runtimes
+
 # We always want the amd64 appimagetool built first so that other AppImages can be built.
 # If this isn't wanted, we clean it up afterwards
 build amd64 appimagetool
@@ -44,12 +44,7 @@ type AppImage struct {
 func NewAppImage(path string) (ai *AppImage, err error) {
 	ai = new(AppImage)
 	ai.AppImage, err = goappimage.NewAppImage(path)
-	ai.uri = strings.TrimSpace(string(uri.File(filepath.Clean(ai.Path))))
-	ai.md5 = ai.calculateMD5filenamepart() // Need this also for non-existing AppImages for removal
-	ai.desktopfilename = "appimagekit_" + ai.md5 + ".desktop"
-	ai.desktopfilepath = filepath.Join(xdg.DataHome, "applications", ai.desktopfilename)
-	ai.thumbnailfilename = ai.md5 + ".png"
-	ai.thumbnailfilepath = filepath.Join(ThumbnailsDirNormal, ai.thumbnailfilename)
+	ai.calculateIntegrationPaths() // Need this also for non-existing AppImages for removal
 	if err != nil {
 		return ai, err
 	}
@@ -60,6 +55,17 @@ func NewAppImage(path string) (ai *AppImage, err error) {
 	return ai, nil
 }
 
+// calculateIntegrationPaths sets where the desktop file and thumbnail
+// for the AppImage at ai.Path are
+func (ai *AppImage) calculateIntegrationPaths() {
+	ai.uri = strings.TrimSpace(string(uri.File(filepath.Clean(ai.Path))))
+	ai.md5 = ai.calculateMD5filenamepart()
+	ai.desktopfilename = "appimagekit_" + ai.md5 + ".desktop"
+	ai.desktopfilepath = filepath.Join(xdg.DataHome, "applications", ai.desktopfilename)
+	ai.thumbnailfilename = ai.md5 + ".png"
+	ai.thumbnailfilepath = filepath.Join(ThumbnailsDirNormal, ai.thumbnailfilename)
+}
+
 func (ai AppImage) calculateMD5filenamepart() string {
 	hasher := md5.New()
 	hasher.Write([]byte(ai.uri))
@@ -69,27 +75,65 @@ func (ai AppImage) calculateMD5filenamepart() string {
 func (ai AppImage) setExecBit() {
 	err := os.Chmod(ai.Path, 0755)
 	if err == nil {
-		if *verbosePtr {
+		if currentConfig().General.Verbose {
 			log.Println("appimage: Set executable bit on", ai.Path)
 		}
 	}
 	// printError("appimage", err) // Do not print error since AppImages on read-only media are common
 }
 
-// Validate checks the quality of an AppImage and sends desktop notification, returns error or nil
-// TODO: Add more checks and reuse this in appimagetool
+// launchLintRules are the cheap rules that matter for launching an AppImage,
+// which are checked on every launch. All rules are checked when it gets integrated
+var launchLintRules = []string{"D002", "U001"}
+
+// Validate checks the quality of an AppImage with the linter that is shared with appimagetool,
+// returns an error describing all problems that are errors or nil
 func (ai AppImage) Validate() error {
-	if *verbosePtr {
+	return ai.validate(nil)
+}
+
+// ValidateLaunch is like Validate but only checks the launchLintRules
+func (ai AppImage) ValidateLaunch() error {
+	return ai.validate(launchLintRules)
+}
+
+// validate checks the rules in only, or all rules if it is empty
+func (ai AppImage) validate(only []string) error {
+	if currentConfig().General.Verbose {
 		log.Println("Validating AppImage", ai.Path)
 	}
-	// Check validity of the updateinformation in this AppImage, if it contains some
-	if ai.updateinformation != "" {
-		log.Println("Validating updateinformation in", ai.Path)
-		err := helpers.ValidateUpdateInformation(ai.updateinformation)
-		if err != nil {
-			helpers.PrintError("appimage: updateinformation verification", err)
-			return err
+	// Type 1 AppImages cannot be read without mounting them, so only check the updateinformation
+	if ai.Type() != 2 {
+		if ai.updateinformation != "" {
+			err := helpers.ValidateUpdateInformation(ai.updateinformation)
+			if err != nil {
+				helpers.PrintError("appimage: updateinformation verification", err)
+				return err
+			}
 		}
+		return nil
+	}
+	rdr, err := ai.SquashfsReader()
+	if err != nil {
+		return err
+	}
+	// We do not know the excludelist the AppImage was made with, hence skip the library checks
+	findings := helpers.Lint(rdr, helpers.LintOptions{
+		UpdateInformation: ai.updateinformation,
+		Disabled:          []string{"E002", "E003"},
+		Only:              only,
+	})
+	var problems []string
+	for _, f := range findings {
+		if currentConfig().General.Verbose {
+			log.Println("appimage: lint:", ai.Path, f)
+		}
+		if f.Severity == helpers.LintError {
+			problems = append(problems, f.Rule+": "+f.Message)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
 	}
 	return nil
 }
@@ -107,26 +151,6 @@ func (ai AppImage) _integrate() error {
 
 	ai.setExecBit()
 
-	// For performance reasons, we stop working immediately
-	// in case a desktop file already exists at that location
-	if !*overwritePtr {
-		// Compare mtime of desktop file and AppImage, similar to
-		// https://specifications.freedesktop.org/thumbnail-spec/thumbnail-spec-latest.html#MODIFICATIONS
-		if desktopFileInfo, err := os.Stat(ai.desktopfilepath); err == nil {
-			if appImageInfo, err := os.Stat(ai.Path); err == nil {
-				diff := desktopFileInfo.ModTime().Sub(appImageInfo.ModTime())
-				if diff > (time.Duration(0) * time.Second) {
-					// Do nothing if the desktop file is already newer than the AppImage file
-					// but subscribe
-					if CheckIfConnectedToNetwork() {
-						go SubscribeMQTT(MQTTclient, ai.updateinformation)
-					}
-					return nil
-				}
-			}
-		}
-	}
-
 	// Let's be evil and integrate only good AppImages...
 	// err := ai.Validate()
 	// if err != nil {
@@ -150,19 +174,20 @@ func (ai AppImage) _integrate() error {
 
 	// For performance reasons, we stop working immediately
 	// in case a thumbnail file already exists at that location
-	// if *overwritePtr == false {
+	// unless configured to regenerate thumbnails.
 	// Compare mtime of thumbnail file and AppImage, similar to
 	// https://specifications.freedesktop.org/thumbnail-spec/thumbnail-spec-latest.html#MODIFICATIONS
-	if thumbnailFileInfo, err := os.Stat(ai.thumbnailfilepath); err == nil {
-		if appImageInfo, err := os.Stat(ai.Path); err == nil {
-			diff := thumbnailFileInfo.ModTime().Sub(appImageInfo.ModTime())
-			if diff > (time.Duration(0) * time.Second) {
-				// Do nothing if the thumbnail file is already newer than the AppImage file
-				return nil
+	if !currentConfig().Thumbnails.Regenerate {
+		if thumbnailFileInfo, err := os.Stat(ai.thumbnailfilepath); err == nil {
+			if appImageInfo, err := os.Stat(ai.Path); err == nil {
+				diff := thumbnailFileInfo.ModTime().Sub(appImageInfo.ModTime())
+				if diff > (time.Duration(0) * time.Second) {
+					// Do nothing if the thumbnail file is already newer than the AppImage file
+					return nil
+				}
 			}
 		}
 	}
-	// }
 
 	return ai.extractDirIconAsThumbnail() // Do not run with "go" as it would interfere with writeDesktopFile
 }
@@ -216,12 +241,17 @@ func LaunchMostRecentAppImage(updateinformation string, args []string) {
 	if updateinformation == "" {
 		return
 	}
-	if !*quietPtr {
+	if currentConfig().Notifications.Enabled {
 		aipath := FindMostRecentAppImageWithMatchingUpdateInformation(updateinformation)
 		log.Println("Launching", aipath, args)
-		cmd := []string{aipath}
-		cmd = append(cmd, args...)
-		err := helpers.RunCmdTransparently(cmd)
+		cmd, err := launchCommand(aipath, args)
+		if err != nil {
+			helpers.PrintError("LaunchMostRecentAppImage", err)
+			sendErrorDesktopNotification("Cannot open "+filepath.Base(aipath), err.Error())
+			return
+		}
+		recordLaunch(aipath)
+		err = helpers.RunCmdTransparently(cmd)
 		if err != nil {
 			helpers.PrintError("LaunchMostRecentAppImage", err)
 		}
@@ -233,8 +263,45 @@ func LaunchMostRecentAppImage(updateinformation string, args []string) {
 // that havs matching upate information embedded
 func FindMostRecentAppImageWithMatchingUpdateInformation(updateinformation string) string {
 	results := FindAppImagesWithMatchingUpdateInformation(updateinformation)
-	mostRecent := helpers.FindMostRecentFile(results)
-	return mostRecent
+	var candidates []helpers.VersionCandidate
+	for _, result := range results {
+		ai, err := NewAppImage(result)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, ai.versionCandidate())
+	}
+	mostRecent, _ := helpers.MostRecentVersionCandidate(candidates, versionPrecedence())
+	if currentConfig().General.Verbose {
+		log.Println("Most recent of", len(candidates), "AppImages:", mostRecent.Path, mostRecent.Version)
+	}
+	return mostRecent.Path
+}
+
+// versionPrecedence returns the criteria for choosing the most recent AppImage
+func versionPrecedence() []string {
+	return currentConfig().Updates.Precedence
+}
+
+// versionCandidate describes the AppImage for comparison with other AppImages
+// of the same application. Unlike ai.Version, the version is empty if the
+// AppImage does not specify X-AppImage-Version
+func (ai AppImage) versionCandidate() helpers.VersionCandidate {
+	c := helpers.VersionCandidate{Path: ai.Path}
+	if ai.Desktop != nil {
+		c.Version = ai.Desktop.Section("Desktop Entry").Key("X-AppImage-Version").Value()
+	}
+	fi, err := os.Stat(ai.Path)
+	if err == nil {
+		c.MTime = fi.ModTime()
+	}
+	// ModTime falls back to the mtime if the squashfs cannot be read
+	if ai.Type() == 2 {
+		if fstime := ai.ModTime(); err != nil || !fstime.Equal(c.MTime) {
+			c.FSTime = fstime
+		}
+	}
+	return c
 }
 
 // FindAppImagesWithMatchingUpdateInformation finds registered AppImages
@@ -7,8 +7,11 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/adrg/xdg"
@@ -31,6 +34,7 @@ import (
 
 var quit = make(chan struct{})
 
+// The following flags override the respective settings in the configuration file, see config.go
 var verbosePtr = flag.Bool("v", false, "Print verbose log messages")
 
 // The following are disabled for now, because the path to this program can
@@ -44,6 +48,11 @@ var cleanPtr = flag.Bool("c", true, "Clean pre-existing desktop files")
 
 var quietPtr = flag.Bool("q", false, "Do not send desktop notifications")
 
+// Which criteria decide which of several AppImages with the same updateinformation is the most recent one.
+// The run, start and update commands are handled before the flags are parsed, hence $APPIMAGED_PRECEDENCE
+// which overrides the configuration file, too
+var precedencePtr = flag.String("precedence", "", "Comma-separated criteria for choosing the most recent AppImage\n(version, semver, debian, fstime, mtime; default \"version,fstime,mtime\",\nor $APPIMAGED_PRECEDENCE if set)")
+
 // var noZeroconfPtr = flag.Bool("nz", false, "Do not announce this service on the network using Zeroconf")
 
 var updateChannel chan struct{} = make(chan struct{}, 10)
@@ -90,6 +99,9 @@ var candidateDirectories = append(
 func main() {
 	thisai, _ = NewAppImage(helpers.Args0())
 
+	// The commands need the configuration, too
+	reloadConfig(false)
+
 	// As quickly as possible go there if we are invoked from the command line with a command
 	takeCareOfCommandlineCommands()
 
@@ -115,12 +127,21 @@ func main() {
 		fmt.Fprintf(os.Stderr, "run <updateinformation>:\n\tRun the most recent AppImage registered\n\tfor the updateinformation provided\n")
 		fmt.Fprintf(os.Stderr, "start <updateinformation>:\n\tStart the most recent AppImage registered\n\tfor the updateinformation provided and exit immediately\n")
 		fmt.Fprintf(os.Stderr, "update <path to AppImage>:\n\tUpdate the AppImage using the most recent\n\tAppImageUpdate registered\n")
+		fmt.Fprintf(os.Stderr, "list [--json]:\n\tList the integrated AppImages\n")
+		fmt.Fprintf(os.Stderr, "permissions <path to AppImage> [set <permissions>|reset]:\n\tShow or change the permissions the AppImage\n\tgets in the sandbox (network, home, audio, devices, dbus)\n")
+		fmt.Fprintf(os.Stderr, "diagnose <path to AppImage>:\n\tPrint a report about the AppImage, this system\n\tand why the AppImage last failed to launch\n")
+		fmt.Fprintf(os.Stderr, "extract [--open] <path to AppImage> [<destination>]:\n\tExtract the AppImage without running it\n\t(default squashfs-root next to it)\n")
+		fmt.Fprintf(os.Stderr, "mount [--open] <path to AppImage> [<mountpoint>]:\n\tMount the AppImage without running it\n\tuntil it is unmounted or interrupted\n")
+		fmt.Fprintf(os.Stderr, "config show:\n\tPrint the configuration in effect\n")
+		fmt.Fprintf(os.Stderr, "config validate [<path>]:\n\tCheck the configuration file\n\t(default "+configPath+")\n")
 		fmt.Fprintf(os.Stderr, "wrap <path to executable>:\n\tExecute the exeutable and send\n\tdesktop notifications for any errors\n")
+		fmt.Fprintf(os.Stderr, "wrap --sandbox=<default|nonetwork|private|overlay> <path to AppImage>:\n\tRun the AppImage in a bubblewrap sandbox\n")
 		fmt.Fprintf(os.Stderr, "\n")
 
 		flag.PrintDefaults()
 	}
 	flag.Parse()
+	reloadConfig(true) // Now that the flags are known
 
 	// Always show version
 	fmt.Println(filepath.Base(os.Args[0]), version)
@@ -140,8 +161,8 @@ func main() {
 	// overwritePtr = &ptrue
 
 	// Connect to MQTT server and subscribe to the topic for ourselves
-	if CheckIfConnectedToNetwork() {
-		uri, err := url.Parse(helpers.MQTTServerURI)
+	if currentConfig().Updates.Check && CheckIfConnectedToNetwork() {
+		uri, err := url.Parse(currentConfig().MQTT.Broker)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -163,8 +184,8 @@ func main() {
 
 	helpers.DeleteDesktopFilesWithNonExistingTargets()
 
-	log.Println("Overwrite:", *overwritePtr)
-	log.Println("Clean:", *overwritePtr)
+	log.Println("Overwrite:", currentConfig().General.Overwrite)
+	log.Println("Clean:", currentConfig().General.Clean)
 
 	// Disable desktop integration provided by scripts within AppImages
 	// as per https://github.com/AppImage/AppImageSpec/blob/master/draft.md#desktop-integration
@@ -198,15 +219,24 @@ func main() {
 		}
 	}()
 
+	// Let other tools talk to us over D-Bus, and let D-Bus start us when we are not running
+	installDbusServiceFile()
+	startDaemonService()
+
 	checkDirectories()
-	for _, dir := range watchedDirectories {
-		err = AddWatchDir(dir)
-		if err != nil {
-			log.Println("can't watch", dir, err)
-		}
-	}
+	watchConfigFile()
 	go StartWatch()
 
+	// Reload the configuration on SIGHUP, e.g., from "systemctl --user reload appimaged"
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Println("main: Reloading", configPath)
+			scheduleApplyDirectories(true)
+		}
+	}()
+
 	// Try to register ourselves as a thumbnailer for AppImages, in the hope that
 	// DBus notifications will be generated for AppImages as thumbnail-able files
 	// FIXME: Currently getting: No such interface 'org.freedesktop.thumbnails' on object at path /org/freedesktop/thumbnails/Manager1
@@ -243,7 +273,7 @@ func main() {
 // This is recommended by MQTT servers since they can go
 // down for maintenance
 func checkMQTTConnected(MQTTclient mqtt.Client) {
-	if CheckIfConnectedToNetwork() {
+	if MQTTclient != nil && CheckIfConnectedToNetwork() {
 		if !MQTTclient.IsConnected() {
 			log.Println("MQTT client connected:", MQTTclient.IsConnected())
 			MQTTclient.Connect()
@@ -259,33 +289,17 @@ func checkMQTTConnected(MQTTclient mqtt.Client) {
 // Periodically update the application menu so that the menu does not get rebuilt all the time
 func updateMenu() error {
 	// Run the various tools that make sure that the added desktop files really show up in the menu.
-	// Of course, almost no 2 systems are similar.
-	updateMenuCommands := []string{
-		"update-menus", // Needed on Ubuntu MATE so that the menu gets populated
-	}
-	for _, updateMenuCommand := range updateMenuCommands {
-		if helpers.IsCommandAvailable(updateMenuCommand) {
-			cmd := exec.Command(updateMenuCommand)
+	// Of course, almost no 2 systems are similar, hence they can be configured
+	for _, updateMenuCommand := range currentConfig().Menu.UpdateCommands {
+		if helpers.IsCommandAvailable(updateMenuCommand[0]) {
+			cmd := exec.Command(updateMenuCommand[0], updateMenuCommand[1:]...)
 			err := cmd.Run()
 			if err == nil {
-				log.Println("Ran", updateMenuCommand, "command")
+				log.Println("Ran", strings.Join(updateMenuCommand, " "))
 			} else {
-				helpers.LogError("main: "+updateMenuCommand, err)
+				helpers.LogError("main: "+updateMenuCommand[0], err)
 			}
 		}
-
-	}
-
-	// Run update-desktop-database
-	// "Build cache database of MIME types handled by desktop files."
-	if helpers.IsCommandAvailable("update-desktop-database") {
-		cmd := exec.Command("update-desktop-database", xdg.DataHome+"/applications/")
-		err := cmd.Run()
-		if err == nil {
-			log.Println("Ran", "update-desktop-database "+xdg.DataHome+"/applications/")
-		} else {
-			helpers.LogError("main", err)
-		}
 	}
 
 	/*
@@ -312,32 +326,48 @@ func checkDirectories() {
 		helpers.PrintError("main", err)
 	}
 
-	for _, dir := range candidateDirectories {
-		if helpers.Exists(dir) {
-			watchedDirectories = append(watchedDirectories, dir)
-		}
-	}
-	watchedDirectories = append(watchedDirectories, getMountDirectories()...)
-
-	for _, dir := range watchedDirectories {
-		ents, err := os.ReadDir(dir)
-		if err != nil {
-			helpers.LogError("checkDirectories", err)
-		}
-		for _, fil := range ents {
-			path := filepath.Join(dir, fil.Name())
-			if IsPossibleAppImage(path) {
-				log.Println("integrating", path)
-				AddIntegration(path, false)
-			}
-		}
-	}
+	mountDirectories = getMountDirectories()
+	sort.Strings(mountDirectories)
+	applyDirectories(false)
 
 	helpers.DeleteDesktopFilesWithNonExistingTargets()
+	pruneDatabase()
 	// So this should also catch AppImages which were formerly hidden in some subdirectory
 	// where the whole directory was deleted
 }
 
+// applyFlags overrides the configuration c with the flags given on the command line
+// and with $APPIMAGED_PRECEDENCE
+func applyFlags(c *config) {
+	if s := os.Getenv("APPIMAGED_PRECEDENCE"); s != "" {
+		precedence, err := helpers.ParseVersionPrecedence(s)
+		if err == nil {
+			c.Updates.Precedence = precedence
+		} else {
+			helpers.PrintError("APPIMAGED_PRECEDENCE", err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "v":
+			c.General.Verbose = *verbosePtr
+		case "o":
+			c.General.Overwrite = *overwritePtr
+		case "c":
+			c.General.Clean = *cleanPtr
+		case "q":
+			c.Notifications.Enabled = !*quietPtr
+		case "precedence":
+			precedence, err := helpers.ParseVersionPrecedence(*precedencePtr)
+			if err == nil {
+				c.Updates.Precedence = precedence
+			} else {
+				helpers.PrintError("-precedence", err)
+			}
+		}
+	})
+}
+
 func getMountDirectories() (out []string) {
 	out = make([]string, 0)
 
@@ -345,7 +375,7 @@ func getMountDirectories() (out []string) {
 	// FIXME: This breaks when the partition label has "-", see https://github.com/prometheus/procfs/issues/227
 
 	for _, mount := range mounts {
-		if *verbosePtr {
+		if currentConfig().General.Verbose {
 			log.Println("main: MountPoint", mount.MountPoint)
 		}
 		if !strings.HasPrefix(mount.MountPoint, "/sys") && // Is /dev needed for openSUSE Live?
@@ -1,6 +1,6 @@
 // appwrapper executes applications and presents errors to the GUI as notifications
-// TODO: Enable appimaged for DBus Activation so that the running instance can wrap
-// the apps, so that we don't need to run another appimaged process for each app
+// TODO: Use the org.appimage.Daemon1 D-Bus interface (see dbusservice.go) so that the running
+// instance can wrap the apps, so that we don't need to run another appimaged process for each app
 package main
 
 import (
@@ -25,71 +25,73 @@ func appwrap() {
 		os.Exit(1)
 	}
 
-	cmd := exec.Command(os.Args[2], os.Args[3:]...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-
-	var out bytes.Buffer
-	cmd.Stderr = &out
+	// "wrap --sandbox=<preset> <path>" runs the AppImage in a bubblewrap sandbox, see sandbox.go
+	var preset *bwrapPreset
+	if strings.HasPrefix(os.Args[2], "--sandbox=") {
+		p, err := findBwrapPreset(strings.TrimPrefix(os.Args[2], "--sandbox="))
+		if err != nil {
+			log.Fatal(err)
+		}
+		preset = &p
+		os.Args = append(os.Args[:2], os.Args[3:]...)
+		if len(os.Args) < 3 {
+			log.Println("Argument missing")
+			os.Exit(1)
+		}
+	}
 
 	// Find desktop file(s) that point to the executable in os.Args[2],
-	// and check them with desktop-file-verify; display notification if verification fails
+	// and check them with helpers.ValidateDesktopFile; display notification if verification fails
 	go checkDesktopFiles(os.Args[2])
 
 	ai, err := NewAppImage(os.Args[2])
 
+	command := os.Args[2:]
 	if err == nil {
-		// TODO: If we have an AppImage, then check the updateinformation inside the AppImage (or better: lint the AppImage)
-		err := ai.Validate()
+		// Only check what matters for launching it, all other rules were checked when it was integrated
+		err := ai.ValidateLaunch()
 		if err != nil {
 			sendDesktopNotification(ai.Name+" is not a proper AppImage", err.Error()+"\nPlease ask the author to fix it.", 30000)
 		}
-		// TODO: If we have an AppImage, then check the desktop file inside the AppImage (or better: lint the AppDir, reuse code from appimagetool)
-		// TODO: If we have an AppImage, then check that the .DirIcon  inside the AppImage exists (or better: lint the AppDir, reuse code from appimagetool)
+		// Run it in a sandbox if it declares its permissions
+		var serr error
+		command, serr = sandboxCommand(ai, os.Args[3:])
+		if serr != nil && preset == nil {
+			sendErrorDesktopNotification("Cannot open "+filepath.Base(os.Args[2]), serr.Error())
+			log.Fatal(serr)
+		}
 	}
+	if preset != nil {
+		var perr error
+		command, perr = presetCommand(*preset, os.Args[2], os.Args[3:])
+		if perr != nil {
+			sendErrorDesktopNotification("Cannot open "+filepath.Base(os.Args[2]), perr.Error())
+			log.Fatal(perr)
+		}
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
 
-	if err := cmd.Start(); err != nil {
-		log.Fatalf("cmd.Start: %v", err)
+	var out bytes.Buffer
+	cmd.Stderr = &out
+
+	if startErr := cmd.Start(); startErr != nil {
+		reportLaunchFailure(os.Args[2], startErr, 0, "")
+		log.Fatalf("cmd.Start: %v", startErr)
+	}
+	if err == nil {
+		recordLaunch(ai.Path)
 	}
 
 	if err := cmd.Wait(); err != nil {
 		if exiterr, ok := err.(*exec.ExitError); ok {
-			// The program has exited with an exit code != 0
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+			// The program has exited with an exit code != 0 or was killed by a signal
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok && isFailure(status) {
 				log.Printf("Exit Status: %d", status.ExitStatus())
 				log.Println(out.String())
-
-				// If what we launched (and failed) was an AppImage, then use its nice (short) name
-				// to display the error message
-				var appname string
-				ai, err = NewAppImage(os.Args[2])
-				if err == nil {
-					appname = ai.Name
-				} else {
-					appname = filepath.Base(os.Args[2])
-				}
-
-				summary := "Cannot open " + appname
-				body := strings.TrimSpace(out.String())
-
-				if strings.Contains(out.String(), "cannot open shared object file: No such file or directory") {
-					parts := strings.Split(out.String(), ":")
-					body = "Missing library " + strings.TrimSpace(parts[2])
-					// summary = "Error: Missing library " + strings.TrimSpace(parts[2])
-					// body = filepath.Base(os.Args[2]) + " could not be started because " + strings.TrimSpace(parts[2]) + " is missing"
-				}
-
-				// https://github.com/AppImage/AppImageKit/issues/1004
-				if strings.Contains(out.String(), "execv error") && err == nil {
-					body = filepath.Base(os.Args[2]) + " is defective, AppRun is missing. \nPlease ask the author to fix it."
-				}
-
-				// https://github.com/pinnaculum/galacteek/issues/6
-				if strings.Contains(out.String(), "Could not load the Qt platform plugin") && err == nil {
-					body = filepath.Base(os.Args[2]) + " is defective, could not load the Qt platform plugin. \nPlease run on the command line with 'QT_DEBUG_PLUGINS=1' \nto see error messages and ask the author to fix it."
-				}
-
-				sendErrorDesktopNotification(summary, body)
+				reportLaunchFailure(os.Args[2], nil, status, out.String())
 			}
 		} else {
 			log.Fatalf("cmd.Wait: %v", err)
@@ -97,6 +99,25 @@ func appwrap() {
 	}
 }
 
+// reportLaunchFailure diagnoses why the executable at path could not be launched (see diagnostics.go),
+// records it for "appimaged diagnose" and tells the user
+func reportLaunchFailure(path string, startErr error, status syscall.WaitStatus, stderr string) {
+	d := diagnose(path, startErr, status, stderr)
+	exitStatus := status.ExitStatus()
+	if startErr != nil {
+		exitStatus = -1
+	}
+	// If what we launched (and failed) was an AppImage, then use its nice (short) name
+	// to display the error message
+	appname := filepath.Base(path)
+	if ai, err := NewAppImage(path); err == nil {
+		appname = ai.Name
+		helpers.LogError("diagnostics", recordCrash(path, exitStatus, d, stderr))
+		d.Message += "\nRun 'appimaged diagnose " + path + "' for a report."
+	}
+	sendErrorDesktopNotification("Cannot open "+appname, d.Message)
+}
+
 // Send desktop notification. See
 // https://developer.gnome.org/notification-spec/
 func sendErrorDesktopNotification(title string, body string) {
@@ -105,6 +126,10 @@ func sendErrorDesktopNotification(title string, body string) {
 	log.Println(title)
 	log.Println(body)
 
+	if n := currentConfig().Notifications; !n.Enabled || !n.Errors {
+		return
+	}
+
 	conn, err := dbus.SessionBusPrivate() // When using SessionBusPrivate(), need to follow with Auth(nil) and Hello()
 	if err != nil {
 		if conn != nil {
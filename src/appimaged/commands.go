@@ -2,9 +2,12 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"text/tabwriter"
 
 	"github.com/probonopd/go-appimage/internal/helpers"
 )
@@ -27,6 +30,63 @@ func takeCareOfCommandlineCommands() {
 		os.Exit(0)
 	}
 
+	// appimaged list [--json]: Lists the integrated AppImages from the database
+	if os.Args[1] == "list" {
+		err := listIntegrated(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// appimaged permissions <AppImage> [set <permissions>|reset]: Shows or changes what the AppImage may do in the sandbox
+	if os.Args[1] == "permissions" {
+		err := permissionsCommand(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// appimaged diagnose <AppImage>: Prints a report about the AppImage and its last failed launch
+	if os.Args[1] == "diagnose" {
+		err := diagnoseCommand(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// appimaged extract [--open] <AppImage> [<destination>]: Extracts the AppImage without running it
+	// appimaged mount [--open] <AppImage> [<mountpoint>]: Mounts the AppImage until it is unmounted
+	if os.Args[1] == "extract" || os.Args[1] == "mount" {
+		var err error
+		if os.Args[1] == "extract" {
+			err = extractCommand(os.Args[2:])
+		} else {
+			err = mountCommand(os.Args[2:])
+		}
+		if err != nil {
+			fmt.Println(err)
+			sendErrorDesktopNotification("Cannot "+os.Args[1]+" AppImage", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// appimaged config show|validate [<path>]: Prints or checks the configuration
+	if os.Args[1] == "config" {
+		err := configCommand(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// As quickly as possible run the most recent AppImage we can find if we are
 	// invoked with the "run" command and updateinformation as arguments
 	// appimaged run <updateinformation>: Waits for the process to exit
@@ -49,8 +109,12 @@ func takeCareOfCommandlineCommands() {
 		if a == "" {
 			fmt.Println("No AppImage found for,")
 		} else {
-			comnd := []string{a}
-			comnd = append(comnd, os.Args[3:]...)
+			comnd, err := launchCommand(a, os.Args[3:])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			recordLaunch(a)
 
 			if os.Args[1] == "run" {
 				err = helpers.RunCmdTransparently(comnd)
@@ -71,3 +135,70 @@ func takeCareOfCommandlineCommands() {
 	}
 
 }
+
+// listIntegrated prints the AppImages in the database, as JSON if args contain --json
+func listIntegrated(args []string) error {
+	asJSON := false
+	for _, arg := range args {
+		switch arg {
+		case "--json", "-json":
+			asJSON = true
+		default:
+			return errors.New("unknown argument: " + arg)
+		}
+	}
+	db, err := readDatabase()
+	if err != nil {
+		return err
+	}
+	if db.AppImages == nil {
+		db.AppImages = []*dbEntry{}
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(db.AppImages)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tSIGNATURE\tLAST LAUNCHED\tPATH")
+	for _, e := range db.AppImages {
+		launched := "never"
+		if e.LastLaunched != nil {
+			launched = e.LastLaunched.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Name, e.Version, e.Signature, launched, e.Path)
+	}
+	return w.Flush()
+}
+
+// configCommand prints the configuration in effect (show), or checks
+// the configuration file at the given path or the default location (validate)
+func configCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: config show|validate [<path>]")
+	}
+	switch {
+	case args[0] == "show" && len(args) == 1:
+		c, err := loadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		applyFlags(&c)
+		fmt.Println("# " + configPath)
+		return c.write(os.Stdout)
+	case args[0] == "validate" && len(args) <= 2:
+		path := configPath
+		if len(args) == 2 {
+			path = args[1]
+		}
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+		if _, err := loadConfig(path); err != nil {
+			return err
+		}
+		fmt.Println(path + ": OK")
+		return nil
+	}
+	return errors.New("usage: config show|validate [<path>]")
+}
@@ -0,0 +1,574 @@
+package main
+
+// Reads the configuration file, e.g.,
+//
+//	# ~/.config/appimaged/appimaged.conf
+//	[General]
+//	# Same as -v, -o and -c; flags given on the command line take precedence
+//	Verbose=false
+//	Overwrite=false
+//	Clean=true
+//
+//	[Directories]
+//	# Whether to watch the default directories ($PATH, ~/Applications, ~/Downloads, ...)
+//	Defaults=true
+//	# How many levels of subdirectories to watch, unless given for a directory
+//	Depth=0
+//	# Additional directories, optionally with their own depth after a ":"
+//	Include=~/Applications:2
+//	Include=/mnt/nas/AppImages
+//	# Directories that are not watched, including their subdirectories
+//	Exclude=~/Downloads/Old
+//	# Files and directories whose names match one of these globs are ignored
+//	Ignore=*.zs-old
+//	Ignore=.*
+//
+//	[Notifications]
+//	# Whether to send desktop notifications at all (-q sets this to false)
+//	Enabled=true
+//	# When AppImages are added and removed
+//	Integration=true
+//	# When updates become available
+//	Updates=true
+//	# When something goes wrong, e.g., an application crashes
+//	Errors=true
+//
+//	[Sandbox]
+//	# Which sandbox is used: auto, firejail, bwrap or none. AppImages that declare
+//	# X-AppImage-Permissions (see sandbox.go) run in it with these permissions
+//	Backend=auto
+//	# Whether to run the other AppImages in the sandbox too, with all permissions
+//	Default=false
+//	# Whether AppImages with permissions run with all permissions when there is no sandbox,
+//	# rather than not at all
+//	AllowUnsandboxed=false
+//
+//	[Updates]
+//	# Whether to subscribe to update notifications
+//	Check=true
+//	# Criteria for choosing the most recent AppImage (same as -precedence)
+//	Precedence=version,fstime,mtime
+//
+//	[MQTT]
+//	# The broker and topic namespace over which update notifications are received
+//	Broker=http://broker.hivemq.com:1883
+//	Namespace=p9q358t
+//
+//	[Menu]
+//	# Commands that are run after desktop files were changed, replacing the default ones.
+//	# An empty value means that no commands are run
+//	UpdateCommand=update-menus
+//	UpdateCommand=update-desktop-database $XDG_DATA_HOME/applications
+//
+//	[Thumbnails]
+//	# Whether to regenerate thumbnails that are newer than their AppImage
+//	Regenerate=false
+//	# Whether to convert SVG icons to PNG thumbnails (slow), rather than using a generic icon
+//	ConvertSVG=true
+//
+// Changes to the file are picked up while appimaged is running, and on SIGHUP.
+// Changes to [MQTT] need a restart of appimaged, changes to [Sandbox] apply to the context menus of
+// AppImages that are integrated afterwards.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adrg/xdg"
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"gopkg.in/ini.v1"
+)
+
+var configPath = filepath.Join(xdg.ConfigHome, "appimaged", "appimaged.conf")
+
+// config is the configuration of appimaged, with one field for each section of the configuration file
+type config struct {
+	General       generalConfig
+	Directories   directoryConfig
+	Notifications notificationConfig
+	Sandbox       sandboxConfig
+	Updates       updateConfig
+	MQTT          mqttConfig
+	Menu          menuConfig
+	Thumbnails    thumbnailConfig
+}
+
+// generalConfig is the [General] section of the configuration file
+type generalConfig struct {
+	Verbose   bool
+	Overwrite bool
+	Clean     bool
+}
+
+// A directory that is watched together with its subdirectories up to Depth levels deep
+type watchRoot struct {
+	Dir   string
+	Depth int
+}
+
+// directoryConfig is the [Directories] section of the configuration file
+type directoryConfig struct {
+	Defaults bool
+	Depth    int
+	Include  []watchRoot
+	Exclude  []string
+	Ignore   []string
+}
+
+// notificationConfig is the [Notifications] section of the configuration file
+type notificationConfig struct {
+	Enabled     bool
+	Integration bool
+	Updates     bool
+	Errors      bool
+}
+
+// Sandboxes that can be used for running AppImages
+const (
+	sandboxAuto     = "auto"
+	sandboxFirejail = "firejail"
+	sandboxBwrap    = "bwrap"
+	sandboxNone     = "none"
+)
+
+// sandboxConfig is the [Sandbox] section of the configuration file
+type sandboxConfig struct {
+	Backend          string
+	Default          bool
+	AllowUnsandboxed bool
+}
+
+// updateConfig is the [Updates] section of the configuration file
+type updateConfig struct {
+	Check      bool
+	Precedence []string
+}
+
+// mqttConfig is the [MQTT] section of the configuration file
+type mqttConfig struct {
+	Broker    string
+	Namespace string
+}
+
+// menuConfig is the [Menu] section of the configuration file
+type menuConfig struct {
+	UpdateCommands [][]string
+}
+
+// thumbnailConfig is the [Thumbnails] section of the configuration file
+type thumbnailConfig struct {
+	Regenerate bool
+	ConvertSVG bool
+}
+
+// The keys that may appear in each section of the configuration file
+var configKeys = map[string][]string{
+	"General":       {"Verbose", "Overwrite", "Clean"},
+	"Directories":   {"Defaults", "Depth", "Include", "Exclude", "Ignore"},
+	"Notifications": {"Enabled", "Integration", "Updates", "Errors"},
+	"Sandbox":       {"Backend", "Default", "AllowUnsandboxed"},
+	"Updates":       {"Check", "Precedence"},
+	"MQTT":          {"Broker", "Namespace"},
+	"Menu":          {"UpdateCommand"},
+	"Thumbnails":    {"Regenerate", "ConvertSVG"},
+}
+
+func defaultConfig() config {
+	return config{
+		General:       generalConfig{Clean: true},
+		Directories:   directoryConfig{Defaults: true},
+		Notifications: notificationConfig{Enabled: true, Integration: true, Updates: true, Errors: true},
+		Sandbox:       sandboxConfig{Backend: sandboxAuto},
+		Updates:       updateConfig{Check: true, Precedence: helpers.DefaultVersionPrecedence},
+		MQTT:          mqttConfig{Broker: helpers.MQTTServerURI, Namespace: helpers.MQTTNamespace},
+		Menu: menuConfig{UpdateCommands: [][]string{
+			{"update-menus"}, // Needed on Ubuntu MATE so that the menu gets populated
+			// "Build cache database of MIME types handled by desktop files."
+			{"update-desktop-database", filepath.Join(xdg.DataHome, "applications")},
+		}},
+		Thumbnails: thumbnailConfig{ConvertSVG: true},
+	}
+}
+
+// loadConfig reads the configuration file at path.
+// If the file does not exist, the defaults are returned
+func loadConfig(path string) (config, error) {
+	c := defaultConfig()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return c, nil
+	}
+	cfg, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true, IgnoreInlineComment: true}, path)
+	if err != nil {
+		return c, err
+	}
+	if err = checkConfigKeys(cfg); err != nil {
+		return c, errors.New(path + ": " + err.Error())
+	}
+	for _, load := range []func(*ini.File) error{
+		c.General.load,
+		c.Directories.load,
+		c.Notifications.load,
+		c.Sandbox.load,
+		c.Updates.load,
+		c.MQTT.load,
+		c.Menu.load,
+		c.Thumbnails.load,
+	} {
+		if err = load(cfg); err != nil {
+			return c, errors.New(path + ": " + err.Error())
+		}
+	}
+	return c, nil
+}
+
+// checkConfigKeys returns an error for sections and keys we do not know,
+// which most likely are typos
+func checkConfigKeys(cfg *ini.File) error {
+	for _, sec := range cfg.Sections() {
+		known, ok := configKeys[sec.Name()]
+		if !ok {
+			if sec.Name() == ini.DefaultSection && len(sec.Keys()) == 0 {
+				continue
+			}
+			if sec.Name() == ini.DefaultSection {
+				return errors.New(sec.Keys()[0].Name() + " is not in a section")
+			}
+			return errors.New("Unknown section [" + sec.Name() + "]")
+		}
+		for _, key := range sec.Keys() {
+			if !helpers.SliceContains(known, key.Name()) {
+				return errors.New("Unknown key " + key.Name() + " in [" + sec.Name() + "]")
+			}
+		}
+	}
+	return nil
+}
+
+// loadBool sets *v to the value of key in sec, if it is there
+func loadBool(sec *ini.Section, key string, v *bool) error {
+	if !sec.HasKey(key) {
+		return nil
+	}
+	b, err := sec.Key(key).Bool()
+	if err != nil {
+		return errors.New(key + " in [" + sec.Name() + "] must be true or false")
+	}
+	*v = b
+	return nil
+}
+
+func (c *generalConfig) load(cfg *ini.File) error {
+	sec := cfg.Section("General")
+	for key, v := range map[string]*bool{"Verbose": &c.Verbose, "Overwrite": &c.Overwrite, "Clean": &c.Clean} {
+		if err := loadBool(sec, key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *directoryConfig) load(cfg *ini.File) error {
+	sec := cfg.Section("Directories")
+	if err := loadBool(sec, "Defaults", &c.Defaults); err != nil {
+		return err
+	}
+	if sec.HasKey("Depth") {
+		var err error
+		if c.Depth, err = sec.Key("Depth").Int(); err != nil || c.Depth < 0 {
+			return errors.New("Depth must be a number of at least 0")
+		}
+	}
+	for _, v := range sec.Key("Include").ValueWithShadows() {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		root := watchRoot{Dir: v, Depth: c.Depth}
+		if i := strings.LastIndex(v, ":"); i >= 0 {
+			if depth, err := strconv.Atoi(v[i+1:]); err == nil {
+				if depth < 0 {
+					return errors.New("Depth of " + v[:i] + " must be at least 0")
+				}
+				root = watchRoot{Dir: v[:i], Depth: depth}
+			}
+		}
+		root.Dir = expandPath(root.Dir)
+		if !filepath.IsAbs(root.Dir) {
+			return errors.New("Include must be an absolute path: " + v)
+		}
+		c.Include = append(c.Include, root)
+	}
+	for _, v := range sec.Key("Exclude").ValueWithShadows() {
+		if v = strings.TrimSpace(v); v != "" {
+			c.Exclude = append(c.Exclude, expandPath(v))
+		}
+	}
+	for _, v := range sec.Key("Ignore").ValueWithShadows() {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if _, err := filepath.Match(v, ""); err != nil {
+			return errors.New("Invalid glob in Ignore: " + v)
+		}
+		c.Ignore = append(c.Ignore, v)
+	}
+	return nil
+}
+
+func (c *notificationConfig) load(cfg *ini.File) error {
+	sec := cfg.Section("Notifications")
+	for key, v := range map[string]*bool{"Enabled": &c.Enabled, "Integration": &c.Integration, "Updates": &c.Updates, "Errors": &c.Errors} {
+		if err := loadBool(sec, key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *sandboxConfig) load(cfg *ini.File) error {
+	sec := cfg.Section("Sandbox")
+	if sec.HasKey("Backend") {
+		c.Backend = strings.TrimSpace(sec.Key("Backend").String())
+		switch c.Backend {
+		case sandboxAuto, sandboxFirejail, sandboxBwrap, sandboxNone:
+		default:
+			return errors.New("Backend in [Sandbox] must be one of auto, firejail, bwrap, none")
+		}
+	}
+	if err := loadBool(sec, "Default", &c.Default); err != nil {
+		return err
+	}
+	return loadBool(sec, "AllowUnsandboxed", &c.AllowUnsandboxed)
+}
+
+func (c *updateConfig) load(cfg *ini.File) error {
+	sec := cfg.Section("Updates")
+	if err := loadBool(sec, "Check", &c.Check); err != nil {
+		return err
+	}
+	if sec.HasKey("Precedence") {
+		precedence, err := helpers.ParseVersionPrecedence(sec.Key("Precedence").String())
+		if err != nil {
+			return errors.New("Precedence in [Updates]: " + err.Error())
+		}
+		c.Precedence = precedence
+	}
+	return nil
+}
+
+func (c *mqttConfig) load(cfg *ini.File) error {
+	sec := cfg.Section("MQTT")
+	if sec.HasKey("Broker") {
+		c.Broker = strings.TrimSpace(sec.Key("Broker").String())
+		if uri, err := url.Parse(c.Broker); err != nil || uri.Host == "" {
+			return errors.New("Broker in [MQTT] must be a URI like tcp://host:port")
+		}
+	}
+	if sec.HasKey("Namespace") {
+		c.Namespace = strings.TrimSpace(sec.Key("Namespace").String())
+		if c.Namespace == "" || strings.ContainsAny(c.Namespace, "/#+") {
+			return errors.New("Namespace in [MQTT] must not be empty or contain /, # or +")
+		}
+	}
+	return nil
+}
+
+func (c *menuConfig) load(cfg *ini.File) error {
+	sec := cfg.Section("Menu")
+	if !sec.HasKey("UpdateCommand") {
+		return nil
+	}
+	c.UpdateCommands = nil
+	for _, v := range sec.Key("UpdateCommand").ValueWithShadows() {
+		var command []string
+		for _, arg := range strings.Fields(v) {
+			command = append(command, expandPath(arg))
+		}
+		if len(command) > 0 {
+			c.UpdateCommands = append(c.UpdateCommands, command)
+		}
+	}
+	return nil
+}
+
+func (c *thumbnailConfig) load(cfg *ini.File) error {
+	sec := cfg.Section("Thumbnails")
+	if err := loadBool(sec, "Regenerate", &c.Regenerate); err != nil {
+		return err
+	}
+	return loadBool(sec, "ConvertSVG", &c.ConvertSVG)
+}
+
+// write writes c in the format of the configuration file
+func (c config) write(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[General]\nVerbose=%t\nOverwrite=%t\nClean=%t\n", c.General.Verbose, c.General.Overwrite, c.General.Clean)
+	fmt.Fprintf(&b, "\n[Directories]\nDefaults=%t\nDepth=%d\n", c.Directories.Defaults, c.Directories.Depth)
+	for _, root := range c.Directories.Include {
+		fmt.Fprintf(&b, "Include=%s:%d\n", root.Dir, root.Depth)
+	}
+	for _, dir := range c.Directories.Exclude {
+		fmt.Fprintf(&b, "Exclude=%s\n", dir)
+	}
+	for _, pattern := range c.Directories.Ignore {
+		fmt.Fprintf(&b, "Ignore=%s\n", pattern)
+	}
+	n := c.Notifications
+	fmt.Fprintf(&b, "\n[Notifications]\nEnabled=%t\nIntegration=%t\nUpdates=%t\nErrors=%t\n", n.Enabled, n.Integration, n.Updates, n.Errors)
+	fmt.Fprintf(&b, "\n[Sandbox]\nBackend=%s\nDefault=%t\nAllowUnsandboxed=%t\n", c.Sandbox.Backend, c.Sandbox.Default, c.Sandbox.AllowUnsandboxed)
+	fmt.Fprintf(&b, "\n[Updates]\nCheck=%t\nPrecedence=%s\n", c.Updates.Check, strings.Join(c.Updates.Precedence, ","))
+	fmt.Fprintf(&b, "\n[MQTT]\nBroker=%s\nNamespace=%s\n", c.MQTT.Broker, c.MQTT.Namespace)
+	b.WriteString("\n[Menu]\n")
+	if len(c.Menu.UpdateCommands) == 0 {
+		b.WriteString("UpdateCommand=\n")
+	}
+	for _, command := range c.Menu.UpdateCommands {
+		fmt.Fprintf(&b, "UpdateCommand=%s\n", strings.Join(command, " "))
+	}
+	fmt.Fprintf(&b, "\n[Thumbnails]\nRegenerate=%t\nConvertSVG=%t\n", c.Thumbnails.Regenerate, c.Thumbnails.ConvertSVG)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// expandPath expands a leading "~" and environment variables
+func expandPath(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		p = home + p[1:]
+	}
+	p = os.ExpandEnv(p)
+	if !strings.Contains(p, "/") {
+		return p // Not a path, e.g., the name of a command
+	}
+	return filepath.Clean(p)
+}
+
+// backend returns the sandbox to be used, or sandboxNone if it is not available.
+// auto prefers Firejail over bubblewrap
+func (c sandboxConfig) backend() string {
+	for _, backend := range []string{sandboxFirejail, sandboxBwrap} {
+		if (c.Backend == backend || c.Backend == sandboxAuto) && helpers.IsCommandAvailable(backend) {
+			return backend
+		}
+	}
+	return sandboxNone
+}
+
+// roots returns the directories to be watched, given the default directories
+// and the Applications directories on mounted partitions
+func (c directoryConfig) roots(defaults []string, mounts []string) []watchRoot {
+	var roots []watchRoot
+	if c.Defaults {
+		for _, dir := range defaults {
+			if filepath.IsAbs(dir) { // $PATH may contain relative or empty entries
+				roots = append(roots, watchRoot{Dir: filepath.Clean(dir), Depth: c.Depth})
+			}
+		}
+		for _, dir := range mounts {
+			roots = append(roots, watchRoot{Dir: filepath.Clean(dir), Depth: c.Depth})
+		}
+	}
+	return append(roots, c.Include...)
+}
+
+// excluded returns true if dir is one of the excluded directories or inside of one
+func (c directoryConfig) excluded(dir string) bool {
+	for _, ex := range c.Exclude {
+		if dir == ex || strings.HasPrefix(dir, ex+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored returns true if the name of a file or directory matches one of the globs to be ignored
+func (c directoryConfig) ignored(name string) bool {
+	for _, pattern := range c.Ignore {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tree adds the directories below root that are to be watched to dirs,
+// which maps them to how many more levels of subdirectories are to be watched
+func (c directoryConfig) tree(root watchRoot, dirs map[string]int) {
+	if c.excluded(root.Dir) {
+		return
+	}
+	if depth, ok := dirs[root.Dir]; ok && depth >= root.Depth {
+		return
+	}
+	fi, err := os.Stat(root.Dir)
+	if err != nil || !fi.IsDir() {
+		return
+	}
+	dirs[root.Dir] = root.Depth
+	if root.Depth == 0 {
+		return
+	}
+	ents, err := os.ReadDir(root.Dir)
+	if err != nil {
+		return
+	}
+	for _, ent := range ents {
+		// Symlinks are not followed so that we cannot end up in loops
+		if ent.IsDir() && !c.ignored(ent.Name()) {
+			c.tree(watchRoot{Dir: filepath.Join(root.Dir, ent.Name()), Depth: root.Depth - 1}, dirs)
+		}
+	}
+}
+
+var configuration = defaultConfig()
+var configurationLock sync.RWMutex
+
+func currentConfig() config {
+	configurationLock.RLock()
+	defer configurationLock.RUnlock()
+	return configuration
+}
+
+// reloadConfig reads the configuration file again and applies the flags given on the
+// command line. If the file is invalid, the previous configuration is kept and,
+// if notify is true, the user is told about it
+func reloadConfig(notify bool) {
+	c, err := loadConfig(configPath)
+	if err != nil {
+		if notify {
+			helpers.PrintError("config", err)
+			sendErrorDesktopNotification("Invalid configuration", err.Error())
+		}
+		return
+	}
+	applyFlags(&c)
+	configurationLock.Lock()
+	old := configuration
+	configuration = c
+	configurationLock.Unlock()
+	if c.General.Verbose {
+		log.Println("config: Loaded", configPath)
+	}
+	if old.MQTT != c.MQTT && MQTTclient != nil {
+		log.Println("config: Restart appimaged to use", c.MQTT.Broker, "with namespace", c.MQTT.Namespace)
+	}
+}
+
+// watchConfigFile watches the directory containing the configuration file,
+// so that changes are picked up without restarting
+func watchConfigFile() {
+	dir := filepath.Dir(configPath)
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = AddWatchDir(dir)
+	}
+	helpers.LogError("config: watch", err)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDirectoryConfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{
+		"Applications/Vendor/App",
+		"Applications/Vendor/App/deeper",
+		"Applications/.hidden",
+		"Applications/Old",
+		"NAS/a/b",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TESTDIR", dir)
+	path := filepath.Join(dir, "appimaged.conf")
+	err := os.WriteFile(path, []byte(`[Directories]
+Defaults=false
+Depth=1
+Include=$TESTDIR/Applications:2
+Include=$TESTDIR/NAS
+Exclude=$TESTDIR/Applications/Old
+Ignore=.*
+Ignore=*.zs-old
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cfg.Directories
+	roots := c.roots([]string{"/usr/bin"}, []string{"/media/usb/Applications"})
+	want := []watchRoot{{filepath.Join(dir, "Applications"), 2}, {filepath.Join(dir, "NAS"), 1}}
+	if !reflect.DeepEqual(roots, want) {
+		t.Errorf("Expected the roots %v, got %v", want, roots)
+	}
+	dirs := make(map[string]int)
+	for _, root := range roots {
+		c.tree(root, dirs)
+	}
+	wantDirs := map[string]int{
+		filepath.Join(dir, "Applications"):            2,
+		filepath.Join(dir, "Applications/Vendor"):     1,
+		filepath.Join(dir, "Applications/Vendor/App"): 0,
+		filepath.Join(dir, "NAS"):                     1,
+		filepath.Join(dir, "NAS/a"):                   0,
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("Expected the directories %v, got %v", wantDirs, dirs)
+	}
+	if !c.ignored("App.AppImage.zs-old") || c.ignored("App.AppImage") {
+		t.Error("Ignore globs are not applied correctly")
+	}
+
+	// Defaults
+	cfg, err = loadConfig(filepath.Join(dir, "nonexistent.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = cfg.Directories
+	roots = c.roots([]string{"/usr/bin", "", "bin"}, []string{"/media/usb/Applications"})
+	want = []watchRoot{{"/usr/bin", 0}, {"/media/usb/Applications", 0}}
+	if !reflect.DeepEqual(roots, want) {
+		t.Errorf("Expected the default roots %v, got %v", want, roots)
+	}
+
+	for _, bad := range []string{
+		"[Directories]\nDepth=-1\n",
+		"[Directories]\nDefaults=maybe\n",
+		"[Directories]\nInclude=relative/path\n",
+		"[Directories]\nIgnore=[\n",
+	} {
+		if err = os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = loadConfig(path); err == nil {
+			t.Errorf("Invalid configuration was accepted: %q", bad)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "appimaged.conf")
+	err := os.WriteFile(path, []byte(`# Comment
+[General]
+Verbose=true
+
+[Notifications]
+Integration=false
+
+[Sandbox]
+Backend=none
+Default=true
+
+[Updates]
+Check=false
+Precedence=semver,mtime
+
+[MQTT]
+Broker=tcp://mqtt.example.com:1883
+Namespace=test
+
+[Menu]
+UpdateCommand=update-desktop-database ~/applications
+UpdateCommand=kbuildsycoca5
+
+[Thumbnails]
+Regenerate=true
+ConvertSVG=false
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultConfig()
+	want.General.Verbose = true
+	want.Notifications.Integration = false
+	want.Sandbox = sandboxConfig{Backend: sandboxNone, Default: true}
+	want.Updates = updateConfig{Check: false, Precedence: []string{"semver", "mtime"}}
+	want.MQTT = mqttConfig{Broker: "tcp://mqtt.example.com:1883", Namespace: "test"}
+	want.Menu.UpdateCommands = [][]string{{"update-desktop-database", filepath.Join(home, "applications")}, {"kbuildsycoca5"}}
+	want.Thumbnails = thumbnailConfig{Regenerate: true, ConvertSVG: false}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Expected %+v, got %+v", want, c)
+	}
+	if c.Sandbox.backend() != sandboxNone {
+		t.Error("A sandbox is used although Backend is none")
+	}
+
+	// What "appimaged config show" prints can be read again
+	var buf bytes.Buffer
+	if err = c.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if reread, err := loadConfig(path); err != nil || !reflect.DeepEqual(reread, c) {
+		t.Errorf("Expected %+v after writing and reading it again, got %+v, %v\n%s", c, reread, err, buf.String())
+	}
+
+	// An empty UpdateCommand means that no commands are run
+	if err = os.WriteFile(path, []byte("[Menu]\nUpdateCommand=\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = loadConfig(path); err != nil || len(c.Menu.UpdateCommands) != 0 {
+		t.Errorf("Expected no menu update commands, got %v, %v", c.Menu.UpdateCommands, err)
+	}
+
+	for _, bad := range []string{
+		"Verbose=true\n",
+		"[Genral]\nVerbose=true\n",
+		"[General]\nVerbos=true\n",
+		"[Notifications]\nEnabled=yes please\n",
+		"[Sandbox]\nBackend=docker\n",
+		"[Updates]\nPrecedence=newest\n",
+		"[MQTT]\nBroker=broker\n",
+		"[MQTT]\nNamespace=a/b\n",
+	} {
+		if err = os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = loadConfig(path); err == nil {
+			t.Errorf("Invalid configuration was accepted: %q", bad)
+		}
+	}
+}
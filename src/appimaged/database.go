@@ -0,0 +1,343 @@
+package main
+
+// Keeps track of the integrated AppImages in a JSON file, so that
+// AppImages that have not changed since they were integrated do not
+// need to be opened again on every start, and so that other processes
+// (e.g., "appimaged list") can query what is integrated.
+// Every change is a transaction: while holding an exclusive lock,
+// the file is read, changed, and atomically replaced.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-appimage/src/goappimage"
+)
+
+var databasePath = filepath.Join(xdg.StateHome, "appimaged", "database.json")
+
+const databaseVersion = 1
+
+// Signature status of an AppImage in the database
+const (
+	signatureUnsigned = "unsigned"
+	signatureValid    = "valid"
+	signatureInvalid  = "invalid"
+)
+
+// dbEntry describes an integrated AppImage.
+// Size, MTime and Inode are used to detect whether the file has changed
+type dbEntry struct {
+	Path              string     `json:"path"`
+	MD5               string     `json:"md5"`
+	Size              int64      `json:"size"`
+	MTime             time.Time  `json:"mtime"`
+	Inode             uint64     `json:"inode"`
+	Name              string     `json:"name"`
+	Version           string     `json:"version,omitempty"`
+	UpdateInformation string     `json:"updateinformation,omitempty"`
+	Signature         string     `json:"signature"`
+	Signer            string     `json:"signer,omitempty"`
+	SignerKey         string     `json:"signer_key,omitempty"` // Fingerprint of the key of a valid signature
+	Problems          string     `json:"problems,omitempty"` // Errors found by the linter when it was integrated
+	Integrator        string     `json:"integrator,omitempty"` // The appimaged that wrote the desktop file, see integrator()
+	FirstSeen         time.Time  `json:"first_seen"`
+	LastLaunched      *time.Time `json:"last_launched,omitempty"`
+}
+
+type database struct {
+	Version   int        `json:"version"`
+	AppImages []*dbEntry `json:"appimages"`
+}
+
+func (db *database) lookup(path string) *dbEntry {
+	for _, e := range db.AppImages {
+		if e.Path == path {
+			return e
+		}
+	}
+	return nil
+}
+
+// put adds e, or replaces the entry with the same path
+func (db *database) put(e *dbEntry) {
+	for i, old := range db.AppImages {
+		if old.Path == e.Path {
+			db.AppImages[i] = e
+			return
+		}
+	}
+	db.AppImages = append(db.AppImages, e)
+}
+
+func (db *database) remove(path string) bool {
+	for i, e := range db.AppImages {
+		if e.Path == path {
+			db.AppImages = append(db.AppImages[:i], db.AppImages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// readDatabase reads the database, which is empty if it does not exist yet.
+// No lock is needed for reading since the file is replaced atomically
+func readDatabase() (*database, error) {
+	db := &database{Version: databaseVersion}
+	data, err := os.ReadFile(databasePath)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return db, err
+	}
+	if err = json.Unmarshal(data, db); err != nil {
+		return &database{Version: databaseVersion}, errors.New("could not parse " + databasePath + ": " + err.Error())
+	}
+	if db.Version > databaseVersion {
+		return &database{Version: databaseVersion}, errors.New(databasePath + " was written by a newer version of appimaged")
+	}
+	return db, nil
+}
+
+// updateDatabase calls change with the current contents of the database and writes
+// the result back unless change returns false or an error. Other processes
+// that want to change the database at the same time wait for us
+func updateDatabase(change func(db *database) (bool, error)) error {
+	dir := filepath.Dir(databasePath)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(databasePath+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	db, err := readDatabase()
+	if err != nil {
+		// Start over rather than being stuck with a broken database forever
+		helpers.LogError("database", err)
+	}
+	changed, err := change(db)
+	if err != nil || !changed {
+		return err
+	}
+	sort.Slice(db.AppImages, func(i, j int) bool { return db.AppImages[i].Path < db.AppImages[j].Path })
+	db.Version = databaseVersion
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file next to the database and rename it over
+	// the database, so that readers never see a partially written file
+	tmp, err := os.CreateTemp(dir, ".database-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(append(data, '\n')); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), databasePath)
+}
+
+// fileIdentity returns the size, mtime and inode of fi
+func fileIdentity(fi os.FileInfo) (int64, time.Time, uint64) {
+	var inode uint64
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		inode = st.Ino
+	}
+	return fi.Size(), fi.ModTime().UTC(), inode
+}
+
+// unchanged returns true if fi looks like the file that e was made from
+func (e *dbEntry) unchanged(fi os.FileInfo) bool {
+	size, mtime, inode := fileIdentity(fi)
+	return e.Size == size && e.MTime.Equal(mtime) && e.Inode == inode
+}
+
+// integrator identifies this appimaged by its path and build, which end up in the desktop files
+// it writes, e.g., in Exec= and TryExec=, and in the actions it adds
+func integrator() string {
+	arg0abs, _ := filepath.Abs(os.Args[0])
+	return arg0abs + " " + commit
+}
+
+// upToDate returns true if fi looks like the file that e was made from, and the desktop file
+// was written by this appimaged rather than by one that has been moved or upgraded since
+func (e *dbEntry) upToDate(fi os.FileInfo) bool {
+	return e.unchanged(fi) && e.Integrator == integrator()
+}
+
+// newDBEntry describes ai, of which fi is the result of os.Stat
+func newDBEntry(ai *AppImage, fi os.FileInfo) *dbEntry {
+	e := &dbEntry{
+		Path:              ai.Path,
+		MD5:               ai.md5,
+		Name:              ai.Name,
+		Version:           ai.Version,
+		UpdateInformation: ai.updateinformation,
+		FirstSeen:         time.Now().UTC(),
+		Integrator:        integrator(),
+	}
+	e.Size, e.MTime, e.Inode = fileIdentity(fi)
+	e.Signature, e.Signer, e.SignerKey = signatureStatus(ai.Path)
+	// Lint it once here rather than on every launch, which would read the whole squashfs each time
+	if err := ai.Validate(); err != nil {
+		log.Println("database:", ai.Path, "is not a proper AppImage:", err)
+		e.Problems = err.Error()
+	}
+	return e
+}
+
+// signatureStatus checks the signature embedded in the AppImage at path
+// and returns its status, the signer and the fingerprint of the key, if any
+func signatureStatus(path string) (string, string, string) {
+	key, err := helpers.GetSectionData(path, ".sig_key")
+	if err != nil || len(bytes.Trim(key, "\x00")) == 0 {
+		return signatureUnsigned, "", ""
+	}
+	ent, err := helpers.CheckSignature(path)
+	if err != nil || ent == nil || ent.PrimaryKey == nil {
+		return signatureInvalid, "", ""
+	}
+	fingerprint := fmt.Sprintf("%X", ent.PrimaryKey.Fingerprint)
+	var names []string
+	for name := range ent.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return signatureValid, "", fingerprint
+	}
+	return signatureValid, names[0], fingerprint
+}
+
+// verifiedSigningKey returns the fingerprint of the key that the AppImage at path was found to be
+// validly signed with when it was integrated, or "" if it was not or has changed since
+func verifiedSigningKey(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	db, err := readDatabase()
+	if err != nil {
+		return ""
+	}
+	e := db.lookup(path)
+	if e == nil || !e.unchanged(fi) || e.Signature != signatureValid {
+		return ""
+	}
+	return e.SignerKey
+}
+
+// appImage returns an AppImage for the integrated AppImage described by e
+// without opening the file
+func (e *dbEntry) appImage() *AppImage {
+	ai := &AppImage{
+		AppImage: &goappimage.AppImage{
+			Path:       e.Path,
+			Name:       e.Name,
+			Version:    e.Version,
+			UpdateInfo: e.UpdateInformation,
+		},
+		updateinformation: e.UpdateInformation,
+	}
+	ai.calculateIntegrationPaths()
+	return ai
+}
+
+// recordIntegration stores ai in the database, keeping what we already know about it
+func recordIntegration(ai *AppImage, fi os.FileInfo) {
+	e := newDBEntry(ai, fi) // Checking the signature and linting take a while, do not hold the lock meanwhile
+	err := updateDatabase(func(db *database) (bool, error) {
+		if old := db.lookup(ai.Path); old != nil {
+			e.FirstSeen = old.FirstSeen
+			e.LastLaunched = old.LastLaunched
+		}
+		db.put(e)
+		return true, nil
+	})
+	helpers.LogError("database", err)
+}
+
+// recordUnintegration removes the AppImages at paths from the database
+func recordUnintegration(paths ...string) {
+	err := updateDatabase(func(db *database) (bool, error) {
+		changed := false
+		for _, path := range paths {
+			if db.remove(path) {
+				changed = true
+			}
+		}
+		return changed, nil
+	})
+	helpers.LogError("database", err)
+}
+
+// recordMove moves the entry of an AppImage that has been moved from oldPath to newPath
+func recordMove(oldPath string, newPath string, md5 string) {
+	err := updateDatabase(func(db *database) (bool, error) {
+		e := db.lookup(oldPath)
+		if e == nil {
+			return false, nil
+		}
+		db.remove(newPath)
+		e.Path = newPath
+		e.MD5 = md5
+		return true, nil
+	})
+	helpers.LogError("database", err)
+}
+
+// recordLaunch remembers when the AppImage at path was launched, if it is integrated
+func recordLaunch(path string) {
+	err := updateDatabase(func(db *database) (bool, error) {
+		e := db.lookup(path)
+		if e == nil {
+			return false, nil
+		}
+		now := time.Now().UTC()
+		e.LastLaunched = &now
+		return true, nil
+	})
+	helpers.LogError("database", err)
+}
+
+// pruneDatabase removes AppImages that no longer exist from the database
+func pruneDatabase() {
+	err := updateDatabase(func(db *database) (bool, error) {
+		changed := false
+		for _, e := range append([]*dbEntry{}, db.AppImages...) {
+			if _, err := os.Stat(e.Path); os.IsNotExist(err) {
+				db.remove(e.Path)
+				changed = true
+			}
+		}
+		return changed, nil
+	})
+	helpers.LogError("database", err)
+}
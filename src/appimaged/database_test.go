@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+func TestDatabase(t *testing.T) {
+	dir := t.TempDir()
+	oldDatabasePath := databasePath
+	databasePath = filepath.Join(dir, "state", "database.json")
+	defer func() { databasePath = oldDatabasePath }()
+
+	db, err := readDatabase()
+	if err != nil || len(db.AppImages) != 0 {
+		t.Fatal("Expected an empty database before anything was written:", db, err)
+	}
+
+	// Concurrent changes must not get lost
+	var wg sync.WaitGroup
+	for _, name := range []string{"b", "a", "c", "d"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			path := filepath.Join(dir, name+".AppImage")
+			if err := os.WriteFile(path, []byte(name), 0755); err != nil {
+				t.Error(err)
+				return
+			}
+			fi, _ := os.Stat(path)
+			ai := (&dbEntry{Path: path, Name: name}).appImage()
+			recordIntegration(ai, fi)
+		}(name)
+	}
+	wg.Wait()
+
+	db, err = readDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.AppImages) != 4 || db.AppImages[0].Name != "a" || db.AppImages[3].Name != "d" {
+		t.Fatalf("Unexpected database contents: %+v", db.AppImages)
+	}
+	e := db.lookup(filepath.Join(dir, "c.AppImage"))
+	if e.Signature != signatureUnsigned || e.FirstSeen.IsZero() || e.LastLaunched != nil {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+	fi, _ := os.Stat(e.Path)
+	if !e.unchanged(fi) {
+		t.Error("Entry does not match the unchanged file")
+	}
+	if err = os.WriteFile(e.Path, []byte("changed"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ = os.Stat(e.Path)
+	if e.unchanged(fi) {
+		t.Error("Entry matches the changed file")
+	}
+
+	recordLaunch(e.Path)
+	os.Remove(filepath.Join(dir, "a.AppImage"))
+	pruneDatabase()
+	recordUnintegration(filepath.Join(dir, "b.AppImage"))
+	db, _ = readDatabase()
+	if len(db.AppImages) != 2 {
+		t.Fatalf("Expected 2 AppImages, got %+v", db.AppImages)
+	}
+	if e = db.lookup(e.Path); e.LastLaunched == nil || time.Since(*e.LastLaunched) > time.Minute {
+		t.Errorf("Launch was not recorded: %+v", e)
+	}
+
+	// Leftover temporary files would pile up over time
+	ents, _ := os.ReadDir(filepath.Dir(databasePath))
+	for _, ent := range ents {
+		if ent.Name() != "database.json" && ent.Name() != "database.json.lock" {
+			t.Error("Unexpected file next to the database:", ent.Name())
+		}
+	}
+}
+
+func TestIntegrateFromDatabaseAfterClean(t *testing.T) {
+	dir := t.TempDir()
+	oldDatabasePath, oldDataHome := databasePath, xdg.DataHome
+	databasePath = filepath.Join(dir, "state", "database.json")
+	xdg.DataHome = filepath.Join(dir, "data")
+	configurationLock.Lock()
+	oldConfiguration := configuration
+	configuration.General.Clean = true
+	configuration.General.Overwrite = false
+	configurationLock.Unlock()
+	defer func() {
+		databasePath, xdg.DataHome = oldDatabasePath, oldDataHome
+		configurationLock.Lock()
+		configuration = oldConfiguration
+		configurationLock.Unlock()
+	}()
+
+	// Not a real AppImage, so that integrating it only works from the database
+	path := filepath.Join(dir, "Test-x86_64.AppImage")
+	if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(path)
+	ai := (&dbEntry{Path: path, Name: "Test"}).appImage()
+	recordIntegration(ai, fi)
+	stale := filepath.Join(xdg.DataHome, "applications", "appimagekit_stale.desktop")
+	os.MkdirAll(filepath.Dir(stale), 0755)
+	for _, desktopFile := range []string{ai.desktopfilepath, stale} {
+		if err := os.WriteFile(desktopFile, []byte("[Desktop Entry]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleanDesktopFiles()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected the desktop file of an AppImage that is not in the database to be deleted")
+	}
+	if _, err := os.Stat(ai.desktopfilepath); err != nil {
+		t.Error("Expected the desktop file of an unchanged AppImage to be kept:", err)
+	}
+	if integrated, err := integrate(path); err != nil || integrated.Name != "Test" {
+		t.Error("Expected the AppImage to be integrated from the database:", err)
+	}
+
+	// The desktop files that an appimaged wrote before it was moved or upgraded point to the old one
+	updateDatabase(func(db *database) (bool, error) {
+		db.lookup(path).Integrator = "/old/appimaged"
+		return true, nil
+	})
+	cleanDesktopFiles()
+	if _, err := os.Stat(ai.desktopfilepath); !os.IsNotExist(err) {
+		t.Error("Expected the desktop file written by another appimaged to be deleted")
+	}
+	if _, err := integrate(path); err == nil {
+		t.Error("Expected the AppImage to be integrated again rather than from the database")
+	}
+}
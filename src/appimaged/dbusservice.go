@@ -0,0 +1,217 @@
+package main
+
+// Exports the org.appimage.Daemon1 interface on the session bus
+// so that other tools (e.g., tray applications) can talk to the
+// running appimaged. A D-Bus service file is installed so that
+// the session bus can activate appimaged when it is not running.
+//
+// Try it with, e.g.,
+// gdbus call --session --dest org.appimage.Daemon1 --object-path /org/appimage/Daemon1 --method org.appimage.Daemon1.ListIntegrated
+// gdbus monitor --session --dest org.appimage.Daemon1
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/adrg/xdg"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+const (
+	daemonBusName    = "org.appimage.Daemon1"
+	daemonObjectPath = dbus.ObjectPath("/org/appimage/Daemon1")
+	daemonInterface  = "org.appimage.Daemon1"
+)
+
+// daemonBus is the connection on which the interface is exported,
+// nil if it is not exported (e.g., when running a command)
+var daemonBus *dbus.Conn
+var daemonBusLock sync.Mutex
+
+// daemonService implements the methods of org.appimage.Daemon1
+type daemonService struct{}
+
+// integratedAppImage is what ListIntegrated returns for each AppImage, (ssss) on the bus
+type integratedAppImage struct {
+	Path              string
+	Name              string
+	Version           string
+	UpdateInformation string
+}
+
+// ListIntegrated returns the AppImages that are currently integrated, sorted by path
+func (daemonService) ListIntegrated() ([]integratedAppImage, *dbus.Error) {
+	integrationLock.Lock()
+	defer integrationLock.Unlock()
+	list := []integratedAppImage{}
+	for path, ai := range integrations {
+		list = append(list, integratedAppImage{
+			Path:              path,
+			Name:              ai.Name,
+			Version:           ai.Version,
+			UpdateInformation: ai.updateinformation,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, nil
+}
+
+// Integrate integrates the AppImage at path into the system
+func (daemonService) Integrate(path string) *dbus.Error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	if !IsPossibleAppImage(path) {
+		return dbus.MakeFailedError(errors.New(path + " is not an AppImage"))
+	}
+	if err = AddIntegration(path, false); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// Unintegrate removes the integration of the AppImage at path from the system
+func (daemonService) Unintegrate(path string) *dbus.Error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	RemoveIntegration(path, false)
+	return nil
+}
+
+// Launch starts the most recent AppImage with matching updateinformation
+// and returns its path without waiting for it to exit
+func (daemonService) Launch(updateinformation string, args []string) (string, *dbus.Error) {
+	if err := helpers.ValidateUpdateInformation(updateinformation); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	path := FindMostRecentAppImageWithMatchingUpdateInformation(updateinformation)
+	if path == "" {
+		return "", dbus.MakeFailedError(errors.New("no AppImage found for " + updateinformation))
+	}
+	log.Println("dbus: Launching", path, args)
+	command, err := launchCommand(path, args)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	if err := cmd.Start(); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	go cmd.Wait()
+	recordLaunch(path)
+	return path, nil
+}
+
+// Update updates the AppImage at path in the background,
+// progress and errors are reported as desktop notifications
+func (daemonService) Update(path string) *dbus.Error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	if _, err = os.Stat(path); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	go runUpdate(path)
+	return nil
+}
+
+var daemonIntrospection = introspect.Node{
+	Name: string(daemonObjectPath),
+	Interfaces: []introspect.Interface{
+		introspect.IntrospectData,
+		{
+			Name:    daemonInterface,
+			Methods: introspect.Methods(daemonService{}),
+			Signals: []introspect.Signal{
+				{Name: "IntegrationAdded", Args: []introspect.Arg{{Name: "path", Type: "s"}, {Name: "name", Type: "s"}}},
+				{Name: "IntegrationRemoved", Args: []introspect.Arg{{Name: "path", Type: "s"}}},
+				{Name: "IntegrationMoved", Args: []introspect.Arg{{Name: "oldpath", Type: "s"}, {Name: "newpath", Type: "s"}}},
+				{Name: "UpdateAvailable", Args: []introspect.Arg{{Name: "path", Type: "s"}, {Name: "version", Type: "s"}}},
+			},
+		},
+	},
+}
+
+// exportDaemonService exports org.appimage.Daemon1 on conn and requests its name.
+// Fails if another instance already owns the name
+func exportDaemonService(conn *dbus.Conn) error {
+	err := conn.Export(daemonService{}, daemonObjectPath, daemonInterface)
+	if err != nil {
+		return err
+	}
+	err = conn.Export(introspect.NewIntrospectable(&daemonIntrospection), daemonObjectPath, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		return err
+	}
+	reply, err := conn.RequestName(daemonBusName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return errors.New(daemonBusName + " is already owned by another process")
+	}
+	daemonBusLock.Lock()
+	daemonBus = conn
+	daemonBusLock.Unlock()
+	return nil
+}
+
+// startDaemonService connects to the session bus and exports org.appimage.Daemon1
+func startDaemonService() {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		helpers.PrintError("dbus: ConnectSessionBus", err)
+		return
+	}
+	if err = exportDaemonService(conn); err != nil {
+		helpers.PrintError("dbus: exportDaemonService", err)
+		conn.Close()
+		return
+	}
+	log.Println("dbus: Exported", daemonInterface, "on the session bus")
+}
+
+// emitDaemonSignal emits a signal of org.appimage.Daemon1 if the interface is exported
+func emitDaemonSignal(name string, values ...interface{}) {
+	daemonBusLock.Lock()
+	defer daemonBusLock.Unlock()
+	if daemonBus == nil {
+		return
+	}
+	err := daemonBus.Emit(daemonObjectPath, daemonInterface+"."+name, values...)
+	helpers.LogError("dbus: Emit "+name, err)
+}
+
+// installDbusServiceFile installs a service file in $XDG_DATA_HOME/dbus-1/services
+// so that the session bus can activate appimaged, via systemd if it is in use
+func installDbusServiceFile() {
+	dir := filepath.Join(xdg.DataHome, "dbus-1", "services")
+	path := filepath.Join(dir, daemonBusName+".service")
+	data := []byte(`[D-BUS Service]
+Name=` + daemonBusName + `
+Exec=` + thisai.Path + `
+SystemdService=appimaged.service
+`)
+	if old, err := os.ReadFile(path); err == nil && string(old) == string(data) {
+		return
+	}
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		helpers.LogError("Failed making directory for D-Bus service files", err)
+		return
+	}
+	log.Println("Creating", path)
+	err = syncWriteFile(path, data, 0644)
+	helpers.LogError("Error writing D-Bus service file", err)
+}
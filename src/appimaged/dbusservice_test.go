@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/probonopd/go-appimage/src/goappimage"
+)
+
+// startPrivateBus starts a dbus-daemon that stands in for the session bus
+func startPrivateBus(t *testing.T) string {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not on the $PATH")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--nopidfile", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func TestDaemonService(t *testing.T) {
+	address := startPrivateBus(t)
+	serverConn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverConn.Close()
+	if err = exportDaemonService(serverConn); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { daemonBus = nil }()
+
+	clientConn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+	obj := clientConn.Object(daemonBusName, daemonObjectPath)
+
+	// A second instance must not be able to take over the name
+	otherConn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherConn.Close()
+	if err = exportDaemonService(otherConn); err == nil {
+		t.Error("A second instance could export the service")
+	}
+
+	var xml string
+	if err = obj.Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&xml); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"ListIntegrated", "Integrate", "Unintegrate", "Launch", "Update", "IntegrationAdded", "IntegrationRemoved", "UpdateAvailable"} {
+		if !strings.Contains(xml, `name="`+s+`"`) {
+			t.Error("Introspection data lacks", s)
+		}
+	}
+
+	integrationLock.Lock()
+	integrations["/tmp/b/App-x86_64.AppImage"] = &AppImage{AppImage: &goappimage.AppImage{Name: "App", Version: "1.0"}, updateinformation: "zsync|https://example.com/App.zsync"}
+	integrations["/tmp/a/Other-x86_64.AppImage"] = &AppImage{AppImage: &goappimage.AppImage{Name: "Other"}}
+	integrationLock.Unlock()
+	defer func() {
+		integrationLock.Lock()
+		integrations = make(map[string]*AppImage)
+		integrationLock.Unlock()
+	}()
+	var list []integratedAppImage
+	if err = obj.Call(daemonInterface+".ListIntegrated", 0).Store(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "Other" || list[1].Path != "/tmp/b/App-x86_64.AppImage" || list[1].UpdateInformation != "zsync|https://example.com/App.zsync" {
+		t.Errorf("Unexpected list of integrated AppImages: %+v", list)
+	}
+
+	if call := obj.Call(daemonInterface+".Integrate", 0, "/nonexistent/App.AppImage"); call.Err == nil {
+		t.Error("Integrating a nonexistent AppImage did not fail")
+	}
+	if call := obj.Call(daemonInterface+".Launch", 0, "invalid", []string{}); call.Err == nil {
+		t.Error("Launching with invalid updateinformation did not fail")
+	}
+	if call := obj.Call(daemonInterface+".Update", 0, "/nonexistent/App.AppImage"); call.Err == nil {
+		t.Error("Updating a nonexistent AppImage did not fail")
+	}
+
+	if err = clientConn.AddMatchSignal(dbus.WithMatchInterface(daemonInterface)); err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 10)
+	clientConn.Signal(signals)
+	emitDaemonSignal("IntegrationAdded", "/tmp/App.AppImage", "App")
+	select {
+	case s := <-signals:
+		if s.Name != daemonInterface+".IntegrationAdded" || s.Path != daemonObjectPath || len(s.Body) != 2 || s.Body[0] != "/tmp/App.AppImage" {
+			t.Errorf("Unexpected signal: %+v", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Did not receive the signal")
+	}
+}
@@ -1,8 +1,7 @@
 package main
 
 // Handles reading, writing, installing, and verifying desktop files.
-// Currently it is using using a static build of desktop-file-validate
-// but eventually may be rewritten to do things natively in Go.
+// Desktop files are verified natively in Go, see helpers.ValidateDesktopFile.
 
 import (
 	"bytes"
@@ -61,7 +60,7 @@ func writeDesktopFile(ai AppImage) error {
 	if err == nil && len(args) > 0 {
 		add = " " + strings.Join(args, " ")
 	}
-	cfg.Section("Desktop Entry").Key("Exec").SetValue(arg0abs + " wrap \"" + ai.Path + "\"" + add) // Resolve to a full path
+	cfg.Section("Desktop Entry").Key("Exec").SetValue(arg0abs + " wrap " + quoteExecArg(ai.Path) + add) // Resolve to a full path
 	cfg.Section("Desktop Entry").Key(ExecLocationKey).SetValue(ai.Path)
 	cfg.Section("Desktop Entry").Key("TryExec").SetValue(arg0abs) // Resolve to a full path
 	// For icons, use absolute paths. This way icons start working
@@ -107,7 +106,7 @@ func writeDesktopFile(ai AppImage) error {
 				}
 			}
 			spl := strings.Split(exec, " ")
-			sec.Key("Exec").SetValue(arg0abs + " wrap \"" + ai.Path + "\" " + strings.Join(spl[1:], " "))
+			sec.Key("Exec").SetValue(arg0abs + " wrap " + quoteExecArg(ai.Path) + " " + strings.Join(spl[1:], " "))
 		}
 	}
 
@@ -161,21 +160,15 @@ func writeDesktopFile(ai AppImage) error {
 	// FIXME: This would actually launch the desktop file, not show it in an editor!
 	// cfg.Section("Desktop Action OpenDesktopFile").Key("Exec").SetValue("xdg-open '" + ai.desktopfilepath + "'")
 
-	// Add "Extract" action
-	// TODO: Actually, we could do the extraction ourselves since we have the extraction logic on board anyways
-	// then we could have a better name for the extracted location, and could handle type-1 as well
-	// TODO: Maybe have a dbus action for extracting AppImages that could be invoked?
-	if ai.Type() > 1 {
-		actions = append(actions, "Extract")
-		cfg.Section("Desktop Action Extract").Key("Name").SetValue("Extract to AppDir")
-		if isWritable(ai.Path) {
-			cfg.Section("Desktop Action Extract").Key("Exec").SetValue("bash -c \"cd '" + filepath.Clean(ai.Path+"/../") + "' && '" + ai.Path + "' --appimage-extract" + " && xdg-open '" + filepath.Clean(ai.Path+"/../squashfs-root") + "'\"")
-		} else {
-			cfg.Section("Desktop Action Extract").Key("Exec").SetValue("bash -c \"cd ~ && '" + ai.Path + "' --appimage-extract" + " && xdg-open ~/squashfs-root\"")
-		}
-	}
+	// Add "Extract" and "Mount" actions. appimaged reads the AppImage itself,
+	// so this works for all types and without running the AppImage
+	actions = append(actions, "Extract")
+	cfg.Section("Desktop Action Extract").Key("Name").SetValue("Extract to AppDir")
+	cfg.Section("Desktop Action Extract").Key("Exec").SetValue(arg0abs + " extract --open " + quoteExecArg(ai.Path))
 
-	// TODO: Add "Mount" action
+	actions = append(actions, "Mount")
+	cfg.Section("Desktop Action Mount").Key("Name").SetValue("Mount")
+	cfg.Section("Desktop Action Mount").Key("Exec").SetValue(arg0abs + " mount --open " + quoteExecArg(ai.Path))
 
 	// Add "Update" action
 	if ai.updateinformation != "" {
@@ -204,10 +197,10 @@ func writeDesktopFile(ai AppImage) error {
 	   sudo chown root:root /usr/bin/firejail ; sudo chmod u+s /usr/bin/firejail # suid
 	*/
 
-	// Add "Run in Firejail" action
-	// TODO: Based on what the AppImage author has specified, run AppImages by default
-	// with the matching subsets of rights, e.g., without network access
-	if helpers.IsCommandAvailable("firejail") {
+	// Add "Run in Firejail" action.
+	// Based on what the AppImage author has specified in X-AppImage-Permissions, the wrap command
+	// runs AppImages by default with the matching subsets of rights, see sandbox.go
+	if currentConfig().Sandbox.backend() == sandboxFirejail {
 		actions = append(actions, "Firejail")
 		cfg.Section("Desktop Action Firejail").Key("Name").SetValue("Run in Firejail")
 		cfg.Section("Desktop Action Firejail").Key("Exec").SetValue("firejail --env=DESKTOPINTEGRATION=appimaged --noprofile --appimage \"" + ai.Path + "\"")
@@ -225,10 +218,20 @@ func writeDesktopFile(ai AppImage) error {
 		cfg.Section("Desktop Action FirejailOverlayTmpfs").Key("Exec").SetValue("firejail --env=DESKTOPINTEGRATION=appimaged --noprofile --overlay-tmpfs --appimage \"" + ai.Path + "\"")
 	}
 
+	// Add the equivalent actions for bubblewrap, which does not need to be setuid.
+	// The wrap command runs the AppImage in the sandboxes of bwrapPresets, see sandbox.go
+	if currentConfig().Sandbox.backend() == sandboxBwrap {
+		for _, preset := range bwrapPresets {
+			actions = append(actions, preset.Action)
+			cfg.Section("Desktop Action " + preset.Action).Key("Name").SetValue(preset.Label)
+			cfg.Section("Desktop Action " + preset.Action).Key("Exec").SetValue(arg0abs + " wrap --sandbox=" + preset.Name + " " + quoteExecArg(ai.Path))
+		}
+	}
+
 	as := strings.Join(actions, ";")
 	cfg.Section("Desktop Entry").Key("Actions").SetValue(as)
 
-	if *verbosePtr {
+	if currentConfig().General.Verbose {
 		log.Println("desktop: Saving to", ai.desktopfilepath)
 	}
 	buf := new(bytes.Buffer)
@@ -247,6 +250,46 @@ func writeDesktopFile(ai AppImage) error {
 	return err
 }
 
+// moveDesktopFile rewrites the desktop file of from for to, which is the same
+// AppImage after it has been moved. Only the paths and the identifier are changed
+// so that whatever else is in the desktop file, e.g., changes made by the user, is kept
+func moveDesktopFile(from AppImage, to AppImage) error {
+	data, err := os.ReadFile(from.desktopfilepath)
+	if err != nil {
+		return err
+	}
+	fromDir, toDir := filepath.Dir(from.Path), filepath.Dir(to.Path)
+	// The longest strings must come first since the replacer tries them in order
+	replacer := strings.NewReplacer(
+		from.thumbnailfilepath, to.thumbnailfilepath,
+		quoteExecArg(from.Path), quoteExecArg(to.Path), // Exec of the application and all actions
+		from.Path, to.Path,
+		"\""+fromDir+"\"", "\""+toDir+"\"", // Show action
+		from.md5, to.md5, // X-AppImage-Identifier
+	)
+	err = os.WriteFile(to.desktopfilepath, []byte(replacer.Replace(string(data))), 0644)
+	if err != nil {
+		return err
+	}
+	if to.desktopfilepath != from.desktopfilepath {
+		return os.Remove(from.desktopfilepath)
+	}
+	return nil
+}
+
+// quoteExecArg quotes s as an argument in the Exec key of a desktop file. Within the quotes,
+// the characters that the specification reserves are escaped with a backslash, and these
+// backslashes are escaped once more since the value is unescaped as a string first
+func quoteExecArg(s string) string {
+	return "\"" + strings.NewReplacer(
+		`\`, `\\\\`,
+		`"`, `\\"`,
+		"`", `\\`+"`",
+		`$`, `\\$`,
+		`%`, `%%`,
+	).Replace(s) + "\""
+}
+
 // Return true if a path to a file is writable
 func isWritable(path string) bool {
 	return unix.Access(path, unix.W_OK) == nil
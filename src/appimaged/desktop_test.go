@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/probonopd/go-appimage/src/goappimage"
+	pngembed "github.com/sabhiram/png-embed"
+)
+
+func TestMoveIntegrationFiles(t *testing.T) {
+	dir := t.TempDir()
+	newAppImage := func(path string) AppImage {
+		ai := AppImage{AppImage: &goappimage.AppImage{Path: path}}
+		ai.calculateIntegrationPaths()
+		ai.desktopfilepath = filepath.Join(dir, ai.desktopfilename)
+		ai.thumbnailfilepath = filepath.Join(dir, ai.thumbnailfilename)
+		return ai
+	}
+	from := newAppImage("/home/me/Downloads/App-x86_64.AppImage")
+	to := newAppImage("/home/me/Applications/My App 100%-x86_64.AppImage")
+
+	desktop := `[Desktop Entry]
+Name=App
+Name[de]=Anwendung
+Exec=/usr/bin/appimaged wrap "` + from.Path + `" %F
+X-ExecLocation=` + from.Path + `
+Icon=` + from.thumbnailfilepath + `
+Comment=` + from.Path + `
+X-AppImage-Identifier=` + from.md5 + `
+Actions=Extract;Show;
+X-MyCustomization=true
+
+[Desktop Action Extract]
+Name=Extract to AppDir
+Exec=/usr/bin/appimaged extract --open "` + from.Path + `"
+
+[Desktop Action Show]
+Name=Open Containing Folder
+Exec=xdg-open "/home/me/Downloads"
+
+[Desktop Action SandboxNoNetwork]
+Name=Run in Sandbox Without Network Access
+Exec=/usr/bin/appimaged wrap --sandbox=nonetwork "` + from.Path + `"
+`
+	if err := os.WriteFile(from.desktopfilepath, []byte(desktop), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveDesktopFile(from, to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(from.desktopfilepath); !os.IsNotExist(err) {
+		t.Error("The old desktop file still exists")
+	}
+	got, err := os.ReadFile(to.desktopfilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"/home/me/Downloads", from.md5} {
+		if strings.Contains(string(got), s) {
+			t.Errorf("The moved desktop file still contains %s:\n%s", s, got)
+		}
+	}
+	for _, s := range []string{
+		`Exec=/usr/bin/appimaged wrap "/home/me/Applications/My App 100%%-x86_64.AppImage" %F`,
+		"Icon=" + to.thumbnailfilepath,
+		"X-AppImage-Identifier=" + to.md5,
+		`Exec=/usr/bin/appimaged extract --open "/home/me/Applications/My App 100%%-x86_64.AppImage"`,
+		`Exec=xdg-open "/home/me/Applications"`,
+		`Exec=/usr/bin/appimaged wrap --sandbox=nonetwork "/home/me/Applications/My App 100%%-x86_64.AppImage"`,
+		"Name[de]=Anwendung",
+		"X-MyCustomization=true",
+	} {
+		if !strings.Contains(string(got), s) {
+			t.Errorf("The moved desktop file lacks %s:\n%s", s, got)
+		}
+	}
+
+	if quoted := quoteExecArg(`/home/me/"$HOME" \ 100%`); quoted != `"/home/me/\\"\\$HOME\\" \\\\ 100%%"` {
+		t.Errorf("Wrong quoting in the Exec key: %s", quoted)
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	thumbnail, err := pngembed.Embed(buf.Bytes(), "Thumb::URI", from.uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(from.thumbnailfilepath, thumbnail, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = moveThumbnail(from, to); err != nil {
+		t.Fatal(err)
+	}
+	thumbnail, err = os.ReadFile(to.thumbnailfilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := pngembed.Extract(thumbnail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content["Thumb::URI"]) != to.uri || bytes.Count(thumbnail, []byte("Thumb::URI")) != 1 {
+		t.Errorf("Expected the thumbnail to have the URI %s, got %s", to.uri, content["Thumb::URI"])
+	}
+	if _, err = png.Decode(bytes.NewReader(thumbnail)); err != nil {
+		t.Error("The moved thumbnail is not a valid PNG:", err)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+// Diagnoses why an AppImage failed to launch from how it exited and what it printed
+// to stderr, and keeps a record of the last failed launch of each AppImage, so that
+// "appimaged diagnose <path>" can print one report that users can paste into bug reports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/acobaugh/osrelease"
+	"github.com/adrg/xdg"
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-appimage/src/goappimage"
+	"golang.org/x/sys/unix"
+)
+
+var crashesDir = filepath.Join(xdg.StateHome, "appimaged", "crashes")
+
+// How many lines of stderr are kept in crash records
+const crashStderrLines = 50
+
+// Kinds of launch failures
+const (
+	failureUnknown           = "unknown"
+	failureMissingLibrary    = "missing-library"
+	failureGlibcTooNew       = "glibc-too-new"
+	failureMissingFUSE       = "missing-fuse"
+	failureNoexec            = "noexec"
+	failureNotExecutable     = "not-executable"
+	failureWrongArchitecture = "wrong-architecture"
+	failureSignal            = "signal"
+	failureMissingAppRun     = "missing-apprun"
+	failureQtPlugin          = "qt-platform-plugin"
+)
+
+// diagnosis is what went wrong when launching an AppImage
+type diagnosis struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`           // For the user, including what can be done about it
+	ELF     string `json:"elf,omitempty"`     // The binary that has the problem, if known
+	Missing string `json:"missing,omitempty"` // The missing library or glibc version, or the signal
+}
+
+// crashRecord describes the last failed launch of an AppImage
+type crashRecord struct {
+	Path       string    `json:"path"`
+	Time       time.Time `json:"time"`
+	ExitStatus int       `json:"exit_status"` // -1 if it was not started or killed by a signal
+	Diagnosis  diagnosis `json:"diagnosis"`
+	Stderr     []string  `json:"stderr"`
+}
+
+var (
+	missingLibraryRegexp = regexp.MustCompile(`(\S+): error while loading shared libraries: (\S+): cannot open shared object file`)
+	glibcRegexp          = regexp.MustCompile("version [`']?(GLIBC_[0-9.]+)['`]? not found \\(required by ([^)]+)\\)")
+	fuseMessages         = []string{
+		"libfuse.so.2",
+		"AppImages require FUSE to run",
+		"fuse: failed to exec fusermount",
+		"fusermount: not found",
+		"fusermount3: not found",
+		"Cannot mount AppImage, please check your FUSE setup",
+		"fuse: device not found",
+	}
+)
+
+// isFailure returns false if the process just exited or was terminated by the user or the session
+func isFailure(ws syscall.WaitStatus) bool {
+	if ws.Signaled() {
+		switch ws.Signal() {
+		case syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGKILL, syscall.SIGPIPE:
+			return false
+		}
+		return true
+	}
+	return ws.ExitStatus() != 0
+}
+
+// diagnose classifies why the AppImage at path failed: startErr is the error from starting it, if any,
+// otherwise ws is how it exited and stderr what it printed
+func diagnose(path string, startErr error, ws syscall.WaitStatus, stderr string) diagnosis {
+	name := filepath.Base(path)
+	if startErr != nil {
+		switch {
+		case errors.Is(startErr, syscall.ENOEXEC):
+			arch, err := helpers.GetElfArchitecture(path)
+			if err == nil && arch != hostArchitecture() {
+				return diagnosis{Kind: failureWrongArchitecture, ELF: path, Missing: arch,
+					Message: name + " is for " + arch + ", but this computer is " + hostArchitecture() + ". Please download the " + hostArchitecture() + " version."}
+			}
+			return diagnosis{Kind: failureUnknown, ELF: path, Message: name + " is not a program that can be run: " + startErr.Error()}
+		case errors.Is(startErr, syscall.EACCES):
+			if mountpoint, ok := noexecMountpoint(path); ok {
+				return diagnosis{Kind: failureNoexec, ELF: path,
+					Message: mountpoint + " is mounted with noexec, so programs cannot be run from there. Please move " + name + " elsewhere, e.g., to ~/Applications."}
+			}
+			return diagnosis{Kind: failureNotExecutable, ELF: path,
+				Message: name + " is not executable. Please run chmod +x on it."}
+		}
+		return diagnosis{Kind: failureUnknown, ELF: path, Message: startErr.Error()}
+	}
+
+	if matches := glibcRegexp.FindAllStringSubmatch(stderr, -1); matches != nil {
+		// Report the newest version that is needed
+		newest := matches[0]
+		for _, m := range matches[1:] {
+			if helpers.CompareVersions(strings.TrimPrefix(m[1], "GLIBC_"), strings.TrimPrefix(newest[1], "GLIBC_")) > 0 {
+				newest = m
+			}
+		}
+		message := filepath.Base(newest[2]) + " in " + name + " needs " + newest[1]
+		if v := hostGlibcVersion(); v != "" {
+			message += ", but this system has glibc " + v
+		}
+		return diagnosis{Kind: failureGlibcTooNew, ELF: newest[2], Missing: newest[1],
+			Message: message + ". Please ask the author to build it on an older system, or use a newer system."}
+	}
+	if m := missingLibraryRegexp.FindStringSubmatch(stderr); m != nil {
+		return diagnosis{Kind: failureMissingLibrary, ELF: m[1], Missing: m[2],
+			Message: "Missing library " + m[2] + ", needed by " + filepath.Base(m[1]) + ". Please ask the author of " + name + " to bundle it."}
+	}
+	for _, s := range fuseMessages {
+		if strings.Contains(stderr, s) {
+			return diagnosis{Kind: failureMissingFUSE, ELF: path,
+				Message: name + " needs FUSE to run. Please install FUSE (e.g., libfuse2 and fuse3), or extract it with \"appimaged extract\"."}
+		}
+	}
+	if strings.Contains(stderr, "Permission denied") {
+		if mountpoint, ok := noexecMountpoint(path); ok {
+			return diagnosis{Kind: failureNoexec, ELF: path,
+				Message: mountpoint + " is mounted with noexec, so programs cannot be run from there. Please move " + name + " elsewhere, e.g., to ~/Applications."}
+		}
+	}
+	// https://github.com/AppImage/AppImageKit/issues/1004
+	if strings.Contains(stderr, "execv error") {
+		return diagnosis{Kind: failureMissingAppRun, ELF: path,
+			Message: name + " is defective, AppRun is missing. \nPlease ask the author to fix it."}
+	}
+	// https://github.com/pinnaculum/galacteek/issues/6
+	if strings.Contains(stderr, "Could not load the Qt platform plugin") {
+		return diagnosis{Kind: failureQtPlugin, ELF: path,
+			Message: name + " is defective, could not load the Qt platform plugin. \nPlease run on the command line with 'QT_DEBUG_PLUGINS=1' \nto see error messages and ask the author to fix it."}
+	}
+	if ws.Signaled() {
+		signal := unix.SignalName(ws.Signal())
+		return diagnosis{Kind: failureSignal, ELF: path, Missing: signal,
+			Message: name + " crashed with " + signal + " (" + ws.Signal().String() + "). Please report this to its author."}
+	}
+	message := fmt.Sprintf("%s exited with status %d", name, ws.ExitStatus())
+	if lines := lastLines(stderr, 1); len(lines) == 1 {
+		message += ": " + lines[0]
+	}
+	return diagnosis{Kind: failureUnknown, ELF: path, Message: message}
+}
+
+// lastLines returns the last n non-empty lines of s
+func lastLines(s string, n int) []string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	var out []string
+	for i := len(lines) - 1; i >= 0 && len(out) < n; i-- {
+		if strings.TrimSpace(lines[i]) != "" {
+			out = append([]string{lines[i]}, out...)
+		}
+	}
+	return out
+}
+
+// hostArchitecture returns the architecture of this computer as used in AppImage file names
+func hostArchitecture() string {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return ""
+	}
+	switch machine := unix.ByteSliceToString(uname.Machine[:]); machine {
+	case "i386", "i486", "i586":
+		return "i686"
+	case "armv6l", "armv7l", "armv8l":
+		return "armhf"
+	case "arm64":
+		return "aarch64"
+	default:
+		return machine
+	}
+}
+
+// hostGlibcVersion returns the version of glibc on this system, or "" if it is not known
+func hostGlibcVersion() string {
+	out, err := exec.Command("getconf", "GNU_LIBC_VERSION").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "glibc ")
+}
+
+// noexecMountpoint returns the mount point of the file system that path is on
+// and true if it is mounted with noexec
+func noexecMountpoint(path string) (string, bool) {
+	data, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return "", false
+	}
+	path, _ = filepath.Abs(path)
+	best, noexec := "", false
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		// Spaces and other special characters are escaped in octal
+		mountpoint := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(fields[1])
+		if (path == mountpoint || strings.HasPrefix(path, strings.TrimSuffix(mountpoint, "/")+"/")) && len(mountpoint) >= len(best) {
+			best = mountpoint
+			noexec = helpers.SliceContains(strings.Split(fields[3], ","), "noexec")
+		}
+	}
+	return best, noexec
+}
+
+func crashRecordPath(path string) string {
+	ai := &AppImage{AppImage: &goappimage.AppImage{Path: path}}
+	ai.calculateIntegrationPaths()
+	return filepath.Join(crashesDir, ai.md5+".json")
+}
+
+// recordCrash stores what went wrong when launching the AppImage at path,
+// replacing the record of an earlier failed launch
+func recordCrash(path string, exitStatus int, d diagnosis, stderr string) error {
+	record := crashRecord{
+		Path:       path,
+		Time:       time.Now().UTC(),
+		ExitStatus: exitStatus,
+		Diagnosis:  d,
+		Stderr:     lastLines(stderr, crashStderrLines),
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(crashesDir, 0755); err != nil {
+		return err
+	}
+	return syncWriteFile(crashRecordPath(path), data, 0644)
+}
+
+// readCrashRecord returns the record of the last failed launch of the AppImage at path, or nil if there is none
+func readCrashRecord(path string) (*crashRecord, error) {
+	data, err := os.ReadFile(crashRecordPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record := &crashRecord{}
+	return record, json.Unmarshal(data, record)
+}
+
+// diagnoseCommand prints a report about the AppImage given in args, this system,
+// and the last failed launch of the AppImage
+func diagnoseCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: diagnose <AppImage>")
+	}
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	return writeDiagnosis(os.Stdout, path)
+}
+
+func writeDiagnosis(w io.Writer, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	line := func(label string, value string) { fmt.Fprintf(w, "%-22s %s\n", label+":", value) }
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+
+	fmt.Fprintln(w, "## AppImage")
+	line("Path", path)
+	line("Size", fmt.Sprint(fi.Size()))
+	line("Modified", fi.ModTime().UTC().Format(time.RFC3339))
+	line("Executable", yesNo(fi.Mode()&0111 != 0))
+	mountpoint, noexec := noexecMountpoint(path)
+	line("Mounted noexec", yesNo(noexec)+" ("+mountpoint+")")
+	arch, err := helpers.GetElfArchitecture(path)
+	if err != nil {
+		arch = "unknown (" + err.Error() + ")"
+	}
+	line("Architecture", arch)
+	ai, err := NewAppImage(path)
+	if ai != nil && ai.AppImage != nil && ai.Type() > 0 {
+		line("Type", fmt.Sprint(ai.Type()))
+		line("Name", ai.Name)
+		line("Version", ai.Version)
+		line("Update information", ai.updateinformation)
+	}
+	if err != nil {
+		line("Problem", err.Error())
+	} else if err = ai.Validate(); err != nil {
+		line("Problem", err.Error())
+	}
+
+	fmt.Fprintln(w, "\n## System")
+	if release, err := osrelease.Read(); err == nil {
+		line("Operating system", release["PRETTY_NAME"])
+	}
+	var uname unix.Utsname
+	if unix.Uname(&uname) == nil {
+		line("Kernel", unix.ByteSliceToString(uname.Release[:]))
+	}
+	line("Architecture", hostArchitecture())
+	line("glibc", hostGlibcVersion())
+	_, err = os.Stat("/dev/fuse")
+	line("/dev/fuse", yesNo(err == nil))
+	for _, command := range []string{"fusermount", "fusermount3"} {
+		p, err := exec.LookPath(command)
+		if err != nil {
+			p = "not found"
+		}
+		line(command, p)
+	}
+	libfuse := "not found"
+	for _, pattern := range []string{"/lib*/libfuse.so.2", "/usr/lib*/libfuse.so.2", "/lib/*/libfuse.so.2", "/usr/lib/*/libfuse.so.2"} {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			libfuse = matches[0]
+			break
+		}
+	}
+	line("libfuse.so.2", libfuse)
+	version := commit
+	if version == "" {
+		version = "unsupported custom build"
+	}
+	line("appimaged", version)
+
+	fmt.Fprintln(w, "\n## Last failed launch")
+	record, err := readCrashRecord(path)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		fmt.Fprintln(w, "None recorded")
+		return nil
+	}
+	line("Time", record.Time.Format(time.RFC3339))
+	if record.Diagnosis.Kind == failureSignal {
+		line("Signal", record.Diagnosis.Missing)
+	} else {
+		line("Exit status", fmt.Sprint(record.ExitStatus))
+	}
+	line("Diagnosis", record.Diagnosis.Kind)
+	line("Message", strings.ReplaceAll(record.Diagnosis.Message, "\n", ""))
+	if record.Diagnosis.ELF != "" {
+		line("ELF", record.Diagnosis.ELF)
+	}
+	if record.Diagnosis.Missing != "" && record.Diagnosis.Kind != failureSignal {
+		line("Missing", record.Diagnosis.Missing)
+	}
+	fmt.Fprintf(w, "\nLast %d lines of stderr:\n", len(record.Stderr))
+	for _, l := range record.Stderr {
+		fmt.Fprintln(w, "    "+l)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	const path = "/home/me/Applications/App-x86_64.AppImage"
+	exited := func(status int) syscall.WaitStatus { return syscall.WaitStatus(status << 8) }
+	tests := []struct {
+		stderr  string
+		status  syscall.WaitStatus
+		kind    string
+		elf     string
+		missing string
+	}{
+		{"/tmp/.mount_AppXYZ/usr/bin/app: error while loading shared libraries: libfoo.so.1: cannot open shared object file: No such file or directory\n",
+			exited(127), failureMissingLibrary, "/tmp/.mount_AppXYZ/usr/bin/app", "libfoo.so.1"},
+		{"/tmp/.mount_AppXYZ/usr/bin/app: /lib/x86_64-linux-gnu/libc.so.6: version `GLIBC_2.34' not found (required by /tmp/.mount_AppXYZ/usr/bin/app)\n" +
+			"/tmp/.mount_AppXYZ/usr/bin/app: /lib/x86_64-linux-gnu/libc.so.6: version `GLIBC_2.38' not found (required by /tmp/.mount_AppXYZ/usr/lib/libbar.so)\n",
+			exited(1), failureGlibcTooNew, "/tmp/.mount_AppXYZ/usr/lib/libbar.so", "GLIBC_2.38"},
+		{"dlopen(): error loading libfuse.so.2\n\nAppImages require FUSE to run.\n", exited(127), failureMissingFUSE, path, ""},
+		{"execv error: No such file or directory\n", exited(1), failureMissingAppRun, path, ""},
+		{"qt.qpa.plugin: Could not load the Qt platform plugin \"xcb\" in \"\" even though it was found.\n", syscall.WaitStatus(syscall.SIGABRT), failureQtPlugin, path, ""},
+		{"", syscall.WaitStatus(syscall.SIGSEGV), failureSignal, path, "SIGSEGV"},
+		{"Something else\nwent wrong\n\n", exited(2), failureUnknown, path, ""},
+	}
+	for _, test := range tests {
+		d := diagnose(path, nil, test.status, test.stderr)
+		if d.Kind != test.kind || d.ELF != test.elf || d.Missing != test.missing {
+			t.Errorf("Expected %s (%s, %s), got %+v", test.kind, test.elf, test.missing, d)
+		}
+	}
+	if d := diagnose(path, nil, exited(2), "Something else\nwent wrong\n\n"); !strings.HasSuffix(d.Message, "status 2: went wrong") {
+		t.Errorf("Expected the exit status and the last line of stderr, got %q", d.Message)
+	}
+
+	// An ELF file for another architecture
+	machine := elf.EM_AARCH64
+	if hostArchitecture() == "aarch64" {
+		machine = elf.EM_X86_64
+	}
+	header := elf.Header64{Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT), Ehsize: 64}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS], header.Ident[elf.EI_DATA], header.Ident[elf.EI_VERSION] = byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	foreign := filepath.Join(t.TempDir(), "App-foreign.AppImage")
+	if err := os.WriteFile(foreign, buf.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if d := diagnose(foreign, syscall.ENOEXEC, 0, ""); d.Kind != failureWrongArchitecture {
+		t.Errorf("Expected the wrong architecture, got %+v", d)
+	}
+	if d := diagnose(foreign, syscall.EACCES, 0, ""); d.Kind != failureNotExecutable && d.Kind != failureNoexec {
+		t.Errorf("Expected the AppImage not to be executable, got %+v", d)
+	}
+
+	if isFailure(exited(0)) || isFailure(syscall.WaitStatus(syscall.SIGTERM)) || !isFailure(syscall.WaitStatus(syscall.SIGSEGV)) || !isFailure(exited(1)) {
+		t.Error("Wrong failures")
+	}
+}
+
+func TestCrashRecord(t *testing.T) {
+	oldCrashesDir := crashesDir
+	crashesDir = filepath.Join(t.TempDir(), "crashes")
+	defer func() { crashesDir = oldCrashesDir }()
+
+	path := filepath.Join(t.TempDir(), "App-x86_64.AppImage")
+	if err := os.WriteFile(path, []byte("not really an AppImage"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := readCrashRecord(path); record != nil || err != nil {
+		t.Fatal("Expected no crash record, got", record, err)
+	}
+	var stderr strings.Builder
+	for i := 0; i < crashStderrLines+10; i++ {
+		stderr.WriteString("line\n")
+	}
+	stderr.WriteString("Segmentation fault\n")
+	d := diagnose(path, nil, syscall.WaitStatus(syscall.SIGSEGV), stderr.String())
+	if err := recordCrash(path, -1, d, stderr.String()); err != nil {
+		t.Fatal(err)
+	}
+	record, err := readCrashRecord(path)
+	if err != nil || record == nil {
+		t.Fatal("Expected a crash record:", err)
+	}
+	if record.Path != path || record.ExitStatus != -1 || record.Diagnosis != d || len(record.Stderr) != crashStderrLines || record.Stderr[crashStderrLines-1] != "Segmentation fault" {
+		t.Errorf("Wrong crash record: %+v", record)
+	}
+
+	var report bytes.Buffer
+	if err = writeDiagnosis(&report, path); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"## AppImage", "## System", "## Last failed launch", "SIGSEGV", "Segmentation fault", path} {
+		if !strings.Contains(report.String(), s) {
+			t.Errorf("The report lacks %s:\n%s", s, report.String())
+		}
+	}
+}
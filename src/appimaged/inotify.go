@@ -23,8 +23,11 @@ package main
 
 import (
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -63,7 +66,6 @@ func RemoveWatchDir(dir string) {
 
 // Starts actually waiting for filesystem events. This will be run in a goroutine, so we don't want to return anything.
 func StartWatch() {
-mainLoop:
 	for {
 		select {
 		case ev, ok := <-watcher.Events:
@@ -71,17 +73,20 @@ mainLoop:
 				return
 			}
 			log.Println("fsnotify event:", ev)
-			for _, dir := range watchedDirectories {
-				// Deleting or creating a watched directory gives fsnotify.Rename.
-				if dir == ev.Name && ev.Has(fsnotify.Rename) {
-					if helpers.Exists(dir) {
-						AddIntegrationsFromDir(dir)
-					} else {
-						RemoveIntegrationsFromDir(dir)
-					}
-					continue mainLoop
+			if ev.Name == configPath {
+				scheduleApplyDirectories(true)
+				continue
+			}
+			// Directories coming and going change which directories are to be watched
+			if ev.Has(fsnotify.Create) {
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					scheduleApplyDirectories(false)
+					continue
 				}
-
+			}
+			if (ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)) && isWatched(ev.Name) {
+				scheduleApplyDirectories(false)
+				continue
 			}
 			if !IsPossibleAppImage(ev.Name) {
 				continue
@@ -94,13 +99,18 @@ mainLoop:
 			}
 			_, ok = integrations[ev.Name]
 			if ok {
-				if ev.Has(fsnotify.Rename) || ev.Has(fsnotify.Remove) {
-					// TODO: Add UpdateIntegration for renames instead of removing and readding it.
+				if ev.Has(fsnotify.Rename) {
+					// Possibly followed by a Create event for the new location
+					moveAway(ev.Name)
+				} else if ev.Has(fsnotify.Remove) {
 					RemoveIntegration(ev.Name, true)
 				}
 				continue
 			}
 			if ev.Has(fsnotify.Create) {
+				if claimMove(ev.Name) {
+					continue
+				}
 				// A create signal may be followed by write signals, so we wait for them to come through (if they do)
 				writeWait(ev.Name)
 			}
@@ -113,8 +123,191 @@ mainLoop:
 	}
 }
 
+// The Applications directories on mounted partitions, see checkMounts
+var mountDirectories []string
+
+// Held while changing which directories are watched
+var watchLock sync.Mutex
+
+// isWatched returns true if dir is watched by the watcher
+func isWatched(dir string) bool {
+	if watcher == nil {
+		return false
+	}
+	for _, watched := range watcher.WatchList() {
+		if watched == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDirectories watches the directories that are to be watched according to the
+// configuration and the mounted partitions, stops watching all others, and
+// integrates or unintegrates the AppImages in them accordingly
+func applyDirectories(notify bool) {
+	watchLock.Lock()
+	defer watchLock.Unlock()
+	c := currentConfig().Directories
+	roots := c.roots(candidateDirectories, mountDirectories)
+	dirs := make(map[string]int)
+	for _, root := range roots {
+		c.tree(root, dirs)
+	}
+
+	configDir := filepath.Dir(configPath)
+	watched := make(map[string]bool)
+	if watcher != nil {
+		for _, dir := range watcher.WatchList() {
+			watched[dir] = true
+			if _, ok := dirs[dir]; !ok && dir != configDir {
+				log.Println("No longer watching", dir)
+				RemoveWatchDir(dir)
+			}
+		}
+	}
+	// This also removes AppImages from directories that have been unmounted
+	RemoveIntegrationsIf(func(path string) bool {
+		_, ok := dirs[filepath.Dir(path)]
+		return !ok || c.ignored(filepath.Base(path))
+	}, notify)
+
+	var sorted []string
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+	for _, dir := range sorted {
+		if watched[dir] {
+			continue
+		}
+		if currentConfig().General.Verbose {
+			log.Println("Watching", dir)
+		}
+		if err := AddWatchDir(dir); err != nil {
+			log.Println("can't watch", dir, err)
+		}
+		AddIntegrationsFromDir(dir, notify)
+	}
+
+	watchedDirectories = watchedDirectories[:0]
+	for _, root := range roots {
+		if _, ok := dirs[root.Dir]; ok {
+			watchedDirectories = helpers.AppendIfMissing(watchedDirectories, root.Dir)
+		}
+	}
+}
+
+// How long to wait for more changes before applying them
+const applyDirectoriesDelay = 300 * time.Millisecond
+
+var pendingApply struct {
+	sync.Mutex
+	timer        *time.Timer
+	reloadConfig bool
+}
+
+// scheduleApplyDirectories calls applyDirectories once no more changes
+// have come in for a while, e.g., while an editor is saving the configuration
+// file or a directory tree is being copied
+func scheduleApplyDirectories(reload bool) {
+	pendingApply.Lock()
+	defer pendingApply.Unlock()
+	pendingApply.reloadConfig = pendingApply.reloadConfig || reload
+	if pendingApply.timer != nil {
+		pendingApply.timer.Reset(applyDirectoriesDelay)
+		return
+	}
+	pendingApply.timer = time.AfterFunc(applyDirectoriesDelay, func() {
+		pendingApply.Lock()
+		reload := pendingApply.reloadConfig
+		pendingApply.reloadConfig = false
+		pendingApply.timer = nil
+		pendingApply.Unlock()
+		if reload {
+			reloadConfig(true)
+		}
+		applyDirectories(true)
+	})
+}
+
+// How long to wait for the Create event that follows the Rename event
+// when an AppImage is moved within or between watched directories
+const moveTimeout = 500 * time.Millisecond
+
+// An integrated AppImage that has been renamed or moved away,
+// identified by the size and inode recorded in the database
+type pendingMove struct {
+	size  int64
+	inode uint64
+	timer *time.Timer
+}
+
+var pendingMoves = make(map[string]*pendingMove)
+var pendingMovesLock sync.Mutex
+
+// moveAway is called when the integrated AppImage at path has been renamed or moved away.
+// If it shows up in a watched directory within moveTimeout, claimMove moves the integration along,
+// otherwise the integration is removed
+func moveAway(path string) {
+	db, _ := readDatabase()
+	e := db.lookup(path)
+	if e == nil || e.Inode == 0 {
+		RemoveIntegration(path, true)
+		return
+	}
+	pendingMovesLock.Lock()
+	defer pendingMovesLock.Unlock()
+	if m, ok := pendingMoves[path]; ok {
+		m.timer.Stop()
+	}
+	pendingMoves[path] = &pendingMove{
+		size:  e.Size,
+		inode: e.Inode,
+		timer: time.AfterFunc(moveTimeout, func() {
+			pendingMovesLock.Lock()
+			_, ok := pendingMoves[path]
+			delete(pendingMoves, path)
+			pendingMovesLock.Unlock()
+			if ok {
+				RemoveIntegration(path, true)
+			}
+		}),
+	}
+}
+
+// claimMove returns true if the file that was created at path is an integrated
+// AppImage that has just been moved there, in which case its integration is moved along
+func claimMove(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	size, _, inode := fileIdentity(fi)
+	var from string
+	pendingMovesLock.Lock()
+	for old, m := range pendingMoves {
+		if m.inode == inode && m.size == size {
+			m.timer.Stop()
+			delete(pendingMoves, old)
+			from = old
+			break
+		}
+	}
+	pendingMovesLock.Unlock()
+	if from == "" {
+		return false
+	}
+	MoveIntegration(from, path)
+	return true
+}
+
 // Only pay attention to files that are probably an appimage based on it's extention.
+// Files whose names match one of the Ignore globs in the configuration are ignored.
 func IsPossibleAppImage(path string) bool {
+	if currentConfig().Directories.ignored(filepath.Base(path)) {
+		return false
+	}
 	return strings.HasSuffix(strings.ToLower(path), ".appimage") || strings.HasSuffix(strings.ToLower(path), ".app")
 }
 
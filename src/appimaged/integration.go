@@ -1,12 +1,13 @@
 package main
 
 import (
+	"log"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 
+	"github.com/adrg/xdg"
 	"github.com/probonopd/go-appimage/internal/helpers"
 )
 
@@ -24,19 +25,13 @@ func AddIntegration(path string, notify bool) (err error) {
 	if _, ok := integrations[path]; ok {
 		return
 	}
-	ai, err := NewAppImage(path)
+	ai, err := integrate(path)
 	if err != nil {
 		return
 	}
-	err = ai._integrate()
-	if err != nil {
-		// If integration fails, remove any files that might or might not have been integrated by unintegrating.
-		helpers.LogError("add integration", err)
-		ai._unintegrate()
-		return err
-	}
 	integrations[path] = ai
-	if notify {
+	emitDaemonSignal("IntegrationAdded", path, ai.Name)
+	if notify && currentConfig().Notifications.Integration {
 		sendDesktopNotification("Added "+ai.Name, path, 5000)
 	}
 	updateChannel <- struct{}{}
@@ -52,30 +47,76 @@ func RemoveIntegration(path string, notify bool) {
 	}
 	ai._unintegrate()
 	delete(integrations, path)
-	if notify {
+	recordUnintegration(path)
+	emitDaemonSignal("IntegrationRemoved", path)
+	if notify && currentConfig().Notifications.Integration {
 		sendDesktopNotification("Removed "+ai.Name, path, 5000)
 	}
 	updateChannel <- struct{}{}
 }
 
-func RemoveIntegrationsFromDir(dir string) {
+// MoveIntegration moves the integration of the AppImage that has been moved from oldPath
+// to newPath, keeping its desktop file (including changes made by the user),
+// thumbnail and launch history
+func MoveIntegration(oldPath string, newPath string) {
+	integrationLock.Lock()
+	defer integrationLock.Unlock()
+	ai, ok := integrations[oldPath]
+	if !ok {
+		return
+	}
+	inner := *ai.AppImage
+	inner.Path = newPath
+	moved := *ai
+	moved.AppImage = &inner
+	moved.calculateIntegrationPaths()
+	log.Println("appimage: Move integration", oldPath, "to", newPath)
+
+	delete(integrations, oldPath)
+	err := moveDesktopFile(*ai, moved)
+	if err != nil {
+		// Integrate from scratch rather than leaving a broken desktop file behind
+		helpers.LogError("move integration", err)
+		ai._unintegrate()
+		recordUnintegration(oldPath)
+		emitDaemonSignal("IntegrationRemoved", oldPath)
+		if newai, err := integrate(newPath); err == nil {
+			integrations[newPath] = newai
+			emitDaemonSignal("IntegrationAdded", newPath, newai.Name)
+		}
+		updateChannel <- struct{}{}
+		return
+	}
+	helpers.LogError("move integration", moveThumbnail(*ai, moved))
+	integrations[newPath] = &moved
+	recordMove(oldPath, newPath, moved.md5)
+	emitDaemonSignal("IntegrationMoved", oldPath, newPath)
+	updateChannel <- struct{}{}
+}
+
+// RemoveIntegrationsIf removes the integrations of all AppImages for which remove returns true
+func RemoveIntegrationsIf(remove func(path string) bool, notify bool) {
 	integrationLock.Lock()
 	defer integrationLock.Unlock()
-	removed := 0
+	var removed []string
 	for key, ai := range integrations {
-		if strings.HasPrefix(key, dir) {
+		if remove(key) {
 			ai._unintegrate()
 			delete(integrations, key)
-			removed++
+			emitDaemonSignal("IntegrationRemoved", key)
+			removed = append(removed, key)
 		}
 	}
-	if removed > 0 {
-		sendDesktopNotification("Removed "+strconv.Itoa(removed)+" applications from "+dir, "", 5000)
+	if len(removed) > 0 {
+		recordUnintegration(removed...)
+		if notify && currentConfig().Notifications.Integration {
+			sendDesktopNotification("Removed "+strconv.Itoa(len(removed))+" applications", "", 5000)
+		}
 		updateChannel <- struct{}{}
 	}
 }
 
-func AddIntegrationsFromDir(dir string) {
+func AddIntegrationsFromDir(dir string, notify bool) {
 	integrationLock.Lock()
 	defer integrationLock.Unlock()
 	ents, err := os.ReadDir(dir)
@@ -90,23 +131,86 @@ func AddIntegrationsFromDir(dir string) {
 			if ok {
 				continue
 			}
-			ai, err := NewAppImage(path)
+			ai, err := integrate(path)
 			if err != nil {
-				return
-			}
-			err = ai._integrate()
-			if err != nil {
-				// If integration fails, remove any files that might or might not have been integrated by unintegrating.
-				helpers.LogError("add integration", err)
-				ai._unintegrate()
 				continue
 			}
 			integrations[path] = ai
+			emitDaemonSignal("IntegrationAdded", path, ai.Name)
 			added++
 		}
 	}
 	if added > 0 {
-		sendDesktopNotification("Added "+strconv.Itoa(added)+" applications from "+dir, "", 5000)
+		if notify && currentConfig().Notifications.Integration {
+			sendDesktopNotification("Added "+strconv.Itoa(added)+" applications from "+dir, "", 5000)
+		}
 		updateChannel <- struct{}{}
 	}
 }
+
+// cleanDesktopFiles deletes the desktop files written by appimaged, except those of AppImages
+// that the database says have not changed since this appimaged integrated them, as integrate keeps using them
+func cleanDesktopFiles() {
+	keep := map[string]bool{}
+	if db, err := readDatabase(); err == nil {
+		for _, e := range db.AppImages {
+			if fi, err := os.Stat(e.Path); err == nil && e.upToDate(fi) {
+				keep[e.appImage().desktopfilepath] = true
+			}
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(xdg.DataHome, "applications", "appimagekit_*"))
+	helpers.LogError("main:", err)
+	deleted := 0
+	for _, file := range files {
+		if keep[file] {
+			continue
+		}
+		if currentConfig().General.Verbose {
+			log.Println("Deleting", file)
+		}
+		err = os.Remove(file)
+		helpers.LogError("main:", err)
+		deleted++
+	}
+	if currentConfig().General.Verbose {
+		log.Println("Deleted", deleted, "desktop files from", xdg.DataHome+"/applications/")
+	} else {
+		log.Println("Deleted", deleted, "desktop files from", xdg.DataHome+"/applications/; use -v to see details")
+	}
+}
+
+// integrate integrates the AppImage at path unless the database says that it
+// has already been integrated by this appimaged and has not changed since. Call with integrationLock held
+func integrate(path string) (*AppImage, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !currentConfig().General.Overwrite {
+		if db, err := readDatabase(); err == nil {
+			if e := db.lookup(path); e != nil && e.upToDate(fi) {
+				ai := e.appImage()
+				if helpers.Exists(ai.desktopfilepath) {
+					if ai.updateinformation != "" && CheckIfConnectedToNetwork() {
+						go SubscribeMQTT(MQTTclient, ai.updateinformation)
+					}
+					return ai, nil
+				}
+			}
+		}
+	}
+	ai, err := NewAppImage(path)
+	if err != nil {
+		return nil, err
+	}
+	err = ai._integrate()
+	if err != nil {
+		// If integration fails, remove any files that might or might not have been integrated by unintegrating.
+		helpers.LogError("add integration", err)
+		ai._unintegrate()
+		return nil, err
+	}
+	recordIntegration(ai, fi)
+	return ai, nil
+}
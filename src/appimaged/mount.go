@@ -0,0 +1,289 @@
+package main
+
+// Extracts and mounts AppImages without running them, so that this also works
+// for AppImages that are not executable, are for another architecture, or are of type 1.
+// Mounting works like squashfuse, but for type 1 AppImages it mounts the ISO 9660 image.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/probonopd/go-appimage/src/goappimage"
+)
+
+// extractCommand extracts the AppImage given in args, see usage.
+// With --open, the extracted files are shown in the file manager
+func extractCommand(args []string) error {
+	usage := errors.New("usage: extract [--open] <AppImage> [<destination>]")
+	open := len(args) > 0 && args[0] == "--open"
+	if open {
+		args = args[1:]
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usage
+	}
+	ai, err := goappimage.NewAppImage(args[0])
+	// AppImages without a proper desktop file can be extracted too
+	if ai.Type() < 1 {
+		return err
+	}
+	destination := filepath.Join(filepath.Dir(ai.Path), "squashfs-root")
+	if len(args) == 2 {
+		destination = args[1]
+	} else if !isWritable(filepath.Dir(ai.Path)) {
+		destination = filepath.Join(home, "squashfs-root")
+	}
+	if err = ai.Extract(destination); err != nil {
+		return err
+	}
+	fmt.Println(destination)
+	if open {
+		return exec.Command("xdg-open", destination).Start()
+	}
+	return nil
+}
+
+// mountCommand mounts the AppImage given in args until it is unmounted, e.g., with
+// "fusermount -u <mountpoint>", or appimaged is interrupted. Without a mountpoint,
+// a temporary directory is used. With --open, it is shown in the file manager
+func mountCommand(args []string) error {
+	usage := errors.New("usage: mount [--open] <AppImage> [<mountpoint>]")
+	open := len(args) > 0 && args[0] == "--open"
+	if open {
+		args = args[1:]
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return usage
+	}
+	ai, err := goappimage.NewAppImage(args[0])
+	// AppImages without a proper desktop file can be mounted too
+	if ai.Type() < 1 {
+		return err
+	}
+	fsys, err := ai.FS()
+	if err != nil {
+		return err
+	}
+	mountpoint := ""
+	if len(args) == 2 {
+		mountpoint = args[1]
+	} else {
+		// Like the AppImage runtime
+		if mountpoint, err = os.MkdirTemp("", ".mount_"); err != nil {
+			return err
+		}
+		defer os.Remove(mountpoint)
+	}
+	server, err := fusefs.Mount(mountpoint, &mountRoot{fsys: fsys}, &fusefs.Options{
+		// Without fusermount when running as root, e.g., in containers
+		MountOptions: fuse.MountOptions{FsName: ai.Path, Name: "appimage", Options: []string{"ro"}, DirectMount: true},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(mountpoint)
+	if open {
+		exec.Command("xdg-open", mountpoint).Start()
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		server.Unmount()
+	}()
+	server.Wait()
+	return nil
+}
+
+// mountRoot is the root directory of a mounted AppImage. It creates the inodes
+// of all files in the AppImage when it is mounted; their contents are read when needed
+type mountRoot struct {
+	fusefs.Inode
+	fsys fs.FS
+}
+
+var _ = (fusefs.NodeOnAdder)((*mountRoot)(nil))
+var _ = (fusefs.NodeGetattrer)((*mountRoot)(nil))
+
+func (r *mountRoot) OnAdd(ctx context.Context) {
+	err := fs.WalkDir(r.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		parent := &r.Inode
+		dir, base := path.Split(name)
+		for _, component := range strings.Split(strings.Trim(dir, "/"), "/") {
+			if component != "" {
+				parent = parent.GetChild(component)
+			}
+		}
+		if parent == nil {
+			return nil
+		}
+		attr := mountAttr(info)
+		var child *fusefs.Inode
+		switch {
+		case info.IsDir():
+			child = parent.NewPersistentInode(ctx, &mountDir{attr: attr}, fusefs.StableAttr{Mode: syscall.S_IFDIR})
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := goappimage.ReadLink(r.fsys, name)
+			if err != nil {
+				return err
+			}
+			attr.Size = uint64(len(target))
+			child = parent.NewPersistentInode(ctx, &fusefs.MemSymlink{Attr: attr, Data: []byte(target)}, fusefs.StableAttr{Mode: syscall.S_IFLNK})
+		case info.Mode().IsRegular():
+			child = parent.NewPersistentInode(ctx, &mountFile{fsys: r.fsys, name: name, attr: attr}, fusefs.StableAttr{Mode: syscall.S_IFREG})
+		default:
+			return nil
+		}
+		parent.AddChild(base, child, false)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mount:", err)
+	}
+}
+
+func (r *mountRoot) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, err := fs.Stat(r.fsys, ".")
+	if err != nil {
+		return syscall.EIO
+	}
+	out.Attr = mountAttr(info)
+	out.Attr.Mode = syscall.S_IFDIR | 0555
+	return 0
+}
+
+// mountAttr returns the attributes of the file described by info
+func mountAttr(info fs.FileInfo) fuse.Attr {
+	mode := uint32(info.Mode().Perm())
+	switch {
+	case info.IsDir():
+		mode |= syscall.S_IFDIR
+	case info.Mode()&fs.ModeSymlink != 0:
+		mode |= syscall.S_IFLNK
+	default:
+		mode |= syscall.S_IFREG
+	}
+	mtime := info.ModTime()
+	return fuse.Attr{
+		Mode:  mode,
+		Size:  uint64(info.Size()),
+		Nlink: 1,
+		Owner: fuse.Owner{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())},
+		Mtime: uint64(mtime.Unix()),
+		Ctime: uint64(mtime.Unix()),
+		Atime: uint64(mtime.Unix()),
+	}
+}
+
+type mountDir struct {
+	fusefs.Inode
+	attr fuse.Attr
+}
+
+var _ = (fusefs.NodeGetattrer)((*mountDir)(nil))
+
+func (d *mountDir) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Attr = d.attr
+	return 0
+}
+
+type mountFile struct {
+	fusefs.Inode
+	fsys fs.FS
+	name string
+	attr fuse.Attr
+}
+
+var _ = (fusefs.NodeGetattrer)((*mountFile)(nil))
+var _ = (fusefs.NodeOpener)((*mountFile)(nil))
+
+func (f *mountFile) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Attr = f.attr
+	return 0
+}
+
+func (f *mountFile) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	file, err := f.fsys.Open(f.name)
+	if err != nil {
+		return nil, 0, syscall.EIO
+	}
+	return &mountHandle{fsys: f.fsys, name: f.name, file: file}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// mountHandle reads an open file in a mounted AppImage
+type mountHandle struct {
+	mu   sync.Mutex
+	fsys fs.FS
+	name string
+	file fs.File
+	pos  int64 // Of file, if it can only be read sequentially
+}
+
+var _ = (fusefs.FileReader)((*mountHandle)(nil))
+var _ = (fusefs.FileReleaser)((*mountHandle)(nil))
+
+func (h *mountHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r, ok := h.file.(io.ReaderAt); ok {
+		n, err := r.ReadAt(dest, off)
+		if err != nil && err != io.EOF {
+			return nil, syscall.EIO
+		}
+		return fuse.ReadResultData(dest[:n]), 0
+	}
+	// Files in squashfs can only be read from the start, which is what the kernel mostly does anyway
+	if off < h.pos {
+		h.file.Close()
+		file, err := h.fsys.Open(h.name)
+		if err != nil {
+			return nil, syscall.EIO
+		}
+		h.file, h.pos = file, 0
+	}
+	if off > h.pos {
+		n, err := io.CopyN(io.Discard, h.file, off-h.pos)
+		h.pos += n
+		if err == io.EOF {
+			return fuse.ReadResultData(nil), 0
+		} else if err != nil {
+			return nil, syscall.EIO
+		}
+	}
+	n, err := io.ReadFull(h.file, dest)
+	h.pos += int64(n)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, syscall.EIO
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *mountHandle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.file.Close()
+	return 0
+}
@@ -39,6 +39,9 @@ func createClientOptions(clientId string, uri *url.URL) *mqtt.ClientOptions {
 // UnSubscribeMQTT unubscribe from receiving update notifications for updateinformation
 // TODO: Keep track of what we have already subscribed, and remove from that list
 func UnSubscribeMQTT(client mqtt.Client, updateinformation string) {
+	if client == nil { // Not connected, or checking for updates is disabled
+		return
+	}
 	queryEscapedUpdateInformation := url.QueryEscape(updateinformation)
 	if queryEscapedUpdateInformation == "" {
 		return
@@ -49,6 +52,9 @@ func UnSubscribeMQTT(client mqtt.Client, updateinformation string) {
 // SubscribeMQTT subscribes to receive update notifications for updateinformation
 // TODO: Keep track of what we have already subscribed, and don't subscribe again
 func SubscribeMQTT(client mqtt.Client, updateinformation string) {
+	if client == nil { // Not connected, or checking for updates is disabled
+		return
+	}
 
 	if helpers.SliceContains(subscribedMQTTTopics, updateinformation) {
 		// We have already subscribed to this; so nothing to do here
@@ -64,17 +70,18 @@ func SubscribeMQTT(client mqtt.Client, updateinformation string) {
 	if queryEscapedUpdateInformation == "" {
 		return
 	}
-	topic := helpers.MQTTNamespace + "/" + queryEscapedUpdateInformation + "/#"
+	namespace := currentConfig().MQTT.Namespace
+	topic := namespace + "/" + queryEscapedUpdateInformation + "/#"
 
-	if *verbosePtr {
-		log.Println("mqtt: Waiting for messages on topic", helpers.MQTTNamespace+"/"+queryEscapedUpdateInformation+"/version")
+	if currentConfig().General.Verbose {
+		log.Println("mqtt: Waiting for messages on topic", namespace+"/"+queryEscapedUpdateInformation+"/version")
 	} else {
 		log.Println("Subscribing to updates for", updateinformation)
 	}
 	client.Subscribe(topic, 0, func(_ mqtt.Client, msg mqtt.Message) {
 		// log.Printf("* [%s] %s\n", msg.Topic(), string(msg.Payload()))
 		// log.Println(topic)
-		short := strings.Replace(msg.Topic(), helpers.MQTTNamespace+"/", "", -1)
+		short := strings.Replace(msg.Topic(), namespace+"/", "", -1)
 		parts := strings.Split(short, "/")
 		log.Println("mqtt: received:", parts)
 		if len(parts) < 2 {
@@ -111,19 +118,13 @@ func SubscribeMQTT(client mqtt.Client, updateinformation string) {
 			fstime := ai.ModTime()
 			log.Println("mqtt:", updateinformation, "reports version", version, "with FSTime", data.FSTime.Unix(), "- we have", mostRecent, "with FSTime", fstime.Unix())
 
-			// FIXME: Only notify if the version is newer than what we already have.
-			// More precisely, if the AppImage being offered is *different* from the one we already have
-			// even despite version numbers being the same.
-			// Blocked by https://github.com/AppImage/AppImageSpec/issues/29,
-			// in the meantime we are using "-fstime" from unsquashfs to
-			// check whether two AppImages are "different". Note that we are
-			// not using this to determine whether which one is newer,
-			// since we don't trust that timestamp enough.
-			// We just determine what is the newest AppImage on the local system
-			// and if that one is deemed "different" from what was received over PubPub,
-			// then we assume we should offer to update.
-			// This mechanism should be more robust against wrong timestamps.
-			if fstime.Unix() != data.FSTime.Unix() {
+			// Only notify if the AppImage being offered is newer than the newest one we already have.
+			// Versions are compared first, then the "-fstime" of the squashfs, which
+			// also tells apart AppImages that were rebuilt without changing the version
+			// (see https://github.com/AppImage/AppImageSpec/issues/29). The mtime is
+			// not known for the offered AppImage and hence does not play a role
+			offered := helpers.VersionCandidate{Version: version, FSTime: data.FSTime}
+			if helpers.CompareVersionCandidates(offered, ai.versionCandidate(), versionPrecedence()) > 0 {
 				ui, err := helpers.NewUpdateInformationFromString(updateinformation)
 				if err != nil {
 					helpers.PrintError("mqtt: NewUpdateInformationFromString:", err)
@@ -134,7 +135,10 @@ func SubscribeMQTT(client mqtt.Client, updateinformation string) {
 						helpers.PrintError("mqtt: GetCommitMessageForLatestCommit:", err)
 					} else {
 						// The following could not be tested yet
-						go sendUpdateDesktopNotification(ai, version, msg)
+						emitDaemonSignal("UpdateAvailable", ai.Path, version)
+						if n := currentConfig().Notifications; n.Enabled && n.Updates {
+							go sendUpdateDesktopNotification(ai, version, msg)
+						}
 						//sendDesktopNotification("Update available for "+ai.niceName, "It can be updated to version "+version+". \n"+msg, 120000)
 					}
 				}
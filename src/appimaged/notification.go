@@ -130,6 +130,10 @@ func sendUpdateDesktopNotification(ai *AppImage, version string, _ string) {
 }
 
 func sendDesktopNotification(title string, body string, durationms int32) {
+	if !currentConfig().Notifications.Enabled {
+		log.Println("Desktop notifications are disabled:", title, body)
+		return
+	}
 
 	conn, err := dbus.SessionBusPrivate() // When using SessionBusPrivate(), need to follow with Auth(nil) and Hello()
 	if err != nil {
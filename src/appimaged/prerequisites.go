@@ -39,7 +39,7 @@ func checkPrerequisites() {
 	// Add the watched directories to the $PATH
 	helpers.AddDirsToPath(watchedDirectories)
 
-	tools := []string{"bsdtar", "unsquashfs", "desktop-file-validate"}
+	tools := []string{"bsdtar", "unsquashfs"}
 	err := helpers.CheckForNeededTools(tools)
 	if err != nil {
 		os.Exit(1)
@@ -88,22 +88,8 @@ func checkPrerequisites() {
 
 	// Clean pre-existing desktop files and thumbnails
 	// This is useful for debugging
-	if *cleanPtr {
-		var files []string
-		files, err = filepath.Glob(filepath.Join(xdg.DataHome, "applications", "appimagekit_*"))
-		helpers.LogError("main:", err)
-		for _, file := range files {
-			if *verbosePtr {
-				log.Println("Deleting", file)
-			}
-			err = os.Remove(file)
-			helpers.LogError("main:", err)
-		}
-		if *verbosePtr {
-			log.Println("Deleted", len(files), "desktop files from", xdg.DataHome+"/applications/")
-		} else {
-			log.Println("Deleted", len(files), "desktop files from", xdg.DataHome+"/applications/; use -v to see details")
-		}
+	if currentConfig().General.Clean {
+		cleanDesktopFiles()
 	}
 
 	// E.g., on Xubuntu this directory is not there by default
@@ -514,6 +500,7 @@ After=syslog.target network.target
 [Service]
 Type=simple
 ExecStart=` + thisai.Path + `
+ExecReload=/bin/kill -HUP $MAINPID
 
 LimitNOFILE=65536
 
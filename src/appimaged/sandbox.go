@@ -0,0 +1,382 @@
+package main
+
+// Runs AppImages in a sandbox that grants only the permissions they declare
+// in X-AppImage-Permissions (see helpers.PermissionsKey), unless the user
+// has set other permissions for them, e.g.,
+//
+//	# ~/.config/appimaged/permissions.conf, sections are named after the update information
+//	# and signing key of the AppImages, or their paths if they are not signed (see permissionsKey)
+//	[gh-releases-zsync|KDE|krita|latest|krita-*-x86_64.AppImage.zsync 0123456789ABCDEF0123456789ABCDEF01234567]
+//	Permissions=home;
+//
+// Use "appimaged permissions <AppImage> [set <permissions>|reset]" to show and change them.
+//
+// Independently of that, "appimaged wrap --sandbox=<preset> <AppImage>" runs an AppImage
+// in one of the bubblewrap sandboxes in bwrapPresets, which the desktop actions offer
+// when bwrap is the sandbox backend.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"gopkg.in/ini.v1"
+)
+
+var permissionsPath = filepath.Join(xdg.ConfigHome, "appimaged", "permissions.conf")
+
+// Where the permissions of an AppImage come from
+const (
+	permissionsUndeclared = ""
+	permissionsDeclared   = "AppImage"
+	permissionsOverridden = "user"
+)
+
+// declaredPermissions returns the permissions that ai declares,
+// and false if it does not declare any
+func declaredPermissions(ai *AppImage) ([]string, bool, error) {
+	if ai.Desktop == nil || !ai.Desktop.Section("Desktop Entry").HasKey(helpers.PermissionsKey) {
+		return nil, false, nil
+	}
+	// goappimage replaces ";" with a fullwidth semicolon so that it is not taken for a comment
+	value := strings.ReplaceAll(ai.Desktop.Section("Desktop Entry").Key(helpers.PermissionsKey).String(), "；", ";")
+	permissions, err := helpers.ParsePermissions(value)
+	if err != nil {
+		return nil, false, errors.New(ai.Path + ": " + err.Error())
+	}
+	return permissions, true, nil
+}
+
+// loadPermissionOverrides reads the permissions the user has set, which is empty if there are none
+func loadPermissionOverrides() (*ini.File, error) {
+	if _, err := os.Stat(permissionsPath); os.IsNotExist(err) {
+		return ini.Empty(), nil
+	}
+	return ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, permissionsPath)
+}
+
+// permissionsKey returns the name of the section in which the permissions the user has set
+// for ai are stored. Any AppImage can claim the name or the update information of another one,
+// so this is the update information together with the fingerprint of the key that ai is validly
+// signed with, so that the permissions survive updates signed by the same key, or else its path
+func permissionsKey(ai *AppImage) string {
+	if ai.updateinformation != "" {
+		if key := verifiedSigningKey(ai.Path); key != "" {
+			return ai.updateinformation + " " + key
+		}
+	}
+	return ai.Path
+}
+
+// overriddenPermissions returns the permissions the user has set for the AppImages
+// with the permissionsKey name, and false if there are none
+func overriddenPermissions(name string) ([]string, bool, error) {
+	cfg, err := loadPermissionOverrides()
+	if err != nil {
+		return nil, false, err
+	}
+	sec, err := cfg.GetSection(name)
+	if err != nil || !sec.HasKey("Permissions") {
+		return nil, false, nil
+	}
+	permissions, err := helpers.ParsePermissions(sec.Key("Permissions").String())
+	if err != nil {
+		return nil, false, errors.New(permissionsPath + ": [" + name + "]: " + err.Error())
+	}
+	return permissions, true, nil
+}
+
+// setPermissionOverride stores the permissions for the AppImages with the permissionsKey name,
+// or removes them if permissions is nil
+func setPermissionOverride(name string, permissions []string) error {
+	cfg, err := loadPermissionOverrides()
+	if err != nil {
+		return err
+	}
+	if permissions == nil {
+		cfg.DeleteSection(name)
+	} else {
+		cfg.Section(name).Key("Permissions").SetValue(helpers.FormatPermissions(permissions))
+	}
+	var buf bytes.Buffer
+	if _, err = cfg.WriteTo(&buf); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(permissionsPath), 0755); err != nil {
+		return err
+	}
+	return syncWriteFile(permissionsPath, buf.Bytes(), 0644)
+}
+
+// effectivePermissions returns the permissions ai gets and where they come from.
+// The permissions set by the user take precedence over those declared by the AppImage
+func effectivePermissions(ai *AppImage) ([]string, string) {
+	permissions, ok, err := overriddenPermissions(permissionsKey(ai))
+	helpers.LogError("sandbox", err)
+	if ok {
+		return permissions, permissionsOverridden
+	}
+	permissions, ok, err = declaredPermissions(ai)
+	helpers.LogError("sandbox", err)
+	if ok {
+		return permissions, permissionsDeclared
+	}
+	return nil, permissionsUndeclared
+}
+
+// sandboxCommand returns the command that launches ai with args. AppImages that have
+// permissions run in the configured sandbox, restricted to these permissions.
+// The others only do if the configuration says so, with all permissions.
+// Returns an error for AppImages that have permissions if there is no sandbox,
+// unless the configuration allows running them unsandboxed
+func sandboxCommand(ai *AppImage, args []string) ([]string, error) {
+	command := append([]string{ai.Path}, args...)
+	permissions, source := effectivePermissions(ai)
+	c := currentConfig().Sandbox
+	if source == permissionsUndeclared {
+		if !c.Default {
+			return command, nil
+		}
+		permissions = helpers.AllPermissions
+	}
+	switch c.backend() {
+	case sandboxFirejail:
+		return append(firejailArgs(permissions), append([]string{"--appimage"}, command...)...), nil
+	case sandboxBwrap:
+		return append(bwrapArgs(permissions, bwrapHomeMode(permissions), ai.Path), append([]string{"--"}, command...)...), nil
+	}
+	if source != permissionsUndeclared {
+		if !c.AllowUnsandboxed {
+			return nil, errors.New(filepath.Base(ai.Path) + " may only run with restricted permissions, but there is no sandbox to restrict them. " +
+				"Install Firejail or bubblewrap, or set AllowUnsandboxed=true in [Sandbox] of " + configPath)
+		}
+		log.Println("sandbox: No sandbox available, running", ai.Path, "with all permissions instead of", permissions)
+	}
+	return command, nil
+}
+
+// launchCommand returns the command that launches the AppImage at path with args,
+// see sandboxCommand
+func launchCommand(path string, args []string) ([]string, error) {
+	ai, err := NewAppImage(path)
+	if err != nil {
+		return append([]string{path}, args...), nil
+	}
+	return sandboxCommand(ai, args)
+}
+
+// firejailArgs returns the firejail command line that grants permissions
+func firejailArgs(permissions []string) []string {
+	args := []string{"firejail", "--env=DESKTOPINTEGRATION=appimaged", "--noprofile"}
+	if !helpers.SliceContains(permissions, helpers.PermissionNetwork) {
+		args = append(args, "--net=none")
+	}
+	if !helpers.SliceContains(permissions, helpers.PermissionHome) {
+		args = append(args, "--private")
+	}
+	if !helpers.SliceContains(permissions, helpers.PermissionAudio) {
+		args = append(args, "--nosound")
+	}
+	if !helpers.SliceContains(permissions, helpers.PermissionDevices) {
+		args = append(args, "--private-dev", "--novideo", "--nou2f")
+	}
+	if !helpers.SliceContains(permissions, helpers.PermissionDBus) {
+		args = append(args, "--dbus-user=none")
+	}
+	return args
+}
+
+// How the home directory of the user appears in a bubblewrap sandbox
+const (
+	bwrapHomeShared   = iota // Writable, as outside of the sandbox
+	bwrapHomeTmpfs           // Empty, whatever is written to it is discarded
+	bwrapHomePortable        // Empty, $HOME is the portable home directory <AppImage>.home
+	bwrapHomeOverlay         // Visible, but whatever is written to it is discarded
+)
+
+// bwrapPreset is a sandbox that "appimaged wrap --sandbox=<preset>" runs an AppImage in
+type bwrapPreset struct {
+	Name        string // As in --sandbox=<preset>
+	Action      string // Name of the desktop action that launches the AppImage in the sandbox
+	Label       string
+	Permissions []string
+	Home        int
+}
+
+// bwrapPresets are the bubblewrap equivalents of the Firejail actions in desktop files
+var bwrapPresets = []bwrapPreset{
+	{"default", "Sandbox", "Run in Sandbox", helpers.AllPermissions, bwrapHomeShared},
+	{"nonetwork", "SandboxNoNetwork", "Run in Sandbox Without Network Access",
+		[]string{helpers.PermissionHome, helpers.PermissionAudio, helpers.PermissionDevices, helpers.PermissionDBus}, bwrapHomeShared},
+	{"private", "SandboxPrivate", "Run in Private Sandbox", helpers.AllPermissions, bwrapHomePortable},
+	{"overlay", "SandboxOverlayTmpfs", "Run in Sandbox with Temporary Overlay Filesystem", helpers.AllPermissions, bwrapHomeOverlay},
+}
+
+// findBwrapPreset returns the preset called name
+func findBwrapPreset(name string) (bwrapPreset, error) {
+	var names []string
+	for _, preset := range bwrapPresets {
+		if preset.Name == name {
+			return preset, nil
+		}
+		names = append(names, preset.Name)
+	}
+	return bwrapPreset{}, errors.New("unknown sandbox " + name + " (known are " + strings.Join(names, ", ") + ")")
+}
+
+// presetCommand returns the command that launches the AppImage at path with args
+// in the bubblewrap sandbox preset. The private preset creates the portable home directory
+func presetCommand(preset bwrapPreset, path string, args []string) ([]string, error) {
+	if !helpers.IsCommandAvailable("bwrap") {
+		return nil, errors.New("bwrap is not installed, cannot run " + filepath.Base(path) + " in a sandbox")
+	}
+	if preset.Home == bwrapHomePortable {
+		if err := os.MkdirAll(path+".home", 0755); err != nil {
+			return nil, err
+		}
+	}
+	return append(bwrapArgs(preset.Permissions, preset.Home, path), append([]string{"--", path}, args...)...), nil
+}
+
+// bwrapHomeMode returns how the home directory appears to an AppImage with permissions
+func bwrapHomeMode(permissions []string) int {
+	if helpers.SliceContains(permissions, helpers.PermissionHome) {
+		return bwrapHomeShared
+	}
+	return bwrapHomeTmpfs
+}
+
+// bwrapArgs returns the bwrap command line that grants permissions to the AppImage at path,
+// with the home directory as in homeMode. /usr and the other system directories of the host
+// are visible read-only. Since FUSE cannot be used in the sandbox, the AppImage extracts
+// itself to the private /tmp and runs from there
+func bwrapArgs(permissions []string, homeMode int, path string) []string {
+	has := func(p string) bool { return helpers.SliceContains(permissions, p) }
+	args := []string{"bwrap", "--die-with-parent", "--unshare-pid", "--ro-bind", "/usr", "/usr"}
+	// On merged /usr systems these are symlinks into /usr
+	for _, dir := range []string{"/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32"} {
+		if target, err := os.Readlink(dir); err == nil {
+			args = append(args, "--symlink", target, dir)
+		} else {
+			args = append(args, "--ro-bind-try", dir, dir)
+		}
+	}
+	for _, dir := range []string{"/etc", "/opt", "/var", "/run", "/sys"} {
+		args = append(args, "--ro-bind-try", dir, dir)
+	}
+	args = append(args, "--proc", "/proc")
+	if has(helpers.PermissionDevices) {
+		args = append(args, "--dev-bind", "/dev", "/dev")
+	} else {
+		args = append(args, "--dev", "/dev", "--dev-bind-try", "/dev/dri", "/dev/dri")
+	}
+	if !has(helpers.PermissionNetwork) {
+		args = append(args, "--unshare-net")
+	}
+	args = append(args, "--tmpfs", "/tmp", "--ro-bind-try", "/tmp/.X11-unix", "/tmp/.X11-unix")
+	switch homeMode {
+	case bwrapHomeShared:
+		args = append(args, "--bind", home, home)
+	case bwrapHomeOverlay:
+		// Needs bubblewrap 0.9.0 or later
+		args = append(args, "--overlay-src", home, "--tmp-overlay", home)
+	default:
+		args = append(args, "--tmpfs", home)
+		if xauthority := os.Getenv("XAUTHORITY"); xauthority != "" {
+			args = append(args, "--ro-bind-try", xauthority, xauthority)
+		} else {
+			args = append(args, "--ro-bind-try", filepath.Join(home, ".Xauthority"), filepath.Join(home, ".Xauthority"))
+		}
+	}
+	// Only the sockets that are needed from $XDG_RUNTIME_DIR
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		args = append(args, "--tmpfs", runtimeDir)
+		var sockets []string
+		if display := os.Getenv("WAYLAND_DISPLAY"); display != "" {
+			sockets = append(sockets, display)
+		}
+		if has(helpers.PermissionAudio) {
+			sockets = append(sockets, "pulse", "pipewire-0")
+		}
+		if has(helpers.PermissionDBus) {
+			sockets = append(sockets, "bus")
+		}
+		for _, socket := range sockets {
+			p := filepath.Join(runtimeDir, socket)
+			args = append(args, "--bind-try", p, p)
+		}
+	}
+	// The AppImage may be in the home directory that has just been hidden
+	args = append(args, "--ro-bind", path, path)
+	if homeMode == bwrapHomePortable {
+		// Like the AppImage runtime does when <AppImage>.home exists
+		args = append(args, "--bind", path+".home", path+".home", "--setenv", "HOME", path+".home")
+	}
+	return append(args,
+		"--setenv", "APPIMAGE_EXTRACT_AND_RUN", "1",
+		"--setenv", "DESKTOPINTEGRATION", "appimaged",
+	)
+}
+
+// permissionsCommand shows or changes the permissions of the AppImage given in args
+func permissionsCommand(args []string) error {
+	usage := errors.New("usage: permissions <AppImage> [set <permissions>|reset]")
+	if len(args) < 1 {
+		return usage
+	}
+	ai, err := NewAppImage(args[0])
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(args) == 1:
+	case len(args) == 3 && args[1] == "set":
+		permissions, err := helpers.ParsePermissions(args[2])
+		if err != nil {
+			return err
+		}
+		if err = setPermissionOverride(permissionsKey(ai), permissions); err != nil {
+			return err
+		}
+	case len(args) == 2 && args[1] == "reset":
+		if err = setPermissionOverride(permissionsKey(ai), nil); err != nil {
+			return err
+		}
+	default:
+		return usage
+	}
+
+	format := func(permissions []string, ok bool) string {
+		if !ok {
+			return "-"
+		}
+		if len(permissions) == 0 {
+			return "none"
+		}
+		return strings.Join(permissions, ", ")
+	}
+	declared, ok, err := declaredPermissions(ai)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Application:", ai.Name)
+	fmt.Println("Declared:   ", format(declared, ok))
+	overridden, ok, err := overriddenPermissions(permissionsKey(ai))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Set by user:", format(overridden, ok))
+	command, err := sandboxCommand(ai, nil)
+	if err != nil {
+		fmt.Println("Launched as: not at all,", err)
+		return nil
+	}
+	fmt.Println("Launched as:", strings.Join(command, " "))
+	return nil
+}
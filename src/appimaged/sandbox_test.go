@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-appimage/src/goappimage"
+	"gopkg.in/ini.v1"
+)
+
+func TestPermissions(t *testing.T) {
+	dir := t.TempDir()
+	oldPermissionsPath, oldDatabasePath := permissionsPath, databasePath
+	permissionsPath = filepath.Join(dir, "appimaged", "permissions.conf")
+	databasePath = filepath.Join(dir, "state", "database.json")
+	defer func() { permissionsPath, databasePath = oldPermissionsPath, oldDatabasePath }()
+
+	// As read by goappimage
+	desktop, err := ini.Load([]byte("[Desktop Entry]\nName=App\nX-AppImage-Permissions=audio；network；\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai := &AppImage{AppImage: &goappimage.AppImage{Path: "/home/me/Applications/App.AppImage", Name: "App", Desktop: desktop}}
+
+	permissions, source := effectivePermissions(ai)
+	if source != permissionsDeclared || !reflect.DeepEqual(permissions, []string{"network", "audio"}) {
+		t.Errorf("Expected the declared permissions, got %v from %q", permissions, source)
+	}
+	if err = setPermissionOverride(permissionsKey(ai), []string{}); err != nil {
+		t.Fatal(err)
+	}
+	const other = "zsync|https://example.com/Other-latest-x86_64.AppImage.zsync"
+	permissions, source = effectivePermissions(ai)
+	if source != permissionsOverridden || len(permissions) != 0 {
+		t.Errorf("Expected no permissions set by the user, got %v from %q", permissions, source)
+	}
+	// Another AppImage that calls itself the same does not get the same permissions
+	impostor := &AppImage{AppImage: &goappimage.AppImage{Path: "/home/me/Downloads/App.AppImage", Name: "App", Desktop: desktop}}
+	if _, source = effectivePermissions(impostor); source != permissionsDeclared {
+		t.Errorf("Expected the declared permissions for another AppImage with the same name, got them from %q", source)
+	}
+	// Signed AppImages with update information keep the permissions across updates signed by the same key
+	signed := func(name string, key string) *AppImage {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(name), 0755)
+		fi, _ := os.Stat(path)
+		e := &dbEntry{Path: path, Name: "Other", UpdateInformation: other, Signature: signatureValid, SignerKey: key}
+		e.Size, e.MTime, e.Inode = fileIdentity(fi)
+		updateDatabase(func(db *database) (bool, error) {
+			db.put(e)
+			return true, nil
+		})
+		return &AppImage{AppImage: &goappimage.AppImage{Path: path, Name: "Other"}, updateinformation: other}
+	}
+	if err = setPermissionOverride(permissionsKey(signed("Other-1.AppImage", "0123ABCD")), []string{helpers.PermissionHome}); err != nil {
+		t.Fatal(err)
+	}
+	updated := signed("Other-2.AppImage", "0123ABCD")
+	if permissions, source = effectivePermissions(updated); source != permissionsOverridden || !reflect.DeepEqual(permissions, []string{"home"}) {
+		t.Errorf("Expected the permissions set for the update information and key, got %v from %q", permissions, source)
+	}
+	// Others cannot get them by copying the update information, be it signed with another key or not at all
+	forged := signed("Forged.AppImage", "BADC0FFEE")
+	if _, source = effectivePermissions(forged); source != permissionsUndeclared {
+		t.Errorf("Expected no permissions for an AppImage signed with another key, got them from %q", source)
+	}
+	unsigned := &AppImage{AppImage: &goappimage.AppImage{Path: filepath.Join(dir, "Unsigned.AppImage"), Name: "Other"}, updateinformation: other}
+	if _, source = effectivePermissions(unsigned); source != permissionsUndeclared {
+		t.Errorf("Expected no permissions for an unsigned AppImage with the same update information, got them from %q", source)
+	}
+	if err = setPermissionOverride(permissionsKey(ai), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, source = effectivePermissions(ai); source != permissionsDeclared {
+		t.Errorf("Expected the declared permissions after resetting, got them from %q", source)
+	}
+	if permissions, ok, _ := overriddenPermissions(permissionsKey(updated)); !ok || !reflect.DeepEqual(permissions, []string{"home"}) {
+		t.Errorf("The permissions of another application were lost: %v", permissions)
+	}
+
+	firejail := strings.Join(firejailArgs([]string{helpers.PermissionNetwork, helpers.PermissionAudio}), " ")
+	for _, arg := range []string{"--private", "--private-dev", "--dbus-user=none"} {
+		if !strings.Contains(firejail, arg) {
+			t.Errorf("Expected %s in %s", arg, firejail)
+		}
+	}
+	for _, arg := range []string{"--net=none", "--nosound"} {
+		if strings.Contains(firejail, arg) {
+			t.Errorf("Did not expect %s in %s", arg, firejail)
+		}
+	}
+
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	t.Setenv("WAYLAND_DISPLAY", "wayland-0")
+	bwrap := strings.Join(bwrapArgs([]string{helpers.PermissionAudio}, bwrapHomeTmpfs, ai.Path), " ")
+	for _, arg := range []string{"--unshare-net", "--tmpfs " + home, "--bind-try /run/user/1000/pulse", "--bind-try /run/user/1000/wayland-0", "--ro-bind " + ai.Path + " " + ai.Path} {
+		if !strings.Contains(bwrap, arg) {
+			t.Errorf("Expected %s in %s", arg, bwrap)
+		}
+	}
+	if strings.Contains(bwrap, "/run/user/1000/bus") {
+		t.Errorf("Did not expect the D-Bus session bus in %s", bwrap)
+	}
+
+	preset, err := findBwrapPreset("private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bwrap = strings.Join(bwrapArgs(preset.Permissions, preset.Home, ai.Path), " ")
+	for _, arg := range []string{"--ro-bind /usr /usr", "--tmpfs " + home, "--bind " + ai.Path + ".home " + ai.Path + ".home", "--setenv HOME " + ai.Path + ".home"} {
+		if !strings.Contains(bwrap, arg) {
+			t.Errorf("Expected %s in %s", arg, bwrap)
+		}
+	}
+	preset, _ = findBwrapPreset("nonetwork")
+	if bwrap = strings.Join(bwrapArgs(preset.Permissions, preset.Home, ai.Path), " "); !strings.Contains(bwrap, "--unshare-net") || !strings.Contains(bwrap, "--bind "+home+" "+home) {
+		t.Errorf("Expected no network and the home directory in %s", bwrap)
+	}
+	preset, _ = findBwrapPreset("overlay")
+	if bwrap = strings.Join(bwrapArgs(preset.Permissions, preset.Home, ai.Path), " "); !strings.Contains(bwrap, "--tmp-overlay "+home) {
+		t.Errorf("Expected an overlay over the home directory in %s", bwrap)
+	}
+	if _, err = findBwrapPreset("firejail"); err == nil {
+		t.Error("Expected an error for an unknown preset")
+	}
+
+	// Without a sandbox, AppImages are launched directly
+	configurationLock.Lock()
+	oldConfiguration := configuration
+	configuration.Sandbox = sandboxConfig{Backend: sandboxNone, Default: true}
+	configurationLock.Unlock()
+	defer func() {
+		configurationLock.Lock()
+		configuration = oldConfiguration
+		configurationLock.Unlock()
+	}()
+	plain := &AppImage{AppImage: &goappimage.AppImage{Path: "/home/me/Applications/Plain.AppImage", Name: "Plain"}}
+	if command, err := sandboxCommand(plain, []string{"--help"}); err != nil || !reflect.DeepEqual(command, []string{plain.Path, "--help"}) {
+		t.Errorf("Expected the AppImage to be launched directly, got %v %v", command, err)
+	}
+	// unless it declares its permissions, then only if the user allows it
+	if command, err := sandboxCommand(ai, nil); err == nil {
+		t.Errorf("Expected an AppImage with permissions not to be launched without a sandbox, got %v", command)
+	}
+	configurationLock.Lock()
+	configuration.Sandbox.AllowUnsandboxed = true
+	configurationLock.Unlock()
+	if command, err := sandboxCommand(ai, nil); err != nil || !reflect.DeepEqual(command, []string{ai.Path}) {
+		t.Errorf("Expected the AppImage to be launched directly, got %v %v", command, err)
+	}
+}
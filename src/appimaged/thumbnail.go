@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"image"
@@ -78,7 +79,10 @@ func (ai AppImage) extractDirIconAsThumbnail() error {
 	// https://specifications.freedesktop.org/thumbnail-spec/thumbnail-spec-latest.html#MODIFICATIONS
 	var err error
 	iconBuf := ai.getThumbnailOrIcon()
-	if issvg.Is(iconBuf) {
+	if issvg.Is(iconBuf) && !currentConfig().Thumbnails.ConvertSVG {
+		log.Println("thumbnail: .DirIcon in", ai.Path, "is an SVG, using generic icon")
+		iconBuf = defaultIcon
+	} else if issvg.Is(iconBuf) {
 		log.Println("thumbnail: .DirIcon in", ai.Path, "is an SVG, this is discouraged. Costly converting it now")
 		iconBuf, err = convertToPng(iconBuf)
 		if err != nil {
@@ -143,7 +147,7 @@ func (ai AppImage) extractDirIconAsThumbnail() error {
 	err = os.MkdirAll(ThumbnailsDirNormal, os.ModePerm)
 	helpers.LogError("thumbnail", err)
 
-	if *verbosePtr {
+	if currentConfig().General.Verbose {
 		log.Println("thumbnail: Writing icon to", ai.thumbnailfilepath)
 	}
 	err = os.WriteFile(ai.thumbnailfilepath, iconBuf, 0600)
@@ -172,6 +176,50 @@ func (ai AppImage) extractDirIconAsThumbnail() error {
 	return nil
 }
 
+// moveThumbnail renames the thumbnail of from for to, which is the same
+// AppImage after it has been moved, and updates the URI embedded in it
+func moveThumbnail(from AppImage, to AppImage) error {
+	buf, err := os.ReadFile(from.thumbnailfilepath)
+	if err != nil {
+		return err
+	}
+	out, err := withPNGText(buf, "Thumb::URI", to.uri)
+	helpers.LogError("thumbnail", err)
+	if err == nil {
+		buf = out
+	}
+	err = os.WriteFile(to.thumbnailfilepath, buf, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Remove(from.thumbnailfilepath)
+}
+
+// withPNGText returns the PNG in buf with the tEXt chunk for key set to value.
+// Unlike pngembed.Embed, it replaces pre-existing chunks for the same key
+func withPNGText(buf []byte, key string, value string) ([]byte, error) {
+	const signatureLength = 8
+	if len(buf) < signatureLength {
+		return nil, errors.New("not a PNG file")
+	}
+	out := append([]byte{}, buf[:signatureLength]...)
+	for pos := signatureLength; pos < len(buf); {
+		// Length, type, data, CRC
+		if pos+12 > len(buf) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		end := pos + 12 + int(binary.BigEndian.Uint32(buf[pos:pos+4]))
+		if end > len(buf) || end < pos {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		if string(buf[pos+4:pos+8]) != "tEXt" || !bytes.HasPrefix(buf[pos+8:end-4], []byte(key+"\x00")) {
+			out = append(out, buf[pos:end]...)
+		}
+		pos = end
+	}
+	return pngembed.Embed(out, key, value)
+}
+
 // Convert a given file into a PNG; its dependencies add about 2 MB to the executable
 func convertToPng(iconBuf []byte) ([]byte, error) {
 	// Strange colors: https://github.com/srwiley/oksvg/issues/15
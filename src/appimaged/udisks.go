@@ -3,6 +3,8 @@ package main
 import (
 	"log"
 	"os"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/probonopd/go-appimage/internal/helpers"
@@ -171,49 +173,17 @@ retry:
 	}
 }
 
-func getOldMountDirectories() (out []string) {
-outer:
-	for _, dir := range watchedDirectories {
-		for _, candidate := range candidateDirectories {
-			if dir == candidate {
-				continue outer
-			}
-		}
-		out = append(out, dir)
-	}
-	return
-}
-
+// checkMounts watches the Applications directories on newly mounted partitions
+// and stops watching those on partitions that have been unmounted
 func checkMounts() {
-	oldDirs := getOldMountDirectories()
 	newDirs := getMountDirectories()
-old:
-	for old := 0; old < len(oldDirs); old++ {
-		for new := range newDirs {
-			if oldDirs[old] == newDirs[new] {
-				oldDirs = append(oldDirs[:old], oldDirs[old+1:]...)
-				newDirs = append(newDirs[:new], newDirs[new+1:]...)
-				old--
-				continue old
-			}
-		}
-	}
-	for _, dir := range oldDirs {
-		RemoveIntegrationsFromDir(dir)
-		for i := range watchedDirectories {
-			if watchedDirectories[i] == dir {
-				watchedDirectories = append(watchedDirectories[:i], watchedDirectories[i+1:]...)
-				break
-			}
-		}
-		RemoveWatchDir(dir)
-		log.Println("umounted: ", dir)
-	}
-	watchedDirectories = append(watchedDirectories, newDirs...)
-	for _, dir := range newDirs {
-		AddIntegrationsFromDir(dir)
-		err := AddWatchDir(dir)
-		helpers.PrintError("add watch", err)
-		log.Println("now watching ", dir)
+	sort.Strings(newDirs)
+	watchLock.Lock()
+	changed := !slices.Equal(mountDirectories, newDirs)
+	mountDirectories = newDirs
+	watchLock.Unlock()
+	if changed {
+		log.Println("Applications directories on mounted partitions:", newDirs)
+		applyDirectories(true)
 	}
 }
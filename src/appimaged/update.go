@@ -8,14 +8,20 @@
 package main
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/probonopd/go-appimage/internal/helpers"
 )
 
 func update() {
-	if len(os.Args) < 2 {
+	if len(os.Args) < 3 {
 		fmt.Println("Argument missing")
 		os.Exit(1)
 	}
@@ -31,10 +37,103 @@ func runUpdate(path string) {
 	// a static location on the $PATH but can be put into any location
 	// from which it gets integrated.
 
-	// For now we don't implement updating functionality ourselves
-	// but merely launch an updater we found among the integrated
-	// AppImages. In the future we may do the updating ourselves.
+	// We update using our own zsync client. Only if that fails, we
+	// launch an updater we found among the integrated AppImages
+	ai, err := NewAppImage(path)
+	if err != nil {
+		helpers.LogError("update", err)
+		sendErrorDesktopNotification("Cannot update", path+"\n\n"+err.Error())
+		return
+	}
+	err = runZsyncUpdate(ai)
+	if err == nil {
+		return
+	}
+	log.Println("update: Updating", ai.Path, "failed:", err)
+	if runExternalUpdater(path) {
+		return
+	}
+	sendErrorDesktopNotification("Cannot update "+ai.Name, err.Error())
+}
+
+// runZsyncUpdate updates the AppImage with the built-in zsync client,
+// reusing the blocks of the AppImage that did not change
+func runZsyncUpdate(ai *AppImage) error {
+	if ai.updateinformation == "" {
+		return errors.New("the AppImage does not contain update information")
+	}
+	ui, err := helpers.NewUpdateInformationFromString(ai.updateinformation)
+	if err != nil {
+		return err
+	}
+	rel, err := ui.ResolveLatest()
+	if err != nil {
+		return err
+	}
+	log.Println("update: Checking", rel.Name, "at", rel.ZsyncURL)
+	zc, err := ui.FetchZsync(rel)
+	if err != nil {
+		return err
+	}
+	if sha1sum(ai.Path) == zc.SHA1 {
+		fmt.Println(ai.Path, "is already up to date")
+		sendDesktopNotification(ai.Name+" is up to date", "No update is available", 5000)
+		return nil
+	}
+
+	// The new version gets written next to the old one. If the name is the same,
+	// the old version is replaced; otherwise it is kept
+	destination := filepath.Join(filepath.Dir(ai.Path), zc.Filename)
+	if err = checkUpdateDestination(ai, destination); err != nil {
+		return err
+	}
+	fmt.Println("Updating", ai.Path, "to", destination, "from", zc.URL)
+	stats, err := helpers.ZsyncUpdate(zc, ai.Path, destination)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reused %d bytes, downloaded %d bytes\n", stats.Reused, stats.Downloaded)
+	sendDesktopNotification("Updated "+ai.Name, "The new version is at\n"+destination, 5000)
+	return nil
+}
 
+// checkUpdateDestination returns an error unless the update of ai may be written to destination,
+// which is named by the server. Files other than ai are only replaced if they are
+// a previous version of it, i.e., an AppImage with the same update information
+func checkUpdateDestination(ai *AppImage, destination string) error {
+	if destination == ai.Path {
+		return nil
+	}
+	fi, err := os.Lstat(destination)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode().IsRegular() {
+		if other, err := NewAppImage(destination); err == nil && other.updateinformation == ai.updateinformation {
+			return nil
+		}
+	}
+	return errors.New("not replacing " + destination + " with the update of " + ai.Path + ", as it is not a previous version of it")
+}
+
+func sha1sum(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// runExternalUpdater launches an updater we found among the integrated AppImages.
+// Returns false if there is none
+func runExternalUpdater(path string) bool {
 	aiur := "gh-releases-zsync|antony-jr|AppImageUpdater|latest|AppImageUpdater*-x86_64.AppImage.zsync"
 	legacy := "gh-releases-zsync|antony-jr|AppImageUpdater|continuous|AppImageUpdater*-x86_64.AppImage.zsync"
 
@@ -47,22 +146,20 @@ func runUpdate(path string) {
 	a := FindMostRecentAppImageWithMatchingUpdateInformation(aiur)
 	legacy_app := FindMostRecentAppImageWithMatchingUpdateInformation(legacy)
 	if a == "" && legacy_app == "" {
-		sendDesktopNotification("AppImageUpdater missing", "Please download the AppImageUpdater\nAppImage and try again", 30000)
-		// Tried making a hyperlink but when I click it in Xfce, nothing happens.
+		return false
+	}
+	os.Unsetenv("INVOCATION_ID") // This is a variable that systemd sets; we use it to determine whether we were launched through systemd
+	var program string
+	if a == "" {
+		program = legacy_app
 	} else {
-		os.Unsetenv("INVOCATION_ID") // This is a variable that systemd sets; we use it to determine whether we were launched through systemd
-		var program string
-		if a == "" {
-			program = legacy_app
-		} else {
-			program = a
-		}
-		cmd := []string{program}
-		cmd = append(cmd, "-n")
-		cmd = append(cmd, "-d")
-		cmd = append(cmd, path)
-		err := helpers.RunCmdTransparently(cmd)
-		helpers.LogError("update", err)
+		program = a
 	}
-
+	cmd := []string{program}
+	cmd = append(cmd, "-n")
+	cmd = append(cmd, "-d")
+	cmd = append(cmd, path)
+	err := helpers.RunCmdTransparently(cmd)
+	helpers.LogError("update", err)
+	return true
 }
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/probonopd/go-appimage/src/goappimage"
+)
+
+func TestCheckUpdateDestination(t *testing.T) {
+	dir := t.TempDir()
+	ai := &AppImage{AppImage: &goappimage.AppImage{Path: filepath.Join(dir, "App-1.0-x86_64.AppImage")}, updateinformation: "zsync|https://example.com/App-latest-x86_64.AppImage.zsync"}
+	if err := checkUpdateDestination(ai, ai.Path); err != nil {
+		t.Error("Expected the AppImage to be replaced by its update:", err)
+	}
+	if err := checkUpdateDestination(ai, filepath.Join(dir, "App-2.0-x86_64.AppImage")); err != nil {
+		t.Error("Expected the update to be written next to the AppImage:", err)
+	}
+	// Neither another file nor another AppImage that the server names gets replaced
+	other := filepath.Join(dir, "Other-x86_64.AppImage")
+	os.WriteFile(other, []byte("not this one"), 0755)
+	if err := checkUpdateDestination(ai, other); err == nil {
+		t.Error("Expected an error for a file that is not a previous version of the AppImage")
+	}
+	if err := checkUpdateDestination(ai, dir); err == nil {
+		t.Error("Expected an error for a directory")
+	}
+}
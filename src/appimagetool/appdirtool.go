@@ -16,10 +16,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/otiai10/copy"
 	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-appimage/src/goappimage"
 )
 
 type QMLImport struct {
@@ -35,6 +38,7 @@ type QMLImport struct {
 var allELFs []string
 var libraryLocations []string // All directories in the host system that may contain libraries
 var seenDeps []string
+var sysrootMachine elf.Machine // The architecture of the ELF files that are deployed from the sysroot
 
 var quirksModePatchQtPrfxPath = false
 
@@ -104,6 +108,25 @@ case "${XDG_CURRENT_DESKTOP}" in
         export QT_QPA_PLATFORMTHEME=gtk2
 esac`
 
+	if len(options.appRunEnv) > 0 {
+		apprun += `
+
+############################################################################################
+# Environment of the application
+############################################################################################
+`
+		var keys []string
+		for key := range options.appRunEnv {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			// Double quotes, so that "${HERE}" can be used
+			value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`").Replace(options.appRunEnv[key])
+			apprun += "\nexport " + key + "=\"" + value + "\""
+		}
+	}
+
 	if options.preserveCwd == false {
 		apprun += `
 
@@ -229,6 +252,14 @@ type DeployOptions struct {
 	standalone     bool
 	libAppRunHooks bool
 	preserveCwd    bool
+	maxGlibc       string
+	include        []string          // Patterns of libraries to bundle even if they are on the excludelist
+	exclude        []string          // Patterns of libraries never to bundle
+	skipQt         bool              // Do not deploy Qt plugins, translations and qml imports
+	skipGtk        bool              // Do not deploy Gdk, Gtk modules and .ui files
+	skipGStreamer  bool              // Do not deploy GStreamer plugins
+	appRunEnv      map[string]string // Additional environment variables set by AppRun
+	sysroot        string            // Root directory of the target system to take libraries and ld-linux from, if not the host
 }
 
 // this is the public options instance
@@ -245,20 +276,26 @@ func AppDirDeploy(path string) {
 	log.Println("Gathering all required libraries for the AppDir...")
 	determineELFsInDirTree(appdir, appdir.Path)
 
-	// Gdk
-	handleGdk(appdir)
+	if !options.skipGtk {
+		// Gdk
+		handleGdk(appdir)
+	}
 
-	// GStreamer
-	handleGStreamer(appdir)
+	if !options.skipGStreamer {
+		// GStreamer
+		handleGStreamer(appdir)
+	}
 
-	// Gtk modules/plugins
-	// If there is a .so with the name libgtk-* inside the AppDir, then we need to
-	// bundle Gdk modules/plugins
-	deployGtkDirectory(appdir, 4)
-	deployGtkDirectory(appdir, 3)
-	deployGtkDirectory(appdir, 2)
+	if !options.skipGtk {
+		// Gtk modules/plugins
+		// If there is a .so with the name libgtk-* inside the AppDir, then we need to
+		// bundle Gdk modules/plugins
+		deployGtkDirectory(appdir, 4)
+		deployGtkDirectory(appdir, 3)
+		deployGtkDirectory(appdir, 2)
 
-	deployGtkUiFiles(appdir)
+		deployGtkUiFiles(appdir)
+	}
 
 	// ALSA
 	handleAlsa(appdir)
@@ -312,6 +349,11 @@ func AppDirDeploy(path string) {
 		qtVersionDetected = 4
 	}
 
+	if qtVersionDetected > 0 && options.skipQt {
+		log.Println("Not deploying Qt plugins, as requested")
+		qtVersionDetected = 0
+	}
+
 	if qtVersionDetected > 0 {
 		handleQt(appdir, qtVersionDetected)
 	}
@@ -328,7 +370,7 @@ func AppDirDeploy(path string) {
 	var libraryLocationsInAppDir []string
 	for _, lib := range libraryLocations {
 		if strings.HasPrefix(lib, appdir.Path) == false {
-			lib = appdir.Path + lib
+			lib = appdir.Path + fromSysroot(lib)
 		}
 		libraryLocationsInAppDir = helpers.AppendIfMissing(libraryLocationsInAppDir, lib)
 	}
@@ -366,6 +408,50 @@ func AppDirDeploy(path string) {
 	}
 
 	deployCopyrightFiles(appdir)
+
+	err = reportRequirements(os.Stdout, appdir, options.maxGlibc)
+	if err != nil {
+		helpers.PrintError("Deployment", err)
+		os.Exit(1)
+	}
+}
+
+// reportRequirements prints the highest symbol versions that the ELF files in the AppDir need
+// from the system, and which ELF file needs them. Returns an error if more than maxGlibc is needed,
+// unless the AppDir bundles glibc
+func reportRequirements(w io.Writer, appdir helpers.AppDir, maxGlibc string) error {
+	r, err := goappimage.ReadRequirements(os.DirFS(appdir.Path))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "The AppDir requires at least:")
+	var prefixes []string
+	for prefix := range r.Versions {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, prefix := range prefixes {
+		lib := goappimage.VersionedLibraries[prefix]
+		if r.Bundled[prefix] {
+			lib += " (bundled)"
+		}
+		fmt.Fprintf(tw, "%s\t%s_%s\tneeded by %s\n", lib, prefix, r.Versions[prefix], r.VersionRequiredBy[prefix])
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "")
+	if maxGlibc == "" {
+		return nil
+	}
+	if r.Bundled["GLIBC"] {
+		fmt.Fprintln(w, "Not checking against GLIBC_"+maxGlibc+" since the AppDir bundles glibc")
+	}
+	// Check against a system that has nothing but that version of glibc, like check-compat does for distributions
+	if problems := r.Check(&goappimage.System{Versions: map[string]string{"GLIBC": maxGlibc}}); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
 }
 
 func deployFontconfig(appdir helpers.AppDir) error {
@@ -404,7 +490,7 @@ func deployInterpreter(appdir helpers.AppDir) (string, error) {
 	if options.standalone {
 		var err error
 		// ld-linux might be a symlink; hence we first need to resolve it
-		src, err := filepath.EvalSymlinks(ldLinux)
+		src, err := filepath.EvalSymlinks(resolveInSysroot(options.sysroot + ldLinux))
 		if err != nil {
 			helpers.PrintError("Could not get the location of ld-linux", err)
 			src = ldLinux
@@ -484,7 +570,7 @@ func deployElf(lib string, appdir helpers.AppDir, err error) {
 
 	log.Println("Working on", lib)
 	if strings.HasPrefix(lib, appdir.Path) == false { // Do not copy if it is already in the AppDir
-		libTargetPath := appdir.Path + "/" + lib
+		libTargetPath := appdir.Path + "/" + fromSysroot(lib)
 		if options.libAppRunHooks && checkWhetherPartOfLibc(lib) == true {
 			// This file is part of the libc family of libraries and we want to use libapprun_hooks,
 			// hence copy to a separate directory unlike the rest of the libraries. The reason is
@@ -492,18 +578,18 @@ func deployElf(lib string, appdir helpers.AppDir, err error) {
 			// bundled version is newer than what is already on the target system; this allows
 			// us to also load libraries from the system such as proprietary GPU drivers
 			log.Println(lib, "is part of libc; copy to", LibcDir, "subdirectory")
-			libTargetPath = appdir.Path + "/" + LibcDir + "/" + lib // If libapprun_hooks is used
+			libTargetPath = appdir.Path + "/" + LibcDir + "/" + fromSysroot(lib) // If libapprun_hooks is used
 		}
 
 		// Skip copying if the source is a directory
-		if fi, err := os.Stat(lib); err == nil && fi.IsDir() {
+		if fi, err := os.Stat(resolveInSysroot(lib)); err == nil && fi.IsDir() {
 			log.Println(lib, "is a directory, skipping")
 			return
 		}
 
 		log.Println("Copying to libTargetPath:", libTargetPath)
 
-		err = helpers.CopyFile(lib, libTargetPath) // If libapprun_hooks is not used
+		err = helpers.CopyFile(resolveInSysroot(lib), libTargetPath) // If libapprun_hooks is not used
 
 		if err != nil {
 			log.Println(libTargetPath, "could not be copied:", err)
@@ -696,22 +782,22 @@ func handleGdk(appdir helpers.AppDir) {
 						os.Exit(1)
 					}
 
-					err = copy.Copy(loadersCaches[0], appdir.Path+loadersCaches[0])
+					err = copy.Copy(loadersCaches[0], appdir.Path+fromSysroot(loadersCaches[0]))
 					if err != nil {
 						helpers.PrintError("Could not copy loaders.cache", err)
 						os.Exit(1)
 					}
 
-					loadersCache, err := filepath.EvalSymlinks(filepath.Dir(loadersCaches[0]))
+					loadersCache, err := filepath.EvalSymlinks(resolveInSysroot(filepath.Dir(loadersCaches[0])))
 					if err != nil {
 						helpers.PrintError("Could not get the location of loaders.cache", err)
 						break
 					}
 
-					whatToPatchAway := loadersCache + "/loaders/"
+					whatToPatchAway := fromSysroot(loadersCache) + "/loaders/"
 
-					log.Println("Patching", appdir.Path+loadersCaches[0], "removing", whatToPatchAway)
-					err = PatchFile(appdir.Path+loadersCaches[0], whatToPatchAway, "")
+					log.Println("Patching", appdir.Path+fromSysroot(loadersCaches[0]), "removing", whatToPatchAway)
+					err = PatchFile(appdir.Path+fromSysroot(loadersCaches[0]), whatToPatchAway, "")
 					if err != nil {
 						helpers.PrintError("PatchFile loaders.cache", err)
 						break // os.Exit(1)
@@ -808,7 +894,7 @@ func handleGStreamer(appdir helpers.AppDir) {
 func patchRpathsInElf(appdir helpers.AppDir, libraryLocationsInAppDir []string, path string) {
 
 	if strings.HasPrefix(path, appdir.Path) == false {
-		path = filepath.Clean(appdir.Path + "/" + path)
+		path = filepath.Clean(appdir.Path + "/" + fromSysroot(path))
 	}
 	var newRpathStringForElf string
 	var newRpathStrings []string
@@ -879,21 +965,21 @@ func deployGtkDirectory(appdir helpers.AppDir, gtkVersion int) {
 						}
 						immodulesCache := immodulesCaches[0]
 
-						err = copy.Copy(immodulesCache, appdir.Path + immodulesCache)
+						err = copy.Copy(immodulesCache, appdir.Path + fromSysroot(immodulesCache))
 						if err != nil {
 							helpers.PrintError("Copy", err)
 							os.Exit(1)
 						}
 
-						immodulesCacheLoc, err := filepath.EvalSymlinks(filepath.Dir(immodulesCache))
+						immodulesCacheLoc, err := filepath.EvalSymlinks(resolveInSysroot(filepath.Dir(immodulesCache)))
 						if err != nil {
 							helpers.PrintError("Could not get the location of immodules.cache", err)
 							os.Exit(1)
 						}
 
-						whatToPatchAway := immodulesCacheLoc + "/immodules/"
-						log.Println("Patching", appdir.Path + immodulesCache, "removing", whatToPatchAway)
-						err = PatchFile(appdir.Path + immodulesCache, whatToPatchAway, "")
+						whatToPatchAway := fromSysroot(immodulesCacheLoc) + "/immodules/"
+						log.Println("Patching", appdir.Path + fromSysroot(immodulesCache), "removing", whatToPatchAway)
+						err = PatchFile(appdir.Path + fromSysroot(immodulesCache), whatToPatchAway, "")
 						if err != nil {
 							helpers.PrintError("PatchFile immodules.cache", err)
 							os.Exit(1)
@@ -937,8 +1023,13 @@ func deployGtkUiFiles(appdir helpers.AppDir) {
 // appendLib appends library in path to allELFs and adds its location as well as any pre-existing rpaths to libraryLocations
 func appendLib(path string) {
 
+	if matchesAny(options.exclude, filepath.Base(path)) {
+		log.Println("Skipping", path, "because it should not be bundled")
+		return
+	}
+
 	for _, excludedlib := range ExcludedLibraries {
-		if filepath.Base(path) == excludedlib && !options.standalone {
+		if filepath.Base(path) == excludedlib && !options.standalone && !matchesAny(options.include, excludedlib) {
 			// log.Println("Skipping", excludedlib, "because it is on the excludelist")
 			return
 		}
@@ -948,13 +1039,17 @@ func appendLib(path string) {
 	// so that we can find libraries there, too
 	// See if the library had a pre-existing rpath that did not start with $. If so, replace it by one that
 	// points to the equal location as the original but inside the AppDir
-	rpaths, err := readRpaths(path)
+	rpaths, err := readRpaths(resolveInSysroot(path))
 	if err != nil {
 		helpers.PrintError("Could not determine rpath in "+path, err)
 		os.Exit(1)
 	}
 
 	for _, rpath := range rpaths {
+		if options.sysroot != "" && strings.HasPrefix(rpath, "/") {
+			// Absolute rpaths refer to the target system
+			rpath = options.sysroot + rpath
+		}
 		rpath = filepath.Clean(strings.Replace(rpath, "$ORIGIN", filepath.Dir(path), -1))
 		if helpers.SliceContains(libraryLocations, rpath) == false && rpath != "" {
 			log.Println("Add", rpath, "to the libraryLocations directories we search for libraries")
@@ -967,6 +1062,16 @@ func appendLib(path string) {
 	allELFs = helpers.AppendIfMissing(allELFs, path)
 }
 
+// matchesAny returns whether name matches one of the shell patterns, e.g., "libfoo.so.*"
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func determineELFsInDirTree(appdir helpers.AppDir, pathToDirTreeToBeDeployed string) {
 	allelfs, err := findAllExecutablesAndLibraries(pathToDirTreeToBeDeployed)
 	if err != nil {
@@ -1063,14 +1168,19 @@ func getDeps(binaryOrLib string) error {
 		return nil
 	}
 
-	if helpers.Exists(binaryOrLib) == false {
+	if helpers.Exists(resolveInSysroot(binaryOrLib)) == false {
 		return nil
 	}
 
-	e, err := elf.Open(binaryOrLib)
+	e, err := elf.Open(resolveInSysroot(binaryOrLib))
 	// log.Println("getDeps", binaryOrLib)
 	helpers.PrintError("elf.Open", err)
 
+	// The first ELF file in the AppDir tells which architecture the libraries from the sysroot have to be for
+	if err == nil && options.sysroot != "" && sysrootMachine == elf.EM_NONE {
+		sysrootMachine = e.Machine
+	}
+
 	// ImportedLibraries returns the names of all libraries
 	// referred to by the binary f that are expected to be
 	// linked with the binary at dynamic link time.
@@ -1118,10 +1228,11 @@ func isBlank(c rune) bool {
 // getDirsFromSoConf returns a []string with the directories specified
 // in the ld config file at path, usually '/etc/ld.so.conf',
 // and in its included config files. We need to search in those locations
-// for libraries as well
-func getDirsFromSoConf(path string) []string {
+// for libraries as well. path and the returned directories are
+// relative to root, which is "" for the host system or the sysroot
+func getDirsFromSoConf(root string, path string) []string {
 	var out []string
-	f, err := os.Open(path)
+	f, err := os.Open(resolveInSysroot(root + path))
 	if err != nil {
 		return nil
 	}
@@ -1137,12 +1248,12 @@ func getDirsFromSoConf(path string) []string {
 				if p[0] != '/' {
 					p = filepath.Dir(path) + "/" + p
 				}
-				files, err := filepath.Glob(p)
+				files, err := filepath.Glob(root + p)
 				if err != nil {
 					return out
 				}
 				for _, file := range files {
-					out = append(out, getDirsFromSoConf(file)...)
+					out = append(out, getDirsFromSoConf(root, strings.TrimPrefix(file, root))...)
 				}
 			}
 			continue
@@ -1155,6 +1266,18 @@ func getDirsFromSoConf(path string) []string {
 	return out
 }
 
+// multiarchTriplets are the Debian multiarch directories of the architectures for which there is a runtime,
+// in a fixed order so that the libraryLocations, and hence the rpaths, are the same on every run
+var multiarchTriplets = []struct {
+	machine elf.Machine
+	triplet string
+}{
+	{elf.EM_X86_64, "x86_64-linux-gnu"},
+	{elf.EM_386, "i386-linux-gnu"},
+	{elf.EM_AARCH64, "aarch64-linux-gnu"},
+	{elf.EM_ARM, "arm-linux-gnueabihf"},
+}
+
 func findLibrary(filename string) (string, error) {
 
 	// Look for libraries in commonly used default locations
@@ -1166,23 +1289,33 @@ func findLibrary(filename string) (string, error) {
 		"/usr/lib/x86_64-linux-gnu",
 		"/lib32",
 		"/usr/lib32"}
+	if options.sysroot != "" {
+		// The sysroot is for some other architecture, so only use the multiarch directory of the deployed ELF files,
+		// or all of them as long as it is not known yet
+		locs = []string{"/usr/lib64", "/lib64", "/usr/lib", "/lib", "/usr/local/lib"}
+		for _, t := range multiarchTriplets {
+			if sysrootMachine == elf.EM_NONE || t.machine == sysrootMachine {
+				locs = append(locs, "/lib/"+t.triplet, "/usr/lib/"+t.triplet, "/usr/local/lib/"+t.triplet)
+			}
+		}
+	}
 	for _, loc := range locs {
-		libraryLocations = helpers.AppendIfMissing(libraryLocations, filepath.Clean(loc))
+		libraryLocations = helpers.AppendIfMissing(libraryLocations, filepath.Clean(options.sysroot+loc))
 	}
 
 	// Additionally, look for libraries in the same locations in which glibc ld.so looks for libraries
-	if helpers.Exists("/etc/ld.so.conf") {
-		locs := getDirsFromSoConf("/etc/ld.so.conf")
+	if helpers.Exists(resolveInSysroot(options.sysroot + "/etc/ld.so.conf")) {
+		locs := getDirsFromSoConf(options.sysroot, "/etc/ld.so.conf")
 		for _, loc := range locs {
-			libraryLocations = helpers.AppendIfMissing(libraryLocations, filepath.Clean(loc))
+			libraryLocations = helpers.AppendIfMissing(libraryLocations, filepath.Clean(options.sysroot+loc))
 		}
 	}
 
-	// Also look for libraries in in LD_LIBRARY_PATH
+	// Also look for libraries in in LD_LIBRARY_PATH, unless they are for the sysroot
 	ldpstr := os.Getenv("LD_LIBRARY_PATH")
 	ldps := strings.Split(ldpstr, ":")
 	for _, ldp := range ldps {
-		if ldp != "" {
+		if ldp != "" && options.sysroot == "" {
 			libraryLocations = helpers.AppendIfMissing(libraryLocations, filepath.Clean(ldp))
 		}
 	}
@@ -1193,13 +1326,94 @@ func findLibrary(filename string) (string, error) {
 
 	// Try to find the library in one of those locations
 	for _, libraryLocation := range libraryLocations {
-		if helpers.Exists(libraryLocation + "/" + filename) {
+		if helpers.Exists(resolveInSysroot(libraryLocation+"/"+filename)) && machineMatches(libraryLocation+"/"+filename) {
 			return libraryLocation + "/" + filename, nil
 		}
 	}
 	return "", errors.New("did not find library " + filename)
 }
 
+// machineMatches returns false for libraries in the sysroot that are for another architecture
+// than the ELF files that are deployed, e.g., from the multiarch directory of another architecture
+// or from the ld.so.conf of the sysroot. Files that are not ELF files, such as linker scripts, match
+func machineMatches(lib string) bool {
+	if options.sysroot == "" || sysrootMachine == elf.EM_NONE {
+		return true
+	}
+	e, err := elf.Open(resolveInSysroot(lib))
+	if err != nil {
+		return true
+	}
+	defer e.Close()
+	if e.Machine != sysrootMachine {
+		log.Println("Skipping", lib, "which is for", e.Machine, "rather than", sysrootMachine)
+		return false
+	}
+	return true
+}
+
+// sysrootOption returns the sysroot at path as it is used in DeployOptions,
+// which is "" for the host system
+func sysrootOption(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	sysroot, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if helpers.IsDirectory(sysroot) == false {
+		return "", errors.New("the sysroot " + path + " is not a directory")
+	}
+	if sysroot == "/" {
+		return "", nil
+	}
+	return sysroot, nil
+}
+
+// resolveInSysroot returns the path at which the file at path in the sysroot
+// really is, resolving symlinks in it as if the sysroot was /. Absolute symlinks
+// in sysroots point to the host system otherwise
+func resolveInSysroot(path string) string {
+	if options.sysroot == "" || !strings.HasPrefix(path, options.sysroot+"/") {
+		return path
+	}
+	resolved := options.sysroot
+	todo := strings.Split(strings.TrimPrefix(path, options.sysroot), "/")
+	for links := 0; len(todo) > 0 && links < 40; {
+		component := todo[0]
+		todo = todo[1:]
+		if component == "" || component == "." {
+			continue
+		} else if component == ".." {
+			if resolved != options.sysroot {
+				resolved = filepath.Dir(resolved)
+			}
+			continue
+		}
+		target, err := os.Readlink(resolved + "/" + component)
+		if err != nil {
+			resolved = resolved + "/" + component
+			continue
+		}
+		links++
+		if filepath.IsAbs(target) {
+			resolved = options.sysroot
+		}
+		todo = append(strings.Split(target, "/"), todo...)
+	}
+	return resolved
+}
+
+// fromSysroot returns the path that the file at path in the sysroot
+// has on the target system, and hence in the AppDir
+func fromSysroot(path string) string {
+	if options.sysroot == "" || !strings.HasPrefix(path, options.sysroot+"/") {
+		return path
+	}
+	return strings.TrimPrefix(path, options.sysroot)
+}
+
 func NewLibrary(path string) ELF {
 	lib := ELF{}
 	lib.path = path
@@ -1303,7 +1517,7 @@ func handleQt(appdir helpers.AppDir, qtVersion int) {
 			os.Exit(1)
 		}
 
-		f, err := os.Open(library)
+		f, err := os.Open(resolveInSysroot(library))
 		defer f.Close()
 		if err != nil {
 			helpers.PrintError(fmt.Sprintf("Could not open libQt%dCore.so.%d", qtVersion, qtVersion), err)
@@ -1311,6 +1525,10 @@ func handleQt(appdir helpers.AppDir, qtVersion int) {
 		}
 
 		qtPrfxpath := getQtPrfxpath(f, err, qtVersion)
+		if options.sysroot != "" && !strings.HasPrefix(qtPrfxpath, options.sysroot+"/") && helpers.Exists(options.sysroot+qtPrfxpath) {
+			// qt_prfxpath is where Qt is on the target system
+			qtPrfxpath = options.sysroot + qtPrfxpath
+		}
 
 		if qtPrfxpath == "" {
 			log.Println("Got empty qtPrfxpath, exiting")
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+func TestSysroot(t *testing.T) {
+	defer func() {
+		options = DeployOptions{}
+		libraryLocations = nil
+		sysrootMachine = elf.EM_NONE
+	}()
+	sysroot, err := sysrootOption(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	options = DeployOptions{sysroot: sysroot}
+	libraryLocations = nil
+
+	write := func(name string, content string) {
+		p := filepath.Join(sysroot, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("etc/ld.so.conf", "include /etc/ld.so.conf.d/*.conf\n")
+	write("etc/ld.so.conf.d/vendor.conf", "# Vendor libraries\n/opt/vendor/lib\n")
+	write("opt/vendor/lib/libvendor.so.1", "")
+	write("usr/lib/aarch64-linux-gnu/libfoo.so.1.2", "")
+	// Absolute symlinks in a sysroot point to the host system unless they are resolved inside of the sysroot
+	if err := os.Symlink("/usr/lib/aarch64-linux-gnu/libfoo.so.1.2", filepath.Join(sysroot, "usr/lib/aarch64-linux-gnu/libfoo.so.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/usr/lib", filepath.Join(sysroot, "lib64")); err != nil {
+		t.Fatal(err)
+	}
+
+	if lib, err := findLibrary("libvendor.so.1"); lib != sysroot+"/opt/vendor/lib/libvendor.so.1" {
+		t.Errorf("Expected libvendor.so.1 from the ld.so.conf of the sysroot, got %q %v", lib, err)
+	}
+	if lib, err := findLibrary("libfoo.so.1"); lib != sysroot+"/usr/lib/aarch64-linux-gnu/libfoo.so.1" {
+		t.Errorf("Expected libfoo.so.1 from the multiarch directory, got %q %v", lib, err)
+	}
+	if lib, err := findLibrary("libc.so.6"); err == nil {
+		t.Error("Expected libc.so.6 not to be taken from the host, got", lib)
+	}
+	// The order of the directories ends up in the rpaths, which must be the same on every run
+	var triplets []string
+	for _, loc := range libraryLocations {
+		if strings.HasPrefix(loc, sysroot+"/usr/lib/") && strings.Contains(loc, "-linux-gnu") {
+			triplets = append(triplets, strings.TrimPrefix(loc, sysroot+"/usr/lib/"))
+		}
+	}
+	if strings.Join(triplets, " ") != "x86_64-linux-gnu i386-linux-gnu aarch64-linux-gnu arm-linux-gnueabihf" {
+		t.Error("Expected the multiarch directories in a fixed order, got", triplets)
+	}
+	if p := resolveInSysroot(sysroot + "/lib64/aarch64-linux-gnu/libfoo.so.1"); p != sysroot+"/usr/lib/aarch64-linux-gnu/libfoo.so.1.2" {
+		t.Error("Symlinks were not resolved inside of the sysroot:", p)
+	}
+	if p := fromSysroot(sysroot + "/usr/lib/aarch64-linux-gnu/libfoo.so.1"); p != "/usr/lib/aarch64-linux-gnu/libfoo.so.1" {
+		t.Error("Expected the path on the target system, got", p)
+	}
+	if p := fromSysroot("/usr/lib/libbar.so.1"); p != "/usr/lib/libbar.so.1" {
+		t.Error("Expected paths outside of the sysroot to be kept, got", p)
+	}
+
+	// Once the architecture of the AppDir is known, libraries for other architectures are not deployed
+	libraryLocations = nil
+	sysrootMachine = elf.EM_AARCH64
+	needsglibc, err := os.ReadFile("testdata/needsglibc/needsglibc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("usr/lib/x86_64-linux-gnu/libbar.so.1", "")
+	write("opt/vendor/lib/libx86.so.1", string(needsglibc))
+	if lib, err := findLibrary("libbar.so.1"); err == nil {
+		t.Error("Expected libbar.so.1 not to be taken from the multiarch directory of another architecture, got", lib)
+	}
+	if lib, err := findLibrary("libx86.so.1"); err == nil {
+		t.Error("Expected libx86.so.1 not to be deployed for aarch64, got", lib)
+	}
+	if lib, err := findLibrary("libfoo.so.1"); lib != sysroot+"/usr/lib/aarch64-linux-gnu/libfoo.so.1" {
+		t.Errorf("Expected libfoo.so.1 from the multiarch directory of aarch64, got %q %v", lib, err)
+	}
+	if runtimeArch("arm64") != "aarch64" || runtimeArch("armv7l") != "armhf" || runtimeArch("x86_64") != "x86_64" {
+		t.Error("Architectures are not mapped to the names of the runtimes")
+	}
+}
+
+//go:generate sh testdata/needsglibc/build.sh
+
+func TestReportRequirements(t *testing.T) {
+	appdir := helpers.AppDir{Path: t.TempDir()}
+	// Needs GLIBC_2.17 and GLIBC_2.30, see testdata/needsglibc/needsglibc.c
+	elf, err := os.ReadFile("testdata/needsglibc/needsglibc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(appdir.Path, "usr/bin"), 0755)
+	if err = os.WriteFile(filepath.Join(appdir.Path, "usr/bin/app"), elf, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var report bytes.Buffer
+	if err = reportRequirements(&report, appdir, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "The AppDir requires at least:") || !regexp.MustCompile(`libc\.so\.6 +GLIBC_2\.30 +needed by usr/bin/app`).MatchString(report.String()) {
+		t.Errorf("Unexpected report:\n%s", report.String())
+	}
+	if err = reportRequirements(io.Discard, appdir, "2.30"); err != nil {
+		t.Error("Expected GLIBC_2.30 to be allowed:", err)
+	}
+	if err = reportRequirements(io.Discard, appdir, "2.28"); err == nil || !strings.Contains(err.Error(), "GLIBC_2.30 is needed by usr/bin/app") {
+		t.Error("Expected an error for GLIBC_2.30 when at most GLIBC_2.28 is allowed, got", err)
+	}
+
+	// An AppDir that bundles glibc does not need it from the system
+	os.MkdirAll(filepath.Join(appdir.Path, "usr/lib"), 0755)
+	os.WriteFile(filepath.Join(appdir.Path, "usr/lib/libc.so.6"), []byte("not really"), 0644)
+	report.Reset()
+	if err = reportRequirements(&report, appdir, "2.28"); err != nil {
+		t.Error("Expected no limit for an AppDir that bundles glibc:", err)
+	}
+	if !strings.Contains(report.String(), "libc.so.6 (bundled)") {
+		t.Errorf("Expected glibc to be reported as bundled:\n%s", report.String())
+	}
+}
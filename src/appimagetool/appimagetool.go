@@ -6,8 +6,8 @@ package main
 import (
 	// "crypto/md5"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"os/exec"
@@ -34,6 +34,35 @@ var commit string
 // path to libc
 var LibcDir = "libc"
 
+// useMksquashfs makes GenerateAppImage shell out to mksquashfs
+// rather than using the built-in squashfs writer
+var useMksquashfs bool
+
+// reproducible makes GenerateAppImage produce bit-for-bit identical AppImages
+// from identical AppDirs. It is also switched on if $SOURCE_DATE_EPOCH is set
+var reproducible bool
+
+// permissions, if not empty, is embedded as X-AppImage-Permissions into the desktop file,
+// declaring what the application needs to be allowed to do when it is run in a sandbox
+var permissions string
+
+// skipSigning makes GenerateAppImage not sign the AppImage, even if a key was set up with setupsigning
+var skipSigning bool
+
+// skipPublishing makes GenerateAppImage not upload the AppImage, even if it runs on CI with a token
+var skipPublishing bool
+
+// embeddedRuntimes are the runtimes built into the binary, if any,
+// together with the sha256 digests pinned for them
+var embeddedRuntimes fs.FS
+
+// runtimeSHA256, if not empty, is the sha256 digest that the runtime used by GenerateAppImage must have
+var runtimeSHA256 string
+
+// allowUnpinnedRuntime lets GenerateAppImage use a runtime file that is neither one of the pinned
+// runtimes nor has the digest in runtimeSHA256
+var allowUnpinnedRuntime bool
+
 // checkRunningWithinDocker  checks if the tool is running within a Docker container
 // and warn the user of passing Environment variables to the container
 func checkRunningWithinDocker() bool {
@@ -138,6 +167,194 @@ func getMeta() (string, string) {
 	return version, gitRoot
 }
 
+// runtimeArch returns the name that the runtime for arch has,
+// e.g., aarch64 for arm64
+func runtimeArch(arch string) string {
+	switch arch {
+	case "amd64", "x86-64":
+		return "x86_64"
+	case "i386", "i486", "i586", "x86":
+		return "i686"
+	case "arm64", "armv8":
+		return "aarch64"
+	case "arm", "armv7l", "armv7":
+		return "armhf"
+	}
+	return arch
+}
+
+// findRuntime returns the path to the runtime for arch that is built into
+// or bundled with the binary, or exits if it cannot be found
+func findRuntime(arch string) string {
+	if embeddedRuntimes != nil {
+		runtimes, err := helpers.ReadRuntimes(embeddedRuntimes)
+		if err != nil {
+			helpers.PrintError("Built-in runtimes", err)
+			os.Exit(1)
+		}
+		for _, r := range runtimes {
+			if r.Arch == arch && r.Embedded {
+				// Not into a directory that others can write to, where they could put their own runtime in place of ours
+				dir, err := os.UserCacheDir()
+				if err == nil {
+					dir = filepath.Join(dir, "appimagetool")
+					err = os.MkdirAll(dir, 0700)
+				}
+				if err != nil {
+					dir, err = os.MkdirTemp("", "appimagetool-")
+				}
+				if err != nil {
+					helpers.PrintError("Built-in runtime", err)
+					os.Exit(1)
+				}
+				runtimeFile := filepath.Join(dir, r.Name()+"-"+r.SHA256[:12])
+				err = extractRuntime(r, runtimeFile)
+				if err != nil {
+					helpers.PrintError("Built-in runtime", err)
+					os.Exit(1)
+				}
+				log.Println("Using the built-in", r.Name())
+				return runtimeFile
+			}
+		}
+	}
+
+	runtimeDir := filepath.Clean(helpers.Here() + "/../share/AppImageKit/runtime/")
+	if _, err := os.Stat(runtimeDir); os.IsNotExist(err) {
+		runtimeDir = helpers.Here()
+	}
+	runtimeFile := runtimeDir + "/runtime-" + arch
+	if helpers.CheckIfFileExists(runtimeFile) == false {
+		log.Println("Cannot find " + runtimeFile + ", exiting")
+		log.Println("It should have been bundled, but you can get it from https://github.com/AppImage/AppImageKit/releases/continuous")
+		log.Println("and use it with --runtime-file")
+		os.Exit(1)
+	}
+	return runtimeFile
+}
+
+// extractRuntime writes the built-in runtime r to path after checking that it has the pinned digest
+func extractRuntime(r helpers.Runtime, path string) error {
+	err := r.Verify()
+	if err != nil {
+		return err
+	}
+	data, err := fs.ReadFile(embeddedRuntimes, r.Name())
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so that nobody gets to see a partially written runtime
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0755)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// checkRuntimeFile exits if the runtime file does not have the sha256 digest in runtimeSHA256
+// or is for another architecture than arch. Without runtimeSHA256, it also exits if the runtime
+// is not one of the pinned runtimes, unless allowUnpinnedRuntime is set or no runtimes are pinned
+func checkRuntimeFile(runtimeFile string, arch string) {
+	f, err := os.Open(runtimeFile)
+	if err != nil {
+		helpers.PrintError("runtime", err)
+		os.Exit(1)
+	}
+	sum, _, err := helpers.RuntimeDigest(f)
+	f.Close()
+	if err != nil {
+		helpers.PrintError("runtime", err)
+		os.Exit(1)
+	}
+	log.Println("sha256 digest of the runtime:", sum)
+	if runtimeSHA256 != "" && strings.EqualFold(sum, runtimeSHA256) == false {
+		log.Fatal("The runtime " + runtimeFile + " does not have the sha256 digest " + runtimeSHA256 + ", exiting")
+	}
+	if res, err := helpers.GetElfArchitecture(runtimeFile); err == nil && res != arch {
+		log.Fatal("The runtime " + runtimeFile + " is for " + res + ", but the AppDir is for " + arch + ", exiting")
+	}
+	if runtimeSHA256 != "" {
+		return
+	}
+	pinned := false
+	if embeddedRuntimes != nil {
+		runtimes, _ := helpers.ReadRuntimes(embeddedRuntimes)
+		for _, r := range runtimes {
+			if r.Pinned == sum {
+				log.Println("This is the pinned", r.Name())
+				return
+			}
+			pinned = pinned || r.Pinned != ""
+		}
+	}
+	// Builds without pinned runtimes have nothing to check against, so they use the runtime as before
+	if !pinned {
+		log.Println("No runtimes are pinned in this build of appimagetool, not checking the runtime")
+		return
+	}
+	if !allowUnpinnedRuntime {
+		log.Fatal("The runtime " + runtimeFile + " is not one of the pinned runtimes; use --runtime-sha256 to make sure that it is the one you expect, " +
+			"or --allow-unpinned-runtime to use it anyway, exiting")
+	}
+	log.Println("This is not one of the pinned runtimes, using it anyway")
+}
+
+// signAppImage signs the AppImage at target if a key was set up with setupsigning,
+// signing digest. Returns whether the AppImage was signed
+func signAppImage(target string, digest string) bool {
+	// Decrypt the private key which we need for signing
+	if helpers.CheckIfFileExists(helpers.EncPrivkeyFileName) == true {
+		_, ok := os.LookupEnv(helpers.EnvSuperSecret)
+		if ok != true {
+			fmt.Println("Environment variable", helpers.EnvSuperSecret, "not present, cannot sign")
+			os.Exit(1)
+		}
+
+		fmt.Println("Attempting to decrypt the private key...")
+		// TODO: Replace with native Go code in ossl.go
+		superSecret := os.Getenv(helpers.EnvSuperSecret)
+		if superSecret == "" {
+			fmt.Println("Could not get secure environment variable $" + helpers.EnvSuperSecret + ", exiting")
+			os.Exit(1)
+		}
+		// Note: 06065064:digital envelope routines:EVP_DecryptFinal_ex:bad decrypt:evp_enc.c:539
+		// OpenSSL 1.1.0 changed from MD5 to SHA-256; they broke stuff (again). Adding '-md sha256' seems to solve it
+		// TODO: Replace OpenSSL call with native Go code
+		// https://stackoverflow.com/a/43847627
+		cmd := "openssl aes-256-cbc -pass pass:" + superSecret + " -in " + helpers.EncPrivkeyFileName + " -out " + helpers.PrivkeyFileName + " -d -a -md sha256"
+		err := helpers.RunCmdStringTransparently(cmd)
+		if err != nil {
+			fmt.Println("Could not decrypt the private key using the password in $" + helpers.EnvSuperSecret + ", exiting")
+			os.Exit(1)
+		}
+	}
+
+	// Sign the AppImage
+	if helpers.CheckIfFileExists(helpers.PrivkeyFileName) == false {
+		return false
+	}
+	fmt.Println("Attempting to sign the AppImage...")
+	err := helpers.SignAppImage(target, digest)
+	if err != nil {
+		helpers.PrintError("SignAppImage", err)
+		_ = os.Remove(helpers.PrivkeyFileName)
+		os.Exit(1)
+	}
+	_ = os.Remove(helpers.PrivkeyFileName)
+	return true
+}
+
 // GenerateAppImage converts an AppDir into an AppImage
 func GenerateAppImage(
 	appdir string,
@@ -201,44 +418,45 @@ func GenerateAppImage(
 	iconname := val.String()
 
 	// Determine the architecture
-	// If no $ARCH variable is set check all .so that we can find to determine the architecture
+	// If no $ARCH variable is set, use the one of AppRun or the main executable,
+	// and if both are scripts, check all .so that we can find to determine the architecture
 	var archs []string
-	if os.Getenv("ARCH") == "" {
-		res, err := helpers.GetElfArchitecture(appdir + "/AppRun")
-		if err == nil {
-			archs = helpers.AppendIfMissing(archs, res)
-			log.Println("Architecture from AppRun:", res)
-		} else {
-			err := filepath.Walk(appdir, func(path string, info os.FileInfo, err error) error {
+	val, _ = d.Section("Desktop Entry").GetKey("Exec")
+	mainExecutable := appdir + "/usr/bin/" + strings.Split(val.String(), " ")[0]
+	if os.Getenv("ARCH") != "" {
+		archs = helpers.AppendIfMissing(archs, runtimeArch(os.Getenv("ARCH")))
+		fmt.Println("Architecture from $ARCH:", os.Getenv("ARCH"))
+	} else if res, err := helpers.GetElfArchitecture(appdir + "/AppRun"); err == nil {
+		archs = helpers.AppendIfMissing(archs, res)
+		log.Println("Architecture from AppRun:", res)
+	} else if res, err := helpers.GetElfArchitecture(mainExecutable); err == nil {
+		archs = helpers.AppendIfMissing(archs, res)
+		log.Println("Architecture from the main executable:", res)
+	} else {
+		err := filepath.Walk(appdir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				helpers.PrintError("Determine architecture", err)
+				return err
+			} else if info.Mode().IsRegular() && strings.Contains(info.Name(), ".so.") {
+				arch, err := helpers.GetElfArchitecture(path)
 				if err != nil {
+					// we received an error when analyzing the arch
 					helpers.PrintError("Determine architecture", err)
 					return err
-				} else if info.IsDir() == false && strings.Contains(info.Name(), ".so.") {
-					arch, err := helpers.GetElfArchitecture(path)
-					if err != nil {
-						// we received an error when analyzing the arch
-						helpers.PrintError("Determine architecture", err)
-						return err
-					} else if helpers.SliceContains(archs, arch) == false {
-						log.Println("Architecture of", info.Name()+":", arch)
-						archs = helpers.AppendIfMissing(archs, arch)
-					} else {
-						// FIXME: we found some data, but still it was not a part of the
-						// known architectures
-						errArchNotKnown := errors.New("Could not detect a valid architecture")
-						return errArchNotKnown
-					}
+				} else if helpers.SliceContains(archs, arch) == false {
+					log.Println("Architecture of", info.Name()+":", arch)
+					archs = helpers.AppendIfMissing(archs, arch)
 				}
-				return nil
-			})
-			helpers.PrintError("Determine architecture", err)
-		}
-	} else {
-		archs = helpers.AppendIfMissing(archs, os.Getenv("ARCH"))
-		fmt.Println("Architecture from $ARCH:", os.Getenv("ARCH"))
+			}
+			return nil
+		})
+		helpers.PrintError("Determine architecture", err)
 	}
 
 	if len(archs) != 1 {
+		if len(archs) > 1 {
+			log.Println("Found libraries for", strings.Join(archs, ", ")+"; were some of them deployed from the wrong system?")
+		}
 		log.Fatal("Could not determine architecture automatically, please supply it as $ARCH " + filepath.Base(os.Args[0]) + " ... \n")
 	}
 	arch := archs[0]
@@ -260,6 +478,26 @@ func GenerateAppImage(
 		helpers.PrintError("Save desktop file", err)
 	}
 
+	// Set X-AppImage-Permissions in desktop file and save it, or check the one that is there
+	if permissions != "" {
+		p, err := helpers.ParsePermissions(permissions)
+		if err != nil {
+			log.Fatal("Invalid permissions: " + err.Error())
+		}
+		d, err = ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, // Do not cripple lines hat contain ";"
+			desktopfile)
+		ini.PrettyFormat = false
+		helpers.PrintError("ini.load", err)
+		d.Section("Desktop Entry").Key(helpers.PermissionsKey).SetValue(helpers.FormatPermissions(p))
+		err = d.SaveTo(desktopfile)
+		helpers.PrintError("Save desktop file", err)
+	} else if d.Section("Desktop Entry").HasKey(helpers.PermissionsKey) {
+		_, err = helpers.ParsePermissions(d.Section("Desktop Entry").Key(helpers.PermissionsKey).String())
+		if err != nil {
+			log.Fatal("Invalid " + helpers.PermissionsKey + " in " + desktopfile + ": " + err.Error())
+		}
+	}
+
 	// Construct target AppImage filename
 	// make sure the output directory exists before continuing
 	target := destination
@@ -391,21 +629,12 @@ func GenerateAppImage(
 	}
 
 	if len(runtimeFile) < 1 {
-		runtimeDir := filepath.Clean(helpers.Here() + "/../share/AppImageKit/runtime/")
-		if _, err := os.Stat(runtimeDir); os.IsNotExist(err) {
-			runtimeDir = helpers.Here()
-		}
-		runtimeFile = runtimeDir + "/runtime-" + arch
-		if helpers.CheckIfFileExists(runtimeFile) == false {
-			log.Println("Cannot find " + runtimeFile + ", exiting")
-			log.Println("It should have been bundled, but you can get it from https://github.com/AppImage/AppImageKit/releases/continuous")
-			// TODO: Download it from there?
-			os.Exit(1)
-		}
+		runtimeFile = findRuntime(arch)
 	} else if helpers.CheckIfFileExists(runtimeFile) == false {
 		log.Println("Cannot find " + runtimeFile + ", exiting")
 		os.Exit(1)
 	}
+	checkRuntimeFile(runtimeFile, arch)
 
 	// Find out the size of the binary runtime
 	fi, err := os.Stat(runtimeFile)
@@ -429,6 +658,22 @@ func GenerateAppImage(
 		FSTime = time.Unix(0, 0)
 	}
 
+	// For reproducible builds, use $SOURCE_DATE_EPOCH (or the beginning of the epoch)
+	// as the fstime and as the modification time of all files
+	sourceDateEpoch, sourceDateEpochSet, err := helpers.SourceDateEpoch()
+	if err != nil {
+		helpers.PrintError("SOURCE_DATE_EPOCH", err)
+		os.Exit(1)
+	}
+	if sourceDateEpochSet {
+		reproducible = true
+	}
+	if reproducible {
+		FSTime = sourceDateEpoch
+		fstime = strconv.FormatInt(FSTime.Unix(), 10)
+		fmt.Println("Building reproducibly with fstime", fstime)
+	}
+
 	// Exit if we cannot set the permissions of the AppDir,
 	// this is important e.g., for Firejail
 	// https://github.com/AppImage/AppImageKit/issues/1032#issuecomment-596225173
@@ -440,15 +685,40 @@ func GenerateAppImage(
 		os.Exit(1)
 	}
 
-	// "mksquashfs", source, destination, "-offset", offset, "-comp", "zstd", "-root-owned", "-noappend", "-b", "1M"
-	cmd := exec.Command("mksquashfs", appdir, target, "-offset", strconv.FormatInt(offset, 10), "-fstime", fstime, "-comp", squashfsCompressionType, "-root-owned", "-noappend", "-b", "1M")
-	fmt.Println(cmd.String())
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	err = cmd.Run()
-	if err != nil {
-		helpers.PrintError("mksquashfs", err)
-		os.Exit(1)
+	if useMksquashfs {
+		// "mksquashfs", source, destination, "-offset", offset, "-comp", "zstd", "-root-owned", "-noappend", "-b", "1M"
+		cmd := exec.Command("mksquashfs", appdir, target, "-offset", strconv.FormatInt(offset, 10), "-fstime", fstime, "-comp", squashfsCompressionType, "-root-owned", "-noappend", "-b", "1M")
+		if reproducible {
+			// mksquashfs refuses -fstime together with $SOURCE_DATE_EPOCH, and cannot normalize permissions
+			log.Println("Warning: mksquashfs does not normalize file permissions, use the built-in squashfs writer for reproducible builds")
+			cmd.Args = append(cmd.Args, "-all-time", fstime, "-no-xattrs")
+			for _, e := range os.Environ() {
+				if !strings.HasPrefix(e, "SOURCE_DATE_EPOCH=") {
+					cmd.Env = append(cmd.Env, e)
+				}
+			}
+		}
+		fmt.Println(cmd.String())
+		cmd.Stderr = os.Stderr
+		cmd.Stdout = os.Stdout
+		err = cmd.Run()
+		if err != nil {
+			helpers.PrintError("mksquashfs", err)
+			os.Exit(1)
+		}
+	} else {
+		fmt.Println("Creating squashfs with", squashfsCompressionType, "compression...")
+		err = helpers.MakeSquashfs(appdir, target, offset, helpers.SquashfsOptions{
+			Compression:  squashfsCompressionType,
+			BlockSize:    helpers.SquashfsDefaultBlockSize,
+			FSTime:       FSTime,
+			RootOwned:    true,
+			Reproducible: reproducible,
+		})
+		if err != nil {
+			helpers.PrintError("squashfs", err)
+			os.Exit(1)
+		}
 	}
 
 	// Embed the binary runtime into the squashfs
@@ -478,15 +748,27 @@ func GenerateAppImage(
 	// which will be overwritten in the following lines of code
 	updateinformation := updateInformation
 
-	// If we know this is a GitLab CI build
-	// do nothing at the moment but print some nice message
+	// If we know this is a GitLab CI build,
+	// then fill in update information based on CI_PROJECT_PATH
 	// https://docs.gitlab.com/ee/ci/variables/#predefined-variables-environment-variables
-	// CI_PROJECT_URL
-	// "CI_COMMIT_REF_NAME"); The branch or tag name for which project is built
-	// "CI_JOB_NAME"); The name of the job as defined in .gitlab-ci.yml
-	if os.Getenv("CI_COMMIT_REF_NAME") != "" {
+	//     CI_SERVER_HOST: The host of the GitLab instance, e.g., gitlab.com
+	//     CI_PROJECT_PATH: The path of the project, e.g., group/project
+	//     CI_COMMIT_TAG: The tag for which the project is built, if any
+	//     CI_MERGE_REQUEST_IID: Set in merge request pipelines
+	if os.Getenv("GITLAB_CI") != "" && generateUpdateInformation {
 		fmt.Println("Running on GitLab CI")
-		fmt.Println("Will not calculate update information for GitLab because GitLab does not support HTTP range requests yet")
+		if os.Getenv("CI_MERGE_REQUEST_IID") != "" {
+			fmt.Println("Will not calculate update information for GitLab because this is a merge request")
+		} else {
+			var channel string
+			if os.Getenv("CI_COMMIT_TAG") != "" && os.Getenv("CI_COMMIT_TAG") != "continuous" {
+				channel = "latest"
+			} else {
+				channel = "continuous"
+			}
+			updateinformation = "gitlab-releases-zsync|" + os.Getenv("CI_SERVER_HOST") + "|" + os.Getenv("CI_PROJECT_PATH") + "|" + channel + "|" + nameWithUnderscores + "-" + "*-" + arch + ".AppImage.zsync"
+			fmt.Println("Calculated updateinformation:", updateinformation)
+		}
 	}
 
 	// If we know this is a Travis CI build,
@@ -589,43 +871,8 @@ func GenerateAppImage(
 
 	// The actual signing
 
-	// Decrypt the private key which we need for signing
-	if helpers.CheckIfFileExists(helpers.EncPrivkeyFileName) == true {
-		_, ok := os.LookupEnv(helpers.EnvSuperSecret)
-		if ok != true {
-			fmt.Println("Environment variable", helpers.EnvSuperSecret, "not present, cannot sign")
-			os.Exit(1)
-		}
-
-		fmt.Println("Attempting to decrypt the private key...")
-		// TODO: Replace with native Go code in ossl.go
-		superSecret := os.Getenv(helpers.EnvSuperSecret)
-		if superSecret == "" {
-			fmt.Println("Could not get secure environment variable $" + helpers.EnvSuperSecret + ", exiting")
-			os.Exit(1)
-		}
-		// Note: 06065064:digital envelope routines:EVP_DecryptFinal_ex:bad decrypt:evp_enc.c:539
-		// OpenSSL 1.1.0 changed from MD5 to SHA-256; they broke stuff (again). Adding '-md sha256' seems to solve it
-		// TODO: Replace OpenSSL call with native Go code
-		// https://stackoverflow.com/a/43847627
-		cmd := "openssl aes-256-cbc -pass pass:" + superSecret + " -in " + helpers.EncPrivkeyFileName + " -out " + helpers.PrivkeyFileName + " -d -a -md sha256"
-		err = helpers.RunCmdStringTransparently(cmd)
-		if err != nil {
-			fmt.Println("Could not decrypt the private key using the password in $" + helpers.EnvSuperSecret + ", exiting")
-			os.Exit(1)
-		}
-	}
-
-	// Sign the AppImage
-	if helpers.CheckIfFileExists(helpers.PrivkeyFileName) == true {
-		fmt.Println("Attempting to sign the AppImage...")
-		err = helpers.SignAppImage(target, digest)
-		if err != nil {
-			helpers.PrintError("SignAppImage", err)
-			_ = os.Remove(helpers.PrivkeyFileName)
-			os.Exit(1)
-		}
-		_ = os.Remove(helpers.PrivkeyFileName)
+	if !skipSigning {
+		signAppImage(target, digest)
 	}
 
 	// Embed public key into '.sig_key' section if it exists
@@ -668,25 +915,23 @@ func GenerateAppImage(
 	pl, _ := constructMQTTPayload(name, version, FSTime)
 	fmt.Println(pl)
 
-	// Upload and publish if we know this is a Travis CI build
-	// https://github.com/probonopd/uploadtool says
-	// Note that UPLOADTOOL* variables will be used in bash script to form a JSON request,
-	// that means some characters like double quotes and new lines need to be escaped
-	// TODO: Instead of trying to somehow force this into uploadtool, do it properly in Go.
-	body, err := helpers.GetCommitMessageForThisCommitOnTravis()
-	fmt.Println("Commit message for this commit:", body)
-
-	// If its a TRAVIS CI, then upload the release assets and zsync file
-	if os.Getenv("TRAVIS_REPO_SLUG") != "" || os.Getenv("GITHUB_TOKEN") != "" {
+	// Upload and publish if we know this is a build on GitHub Actions, Travis CI or GitLab CI.
+	// The release notes are the commit message
+	publisher, release, err := helpers.PublisherFromEnvironment()
+	if skipPublishing {
+		publisher = nil
+	} else if err != nil {
+		fmt.Println("Will not publish the AppImage:", err)
+		publisher = nil
+	}
+	if publisher != nil {
 		if _, err := os.Stat(target + ".zsync"); err == nil {
-			cmd := exec.Command("uploadtool", target, target+".zsync")
-			fmt.Println(cmd.String())
-			out, err := cmd.CombinedOutput()
-			fmt.Printf("%s", string(out))
+			releaseURL, err := publisher.Publish(release, target, target+".zsync")
 			if err != nil {
-				helpers.PrintError("uploadtool", err)
+				helpers.PrintError("Publish", err)
 				os.Exit(1)
 			}
+			fmt.Println("Published to", releaseURL)
 
 			// If upload succeeded, publish MQTT message
 			// TODO: Message AppImageHub instead, which in turn messages the clients
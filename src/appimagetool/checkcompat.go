@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/probonopd/go-appimage/src/goappimage"
+	"github.com/urfave/cli/v2"
+)
+
+// bootstrapCheckCompat checks whether an AppImage can run on this system (or a sysroot)
+// and on common distributions, based on the symbol versions and libraries its ELF files need.
+// Exits with an error if it cannot run on this system or the sysroot
+// 		Args: c: cli.Context
+func bootstrapCheckCompat(c *cli.Context) error {
+	if c.NArg() != 1 {
+		log.Fatal("Please specify the path to an AppImage to check")
+	}
+	target := c.Args().Get(0)
+	ai, err := goappimage.NewAppImage(target)
+	if ai.Type() < 1 {
+		log.Fatal(target, " is not an AppImage: ", err)
+	}
+	requirements, err := ai.Requirements()
+	if err != nil {
+		log.Fatal("Could not read the contents of ", target, ": ", err)
+	}
+	root := c.String("sysroot")
+	system, err := goappimage.ReadSystem(root)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Requires:")
+	var prefixes []string
+	for prefix := range requirements.Versions {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		bundled := ""
+		if requirements.Bundled[prefix] {
+			bundled = "\tbundled"
+		}
+		fmt.Fprintf(w, "  %s_%s\t(%s)%s\n", prefix, requirements.Versions[prefix], requirements.VersionRequiredBy[prefix], bundled)
+	}
+	var libraries []string
+	for lib := range requirements.Libraries {
+		libraries = append(libraries, lib)
+	}
+	sort.Strings(libraries)
+	for _, lib := range libraries {
+		found := "missing"
+		if p, ok := system.Libraries[lib]; ok {
+			found = p
+		}
+		fmt.Fprintf(w, "  %s\t(%s)\t%s\n", lib, strings.Join(requirements.Libraries[lib], ", "), found)
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Distributions (glibc and libstdc++ only):")
+	for _, d := range goappimage.Distributions {
+		if problems := requirements.Check(d.System()); len(problems) > 0 {
+			fmt.Fprintf(w, "  %s\tno, %s\n", d.Name, strings.Join(problems, "; "))
+		} else {
+			fmt.Fprintf(w, "  %s\tyes\n", d.Name)
+		}
+	}
+	w.Flush()
+
+	fmt.Println()
+	name := "this system"
+	if root != "/" {
+		name = root
+	}
+	problems := requirements.Check(system)
+	if len(problems) == 0 {
+		fmt.Println(target, "should run on", name)
+		return nil
+	}
+	fmt.Println(target, "will not run on", name+":")
+	for _, p := range problems {
+		fmt.Println("  " + p)
+	}
+	os.Exit(1)
+	return nil
+}
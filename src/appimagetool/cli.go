@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/probonopd/go-appimage/internal/helpers"
@@ -33,7 +34,16 @@ func bootstrapAppImageDeploy(c *cli.Context) error {
 		standalone:     c.Bool("standalone"),
 		libAppRunHooks: c.Bool("libapprun_hooks"),
 		preserveCwd:    c.Bool("preserve_cwd"),
+		maxGlibc:       c.String("max-glibc"),
 	}
+	if strings.Trim(options.maxGlibc, "0123456789.") != "" {
+		log.Fatal("--max-glibc needs a version such as 2.28, not ", options.maxGlibc)
+	}
+	sysroot, err := sysrootOption(c.String("sysroot"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	options.sysroot = sysroot
 	AppDirDeploy(c.Args().Get(0))
 	return nil
 }
@@ -147,6 +157,21 @@ func bootstrapAppImageBuild(c *cli.Context) error {
 	}
 	fileToAppDir := c.Args().Get(0)
 
+	reproducible = c.Bool("reproducible")
+	permissions = c.String("permissions")
+	runtimeSHA256 = c.String("runtime-sha256")
+	allowUnpinnedRuntime = c.Bool("allow-unpinned-runtime")
+
+	// Only check for mksquashfs if we were asked to use it rather than the built-in squashfs writer
+	useMksquashfs = c.Bool("mksquashfs")
+	if useMksquashfs {
+		helpers.CheckIfAllToolsArePresent([]string{"mksquashfs"})
+		// Check whether we have a sufficient version of mksquashfs for -offset
+		if helpers.CheckIfSquashfsVersionSufficient("mksquashfs") == false {
+			os.Exit(1)
+		}
+	}
+
 	// does the file exist? if not early-exit
 	if !helpers.CheckIfFileOrFolderExists(fileToAppDir) {
 		log.Fatal("The specified file does not exist")
@@ -159,6 +184,7 @@ func bootstrapAppImageBuild(c *cli.Context) error {
 		// for optimum performance, the following default parameters are passed
 		// fileToAppDir: 				fileToAppDir
 		// generateUpdateInformation: 	true (always guess based on environment variables)
+		// runtimeFile: 				--runtime-file, or the built-in runtime for the architecture
 		// squashfsCompressionType: 	zstd
 		// checkAppStreamMetadata: 		true (always verify the appstream metadata if files exists
 		// 								using appstreamcli
@@ -168,7 +194,7 @@ func bootstrapAppImageBuild(c *cli.Context) error {
 		GenerateAppImage(
 			fileToAppDir, "",
 			true,
-			"",
+			c.String("runtime-file"),
 			"zstd",
 			true,
 			"",
@@ -225,25 +251,29 @@ func main() {
 	// fmt.Println("PATH:", os.Getenv("PATH"))
 
 	// Check for needed files on $PATH
-	tools := []string{"file", "mksquashfs", "desktop-file-validate", "uploadtool", "patchelf", "desktop-file-validate", "patchelf"} // "sh", "strings", "grep" no longer needed?; "curl" is needed for uploading only, "glib-compile-schemas" is needed in some cases only
-	// curl is needed by uploadtool; TODO: Replace uploadtool with native Go code
+	tools := []string{"file", "patchelf"} // "sh", "strings", "grep" no longer needed?; "glib-compile-schemas" is needed in some cases only
 	// "sh", "strings", "grep" are needed by appdirtool to parse qt_prfxpath; TODO: Replace with native Go code
 	err := helpers.CheckForNeededTools(tools)
 	if err != nil {
 		os.Exit(1)
 	}
-	
-	// Check whether we have a sufficient version of mksquashfs for -offset
-	if helpers.CheckIfSquashfsVersionSufficient("mksquashfs") == false {
-		os.Exit(1)
-	}
-	
+
 	// define subcommands, like 'deploy', 'validate', ...
 	app.Commands = []*cli.Command{
 		{
 			Name:   "deploy",
 			Usage:  "Turns PREFIX directory into AppDir by deploying dependencies and AppRun file",
 			Action: bootstrapAppImageDeploy,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "max-glibc",
+					Usage: "Fail if the AppDir needs a newer glibc than this, e.g., 2.28",
+				},
+				&cli.StringFlag{
+					Name:  "sysroot",
+					Usage: "Take libraries and ld-linux from the system in this directory, e.g., for another architecture",
+				},
+			},
 		},
 		{
 			Name:   "validate",
@@ -260,6 +290,133 @@ func main() {
 			Usage:  "",
 			Action: bootstrapAppImageSections,
 		},
+		{
+			Name:      "convert",
+			Usage:     "Convert a type 1 AppImage into a type 2 AppImage",
+			ArgsUsage: "<type 1 AppImage> [destination]",
+			Action:    bootstrapConvert,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "runtime-file",
+					Usage: "Specify an external type 2 runtime file",
+				},
+				&cli.StringFlag{
+					Name:  "runtime-sha256",
+					Usage: "Refuse to use a runtime that does not have this sha256 digest",
+				},
+				&cli.BoolFlag{
+					Name:  "allow-unpinned-runtime",
+					Usage: "Use a runtime file that is not one of the pinned runtimes without --runtime-sha256",
+				},
+				&cli.StringFlag{
+					Name:  "comp",
+					Value: "zstd",
+					Usage: "Squashfs compression (zstd, xz or gzip)",
+				},
+			},
+		},
+		{
+			Name:      "lint",
+			Usage:     "Check an AppDir or AppImage for common mistakes",
+			ArgsUsage: "<AppDir|AppImage>",
+			Action:    bootstrapLint,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "format",
+					Value: "text",
+					Usage: "Output format (text, json or sarif)",
+				},
+				&cli.StringSliceFlag{
+					Name:  "disable",
+					Usage: "ID of a rule that should not be checked, can be given multiple times",
+				},
+			},
+		},
+		{
+			Name:   "build",
+			Usage:  "Deploy and build an AppImage as described by a recipe",
+			Action: bootstrapBuild,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "file",
+					Aliases: []string{"f"},
+					Usage:   "The recipe (YAML)",
+				},
+				&cli.BoolFlag{
+					Name:    "dry-run",
+					Aliases: []string{"n"},
+					Usage:   "Only show what would be done",
+				},
+			},
+		},
+		{
+			Name:  "runtime",
+			Usage: "Inspect the runtimes built into appimagetool",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "list",
+					Usage:  "List the built-in runtimes and their sha256 digests",
+					Action: bootstrapRuntimeList,
+				},
+				{
+					Name:      "extract",
+					Usage:     "Write the built-in runtime for an architecture to a file",
+					ArgsUsage: "<arch> [destination]",
+					Action:    bootstrapRuntimeExtract,
+				},
+				{
+					Name:      "info",
+					Usage:     "Show a built-in runtime, or whether a runtime file is one of the pinned runtimes",
+					ArgsUsage: "<arch|file>",
+					Action:    bootstrapRuntimeInfo,
+				},
+			},
+		},
+		{
+			Name:      "runtime-swap",
+			Usage:     "Put another runtime into an AppImage, keeping its payload, update information and signing key",
+			ArgsUsage: "<AppImage> [destination]",
+			Action:    bootstrapRuntimeSwap,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "runtime",
+					Usage: "Use this runtime rather than the built-in one",
+				},
+				&cli.StringFlag{
+					Name:  "runtime-sha256",
+					Usage: "Refuse to use a runtime that does not have this sha256 digest",
+				},
+				&cli.BoolFlag{
+					Name:  "allow-unpinned-runtime",
+					Usage: "Use a runtime that is not one of the pinned runtimes without --runtime-sha256",
+				},
+			},
+		},
+		{
+			Name:      "check-compat",
+			Usage:     "Check whether an AppImage can run on this system and on common distributions",
+			ArgsUsage: "<AppImage>",
+			Action:    bootstrapCheckCompat,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "sysroot",
+					Value: "/",
+					Usage: "Check against the system in this directory instead of this system",
+				},
+			},
+		},
+		{
+			Name:      "verify-reproducible",
+			Usage:     "Rebuild the payload of an AppDir (and compare it to a reference AppImage), or compare two AppImages",
+			ArgsUsage: "<AppDir|AppImage> [reference AppImage]",
+			Action:    bootstrapVerifyReproducible,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "comp",
+					Usage: "Squashfs compression (zstd, xz or gzip), defaults to that of the reference or zstd",
+				},
+			},
+		},
 	}
 
 	// define flags, such as --libapprun_hooks, --standalone here ...
@@ -283,6 +440,30 @@ func main() {
 			Name:    "preserve_cwd",
 			Usage:   "Preserve the current working directory when running the app",
 		},
+		&cli.BoolFlag{
+			Name:  "reproducible",
+			Usage: "Build bit-for-bit reproducibly, using $SOURCE_DATE_EPOCH (or 0) as the timestamp of all files",
+		},
+		&cli.BoolFlag{
+			Name:  "mksquashfs",
+			Usage: "Use the external mksquashfs tool (at least version 4.4) instead of the built-in squashfs writer",
+		},
+		&cli.StringFlag{
+			Name:  "runtime-file",
+			Usage: "Use this runtime rather than the built-in one",
+		},
+		&cli.StringFlag{
+			Name:  "runtime-sha256",
+			Usage: "Refuse to use a runtime that does not have this sha256 digest",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-unpinned-runtime",
+			Usage: "Use a runtime file that is not one of the pinned runtimes without --runtime-sha256",
+		},
+		&cli.StringFlag{
+			Name:  "permissions",
+			Usage: "Declare what the application needs when run in a sandbox, e.g., \"network,audio\" (network, home, audio, devices, dbus)",
+		},
 	}
 
 	// TODO: move travis based Sections to travis.go in future
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-appimage/src/goappimage"
+	"github.com/urfave/cli/v2"
+)
+
+// bootstrapConvert converts a type 1 AppImage into a type 2 AppImage
+// 		Args: c: cli.Context
+func bootstrapConvert(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		log.Fatal("Please specify the path to a type 1 AppImage, and optionally the destination")
+	}
+	source := c.Args().Get(0)
+	if !helpers.CheckIfFileExists(source) {
+		log.Fatal("The specified file could not be found")
+	}
+	ai, err := goappimage.NewAppImage(source)
+	if err != nil && ai.Type() < 0 {
+		log.Fatal(source, " is not an AppImage")
+	}
+	if ai.Type() != 1 {
+		log.Fatal(source, " is not a type 1 AppImage but type ", ai.Type())
+	}
+	if err != nil {
+		log.Println("Warning:", err)
+	}
+
+	destination := c.Args().Get(1)
+	if destination == "" {
+		destination = strings.TrimSuffix(source, filepath.Ext(source)) + "-type2.AppImage"
+	}
+
+	// The runtime of a type 1 AppImage is an ELF file for the architecture of the payload
+	arch, err := helpers.GetElfArchitecture(source)
+	if err != nil {
+		log.Fatal("Could not determine the architecture of ", source, ": ", err)
+	}
+	runtimeFile := c.String("runtime-file")
+	if runtimeFile == "" {
+		runtimeFile = findRuntime(arch)
+	}
+	runtimeSHA256 = c.String("runtime-sha256")
+	allowUnpinnedRuntime = c.Bool("allow-unpinned-runtime")
+	checkRuntimeFile(runtimeFile, arch)
+
+	fmt.Println("Converting", source, "to", destination, "using", runtimeFile)
+	if ai.UpdateInfo != "" {
+		fmt.Println("Carrying over update information:", ai.UpdateInfo)
+	}
+	err = ai.ConvertToType2(destination, runtimeFile, c.String("comp"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Success")
+	return nil
+}
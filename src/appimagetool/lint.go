@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-appimage/src/goappimage"
+	"github.com/urfave/cli/v2"
+)
+
+// bootstrapLint checks an AppDir or a type 2 AppImage for common mistakes
+// and prints the findings. Exits with an error if any finding is an error,
+// so that it can be used to gate CI
+// 		Args: c: cli.Context
+func bootstrapLint(c *cli.Context) error {
+	if c.NArg() != 1 {
+		log.Fatal("Please specify the path to an AppDir or AppImage to lint")
+	}
+	target := c.Args().Get(0)
+	info, err := os.Stat(target)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := helpers.LintOptions{
+		ExcludedLibraries: ExcludedLibraries,
+		Disabled:          c.StringSlice("disable"),
+	}
+	var fsys fs.FS
+	if info.IsDir() {
+		fsys = os.DirFS(target)
+	} else {
+		ai, err := goappimage.NewAppImage(target)
+		if err != nil && ai.Type() < 0 {
+			log.Fatal(target, " is not an AppImage")
+		}
+		rdr, err := ai.SquashfsReader()
+		if err != nil {
+			log.Fatal("Could not read the contents of ", target, ": ", err)
+		}
+		fsys = rdr
+		opts.UpdateInformation = ai.UpdateInfo
+	}
+
+	findings := helpers.Lint(fsys, opts)
+	if err = helpers.WriteLintReport(os.Stdout, findings, c.String("format"), "appimagetool"); err != nil {
+		log.Fatal(err)
+	}
+	if helpers.LintHasErrors(findings) {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/otiai10/copy"
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Recipe describes how to turn a directory into an AppImage, in one step, with "appimagetool build -f".
+// Relative paths are relative to the directory of the recipe
+type Recipe struct {
+	AppDir            string        `yaml:"appdir"`
+	Files             []RecipeFile  `yaml:"files"`  // Copied into the AppDir before deploying
+	Deploy            *RecipeDeploy `yaml:"deploy"` // If missing, the AppDir is used as it is
+	Version           RecipeVersion `yaml:"version"`
+	Arch              string        `yaml:"arch"`
+	Output            string        `yaml:"output"` // File name or, if it ends with "/", directory of the AppImage
+	Compression       string        `yaml:"compression"`
+	Runtime           string        `yaml:"runtime"`        // Without it, the built-in runtime
+	RuntimeSHA256     string        `yaml:"runtime-sha256"` // The sha256 digest that the runtime must have
+	AllowUnpinned     bool          `yaml:"allow-unpinned-runtime"`
+	Reproducible      bool          `yaml:"reproducible"`
+	Mksquashfs        bool          `yaml:"mksquashfs"`
+	Permissions       []string      `yaml:"permissions"`
+	AppStream         *bool         `yaml:"appstream"`          // Check the AppStream metadata, default true
+	UpdateInformation string        `yaml:"update-information"` // "guess" (default), "none", or the update information
+	Sign              *bool         `yaml:"sign"`               // Sign if a key was set up with setupsigning, default true
+	Publish           *bool         `yaml:"publish"`            // Upload when running on CI with a token, default true
+
+	dir string
+}
+
+// RecipeFile is a file or directory that is copied into the AppDir
+type RecipeFile struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"` // Relative to the AppDir
+}
+
+// RecipeDeploy are the options of "appimagetool deploy"
+type RecipeDeploy struct {
+	Desktop        string            `yaml:"desktop"` // Relative to the AppDir
+	Standalone     bool              `yaml:"standalone"`
+	LibAppRunHooks bool              `yaml:"libapprun-hooks"`
+	PreserveCwd    bool              `yaml:"preserve-cwd"`
+	Include        []string          `yaml:"include"`   // Libraries to bundle even if they are on the excludelist, e.g., "libstdc++.so.6"
+	Exclude        []string          `yaml:"exclude"`   // Libraries never to bundle, e.g., "libfoo.so.*"
+	Qt             *bool             `yaml:"qt"`        // Default true
+	QtDir          string            `yaml:"qt-dir"`    // Same as $QTDIR
+	Gtk            *bool             `yaml:"gtk"`       // Default true
+	GStreamer      *bool             `yaml:"gstreamer"` // Default true
+	MaxGlibc       string            `yaml:"max-glibc"`
+	Sysroot        string            `yaml:"sysroot"` // Take libraries and ld-linux from this system, e.g., for another architecture
+	Env            map[string]string `yaml:"env"`     // Set by AppRun, "${HERE}" is the AppDir
+}
+
+// RecipeVersion is where the version comes from: a value, the first line of a file, or the output of a command.
+// If none is given, $VERSION or the git commit is used, as without a recipe
+type RecipeVersion struct {
+	Value   string `yaml:"value"`
+	File    string `yaml:"file"`
+	Command string `yaml:"command"`
+}
+
+// UnmarshalYAML allows "version: 1.0" as a short form of "version: {value: 1.0}"
+func (v *RecipeVersion) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		v.Value = node.Value
+		return nil
+	}
+	type plain RecipeVersion
+	return node.Decode((*plain)(v))
+}
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ReadRecipe reads and checks the recipe at path
+func ReadRecipe(path string) (*Recipe, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := &Recipe{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	r.dir = filepath.Dir(abs)
+	if err = r.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Validate checks the recipe for mistakes that can be found without running it
+func (r *Recipe) Validate() error {
+	if r.AppDir == "" {
+		return errors.New("appdir is missing")
+	}
+	for _, f := range r.Files {
+		if f.From == "" || f.To == "" {
+			return errors.New("files need both from and to")
+		}
+		if filepath.IsAbs(f.To) || strings.HasPrefix(filepath.Clean(f.To), "..") {
+			return errors.New("files must be copied into the AppDir, not to " + f.To)
+		}
+	}
+	if d := r.Deploy; d != nil {
+		if d.Desktop == "" {
+			return errors.New("deploy needs the desktop file, e.g., usr/share/applications/myapp.desktop")
+		}
+		if strings.Trim(d.MaxGlibc, "0123456789.") != "" {
+			return errors.New("max-glibc needs a version such as 2.28, not " + d.MaxGlibc)
+		}
+		for _, pattern := range append(append([]string{}, d.Include...), d.Exclude...) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("library pattern %s: %w", pattern, err)
+			}
+		}
+		for key := range d.Env {
+			if !envNameRegexp.MatchString(key) {
+				return errors.New("not a valid name of an environment variable: " + key)
+			}
+		}
+	}
+	n := 0
+	for _, source := range []string{r.Version.Value, r.Version.File, r.Version.Command} {
+		if source != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("version needs one of value, file and command, not several")
+	}
+	if _, err := hex.DecodeString(r.RuntimeSHA256); err != nil || (r.RuntimeSHA256 != "" && len(r.RuntimeSHA256) != sha256.Size*2) {
+		return errors.New("runtime-sha256 needs a sha256 digest, not " + r.RuntimeSHA256)
+	}
+	if _, ok := helpers.SquashfsCompressors[r.Compression]; r.Compression != "" && !ok {
+		return errors.New("unknown compression " + r.Compression)
+	}
+	if _, err := helpers.ParsePermissions(strings.Join(r.Permissions, ",")); err != nil {
+		return err
+	}
+	switch r.UpdateInformation {
+	case "", "guess", "none":
+	default:
+		if err := helpers.ValidateUpdateInformation(r.UpdateInformation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// path returns p relative to the directory of the recipe
+func (r *Recipe) path(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(r.dir, p)
+}
+
+// enabled returns the value of an option that is on unless switched off
+func enabled(b *bool) bool {
+	return b == nil || *b
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// resolveVersion returns the version, or an empty string to let GenerateAppImage determine it
+func (r *Recipe) resolveVersion() (string, error) {
+	switch {
+	case r.Version.File != "":
+		data, err := os.ReadFile(r.path(r.Version.File))
+		if err != nil {
+			return "", err
+		}
+		line, _, _ := strings.Cut(string(data), "\n")
+		return strings.TrimSpace(line), nil
+	case r.Version.Command != "":
+		cmd := exec.Command("sh", "-c", r.Version.Command)
+		cmd.Dir = r.dir
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", r.Version.Command, err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return r.Version.Value, nil
+}
+
+// recipeStep is one step of running a recipe
+type recipeStep struct {
+	description string
+	run         func() error
+}
+
+// Plan returns the steps that running the recipe takes
+func (r *Recipe) Plan() []recipeStep {
+	appdir := r.path(r.AppDir)
+	var steps []recipeStep
+
+	for _, f := range r.Files {
+		from, to := r.path(f.From), filepath.Join(appdir, f.To)
+		steps = append(steps, recipeStep{
+			description: "Copy " + f.From + " to " + filepath.Join(r.AppDir, f.To),
+			run: func() error {
+				if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+					return err
+				}
+				return copy.Copy(from, to)
+			},
+		})
+	}
+
+	if d := r.Deploy; d != nil {
+		var sb strings.Builder
+		sb.WriteString("Deploy the dependencies of " + filepath.Join(r.AppDir, d.Desktop))
+		sb.WriteString("\n     bundle everything: " + yesNo(d.Standalone) + ", Qt: " + yesNo(enabled(d.Qt)) + ", Gtk: " + yesNo(enabled(d.Gtk)) + ", GStreamer: " + yesNo(enabled(d.GStreamer)))
+		if d.QtDir != "" {
+			sb.WriteString("\n     Qt from " + d.QtDir)
+		}
+		if d.Sysroot != "" {
+			sb.WriteString("\n     libraries from the sysroot " + d.Sysroot)
+		}
+		if len(d.Include) > 0 {
+			sb.WriteString("\n     bundle despite the excludelist: " + strings.Join(d.Include, ", "))
+		}
+		if len(d.Exclude) > 0 {
+			sb.WriteString("\n     never bundle: " + strings.Join(d.Exclude, ", "))
+		}
+		if d.MaxGlibc != "" {
+			sb.WriteString("\n     fail if glibc newer than " + d.MaxGlibc + " is needed")
+		}
+		var keys []string
+		for key := range d.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sb.WriteString("\n     AppRun sets " + key + "=" + d.Env[key])
+		}
+		steps = append(steps, recipeStep{
+			description: sb.String(),
+			run: func() error {
+				options = DeployOptions{
+					standalone:     d.Standalone,
+					libAppRunHooks: d.LibAppRunHooks,
+					preserveCwd:    d.PreserveCwd,
+					maxGlibc:       d.MaxGlibc,
+					include:        d.Include,
+					exclude:        d.Exclude,
+					skipQt:         !enabled(d.Qt),
+					skipGtk:        !enabled(d.Gtk),
+					skipGStreamer:  !enabled(d.GStreamer),
+					appRunEnv:      d.Env,
+				}
+				if d.QtDir != "" {
+					os.Setenv("QTDIR", r.path(d.QtDir))
+				}
+				if d.Sysroot != "" {
+					sysroot, err := sysrootOption(r.path(d.Sysroot))
+					if err != nil {
+						return err
+					}
+					options.sysroot = sysroot
+				}
+				AppDirDeploy(filepath.Join(appdir, d.Desktop))
+				return nil
+			},
+		})
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Build " + r.AppDir + " into an AppImage")
+	if r.Output != "" {
+		sb.WriteString(" at " + r.Output)
+	}
+	switch {
+	case r.Version.File != "":
+		sb.WriteString("\n     version: first line of " + r.Version.File)
+	case r.Version.Command != "":
+		sb.WriteString("\n     version: output of " + r.Version.Command)
+	case r.Version.Value != "":
+		sb.WriteString("\n     version: " + r.Version.Value)
+	default:
+		sb.WriteString("\n     version: $VERSION, the CI build number or the git commit")
+	}
+	arch := r.Arch
+	if arch == "" {
+		arch = "detected from the AppDir"
+	}
+	compression := r.Compression
+	if compression == "" {
+		compression = "zstd"
+	}
+	sb.WriteString("\n     architecture: " + arch + ", compression: " + compression + ", reproducible: " + yesNo(r.Reproducible))
+	if r.Runtime != "" {
+		sb.WriteString("\n     runtime: " + r.Runtime)
+	}
+	if r.RuntimeSHA256 != "" {
+		sb.WriteString("\n     runtime sha256: " + r.RuntimeSHA256)
+	} else if r.AllowUnpinned {
+		sb.WriteString("\n     runtime may be one that is not pinned")
+	}
+	if len(r.Permissions) > 0 {
+		sb.WriteString("\n     permissions: " + strings.Join(r.Permissions, ", "))
+	}
+	switch r.UpdateInformation {
+	case "", "guess":
+		sb.WriteString("\n     update information: guessed from the CI environment")
+	case "none":
+		sb.WriteString("\n     update information: none")
+	default:
+		sb.WriteString("\n     update information: " + r.UpdateInformation)
+	}
+	if enabled(r.Sign) {
+		sb.WriteString("\n     sign if a key was set up with setupsigning")
+	} else {
+		sb.WriteString("\n     do not sign")
+	}
+	if enabled(r.Publish) {
+		sb.WriteString("\n     publish if running on CI with $GITHUB_TOKEN or $GITLAB_TOKEN")
+	} else {
+		sb.WriteString("\n     do not publish")
+	}
+	steps = append(steps, recipeStep{
+		description: sb.String(),
+		run: func() error {
+			version, err := r.resolveVersion()
+			if err != nil {
+				return err
+			}
+			if version != "" {
+				os.Setenv("VERSION", version)
+			}
+			if r.Arch != "" {
+				os.Setenv("ARCH", r.Arch)
+			}
+			reproducible = r.Reproducible
+			permissions = strings.Join(r.Permissions, ",")
+			runtimeSHA256 = r.RuntimeSHA256
+			allowUnpinnedRuntime = r.AllowUnpinned
+			skipSigning = !enabled(r.Sign)
+			skipPublishing = !enabled(r.Publish)
+			useMksquashfs = r.Mksquashfs
+			if useMksquashfs {
+				helpers.CheckIfAllToolsArePresent([]string{"mksquashfs"})
+				if helpers.CheckIfSquashfsVersionSufficient("mksquashfs") == false {
+					return errors.New("mksquashfs is too old")
+				}
+			}
+			output := ""
+			if r.Output != "" {
+				output = r.path(r.Output)
+				if strings.HasSuffix(r.Output, "/") {
+					if err = os.MkdirAll(output, 0755); err != nil {
+						return err
+					}
+				}
+			}
+			runtimeFile := ""
+			if r.Runtime != "" {
+				runtimeFile = r.path(r.Runtime)
+			}
+			guess, updateinformation := true, ""
+			switch r.UpdateInformation {
+			case "", "guess":
+			case "none":
+				guess = false
+			default:
+				guess, updateinformation = false, r.UpdateInformation
+			}
+			source, err := filepath.EvalSymlinks(appdir)
+			if err != nil {
+				return err
+			}
+			GenerateAppImage(source, output, guess, runtimeFile, compression, enabled(r.AppStream), updateinformation, "appimagetool")
+			return nil
+		},
+	})
+	return steps
+}
+
+// bootstrapBuild deploys and builds an AppImage as described by a recipe,
+// or only shows what it would do
+// 		Args: c: cli.Context
+func bootstrapBuild(c *cli.Context) error {
+	if c.String("file") == "" || c.NArg() != 0 {
+		log.Fatal("Please specify the recipe with -f")
+	}
+	recipe, err := ReadRecipe(c.String("file"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	steps := recipe.Plan()
+	fmt.Println("Plan:")
+	for i, step := range steps {
+		fmt.Printf("  %d. %s\n", i+1, step.description)
+	}
+	if c.Bool("dry-run") {
+		return nil
+	}
+	fmt.Println("")
+	for i, step := range steps {
+		log.Printf("Step %d of %d", i+1, len(steps))
+		if err = step.run(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecipe(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	write("LICENSE", "MIT")
+	write("VERSION", "1.2.3\nsomething else\n")
+	recipe, err := ReadRecipe(write("recipe.yml", `appdir: AppDir
+files:
+  - from: LICENSE
+    to: usr/share/doc/app/LICENSE
+deploy:
+  desktop: usr/share/applications/app.desktop
+  include: [libstdc++.so.6]
+  exclude: ["libfoo.so.*"]
+  gstreamer: false
+  max-glibc: "2.28"
+  env:
+    APP_DATA: ${HERE}/usr/share/app
+version:
+  file: VERSION
+arch: x86_64
+output: out/
+update-information: none
+publish: false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := recipe.resolveVersion(); version != "1.2.3" || err != nil {
+		t.Errorf("Expected version 1.2.3, got %q %v", version, err)
+	}
+
+	steps := recipe.Plan()
+	if len(steps) != 3 {
+		t.Fatalf("Expected to copy, deploy and build, got %d steps", len(steps))
+	}
+	for i, s := range []string{
+		"Copy LICENSE to AppDir/usr/share/doc/app/LICENSE",
+		"Gtk: yes, GStreamer: no",
+		"never bundle: libfoo.so.*",
+		"AppRun sets APP_DATA=${HERE}/usr/share/app",
+		"version: first line of VERSION",
+		"update information: none",
+		"do not publish",
+	} {
+		step := steps[0]
+		if i > 0 {
+			step = steps[1]
+		}
+		if i > 3 {
+			step = steps[2]
+		}
+		if !strings.Contains(step.description, s) {
+			t.Errorf("The plan lacks %q:\n%s", s, step.description)
+		}
+	}
+	if err = steps[0].run(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "AppDir/usr/share/doc/app/LICENSE")); string(data) != "MIT" {
+		t.Error("LICENSE was not copied:", err)
+	}
+
+	for _, bad := range []string{
+		"files: [{from: LICENSE, to: usr/share/doc/app/LICENSE}]",
+		"appdir: AppDir\nfiles: [{from: LICENSE, to: ../LICENSE}]",
+		"appdir: AppDir\ndeploy: {standalone: true}",
+		"appdir: AppDir\ndeploy: {desktop: app.desktop, max-glibc: latest}",
+		"appdir: AppDir\ndeploy: {desktop: app.desktop, env: {APP-DATA: x}}",
+		"appdir: AppDir\nversion: {value: 1.0, command: git describe}",
+		"appdir: AppDir\ncompression: lzma4",
+		"appdir: AppDir\nruntime-sha256: abc",
+		"appdir: AppDir\npermissions: [everything]",
+		"appdir: AppDir\nupdate-information: zsync",
+		"appdir: AppDir\nunknown: true",
+	} {
+		if _, err := ReadRecipe(write("bad.yml", bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestAppRunEnv(t *testing.T) {
+	defer func() { options = DeployOptions{} }()
+	options = DeployOptions{appRunEnv: map[string]string{"B": `say "hi"`, "A": "${HERE}/usr/share"}}
+	apprun := getAppRunData()
+	if !strings.Contains(apprun, "export A=\"${HERE}/usr/share\"\nexport B=\"say \\\"hi\\\"\"") {
+		t.Error("AppRun does not set the environment:", apprun)
+	}
+}
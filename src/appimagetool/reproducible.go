@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/CalebQ42/squashfs"
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/urfave/cli/v2"
+)
+
+// bootstrapVerifyReproducible checks whether AppImages can be built reproducibly.
+// Given an AppDir, it builds the squashfs payload twice and compares the results;
+// given an AppDir and a reference AppImage, it rebuilds the payload of the reference;
+// given two AppImages, it compares them
+// 		Args: c: cli.Context
+func bootstrapVerifyReproducible(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		log.Fatal("Please specify an AppDir or AppImage, and optionally a reference AppImage")
+	}
+	first := c.Args().Get(0)
+	reference := c.Args().Get(1)
+	info, err := os.Stat(first)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var identical bool
+	if info.IsDir() {
+		identical, err = verifyAppDirReproducible(first, reference, c.String("comp"))
+	} else if reference != "" {
+		identical, err = compareAppImages(first, reference)
+	} else {
+		log.Fatal("Please specify a second AppImage to compare ", first, " with")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !identical {
+		log.Fatal("The builds are NOT identical")
+	}
+	fmt.Println("The builds are identical")
+	return nil
+}
+
+// verifyAppDirReproducible builds the payload of appdir twice, or once if there is a
+// reference AppImage to compare against, and reports any differences
+func verifyAppDirReproducible(appdir string, reference string, comp string) (bool, error) {
+	fstime, set, err := helpers.SourceDateEpoch()
+	if err != nil {
+		return false, err
+	}
+	opts := helpers.SquashfsOptions{Compression: comp, FSTime: fstime, RootOwned: true, Reproducible: true}
+
+	var refPath string
+	var refOffset int64
+	if reference != "" {
+		refPath = reference
+		refOffset = helpers.CalculateElfSize(reference)
+		f, err := os.Open(reference)
+		if err != nil {
+			return false, err
+		}
+		refOpts, err := helpers.ReadSquashfsOptions(f, refOffset)
+		f.Close()
+		if err != nil {
+			return false, errors.New("could not read the payload of " + reference + ": " + err.Error())
+		}
+		// Build with the settings of the reference unless told otherwise
+		if comp == "" {
+			opts.Compression = refOpts.Compression
+		}
+		opts.BlockSize = refOpts.BlockSize
+		if !set {
+			log.Println("SOURCE_DATE_EPOCH is not set, using the fstime of the reference:", refOpts.FSTime.Unix())
+			opts.FSTime = refOpts.FSTime
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "verify-reproducible")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	build := func(name string) (string, error) {
+		p := filepath.Join(tmpDir, name)
+		fmt.Println("Building", p, "from", appdir, "with fstime", opts.FSTime.Unix())
+		return p, helpers.MakeSquashfs(appdir, p, 0, opts)
+	}
+	a, err := build("a.squashfs")
+	if err != nil {
+		return false, err
+	}
+	if refPath == "" {
+		refPath, err = build("b.squashfs")
+		if err != nil {
+			return false, err
+		}
+	}
+	return comparePayloads(a, 0, refPath, refOffset)
+}
+
+// compareAppImages compares two AppImages. If they differ, it tells whether only
+// the signatures differ or which files in the payloads are different
+func compareAppImages(a string, b string) (bool, error) {
+	ha, err := sha256File(a, 0)
+	if err != nil {
+		return false, err
+	}
+	hb, err := sha256File(b, 0)
+	if err != nil {
+		return false, err
+	}
+	fmt.Println(ha, a)
+	fmt.Println(hb, b)
+	if ha == hb {
+		return true, nil
+	}
+	// The digest that gets signed leaves out the signature sections, which can never be reproducible
+	if helpers.CalculateSHA256Digest(a) == helpers.CalculateSHA256Digest(b) {
+		fmt.Println("The AppImages only differ in their signatures")
+		return false, nil
+	}
+	offsetA := helpers.CalculateElfSize(a)
+	offsetB := helpers.CalculateElfSize(b)
+	runtimeA, err := sha256Range(a, 0, offsetA)
+	if err != nil {
+		return false, err
+	}
+	runtimeB, err := sha256Range(b, 0, offsetB)
+	if err != nil {
+		return false, err
+	}
+	if runtimeA != runtimeB {
+		fmt.Println("The runtimes (including update information and signatures) differ")
+	}
+	return comparePayloads(a, offsetA, b, offsetB)
+}
+
+// comparePayloads compares the squashfs images at the given offsets
+// and prints the differences between them
+func comparePayloads(a string, offsetA int64, b string, offsetB int64) (bool, error) {
+	ha, err := sha256File(a, offsetA)
+	if err != nil {
+		return false, err
+	}
+	hb, err := sha256File(b, offsetB)
+	if err != nil {
+		return false, err
+	}
+	fmt.Println("Payload sha256:", ha, a)
+	fmt.Println("Payload sha256:", hb, b)
+	if ha == hb {
+		return true, nil
+	}
+
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	optsA, err := helpers.ReadSquashfsOptions(fa, offsetA)
+	if err != nil {
+		return false, err
+	}
+	optsB, err := helpers.ReadSquashfsOptions(fb, offsetB)
+	if err != nil {
+		return false, err
+	}
+	if optsA.Compression != optsB.Compression || optsA.BlockSize != optsB.BlockSize {
+		fmt.Println("Squashfs settings differ:", optsA.Compression, optsA.BlockSize, "vs.", optsB.Compression, optsB.BlockSize)
+	}
+	if !optsA.FSTime.Equal(optsB.FSTime) {
+		fmt.Println("fstime differs:", optsA.FSTime.Unix(), "vs.", optsB.FSTime.Unix())
+	}
+	ra, err := squashfs.NewReaderAtOffset(fa, offsetA)
+	if err != nil {
+		return false, err
+	}
+	rb, err := squashfs.NewReaderAtOffset(fb, offsetB)
+	if err != nil {
+		return false, err
+	}
+	err = fs.WalkDir(ra, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ia, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ib, err := fs.Stat(rb, path)
+		if err != nil {
+			fmt.Println("Only in", a+":", path)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if ia.Mode() != ib.Mode() {
+			fmt.Println("Mode differs:", path, ia.Mode(), "vs.", ib.Mode())
+		}
+		if !ia.ModTime().Equal(ib.ModTime()) {
+			fmt.Println("Modification time differs:", path, ia.ModTime().Unix(), "vs.", ib.ModTime().Unix())
+		}
+		// The FileInfo of the squashfs reader does not know about symlinks, hence ask the files
+		sa, err := ra.Open(path)
+		if err != nil {
+			return err
+		}
+		defer sa.Close()
+		sb, err := rb.Open(path)
+		if err != nil {
+			return err
+		}
+		defer sb.Close()
+		fa, fb := sa.(*squashfs.File), sb.(*squashfs.File)
+		switch {
+		case fa.IsSymlink() != fb.IsSymlink() || fa.IsRegular() != fb.IsRegular():
+			fmt.Println("File type differs:", path)
+		case fa.IsSymlink():
+			if fa.SymlinkPath() != fb.SymlinkPath() {
+				fmt.Println("Symlink target differs:", path, fa.SymlinkPath(), "vs.", fb.SymlinkPath())
+			}
+		case fa.IsRegular():
+			ca, err := io.ReadAll(fa)
+			if err != nil {
+				return err
+			}
+			cb, err := io.ReadAll(fb)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(ca, cb) {
+				fmt.Println("Content differs:", path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	err = fs.WalkDir(rb, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, err := fs.Stat(ra, path); err != nil {
+			fmt.Println("Only in", b+":", path)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+		}
+		return nil
+	})
+	return false, err
+}
+
+func sha256File(path string, offset int64) (string, error) {
+	return sha256Range(path, offset, -1)
+}
+
+// sha256Range returns the sha256 of length bytes at offset in path,
+// or of everything after offset if length is negative
+func sha256Range(path string, offset int64, length int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	var r io.Reader = f
+	if length >= 0 {
+		r = io.LimitReader(f, length)
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/urfave/cli/v2"
+)
+
+// The runtimes are downloaded into runtimes/ by scripts/build.sh, which checks them against runtimes/SHA256SUMS.
+// Builds without them only contain the pinned digests, and look for the runtimes next to the binary instead
+//
+//go:embed runtimes
+var runtimesDir embed.FS
+
+func init() {
+	embeddedRuntimes, _ = fs.Sub(runtimesDir, "runtimes")
+}
+
+// runtimeStatus describes whether the built-in runtime r can be used
+func runtimeStatus(r helpers.Runtime) string {
+	switch {
+	case !r.Embedded:
+		return "not built in"
+	case r.Pinned == "":
+		return "not pinned"
+	case r.Pinned != r.SHA256:
+		return "digest does not match"
+	}
+	return "ok"
+}
+
+// builtInRuntimes returns the runtimes built into appimagetool, or exits
+func builtInRuntimes() []helpers.Runtime {
+	runtimes, err := helpers.ReadRuntimes(embeddedRuntimes)
+	if err != nil {
+		log.Fatal("Could not read the built-in runtimes: ", err)
+	}
+	return runtimes
+}
+
+// bootstrapRuntimeList lists the runtimes built into appimagetool and the digests pinned for them
+// 		Args: c: cli.Context
+func bootstrapRuntimeList(c *cli.Context) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ARCH\tSIZE\tSHA256\tSTATUS")
+	for _, r := range builtInRuntimes() {
+		sum := r.SHA256
+		if sum == "" {
+			sum = r.Pinned
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", r.Arch, r.Size, sum, runtimeStatus(r))
+	}
+	return w.Flush()
+}
+
+// bootstrapRuntimeExtract writes a runtime built into appimagetool to a file,
+// e.g., to use it with another tool
+// 		Args: c: cli.Context
+func bootstrapRuntimeExtract(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		log.Fatal("Please specify the architecture of the runtime, and optionally where to write it")
+	}
+	arch := runtimeArch(c.Args().Get(0))
+	destination := c.Args().Get(1)
+	for _, r := range builtInRuntimes() {
+		if r.Arch != arch {
+			continue
+		}
+		if destination == "" {
+			destination = r.Name()
+		} else if helpers.IsDirectory(destination) {
+			destination = filepath.Join(destination, r.Name())
+		}
+		err := extractRuntime(r, destination)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Wrote", r.Name(), "to", destination)
+		return nil
+	}
+	log.Fatal("There is no built-in runtime for ", arch)
+	return nil
+}
+
+// bootstrapRuntimeInfo shows the details of a runtime built into appimagetool,
+// or of a runtime file and whether it is one of the pinned runtimes
+// 		Args: c: cli.Context
+func bootstrapRuntimeInfo(c *cli.Context) error {
+	if c.NArg() != 1 {
+		log.Fatal("Please specify the architecture of a built-in runtime, or the path to a runtime file")
+	}
+	arg := c.Args().Get(0)
+	runtimes := builtInRuntimes()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	if helpers.CheckIfFileExists(arg) {
+		f, err := os.Open(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sum, size, err := helpers.RuntimeDigest(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		arch, err := helpers.GetElfArchitecture(arg)
+		if err != nil {
+			arch = "not an ELF file"
+		}
+		pinned := "no"
+		for _, r := range runtimes {
+			if r.Pinned == sum {
+				pinned = "yes, " + r.Name()
+			}
+		}
+		fmt.Fprintln(w, "File:\t"+arg)
+		fmt.Fprintln(w, "Architecture:\t"+arch)
+		fmt.Fprintf(w, "Size:\t%d\n", size)
+		fmt.Fprintln(w, "SHA256:\t"+sum)
+		fmt.Fprintln(w, "Pinned:\t"+pinned)
+		return w.Flush()
+	}
+
+	arch := runtimeArch(arg)
+	for _, r := range runtimes {
+		if r.Arch != arch {
+			continue
+		}
+		fmt.Fprintln(w, "Name:\t"+r.Name())
+		fmt.Fprintln(w, "Architecture:\t"+r.Arch)
+		if r.Embedded {
+			fmt.Fprintf(w, "Size:\t%d\n", r.Size)
+			fmt.Fprintln(w, "SHA256:\t"+r.SHA256)
+		}
+		if r.Pinned != "" {
+			fmt.Fprintln(w, "Pinned SHA256:\t"+r.Pinned)
+		}
+		fmt.Fprintln(w, "Status:\t"+runtimeStatus(r))
+		return w.Flush()
+	}
+	log.Fatal("There is no built-in runtime for ", arch, ", and there is no such file")
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+	"github.com/probonopd/go-appimage/src/goappimage"
+	"github.com/probonopd/go-zsyncmake/zsync"
+	"github.com/urfave/cli/v2"
+)
+
+// bootstrapRuntimeSwap puts another runtime in front of the unchanged payload of an AppImage,
+// e.g., to get a fixed runtime into an AppImage without building it again from the AppDir.
+// Carries over the update information, signs again and embeds the public key if a key was set up
+// with setupsigning, otherwise drops the old signature and key, and writes the zsync file again
+// 		Args: c: cli.Context
+func bootstrapRuntimeSwap(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		log.Fatal("Please specify the path to an AppImage, and optionally the destination")
+	}
+	source := c.Args().Get(0)
+	if !helpers.CheckIfFileExists(source) {
+		log.Fatal("The specified file could not be found")
+	}
+	ai, err := goappimage.NewAppImage(source)
+	if ai.Type() != 2 {
+		log.Fatal(source, " is not a type 2 AppImage: ", err)
+	}
+	destination := c.Args().Get(1)
+	if destination == "" {
+		destination = source
+	}
+
+	arch, err := helpers.GetElfArchitecture(source)
+	if err != nil {
+		log.Fatal("Could not determine the architecture of ", source, ": ", err)
+	}
+	current, offset, err := ai.RuntimeDigest()
+	if err != nil {
+		log.Fatal("Could not read the runtime of ", source, ": ", err)
+	}
+	fmt.Println("Architecture:", arch)
+	fmt.Println("squashfs offset:", offset)
+	fmt.Println("sha256 digest of the current runtime:", current)
+
+	runtimeFile := c.String("runtime")
+	if runtimeFile == "" {
+		runtimeFile = findRuntime(arch)
+	} else if helpers.CheckIfFileExists(runtimeFile) == false {
+		log.Fatal("Cannot find ", runtimeFile)
+	}
+	runtimeSHA256 = c.String("runtime-sha256")
+	allowUnpinnedRuntime = c.Bool("allow-unpinned-runtime")
+	checkRuntimeFile(runtimeFile, arch)
+	f, err := os.Open(runtimeFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sum, _, err := helpers.RuntimeDigest(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if sum == current && destination == source {
+		fmt.Println(source, "already has this runtime")
+		return nil
+	}
+
+	signed, _ := helpers.GetSectionData(source, ".sha256_sig")
+	// The signature of an AppImage that is signed again has to be checked with the key that signs it,
+	// which is embedded as in GenerateAppImage
+	var key []byte
+	if helpers.CheckIfFileExists(helpers.PrivkeyFileName) || helpers.CheckIfFileExists(helpers.EncPrivkeyFileName) {
+		key, err = os.ReadFile(helpers.PubkeyFileName)
+		if err != nil {
+			log.Fatal("Cannot sign ", destination, " again without the public key: ", err)
+		}
+	}
+	fmt.Println("Putting", runtimeFile, "in front of the payload of", source+"...")
+	err = ai.SwapRuntime(destination, runtimeFile, key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// As in GenerateAppImage, AppImages without update information get their digest
+	// into the .sha256_sig section, unless they get signed
+	digest := helpers.CalculateSHA256Digest(destination)
+	if ai.UpdateInfo == "" {
+		err = helpers.EmbedStringInSegment(destination, ".sha256_sig", digest)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if !signAppImage(destination, digest) && bytes.HasPrefix(signed, []byte("-----BEGIN PGP SIGNATURE")) {
+		fmt.Println("The signature and key of", source, "were dropped because no key is available to sign it again")
+	}
+
+	if ai.UpdateInfo != "" {
+		fmt.Println("Update information:", ai.UpdateInfo)
+		// Do not mistake the zsync file of the old AppImage for the new one
+		if err = os.Remove(destination + ".zsync"); err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		zsync.ZsyncMake(destination, zsync.Options{Url: filepath.Base(destination)})
+		if _, err = os.Stat(destination + ".zsync"); err != nil {
+			helpers.PrintError("zsync file not generated", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Println("Success")
+	fmt.Println("")
+	abs, _ := filepath.Abs(destination)
+	fmt.Println(abs)
+	return nil
+}
@@ -0,0 +1,10 @@
+#!/bin/sh
+# Builds needsglibc from needsglibc.c, an ELF file that needs GLIBC_2.17 and GLIBC_2.30 from libc.so.6,
+# against a stub libc.so.6 made from libc.c and libc.map rather than the glibc of the build system.
+# Run by go generate in src/appimagetool
+set -e
+cd "$(dirname "$0")"
+gcc -shared -fPIC -nostdlib -Wl,--version-script=libc.map -Wl,-soname,libc.so.6 -o libc.so.6 libc.c
+gcc -nostdlib -fPIE -pie -s -o needsglibc needsglibc.c ./libc.so.6 \
+    -Wl,--build-id=none,-z,noseparate-code,-z,max-page-size=0x1000,--hash-style=gnu
+rm libc.so.6
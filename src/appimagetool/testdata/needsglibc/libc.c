@@ -0,0 +1,2 @@
+void old_function(void) {}
+void new_function(void) {}
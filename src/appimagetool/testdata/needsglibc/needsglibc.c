@@ -0,0 +1,11 @@
+/*
+ * An ELF file that needs GLIBC_2.17 and GLIBC_2.30 from libc.so.6, without the glibc of the build system.
+ * build.sh (go generate) builds needsglibc from it
+ */
+extern void old_function(void);
+extern void new_function(void);
+
+void _start(void) {
+	old_function();
+	new_function();
+}
@@ -121,7 +121,11 @@ func NewAppImage(path string) (ai *AppImage, err error) {
 		ai.Version = "1.0"
 	}
 
-	ai.UpdateInfo, _ = helpers.ReadUpdateInfo(ai.Path)
+	if ai.imageType == 1 {
+		ai.UpdateInfo, _ = helpers.ReadType1UpdateInfo(ai.Path)
+	} else {
+		ai.UpdateInfo, _ = helpers.ReadUpdateInfo(ai.Path)
+	}
 	return
 }
 
@@ -1,9 +1,9 @@
 package goappimage
 
 import (
-	"bytes"
 	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
@@ -133,26 +133,37 @@ type type1Reader struct {
 	structure map[string][]string //[folder]File
 	path      string
 	folders   []string
+	fsys      *isoFS // Lists and reads the files without bsdtar
 }
 
 func newType1Reader(filepath string) (*type1Reader, error) {
-	cmd := exec.Command("bsdtar", "-f", filepath, "-t")
-	wrt, err := runCommand(cmd)
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fsys, err := newISOFS(f, fi.Size())
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
-	containedFiles := strings.Split(wrt.String(), "\n")
 	var rdr type1Reader
 	rdr.path = filepath
+	rdr.fsys = fsys
 	rdr.structure = make(map[string][]string)
-	for _, contained := range containedFiles {
-		contained = path.Clean(contained)
-		if contained == "" || contained == "." {
-			continue
+	err = fs.WalkDir(fsys, ".", func(contained string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if contained == "." {
+			return nil
 		}
 		fileName := path.Base(contained)
 		dir := path.Dir(contained)
-		dir = path.Clean(dir)
 		if !strings.Contains(contained, "/") {
 			dir = "/"
 		}
@@ -160,6 +171,11 @@ func newType1Reader(filepath string) (*type1Reader, error) {
 			rdr.folders = append(rdr.folders, dir)
 		}
 		rdr.structure[dir] = append(rdr.structure[dir], fileName)
+		return nil
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
 	}
 	sort.Strings(rdr.folders)
 	for folds := range rdr.structure {
@@ -177,7 +193,7 @@ func newType1Reader(filepath string) (*type1Reader, error) {
 func (r *type1Reader) cleanPath(filepath string) (string, error) {
 	filepath = strings.TrimPrefix(filepath, "/")
 	filepath = path.Clean(filepath)
-	if filepath == "" {
+	if filepath == "" || filepath == "." {
 		return "", nil
 	}
 	filepathDir := path.Dir(filepath)
@@ -221,14 +237,26 @@ func (r *type1Reader) FileReader(filepath string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	cmd := exec.Command("bsdtar", "-f", r.path, "-xO", filepath)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err = cmd.Run()
+	// Follow relative symlinks, like type2Reader does
+	for i := 0; i < 40; i++ {
+		target, err := ReadLink(r.fsys, filepath)
+		if err != nil || target == "" {
+			break
+		}
+		if strings.HasPrefix(target, "/") {
+			return nil, errors.New("Can't resolve symlink at: " + filepath)
+		}
+		filepath = path.Join(path.Dir(filepath), target)
+	}
+	f, err := r.fsys.Open(filepath)
 	if err != nil {
 		return nil, err
 	}
-	return io.NopCloser(&out), nil
+	if fi, _ := f.Stat(); fi.IsDir() {
+		f.Close()
+		return nil, errors.New("Path is a directory: " + filepath)
+	}
+	return f, nil
 }
 
 func (r *type1Reader) IsDir(filepath string) bool {
@@ -0,0 +1,351 @@
+package goappimage
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+// Symbol version prefixes of the libraries that AppImages usually take from the system
+// and whose versions determine on which systems they run
+var VersionedLibraries = map[string]string{
+	"GLIBC":   "libc.so.6",
+	"GLIBCXX": "libstdc++.so.6",
+	"CXXABI":  "libstdc++.so.6",
+}
+
+// Requirements describes what the ELF files in an AppImage need from the system
+type Requirements struct {
+	// Highest required symbol version for each of the prefixes in VersionedLibraries, e.g., "GLIBC": "2.34"
+	Versions map[string]string
+	// The ELF file that requires the highest version, for each prefix
+	VersionRequiredBy map[string]string
+	// DT_NEEDED libraries that are not shipped in the AppImage, with the ELF files that need them
+	Libraries map[string][]string
+	// The prefixes in Versions whose library is shipped in the AppImage, e.g., "GLIBC" if it
+	// bundles libc.so.6, and which hence do not need to be provided by the system
+	Bundled map[string]bool
+}
+
+// System describes what a system provides to AppImages
+type System struct {
+	// Highest provided symbol version for each of the prefixes in VersionedLibraries
+	Versions map[string]string
+	// Paths of the shared libraries, by file name
+	Libraries map[string]string
+}
+
+// Distribution describes what a Linux distribution provides in its default installation
+type Distribution struct {
+	Name     string
+	Versions map[string]string
+}
+
+// Distributions are commonly targeted distributions and the versions of glibc and libstdc++ they come with
+var Distributions = []Distribution{
+	{"CentOS 7", map[string]string{"GLIBC": "2.17", "GLIBCXX": "3.4.19", "CXXABI": "1.3.7"}},
+	{"Ubuntu 16.04", map[string]string{"GLIBC": "2.23", "GLIBCXX": "3.4.21", "CXXABI": "1.3.9"}},
+	{"Ubuntu 18.04", map[string]string{"GLIBC": "2.27", "GLIBCXX": "3.4.25", "CXXABI": "1.3.11"}},
+	{"Debian 10", map[string]string{"GLIBC": "2.28", "GLIBCXX": "3.4.25", "CXXABI": "1.3.11"}},
+	{"RHEL 8", map[string]string{"GLIBC": "2.28", "GLIBCXX": "3.4.25", "CXXABI": "1.3.11"}},
+	{"Ubuntu 20.04", map[string]string{"GLIBC": "2.31", "GLIBCXX": "3.4.28", "CXXABI": "1.3.12"}},
+	{"Debian 11", map[string]string{"GLIBC": "2.31", "GLIBCXX": "3.4.28", "CXXABI": "1.3.12"}},
+	{"RHEL 9", map[string]string{"GLIBC": "2.34", "GLIBCXX": "3.4.29", "CXXABI": "1.3.13"}},
+	{"Ubuntu 22.04", map[string]string{"GLIBC": "2.35", "GLIBCXX": "3.4.30", "CXXABI": "1.3.13"}},
+	{"Debian 12", map[string]string{"GLIBC": "2.36", "GLIBCXX": "3.4.30", "CXXABI": "1.3.13"}},
+	{"Ubuntu 24.04", map[string]string{"GLIBC": "2.39", "GLIBCXX": "3.4.33", "CXXABI": "1.3.15"}},
+}
+
+// Requirements reads every ELF file in the AppImage and returns what they need from the system.
+func (ai AppImage) Requirements() (*Requirements, error) {
+	fsys, err := ai.FS()
+	if err != nil {
+		return nil, err
+	}
+	return ReadRequirements(fsys)
+}
+
+// ReadRequirements reads every ELF file in fsys, e.g., the contents of an AppImage or AppDir,
+// and returns what they need from the system.
+func ReadRequirements(fsys fs.FS) (*Requirements, error) {
+	r := &Requirements{Versions: map[string]string{}, VersionRequiredBy: map[string]string{}, Libraries: map[string][]string{}, Bundled: map[string]bool{}}
+	shipped := map[string]bool{}
+	needed := map[string][]string{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		shipped[path.Base(name)] = true
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		ef, err := readELF(fsys, name)
+		if err != nil || ef == nil {
+			return err
+		}
+		defer ef.Close()
+		libraries, _ := ef.ImportedLibraries()
+		for _, lib := range libraries {
+			needed[lib] = append(needed[lib], name)
+		}
+		symbols, _ := ef.ImportedSymbols()
+		for _, sym := range symbols {
+			r.require(sym.Version, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for lib, by := range needed {
+		if !shipped[lib] {
+			r.Libraries[lib] = by
+		}
+	}
+	for prefix, lib := range VersionedLibraries {
+		if _, ok := r.Versions[prefix]; ok && shipped[lib] {
+			r.Bundled[prefix] = true
+		}
+	}
+	return r, nil
+}
+
+// require records that the ELF file name needs the symbol version, e.g., GLIBC_2.34
+func (r *Requirements) require(version string, name string) {
+	prefix, v, _ := strings.Cut(version, "_")
+	if _, ok := VersionedLibraries[prefix]; !ok || v == "" || !isNumericVersion(v) {
+		return
+	}
+	if old, ok := r.Versions[prefix]; !ok || helpers.CompareVersions(v, old) > 0 {
+		r.Versions[prefix] = v
+		r.VersionRequiredBy[prefix] = name
+	}
+}
+
+func isNumericVersion(v string) bool {
+	for _, c := range v {
+		if (c < '0' || c > '9') && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// readELF returns the parsed ELF file at name in fsys, or nil if it is not an ELF file
+func readELF(fsys fs.FS, name string) (*elf.File, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err = io.ReadFull(f, magic); err != nil || string(magic) != elf.ELFMAG {
+		return nil, nil
+	}
+	// Not every fs.FS supports random access, hence read the whole file
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	ef, err := elf.NewFile(bytes.NewReader(append(magic, rest...)))
+	if err != nil {
+		// Not every file that starts like an ELF file is one
+		return nil, nil
+	}
+	return ef, nil
+}
+
+// ReadSystem returns what the system at root provides, "/" for the host or the path of a sysroot.
+func ReadSystem(root string) (*System, error) {
+	s := &System{Versions: map[string]string{}, Libraries: map[string]string{}}
+	for _, dir := range libraryDirs(root) {
+		entries, err := os.ReadDir(inRoot(root, dir))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !strings.Contains(e.Name(), ".so") || e.IsDir() {
+				continue
+			}
+			if _, ok := s.Libraries[e.Name()]; !ok {
+				s.Libraries[e.Name()] = filepath.Join(dir, e.Name())
+			}
+		}
+	}
+	for prefix, lib := range VersionedLibraries {
+		p, ok := s.Libraries[lib]
+		if !ok {
+			continue
+		}
+		versions, err := definedVersions(inRoot(root, p))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		for _, version := range versions {
+			if pre, v, _ := strings.Cut(version, "_"); pre == prefix && isNumericVersion(v) {
+				if old, ok := s.Versions[prefix]; !ok || helpers.CompareVersions(v, old) > 0 {
+					s.Versions[prefix] = v
+				}
+			}
+		}
+	}
+	if len(s.Libraries) == 0 {
+		return nil, errors.New("no libraries found in " + root)
+	}
+	return s, nil
+}
+
+// libraryDirs returns the directories in which the dynamic linker of the system at root looks for libraries
+func libraryDirs(root string) []string {
+	dirs := []string{"/lib64", "/usr/lib64", "/lib", "/usr/lib", "/usr/local/lib"}
+	// Multiarch directories, e.g., /usr/lib/x86_64-linux-gnu
+	for _, pattern := range []string{"/lib/*-linux-gnu*", "/usr/lib/*-linux-gnu*"} {
+		matches, _ := filepath.Glob(filepath.Join(root, pattern))
+		for _, m := range matches {
+			dirs = append(dirs, strings.TrimPrefix(m, filepath.Clean(root)))
+		}
+	}
+	// Directories configured in /etc/ld.so.conf.d
+	confs, _ := filepath.Glob(filepath.Join(root, "/etc/ld.so.conf.d/*.conf"))
+	for _, conf := range confs {
+		data, err := os.ReadFile(conf)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); strings.HasPrefix(line, "/") {
+				dirs = append(dirs, line)
+			}
+		}
+	}
+	var out []string
+	for _, dir := range dirs {
+		out = helpers.AppendIfMissing(out, filepath.Join(root, dir))
+	}
+	return out
+}
+
+// inRoot resolves the symlink at p in the system at root, if it is one,
+// so that absolute symlinks in a sysroot do not point to the host
+func inRoot(root string, p string) string {
+	for i := 0; i < 40; i++ {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return p
+		}
+		if filepath.IsAbs(target) {
+			p = filepath.Join(root, target)
+		} else {
+			p = filepath.Join(filepath.Dir(p), target)
+		}
+	}
+	return p
+}
+
+// definedVersions returns the symbol versions that the shared library at p defines,
+// from its SHT_GNU_verdef section
+func definedVersions(p string) ([]string, error) {
+	ef, err := elf.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer ef.Close()
+	verdef := ef.SectionByType(elf.SHT_GNU_VERDEF)
+	if verdef == nil || int(verdef.Link) >= len(ef.Sections) {
+		return nil, nil
+	}
+	data, err := verdef.Data()
+	if err != nil {
+		return nil, err
+	}
+	strtab, err := ef.Sections[verdef.Link].Data()
+	if err != nil {
+		return nil, err
+	}
+	str := func(off uint32) string {
+		if int(off) >= len(strtab) {
+			return ""
+		}
+		end := bytes.IndexByte(strtab[off:], 0)
+		if end < 0 {
+			return ""
+		}
+		return string(strtab[off : int(off)+end])
+	}
+	var versions []string
+	// Elf_Verdef: vd_version, vd_flags, vd_ndx, vd_cnt (16 bit), vd_hash, vd_aux, vd_next (32 bit).
+	// The first Elf_Verdaux (vda_name, vda_next) of each is the name of the version
+	for off, i := 0, 0; off+20 <= len(data) && i < 10000; i++ {
+		aux := off + int(ef.ByteOrder.Uint32(data[off+12:]))
+		if aux+8 <= len(data) {
+			versions = append(versions, str(ef.ByteOrder.Uint32(data[aux:])))
+		}
+		next := int(ef.ByteOrder.Uint32(data[off+16:]))
+		if next == 0 {
+			break
+		}
+		off += next
+	}
+	return versions, nil
+}
+
+// Check returns why the requirements are not met by the system, or nothing if they are.
+// The versions of libraries that are bundled are not checked.
+// Use Distribution.System to check against a distribution
+func (r *Requirements) Check(s *System) []string {
+	var problems []string
+	for _, prefix := range r.sortedPrefixes() {
+		if r.Bundled[prefix] {
+			continue
+		}
+		v := r.Versions[prefix]
+		if has, ok := s.Versions[prefix]; !ok {
+			if s.Libraries != nil {
+				problems = append(problems, fmt.Sprintf("%s_%s is needed by %s, but %s is missing", prefix, v, r.VersionRequiredBy[prefix], VersionedLibraries[prefix]))
+			}
+		} else if helpers.CompareVersions(v, has) > 0 {
+			problems = append(problems, fmt.Sprintf("%s_%s is needed by %s, but only %s_%s is available", prefix, v, r.VersionRequiredBy[prefix], prefix, has))
+		}
+	}
+	if s.Libraries != nil {
+		var missing []string
+		for lib := range r.Libraries {
+			if _, ok := s.Libraries[lib]; !ok {
+				missing = append(missing, lib)
+			}
+		}
+		sort.Strings(missing)
+		for _, lib := range missing {
+			problems = append(problems, lib+" is needed by "+strings.Join(r.Libraries[lib], ", ")+", but is missing")
+		}
+	}
+	return problems
+}
+
+// System returns what the distribution provides. Which libraries it has is not known,
+// so only the versions of glibc and libstdc++ are checked
+func (d Distribution) System() *System {
+	return &System{Versions: d.Versions}
+}
+
+func (r *Requirements) sortedPrefixes() []string {
+	var prefixes []string
+	for prefix := range r.Versions {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
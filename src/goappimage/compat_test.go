@@ -0,0 +1,82 @@
+package goappimage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequirements(t *testing.T) {
+	host, err := ReadSystem("/")
+	if err != nil {
+		t.Skip("No libraries on this system:", err)
+	}
+	libc, ok := host.Libraries["libc.so.6"]
+	if !ok || host.Versions["GLIBC"] == "" {
+		t.Skip("No glibc on this system")
+	}
+	ls, err := os.ReadFile("/bin/ls")
+	if err != nil {
+		t.Skip("/bin/ls is needed:", err)
+	}
+
+	appdir := t.TempDir()
+	os.MkdirAll(filepath.Join(appdir, "usr/bin"), 0755)
+	os.WriteFile(filepath.Join(appdir, "usr/bin/ls"), ls, 0755)
+	os.WriteFile(filepath.Join(appdir, "usr/bin/script"), []byte("#!/bin/sh\n"), 0755)
+	r, err := ReadRequirements(os.DirFS(appdir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Versions["GLIBC"] == "" || r.VersionRequiredBy["GLIBC"] != "usr/bin/ls" {
+		t.Errorf("Expected a GLIBC version required by usr/bin/ls, got %v %v", r.Versions, r.VersionRequiredBy)
+	}
+	if by := r.Libraries["libc.so.6"]; len(by) != 1 || by[0] != "usr/bin/ls" {
+		t.Errorf("Expected libc.so.6 to be needed by usr/bin/ls, got %v", r.Libraries)
+	}
+	// ls runs here, after all
+	if problems := r.Check(host); len(problems) != 0 {
+		t.Error("Expected no problems on this system, got", problems)
+	}
+	old := Distribution{"Old", map[string]string{"GLIBC": "2.0", "GLIBCXX": "3.4", "CXXABI": "1.3"}}
+	if problems := r.Check(old.System()); len(problems) == 0 {
+		t.Error("Expected glibc 2.0 to be too old")
+	}
+
+	// Libraries that are shipped are not needed from the system
+	os.MkdirAll(filepath.Join(appdir, "usr/lib"), 0755)
+	os.WriteFile(filepath.Join(appdir, "usr/lib/libc.so.6"), []byte("not really"), 0644)
+	if r, err = ReadRequirements(os.DirFS(appdir)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Libraries["libc.so.6"]; ok {
+		t.Error("libc.so.6 is shipped, but still reported as needed")
+	}
+	// and neither are the versions of the libraries that are shipped, e.g., by deploy -s
+	if !r.Bundled["GLIBC"] || r.Versions["GLIBC"] == "" {
+		t.Errorf("Expected GLIBC to be bundled, got %v %v", r.Versions, r.Bundled)
+	}
+	if problems := r.Check(old.System()); len(problems) != 0 {
+		t.Error("Expected the bundled glibc not to be checked, got", problems)
+	}
+
+	// A sysroot with only glibc, behind an absolute symlink
+	sysroot := t.TempDir()
+	os.MkdirAll(filepath.Join(sysroot, "usr/lib/x86_64-linux-gnu"), 0755)
+	data, err := os.ReadFile(libc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(sysroot, "usr/lib/x86_64-linux-gnu/libc-real.so"), data, 0755)
+	os.Symlink("/usr/lib/x86_64-linux-gnu/libc-real.so", filepath.Join(sysroot, "usr/lib/x86_64-linux-gnu/libc.so.6"))
+	system, err := ReadSystem(sysroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if system.Versions["GLIBC"] != host.Versions["GLIBC"] {
+		t.Errorf("Expected GLIBC_%s in the sysroot, got %v", host.Versions["GLIBC"], system.Versions)
+	}
+	if _, ok := system.Libraries["libstdc++.so.6"]; ok {
+		t.Error("The sysroot has no libstdc++.so.6")
+	}
+}
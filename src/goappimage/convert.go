@@ -0,0 +1,159 @@
+package goappimage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+// ConvertToType2 writes the contents of a type 1 AppImage into a new type 2 AppImage
+// at destination, using the type 2 runtime at runtimePath and the given squashfs
+// compression (zstd, xz or gzip). The update information and the .DirIcon are carried over.
+//
+// The contents are read from the ISO 9660 image directly, so nothing
+// needs to be extracted to disk or mounted, and no external tools are needed.
+func (ai *AppImage) ConvertToType2(destination string, runtimePath string, compression string) error {
+	if ai.imageType != 1 {
+		return errors.New("not a type 1 AppImage")
+	}
+	runtime, err := os.ReadFile(runtimePath)
+	if err != nil {
+		return err
+	}
+	if len(runtime) < 11 || string(runtime[8:11]) != "AI\x02" {
+		return errors.New(runtimePath + " is not a type 2 runtime")
+	}
+
+	f, err := os.Open(ai.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fsys, err := newISOFS(f, fi.Size())
+	if err != nil {
+		return errors.Join(errors.New("could not read "+ai.Path), err)
+	}
+	root, fstime, err := type1Tree(fsys)
+	if err != nil {
+		return errors.Join(errors.New("could not read "+ai.Path), err)
+	}
+
+	desktopFile := ""
+	for _, c := range root.Children {
+		if c.Mode.IsRegular() && strings.HasSuffix(c.Name, ".desktop") {
+			desktopFile = c.Name
+		}
+	}
+	if desktopFile == "" {
+		return errors.New("no desktop file found in the root of " + ai.Path)
+	}
+	// Old AppImages did not always have a .DirIcon, use the icon from the desktop file then
+	if root.Child(".DirIcon") == nil && ai.Desktop != nil {
+		icon := ai.Desktop.Section("Desktop Entry").Key("Icon").Value()
+		if root.Child(icon+".png") != nil {
+			root.Children = append(root.Children, &helpers.SquashfsEntry{
+				Name:    ".DirIcon",
+				Mode:    fs.ModeSymlink | 0777,
+				ModTime: fstime,
+				Target:  icon + ".png",
+			})
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(destination), "."+filepath.Base(destination)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(runtime); err != nil {
+		tmp.Close()
+		return err
+	}
+	_, err = helpers.WriteSquashfs(tmp, int64(len(runtime)), root, helpers.SquashfsOptions{
+		Compression: compression,
+		BlockSize:   helpers.SquashfsDefaultBlockSize,
+		FSTime:      fstime,
+		RootOwned:   true,
+	})
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0755); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if ai.UpdateInfo != "" {
+		if err = helpers.EmbedStringInSegment(tmp.Name(), ".upd_info", ai.UpdateInfo); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), destination)
+}
+
+// type1Tree builds a squashfs tree from the ISO 9660 image of a type 1 AppImage,
+// whose file contents are read from there when the squashfs is written. Returns the tree
+// and the newest modification time, which is used as the fstime of the new AppImage
+func type1Tree(fsys fs.FS) (*helpers.SquashfsEntry, time.Time, error) {
+	root := &helpers.SquashfsEntry{Mode: fs.ModeDir | 0755}
+	var newest time.Time
+	dirs := map[string]*helpers.SquashfsEntry{".": root}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		if name == "." {
+			root.ModTime = info.ModTime()
+			return nil
+		}
+		entry := &helpers.SquashfsEntry{Name: path.Base(name), Mode: info.Mode().Perm(), ModTime: info.ModTime()}
+		switch {
+		case info.IsDir():
+			entry.Mode |= fs.ModeDir
+			dirs[name] = entry
+		case info.Mode()&fs.ModeSymlink != 0:
+			entry.Mode |= fs.ModeSymlink
+			if entry.Target, err = ReadLink(fsys, name); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			entry.Size = info.Size()
+			entry.Open = func() (io.ReadCloser, error) {
+				return fsys.Open(name)
+			}
+		default:
+			return errors.New("unsupported file type in type 1 AppImage: " + name)
+		}
+		parent := dirs[path.Dir(name)]
+		parent.Children = append(parent.Children, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, newest, err
+	}
+	if root.ModTime.IsZero() {
+		root.ModTime = newest
+	}
+	return root, newest, nil
+}
@@ -0,0 +1,86 @@
+package goappimage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertToType2(t *testing.T) {
+	if _, err := exec.LookPath("bsdtar"); err != nil {
+		t.Skip("bsdtar is needed to create type 1 AppImages")
+	}
+	appdir := t.TempDir()
+	files := map[string][]byte{
+		"test.desktop":       []byte("[Desktop Entry]\nName=Converted\nExec=test\nIcon=test\nType=Application\n"),
+		"test.png":           []byte("icon"),
+		"usr/bin/test":       []byte("#!/bin/sh\n"),
+		"usr/share/test/big": bytes.Repeat([]byte("big"), 100000),
+	}
+	for name, content := range files {
+		p := filepath.Join(appdir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, content, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("usr/bin/test", filepath.Join(appdir, "AppRun")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A type 1 AppImage is an ISO 9660 image with an ELF runtime in its system area
+	// and the update information in the application use area
+	type1 := filepath.Join(t.TempDir(), "Test-x86_64.AppImage")
+	out, err := exec.Command("bsdtar", "-c", "-f", type1, "--format", "iso9660", "-C", appdir, ".").CombinedOutput()
+	if err != nil {
+		t.Fatal(string(out), err)
+	}
+	const updateInformation = "zsync|https://example.com/Test-x86_64.AppImage.zsync"
+	f, err := os.OpenFile(type1, os.O_WRONLY, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0x41, 0x49, 0x01}, 0)
+	f.WriteAt([]byte(updateInformation), 33651)
+	f.Close()
+
+	// Reading and converting it must not need bsdtar
+	t.Setenv("PATH", "")
+	ai, err := NewAppImage(type1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.Type() != 1 || ai.UpdateInfo != updateInformation {
+		t.Fatal("Not recognized as a type 1 AppImage with update information:", ai.Type(), ai.UpdateInfo)
+	}
+	runtime := filepath.Join(t.TempDir(), "runtime")
+	os.WriteFile(runtime, testRuntime(), 0755)
+	type2 := filepath.Join(t.TempDir(), "Test-type2-x86_64.AppImage")
+	if err = ai.ConvertToType2(type2, runtime, "zstd"); err != nil {
+		t.Fatal(err)
+	}
+
+	ai, err = NewAppImage(type2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.Type() != 2 || ai.Name != "Converted" || ai.UpdateInfo != updateInformation {
+		t.Error("Converted AppImage is wrong:", ai.Type(), ai.Name, ai.UpdateInfo)
+	}
+	files[".DirIcon"] = files["test.png"]
+	files["AppRun"] = files["usr/bin/test"]
+	for name, want := range files {
+		r, err := ai.ExtractFileReader(name)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if !bytes.Equal(got, want) {
+			t.Error("Wrong content of", name)
+		}
+	}
+}
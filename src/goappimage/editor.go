@@ -0,0 +1,300 @@
+package goappimage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/squashfs"
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+// AppImageEditor records changes to the files inside of a type 2 AppImage.
+// The changes are overlaid on the existing squashfs when Save writes a new
+// AppImage, which uses the same runtime (including its update information and
+// signing key) and the same squashfs compression as the original.
+type AppImageEditor struct {
+	ai         *AppImage
+	changes    []editorChange
+	updateInfo *string
+}
+
+type editorChange struct {
+	path   string
+	remove bool
+	entry  *helpers.SquashfsEntry
+}
+
+// Edit returns an AppImageEditor for the AppImage. Only works on type 2 AppImages
+func (ai *AppImage) Edit() (*AppImageEditor, error) {
+	if ai.imageType != 2 {
+		return nil, errors.New("only type 2 AppImages can be edited")
+	}
+	return &AppImageEditor{ai: ai}, nil
+}
+
+func cleanEditorPath(name string) (string, error) {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || name == "" || strings.HasPrefix(name, "../") || name == ".." {
+		return "", errors.New("invalid path: " + name)
+	}
+	return name, nil
+}
+
+func (e *AppImageEditor) add(name string, entry *helpers.SquashfsEntry) error {
+	name, err := cleanEditorPath(name)
+	if err != nil {
+		return err
+	}
+	entry.Name = path.Base(name)
+	e.changes = append(e.changes, editorChange{path: name, entry: entry})
+	return nil
+}
+
+// WriteFile adds or replaces the file at name with data
+func (e *AppImageEditor) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return e.add(name, &helpers.SquashfsEntry{
+		Mode:    perm.Perm(),
+		ModTime: time.Now(),
+		Size:    int64(len(data)),
+		Open:    func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil },
+	})
+}
+
+// AddFile adds or replaces the file at name with the contents of the local file src.
+// src is only read when the AppImage gets saved
+func (e *AppImageEditor) AddFile(name string, src string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New(src + " is not a regular file")
+	}
+	return e.add(name, &helpers.SquashfsEntry{
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Open:    func() (io.ReadCloser, error) { return os.Open(src) },
+	})
+}
+
+// Symlink adds or replaces name with a symlink pointing to target
+func (e *AppImageEditor) Symlink(target string, name string) error {
+	return e.add(name, &helpers.SquashfsEntry{
+		Mode:    fs.ModeSymlink | 0777,
+		ModTime: time.Now(),
+		Target:  target,
+	})
+}
+
+// Mkdir adds an empty directory at name. An existing directory at name is kept as it is
+func (e *AppImageEditor) Mkdir(name string, perm fs.FileMode) error {
+	return e.add(name, &helpers.SquashfsEntry{
+		Mode:    fs.ModeDir | perm.Perm(),
+		ModTime: time.Now(),
+	})
+}
+
+// Remove removes the file or directory (including its contents) at name
+func (e *AppImageEditor) Remove(name string) error {
+	name, err := cleanEditorPath(name)
+	if err != nil {
+		return err
+	}
+	e.changes = append(e.changes, editorChange{path: name, remove: true})
+	return nil
+}
+
+// SetUpdateInformation replaces the update information in the .upd_info section of the runtime
+func (e *AppImageEditor) SetUpdateInformation(updateInformation string) error {
+	if err := helpers.ValidateUpdateInformation(updateInformation); err != nil {
+		return err
+	}
+	e.updateInfo = &updateInformation
+	return nil
+}
+
+// Save writes the AppImage with all changes applied to destination, which may be the
+// path of the original AppImage. As the contents change, the signature in the
+// .sha256_sig section gets cleared, so the result needs to be signed again if desired
+func (e *AppImageEditor) Save(destination string) error {
+	src, err := os.Open(e.ai.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	opts, err := helpers.ReadSquashfsOptions(src, e.ai.offset)
+	if err != nil {
+		return err
+	}
+	rdr, err := squashfs.NewReaderAtOffset(src, e.ai.offset)
+	if err != nil {
+		return err
+	}
+	root, err := squashfsTree(rdr, ".")
+	if err != nil {
+		return err
+	}
+	for _, c := range e.changes {
+		if err = applyEditorChange(root, c); err != nil {
+			return err
+		}
+	}
+
+	// Keep the fstime reproducible if asked to, otherwise the modified AppImage is newer than the original
+	opts.FSTime = time.Now()
+	if t, set, err := helpers.SourceDateEpoch(); set && err == nil {
+		opts.FSTime = t
+	}
+
+	// Write into a temporary file next to the destination first, so that we can
+	// overwrite the original AppImage, which we are still reading from
+	tmp, err := os.CreateTemp(filepath.Dir(destination), "."+filepath.Base(destination)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, io.NewSectionReader(src, 0, e.ai.offset)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err = helpers.WriteSquashfs(tmp, e.ai.offset, root, opts); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0755); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	// The old signature does not match the new contents anymore
+	offset, length, err := helpers.GetSectionOffsetAndLength(tmp.Name(), ".sha256_sig")
+	if err == nil && length > 0 {
+		if err = helpers.WriteStringIntoOtherFileAtOffset(string(make([]byte, length)), tmp.Name(), offset); err != nil {
+			return err
+		}
+	}
+	if e.updateInfo != nil {
+		if err = helpers.EmbedStringInSegment(tmp.Name(), ".upd_info", *e.updateInfo); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), destination)
+}
+
+// squashfsTree turns the directory at dir of an existing squashfs into a tree
+// that can be written with helpers.WriteSquashfs. File contents are read lazily
+func squashfsTree(rdr *squashfs.Reader, dir string) (*helpers.SquashfsEntry, error) {
+	f, err := rdr.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entry, err := squashfsEntry(f.(*squashfs.File))
+	if err != nil {
+		return nil, err
+	}
+	children, err := rdr.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range children {
+		p := path.Join(dir, c.Name())
+		var child *helpers.SquashfsEntry
+		if c.IsDir() {
+			child, err = squashfsTree(rdr, p)
+		} else {
+			var cf fs.File
+			cf, err = rdr.Open(p)
+			if err != nil {
+				return nil, err
+			}
+			child, err = squashfsEntry(cf.(*squashfs.File))
+			cf.Close()
+			if err == nil && child.Mode.IsRegular() {
+				child.Open = func() (io.ReadCloser, error) { return rdr.Open(p) }
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry.Children = append(entry.Children, child)
+	}
+	return entry, nil
+}
+
+// squashfsEntry converts the metadata of f. The FileInfo of the squashfs
+// reader only knows about directories, hence we ask the file for its type
+func squashfsEntry(f *squashfs.File) (*helpers.SquashfsEntry, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	entry := &helpers.SquashfsEntry{
+		Name:    info.Name(),
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case f.IsDir():
+		entry.Mode |= fs.ModeDir
+	case f.IsSymlink():
+		entry.Mode |= fs.ModeSymlink
+		entry.Target = f.SymlinkPath()
+	case f.IsRegular():
+		entry.Size = info.Size()
+	default:
+		return nil, errors.New("unsupported file type: " + info.Name())
+	}
+	return entry, nil
+}
+
+// applyEditorChange applies a single change to the tree below root,
+// creating missing parent directories as needed
+func applyEditorChange(root *helpers.SquashfsEntry, c editorChange) error {
+	parent := root
+	dir := path.Dir(c.path)
+	if dir != "." {
+		for i, name := range strings.Split(dir, "/") {
+			next := parent.Child(name)
+			if next == nil {
+				if c.remove {
+					return nil // Nothing to remove
+				}
+				next = &helpers.SquashfsEntry{Name: name, Mode: fs.ModeDir | 0755, ModTime: time.Now()}
+				parent.Children = append(parent.Children, next)
+			}
+			if !next.Mode.IsDir() {
+				return errors.New(strings.Join(strings.Split(dir, "/")[:i+1], "/") + " is not a directory in the AppImage")
+			}
+			parent = next
+		}
+	}
+	name := path.Base(c.path)
+	existing := parent.Child(name)
+	if existing != nil {
+		if c.entry != nil && c.entry.Mode.IsDir() && existing.Mode.IsDir() {
+			return nil // Mkdir on an existing directory
+		}
+		for i, child := range parent.Children {
+			if child == existing {
+				parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+				break
+			}
+		}
+	}
+	if !c.remove {
+		parent.Children = append(parent.Children, c.entry)
+	}
+	return nil
+}
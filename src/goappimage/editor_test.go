@@ -0,0 +1,120 @@
+package goappimage
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+// testRuntime returns a minimal x86_64 ELF file with the AppImage type 2 magic
+// and empty .upd_info and .sig_key sections. Its section header table ends at 128 KiB,
+// which is where the squashfs starts
+func testRuntime() []byte {
+	const shoff = 128*1024 - 4*64
+	runtime := make([]byte, shoff+4*64)
+	copy(runtime, []byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0x41, 0x49, 0x02})
+	binary.LittleEndian.PutUint16(runtime[16:], 2)  // e_type: executable
+	binary.LittleEndian.PutUint16(runtime[18:], 62) // e_machine: x86_64
+	binary.LittleEndian.PutUint32(runtime[20:], 1)  // e_version
+	binary.LittleEndian.PutUint64(runtime[40:], shoff)
+	binary.LittleEndian.PutUint16(runtime[52:], 64) // e_ehsize
+	binary.LittleEndian.PutUint16(runtime[58:], 64) // e_shentsize
+	binary.LittleEndian.PutUint16(runtime[60:], 4)  // e_shnum
+	binary.LittleEndian.PutUint16(runtime[62:], 2)  // e_shstrndx
+	copy(runtime[0x1400:], "\x00.upd_info\x00.shstrtab\x00.sig_key\x00")
+	section := func(i int, name uint32, offset uint64, size uint64) {
+		sh := runtime[shoff+64*i:]
+		binary.LittleEndian.PutUint32(sh[0:], name)
+		binary.LittleEndian.PutUint32(sh[4:], 1) // SHT_PROGBITS
+		binary.LittleEndian.PutUint64(sh[24:], offset)
+		binary.LittleEndian.PutUint64(sh[32:], size)
+	}
+	section(1, 1, 0x1000, 1024)                              // .upd_info
+	section(2, 11, 0x1400, 30)                               // .shstrtab
+	section(3, 21, 0x1800, 1024)                             // .sig_key
+	binary.LittleEndian.PutUint32(runtime[shoff+2*64+4:], 3) // SHT_STRTAB
+	return runtime
+}
+
+// makeTestAppImage puts an AppDir with the given files into a fake type 2 AppImage
+func makeTestAppImage(t *testing.T, files map[string]string) string {
+	appdir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(appdir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runtime := testRuntime()
+	target := filepath.Join(t.TempDir(), "Test-x86_64.AppImage")
+	if err := os.WriteFile(target, runtime, 0755); err != nil {
+		t.Fatal(err)
+	}
+	offset := helpers.CalculateElfSize(target)
+	err := helpers.MakeSquashfs(appdir, target, offset, helpers.SquashfsOptions{FSTime: time.Unix(1600000000, 0), RootOwned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteAt(runtime[:offset], 0); err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func TestAppImageEditor(t *testing.T) {
+	path := makeTestAppImage(t, map[string]string{
+		"test.desktop":     "[Desktop Entry]\nName=Test\nExec=test\nIcon=test\nType=Application\n",
+		"usr/bin/test":     "#!/bin/sh\n",
+		"usr/share/remove": "bye",
+		"test.png":         "old icon",
+	})
+	ai, err := NewAppImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed, err := ai.Edit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed.WriteFile("test.desktop", []byte("[Desktop Entry]\nName=Edited\nExec=test\nIcon=test\nType=Application\n"), 0644)
+	ed.WriteFile("test.png", []byte("new icon"), 0644)
+	ed.WriteFile("usr/share/new/file", []byte("new"), 0644)
+	ed.Remove("usr/share/remove")
+	ed.Symlink("test.png", ".DirIcon")
+	if err = ed.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ai, err = NewAppImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.Name != "Edited" {
+		t.Error("Desktop file was not replaced, name is", ai.Name)
+	}
+	for name, want := range map[string]string{"test.png": "new icon", ".DirIcon": "new icon", "usr/share/new/file": "new", "usr/bin/test": "#!/bin/sh\n"} {
+		r, err := ai.ExtractFileReader(name)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if string(got) != want {
+			t.Errorf("Wrong content of %s: %q", name, got)
+		}
+	}
+	if _, err = ai.ExtractFileReader("usr/share/remove"); err == nil {
+		t.Error("Removed file is still there")
+	}
+}
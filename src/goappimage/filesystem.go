@@ -0,0 +1,154 @@
+package goappimage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+// FS returns the files in the AppImage as a read-only file system, e.g., to mount it.
+// For type 2 AppImages this is the squashfs after the ELF runtime, for type 1 AppImages the ISO 9660 image.
+// Unlike the other methods, it does not follow symlinks: Stat and ReadDir report them as such,
+// and ReadLink returns their targets.
+func (ai AppImage) FS() (fs.FS, error) {
+	switch ai.imageType {
+	case 1:
+		f, err := os.Open(ai.Path)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return newISOFS(f, fi.Size())
+	case 2:
+		r, err := ai.SquashfsReader()
+		if err != nil {
+			return nil, err
+		}
+		return squashFS{r}, nil
+	}
+	return nil, errors.New("not an AppImage")
+}
+
+// ReadLink returns the target of the symlink at name in fsys, which must have been returned by FS.
+func ReadLink(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if l, ok := f.(interface{ SymlinkPath() string }); ok && l.SymlinkPath() != "" {
+		return l.SymlinkPath(), nil
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.New("not a symlink")}
+}
+
+// Extract extracts all files in the AppImage to the folder at destination, which is created if needed.
+// Unlike ExtractFile, it keeps symlinks and permissions as they are in the AppImage.
+func (ai AppImage) Extract(destination string) error {
+	fsys, err := ai.FS()
+	if err != nil {
+		return err
+	}
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, filepath.FromSlash(name))
+		switch {
+		case info.IsDir():
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := ReadLink(fsys, name)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return extractRegularFile(fsys, name, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func extractRegularFile(fsys fs.FS, name, target string, perm fs.FileMode) error {
+	in, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	os.Remove(target)
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0200)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// squashFS is a squashfs.Reader whose files report symlinks in Stat and ReadDir
+type squashFS struct {
+	r *squashfs.Reader
+}
+
+func (s squashFS) Open(name string) (fs.File, error) {
+	f, err := s.r.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return squashFile{f.(*squashfs.File)}, nil
+}
+
+type squashFile struct {
+	*squashfs.File
+}
+
+type squashFileInfo struct {
+	fs.FileInfo
+	mode fs.FileMode
+}
+
+func (i squashFileInfo) Mode() fs.FileMode { return i.mode }
+
+func (f squashFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return squashFileInfo{info, f.File.Mode()}, nil
+}
+
+func (f squashFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := f.File.ReadDir(n)
+	dir, ferr := f.File.FS()
+	if ferr != nil {
+		return nil, ferr
+	}
+	for i, e := range entries {
+		child, cerr := dir.Open(e.Name())
+		if cerr != nil {
+			return entries[:i], cerr
+		}
+		info, _ := squashFile{child.(*squashfs.File)}.Stat()
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries, err
+}
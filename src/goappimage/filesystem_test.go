@@ -0,0 +1,131 @@
+package goappimage
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	if _, err := exec.LookPath("bsdtar"); err != nil {
+		t.Skip("bsdtar is needed to create type 1 AppImages")
+	}
+	appdir := t.TempDir()
+	files := map[string][]byte{
+		"test.desktop":                   []byte("[Desktop Entry]\nName=Mounted\nExec=test\nIcon=test\nType=Application\n"),
+		"test.png":                       []byte("icon"),
+		"usr/bin/test":                   []byte("#!/bin/sh\n"),
+		"usr/share/test/a/long/path/big": bytes.Repeat([]byte("big"), 100000),
+	}
+	for name, content := range files {
+		p := filepath.Join(appdir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, content, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("usr/bin/test", filepath.Join(appdir, "AppRun")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("test.png", filepath.Join(appdir, ".DirIcon")); err != nil {
+		t.Fatal(err)
+	}
+
+	type1 := filepath.Join(t.TempDir(), "Test-x86_64.AppImage")
+	out, err := exec.Command("bsdtar", "-c", "-f", type1, "--format", "iso9660", "-C", appdir, ".").CombinedOutput()
+	if err != nil {
+		t.Fatal(string(out), err)
+	}
+	f, err := os.OpenFile(type1, os.O_WRONLY, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0x41, 0x49, 0x01}, 0)
+	f.Close()
+	ai1, err := NewAppImage(type1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime := filepath.Join(t.TempDir(), "runtime")
+	os.WriteFile(runtime, testRuntime(), 0755)
+	type2 := filepath.Join(t.TempDir(), "Test-type2-x86_64.AppImage")
+	if err = ai1.ConvertToType2(type2, runtime, "zstd"); err != nil {
+		t.Fatal(err)
+	}
+	ai2, err := NewAppImage(type2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ai := range []*AppImage{ai1, ai2} {
+		fsys, err := ai.FS()
+		if err != nil {
+			t.Fatal(ai.Type(), err)
+		}
+		for name, want := range files {
+			got, err := fs.ReadFile(fsys, name)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("Type %d: wrong content of %s: %v", ai.Type(), name, err)
+			}
+		}
+		info, err := fs.Stat(fsys, "AppRun")
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			t.Errorf("Type %d: AppRun is not reported as a symlink: %v", ai.Type(), err)
+		}
+		if target, err := ReadLink(fsys, "AppRun"); err != nil || target != "usr/bin/test" {
+			t.Errorf("Type %d: wrong target of AppRun: %q %v", ai.Type(), target, err)
+		}
+		if _, err = ReadLink(fsys, "test.png"); err == nil {
+			t.Errorf("Type %d: expected an error for a file that is not a symlink", ai.Type())
+		}
+		if info, err = fs.Stat(fsys, "usr/bin/test"); err != nil || info.Mode().Perm()&0111 == 0 {
+			t.Errorf("Type %d: usr/bin/test is not executable: %v %v", ai.Type(), info.Mode(), err)
+		}
+
+		destination := filepath.Join(t.TempDir(), "squashfs-root")
+		if err = ai.Extract(destination); err != nil {
+			t.Fatal(ai.Type(), err)
+		}
+		for name, want := range files {
+			got, err := os.ReadFile(filepath.Join(destination, name))
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("Type %d: wrong extracted content of %s: %v", ai.Type(), name, err)
+			}
+		}
+		if target, err := os.Readlink(filepath.Join(destination, "AppRun")); err != nil || target != "usr/bin/test" {
+			t.Errorf("Type %d: AppRun was not extracted as a symlink: %q %v", ai.Type(), target, err)
+		}
+		r, err := os.Open(filepath.Join(destination, "usr/share/test/a/long/path/big"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := io.Copy(io.Discard, r)
+		r.Close()
+		if n != int64(len(files["usr/share/test/a/long/path/big"])) {
+			t.Errorf("Type %d: wrong size of the extracted big file: %d", ai.Type(), n)
+		}
+	}
+}
+
+func TestISOFSInvalid(t *testing.T) {
+	image := make([]byte, 20*isoSectorSize)
+	f := &isoFS{r: bytes.NewReader(image), size: int64(len(image))}
+
+	// A record that is too short to have a name
+	image[18*isoSectorSize] = 10
+	if _, err := f.readDir(&isoEntry{offset: 18 * isoSectorSize, size: isoSectorSize}); err == nil {
+		t.Error("Expected an error for a directory record that is too short")
+	}
+	if _, err := f.readDir(&isoEntry{offset: 18 * isoSectorSize, size: 1 << 31}); err == nil {
+		t.Error("Expected an error for a directory that is larger than the image")
+	}
+	// Block 19, offset 0, length 0x7fffffff, each both little and big endian
+	ce := []byte{'C', 'E', 28, 1, 19, 0, 0, 0, 0, 0, 0, 19, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0x7f, 0x7f, 0xff, 0xff, 0xff}
+	if err := f.parseRockRidge(&isoEntry{}, ce); err == nil {
+		t.Error("Expected an error for a continuation area that is larger than the image")
+	}
+}
@@ -0,0 +1,320 @@
+package goappimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// isoFS is a read-only ISO 9660 file system with Rock Ridge extensions, which is what
+// type 1 AppImages are. It does not need bsdtar; type1Reader lists and reads files with it
+
+const isoSectorSize = 2048
+
+type isoFS struct {
+	r    io.ReaderAt
+	size int64 // Of the image, which nothing that is read from it can be larger than
+	root *isoEntry
+	skip int // Bytes to skip at the start of each System Use area, from the SP entry
+}
+
+// isoEntry is a file in an ISO 9660 image. It is its own fs.FileInfo
+type isoEntry struct {
+	name    string
+	mode    fs.FileMode
+	size    int64
+	offset  int64 // Of the data of the file in the image
+	modTime time.Time
+	target  string // Of symlinks
+	hidden  bool   // Relocated directories are listed where their child links are
+}
+
+func (e *isoEntry) Name() string       { return e.name }
+func (e *isoEntry) Size() int64        { return e.size }
+func (e *isoEntry) Mode() fs.FileMode  { return e.mode }
+func (e *isoEntry) ModTime() time.Time { return e.modTime }
+func (e *isoEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *isoEntry) Sys() any           { return nil }
+
+func newISOFS(r io.ReaderAt, size int64) (*isoFS, error) {
+	pvd := make([]byte, isoSectorSize)
+	if _, err := r.ReadAt(pvd, 16*isoSectorSize); err != nil {
+		return nil, err
+	}
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return nil, errors.New("no ISO 9660 primary volume descriptor")
+	}
+	f := &isoFS{r: r, size: size}
+	root, err := f.parseRecord(pvd[156:190])
+	if err != nil {
+		return nil, err
+	}
+	// The first record of the root directory is "." and may start with the SUSP SP entry
+	buf := make([]byte, 255)
+	if _, err = r.ReadAt(buf, root.offset); err != nil {
+		return nil, err
+	}
+	if n := int(buf[32]); len(buf) > 34+n+7 {
+		su := buf[33+n+(1-n%2):]
+		if string(su[0:2]) == "SP" && su[4] == 0xbe && su[5] == 0xef {
+			f.skip = int(su[6])
+		}
+	}
+	root.name = "."
+	root.mode = fs.ModeDir | 0555
+	f.root = root
+	return f, nil
+}
+
+// parseRecord parses the directory record rec
+func (f *isoFS) parseRecord(rec []byte) (*isoEntry, error) {
+	if len(rec) < 34 || int(rec[32]) > len(rec)-33 {
+		return nil, errors.New("invalid ISO 9660 directory record")
+	}
+	n := int(rec[32])
+	e := &isoEntry{
+		name:    string(rec[33 : 33+n]),
+		offset:  int64(binary.LittleEndian.Uint32(rec[2:6])) * isoSectorSize,
+		size:    int64(binary.LittleEndian.Uint32(rec[10:14])),
+		modTime: isoTime(rec[18:25]),
+		mode:    0444,
+	}
+	if rec[25]&0x02 != 0 {
+		e.mode = fs.ModeDir | 0555
+	}
+	// Without Rock Ridge, names have a version and maybe a trailing dot
+	if i := strings.IndexByte(e.name, ';'); i >= 0 {
+		e.name = e.name[:i]
+	}
+	e.name = strings.TrimSuffix(e.name, ".")
+	if start := 33 + n + (1 - n%2); start+f.skip < len(rec) {
+		if err := f.parseRockRidge(e, rec[start+f.skip:]); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// parseRockRidge applies the Rock Ridge entries in the System Use area su to e
+func (f *isoFS) parseRockRidge(e *isoEntry, su []byte) error {
+	var name, target string
+	hasName, continued := false, false
+	for continuations := 0; len(su) >= 4; {
+		sig, l := string(su[0:2]), int(su[2])
+		if l < 4 || l > len(su) {
+			break
+		}
+		data := su[4:l]
+		su = su[l:]
+		switch sig {
+		case "NM": // Alternate name
+			if len(data) >= 1 && data[0]&0x06 == 0 {
+				name += string(data[1:])
+				hasName = true
+			}
+		case "PX": // POSIX file attributes
+			if len(data) >= 4 {
+				e.mode = unixMode(binary.LittleEndian.Uint32(data[0:4]))
+			}
+		case "SL": // Symlink target
+			for comps := data[1:]; len(comps) >= 2 && 2+int(comps[1]) <= len(comps); comps = comps[2+int(comps[1]):] {
+				flags, part := comps[0], string(comps[2:2+int(comps[1])])
+				switch {
+				case flags&0x02 != 0:
+					part = "."
+				case flags&0x04 != 0:
+					part = ".."
+				case flags&0x08 != 0:
+					target, part = "", "/"
+				}
+				if target != "" && !continued && !strings.HasSuffix(target, "/") {
+					target += "/"
+				}
+				target += part
+				continued = flags&0x01 != 0
+			}
+		case "CL": // Child link to a relocated directory
+			if len(data) >= 4 {
+				buf := make([]byte, 255)
+				if _, err := f.r.ReadAt(buf, int64(binary.LittleEndian.Uint32(data[0:4]))*isoSectorSize); err != nil {
+					return err
+				}
+				dot, err := f.parseRecord(buf[:buf[0]])
+				if err != nil {
+					return err
+				}
+				e.offset, e.size, e.mode = dot.offset, dot.size, dot.mode
+			}
+		case "RE": // Relocated directory
+			e.hidden = true
+		case "CE": // Continuation area
+			if len(data) >= 20 && continuations < 16 {
+				continuations++
+				offset := int64(binary.LittleEndian.Uint32(data[0:4]))*isoSectorSize + int64(binary.LittleEndian.Uint32(data[8:12]))
+				length := int64(binary.LittleEndian.Uint32(data[16:20]))
+				if offset+length > f.size {
+					return errors.New("invalid Rock Ridge continuation area")
+				}
+				su = make([]byte, length)
+				if _, err := f.r.ReadAt(su, offset); err != nil {
+					return err
+				}
+			}
+		case "ST": // Terminator
+			su = nil
+		}
+	}
+	if hasName {
+		e.name = name
+	}
+	if e.mode&fs.ModeSymlink != 0 {
+		e.target = target
+	}
+	return nil
+}
+
+// unixMode converts a POSIX st_mode to a fs.FileMode
+func unixMode(m uint32) fs.FileMode {
+	mode := fs.FileMode(m & 0777)
+	switch m & 0170000 {
+	case 0040000:
+		mode |= fs.ModeDir
+	case 0120000:
+		mode |= fs.ModeSymlink
+	case 0100000:
+	default:
+		mode |= fs.ModeIrregular
+	}
+	return mode
+}
+
+// isoTime parses the 7 byte recording date and time of a directory record
+func isoTime(b []byte) time.Time {
+	zone := time.FixedZone("", int(int8(b[6]))*15*60)
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, zone)
+}
+
+// readDir returns the files in the directory dir
+func (f *isoFS) readDir(dir *isoEntry) ([]*isoEntry, error) {
+	if dir.offset+dir.size > f.size {
+		return nil, errors.New("invalid ISO 9660 directory extent")
+	}
+	buf := make([]byte, dir.size)
+	if _, err := f.r.ReadAt(buf, dir.offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var entries []*isoEntry
+	for pos := 0; pos < len(buf); {
+		l := int(buf[pos])
+		if l == 0 {
+			// Records do not cross sector boundaries
+			pos = (pos/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		if l < 34 || pos+l > len(buf) {
+			return nil, errors.New("invalid ISO 9660 directory record")
+		}
+		rec := buf[pos : pos+l]
+		pos += l
+		// Skip "." and ".."
+		if rec[32] == 1 && (rec[33] == 0 || rec[33] == 1) {
+			continue
+		}
+		e, err := f.parseRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		if e.hidden || e.name == "" || e.name == "." || e.name == ".." || strings.Contains(e.name, "/") {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Open opens the file at name without following symlinks
+func (f *isoFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e := f.root
+	if name != "." {
+		for _, part := range strings.Split(name, "/") {
+			if !e.IsDir() {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+			}
+			entries, err := f.readDir(e)
+			if err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+			e = nil
+			for _, entry := range entries {
+				if entry.name == part {
+					e = entry
+					break
+				}
+			}
+			if e == nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+			}
+		}
+	}
+	return &isoFile{fs: f, entry: e, r: io.NewSectionReader(f.r, e.offset, e.size)}, nil
+}
+
+type isoFile struct {
+	fs      *isoFS
+	entry   *isoEntry
+	r       *io.SectionReader
+	entries []*isoEntry // Not yet returned by ReadDir
+	listed  bool
+}
+
+func (f *isoFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *isoFile) Close() error               { return nil }
+
+// SymlinkPath returns the target of the file if it is a symlink, like squashfs.File does
+func (f *isoFile) SymlinkPath() string { return f.entry.target }
+
+func (f *isoFile) Read(b []byte) (int, error) {
+	if !f.entry.mode.IsRegular() {
+		return 0, errors.New("file is not a regular file")
+	}
+	return f.r.Read(b)
+}
+
+func (f *isoFile) ReadAt(b []byte, off int64) (int, error) {
+	if !f.entry.mode.IsRegular() {
+		return 0, errors.New("file is not a regular file")
+	}
+	return f.r.ReadAt(b, off)
+}
+
+func (f *isoFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.entry.IsDir() {
+		return nil, errors.New("file is not a directory")
+	}
+	if !f.listed {
+		entries, err := f.fs.readDir(f.entry)
+		if err != nil {
+			return nil, err
+		}
+		f.entries, f.listed = entries, true
+	}
+	count := len(f.entries)
+	if n > 0 && n < count {
+		count = n
+	}
+	out := make([]fs.DirEntry, count)
+	for i, e := range f.entries[:count] {
+		out[i] = fs.FileInfoToDirEntry(e)
+	}
+	f.entries = f.entries[count:]
+	if n > 0 && count == 0 {
+		return out, io.EOF
+	}
+	return out, nil
+}
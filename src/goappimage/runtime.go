@@ -0,0 +1,114 @@
+package goappimage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+// runtimeSections are the sections of the runtime that get filled in when an AppImage is made
+var runtimeSections = []string{".upd_info", ".sha256_sig", ".sig_key", ".digest_md5"}
+
+// RuntimeDigest returns the sha256 digest of the runtime of a type 2 AppImage as it was
+// before the update information, signature and key were embedded into it, i.e., the digest
+// of the runtime file that it was made with, and the size of the runtime, which is the
+// offset of the squashfs
+func (ai AppImage) RuntimeDigest() (string, int64, error) {
+	if ai.imageType != 2 {
+		return "", 0, errors.New("not a type 2 AppImage")
+	}
+	f, err := os.Open(ai.Path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	runtime := make([]byte, ai.offset)
+	if _, err = io.ReadFull(f, runtime); err != nil {
+		return "", 0, err
+	}
+	for _, section := range runtimeSections {
+		offset, length, err := helpers.GetSectionOffsetAndLength(ai.Path, section)
+		if err == nil && offset+length <= uint64(len(runtime)) {
+			copy(runtime[offset:offset+length], make([]byte, length))
+		}
+	}
+	sum := sha256.Sum256(runtime)
+	return hex.EncodeToString(sum[:]), ai.offset, nil
+}
+
+// SwapRuntime writes the AppImage to destination, which may be the path of the original AppImage,
+// with the type 2 runtime at runtimePath in front of the unchanged squashfs. The update information
+// is carried over. The signature is not, as it does not match anymore. key is embedded as the
+// public key of the signature when the AppImage is going to be signed again; if it is nil,
+// no key is embedded, as a key without a signature makes the AppImage look tampered with
+func (ai *AppImage) SwapRuntime(destination string, runtimePath string, key []byte) error {
+	if ai.imageType != 2 {
+		return errors.New("not a type 2 AppImage")
+	}
+	runtime, err := os.ReadFile(runtimePath)
+	if err != nil {
+		return err
+	}
+	if len(runtime) < 11 || string(runtime[8:11]) != "AI\x02" {
+		return errors.New(runtimePath + " is not a type 2 runtime")
+	}
+	for section, s := range map[string]string{".upd_info": ai.UpdateInfo, ".sig_key": string(key)} {
+		if s == "" {
+			continue
+		}
+		_, length, err := helpers.GetSectionOffsetAndLength(runtimePath, section)
+		if err != nil || length < uint64(len(s)) {
+			return errors.New("the runtime " + runtimePath + " has no room for the " + section + " of " + ai.Path)
+		}
+	}
+
+	src, err := os.Open(ai.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Write into a temporary file next to the destination first, so that we can
+	// overwrite the original AppImage, which we are still reading from
+	tmp, err := os.CreateTemp(filepath.Dir(destination), "."+filepath.Base(destination)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(runtime); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err = io.Copy(tmp, io.NewSectionReader(src, ai.offset, fi.Size()-ai.offset)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0755); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if ai.UpdateInfo != "" {
+		if err = helpers.EmbedStringInSegment(tmp.Name(), ".upd_info", ai.UpdateInfo); err != nil {
+			return err
+		}
+	}
+	if len(key) > 0 {
+		if err = helpers.EmbedStringInSegment(tmp.Name(), ".sig_key", string(key)); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), destination)
+}
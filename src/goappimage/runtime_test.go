@@ -0,0 +1,85 @@
+package goappimage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/probonopd/go-appimage/internal/helpers"
+)
+
+func TestSwapRuntime(t *testing.T) {
+	digest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}
+	path := makeTestAppImage(t, map[string]string{
+		"test.desktop": "[Desktop Entry]\nName=Test\nExec=test\nIcon=test\nType=Application\n",
+		"usr/bin/test": "#!/bin/sh\n",
+	})
+	const updateInformation = "zsync|https://example.com/Test-x86_64.AppImage.zsync"
+	if err := helpers.EmbedStringInSegment(path, ".upd_info", updateInformation); err != nil {
+		t.Fatal(err)
+	}
+	if err := helpers.EmbedStringInSegment(path, ".sig_key", "old key"); err != nil {
+		t.Fatal(err)
+	}
+	ai, err := NewAppImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum, size, err := ai.RuntimeDigest(); sum != digest(testRuntime()) || size != int64(len(testRuntime())) {
+		t.Fatal("Expected the digest of the runtime without the update information and key:", sum, size, err)
+	}
+
+	// A fixed runtime
+	runtime := testRuntime()
+	runtime[0x2000] = 1
+	runtimePath := filepath.Join(t.TempDir(), "runtime-x86_64")
+	if err = os.WriteFile(runtimePath, runtime, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ai.SwapRuntime(path, runtimePath, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	swapped, err := NewAppImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swapped.UpdateInfo != updateInformation {
+		t.Error("The update information was not carried over:", swapped.UpdateInfo)
+	}
+	// Without a signature, the old key would make it look tampered with
+	if key, _ := helpers.GetSectionData(path, ".sig_key"); len(bytes.TrimRight(key, "\x00")) != 0 {
+		t.Errorf("The key was carried over without the signature: %q", key)
+	}
+	if sum, _, err := swapped.RuntimeDigest(); sum != digest(runtime) {
+		t.Error("Expected the new runtime:", err)
+	}
+	r, err := swapped.ExtractFileReader("usr/bin/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != "#!/bin/sh\n" {
+		t.Errorf("The payload changed: %q", data)
+	}
+
+	// The key of whoever signs the AppImage again is embedded
+	if err = swapped.SwapRuntime(path, runtimePath, []byte("new key")); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := helpers.GetSectionData(path, ".sig_key"); string(bytes.TrimRight(key, "\x00")) != "new key" {
+		t.Errorf("The key was not embedded: %q", key)
+	}
+
+	os.WriteFile(runtimePath, []byte("#!/bin/sh\n"), 0755)
+	if err = swapped.SwapRuntime(path, runtimePath, nil); err == nil {
+		t.Error("Expected an error for a file that is not a type 2 runtime")
+	}
+}
@@ -54,9 +54,17 @@ func bootstrapMkAppImage(c *cli.Context) error {
 	// Add the location of the executable to the $PATH
 	helpers.AddHereToPath()
 
-	// Check whether we have a sufficient version of mksquashfs for -offset
-	if helpers.CheckIfSquashfsVersionSufficient("mksquashfs") == false {
-		os.Exit(1)
+	reproducible = c.Bool("reproducible")
+	permissions = c.String("permissions")
+
+	// Only check for mksquashfs if we were asked to use it rather than the built-in squashfs writer
+	useMksquashfs = c.Bool("mksquashfs")
+	if useMksquashfs {
+		helpers.CheckIfAllToolsArePresent([]string{"mksquashfs"})
+		// Check whether we have a sufficient version of mksquashfs for -offset
+		if helpers.CheckIfSquashfsVersionSufficient("mksquashfs") == false {
+			os.Exit(1)
+		}
 	}
 
 	// Check if is directory, then assume we want to convert an AppDir into an AppImage
@@ -73,9 +81,8 @@ func bootstrapMkAppImage(c *cli.Context) error {
 		// check if the file provided is an AppDir Directory
 
 		// Check for needed files on $PATH
-		// curl is needed by uploadtool; TODO: Replace uploadtool with native Go code
 		// "sh", "strings", "grep" are needed by appdirtool to parse qt_prfxpath; TODO: Replace with native Go code
-		tools := []string{"file", "mksquashfs", "desktop-file-validate", "uploadtool", "patchelf", "desktop-file-validate", "patchelf"} // "sh", "strings", "grep" no longer needed?; "curl" is needed for uploading only, "glib-compile-schemas" is needed in some cases only
+		tools := []string{"file", "patchelf"} // "sh", "strings", "grep" no longer needed?; "glib-compile-schemas" is needed in some cases only
 		helpers.CheckIfAllToolsArePresent(tools)
 
 		// check if we need to guess the update information
@@ -84,11 +91,12 @@ func bootstrapMkAppImage(c *cli.Context) error {
 			shouldGuessUpdateInformation = true
 		}
 
-		// Manually specify an external runtime file
+		// Manually specify an external runtime file. mkappimage has no pinned runtimes to check it against
 		runtimeFile := ""
 		if c.String("runtime-file") != "" {
 			runtimeFile = filepath.Clean(c.String("runtime-file"))
 		}
+		allowUnpinnedRuntime = true
 
 		// is manual compressor provided? if yes use that, else default
 		compressionType := "zstd"
@@ -127,8 +135,7 @@ func bootstrapMkAppImage(c *cli.Context) error {
 		if c.Bool("list") || c.Bool("listlong") {
 			// check if the file provided as argument is an AppImage
 			// Check for needed files on $PATH
-			tools := []string{"unsquashfs", "bsdtar", "file", "mksquashfs", "desktop-file-validate", "uploadtool", "patchelf", "desktop-file-validate", "patchelf"} // "sh", "
-			// curl is needed by uploadtool; TODO: Replace uploadtool with native Go code
+			tools := []string{"unsquashfs", "bsdtar", "file", "mksquashfs", "patchelf"} // "sh", "
 			// "sh", "strings", "grep" are needed by appdirtool to parse qt_prfxpath; TODO: Replace with native Go code
 			helpers.CheckIfAllToolsArePresent(tools)
 			if c.Bool("list") {
@@ -208,7 +215,19 @@ func main() {
 		},
 		&cli.StringFlag{
 			Name:  "comp",
-			Usage: "Squashfs compression",
+			Usage: "Squashfs compression (zstd, xz or gzip)",
+		},
+		&cli.BoolFlag{
+			Name:  "reproducible",
+			Usage: "Build bit-for-bit reproducibly, using $SOURCE_DATE_EPOCH (or 0) as the timestamp of all files",
+		},
+		&cli.BoolFlag{
+			Name:  "mksquashfs",
+			Usage: "Use the external mksquashfs tool (at least version 4.4) instead of the built-in squashfs writer",
+		},
+		&cli.StringFlag{
+			Name:  "permissions",
+			Usage: "Declare what the application needs when run in a sandbox, e.g., \"network,audio\" (network, home, audio, devices, dbus)",
 		},
 		&cli.StringFlag{
 			Name:    "updateinformation",